@@ -0,0 +1,142 @@
+// Package age reads and writes files in the age v1 encryption format
+// (https://age-encryption.org/v1) through filippo.io/age, the reference
+// implementation, so that exports can be decrypted with stock age tooling.
+// It adapts the library to gotp's X25519 keys and byte-slice secrets.
+package age
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"errors"
+	"io"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/zulfikawr/gotp/internal/crypto"
+)
+
+// DefaultScryptWorkFactor is the log2 of the scrypt cost used for
+// passphrase encryption, the same as age's default.
+const DefaultScryptWorkFactor = 18
+
+// ErrIncorrectIdentity is returned when none of the identities can unwrap
+// the file key.
+var ErrIncorrectIdentity = errors.New("no identity matched any of the file's recipients")
+
+// Recipient wraps a file key for one or more stanzas.
+type Recipient = age.Recipient
+
+// Identity unwraps the file key from the header stanzas.
+type Identity = age.Identity
+
+// NewX25519Recipient returns a recipient for the "age1..." public key pub.
+func NewX25519Recipient(pub *ecdh.PublicKey) (Recipient, error) {
+	return age.ParseX25519Recipient(crypto.FormatRecipient(pub))
+}
+
+// NewX25519Identity returns an identity for the private key priv.
+func NewX25519Identity(priv *ecdh.PrivateKey) (Identity, error) {
+	return age.ParseX25519Identity(crypto.FormatIdentity(priv))
+}
+
+// NewScryptRecipient returns a passphrase recipient with the given work
+// factor. It must be the only recipient of a file.
+func NewScryptRecipient(passphrase []byte, workFactor int) (Recipient, error) {
+	r, err := age.NewScryptRecipient(string(passphrase))
+	if err != nil {
+		return nil, err
+	}
+	r.SetWorkFactor(workFactor)
+	return r, nil
+}
+
+// NewScryptIdentity returns an identity for passphrase.
+func NewScryptIdentity(passphrase []byte) (Identity, error) {
+	return age.NewScryptIdentity(string(passphrase))
+}
+
+// Encrypt encrypts plaintext to the given recipients.
+func Encrypt(plaintext []byte, recipients ...Recipient) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, recipients...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decrypt decrypts an age file, binary or armored, with the first identity
+// that unwraps its file key.
+func Decrypt(data []byte, identities ...Identity) ([]byte, error) {
+	r, err := age.Decrypt(reader(data), identities...)
+	var noMatch *age.NoIdentityMatchError
+	if errors.As(err, &noMatch) {
+		return nil, ErrIncorrectIdentity
+	}
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// Armor encodes an age file in the ASCII armor format (age -a).
+func Armor(data []byte) []byte {
+	var buf bytes.Buffer
+	w := armor.NewWriter(&buf)
+	_, _ = w.Write(data)
+	_ = w.Close()
+	return buf.Bytes()
+}
+
+// IsArmored reports whether data is an ASCII armored age file.
+func IsArmored(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte(armor.Header))
+}
+
+// IsEncrypted reports whether data looks like an age file, binary or
+// armored.
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("age-encryption.org/v1\n")) || IsArmored(data)
+}
+
+// HasPassphrase reports whether an age file is encrypted with a passphrase
+// rather than to recipients.
+func HasPassphrase(data []byte) (bool, error) {
+	probe := &stanzaProbe{}
+	_, err := age.Decrypt(reader(data), probe)
+	if !probe.called {
+		return false, err
+	}
+	return probe.scrypt, nil
+}
+
+// reader returns a reader of the binary age file in data.
+func reader(data []byte) io.Reader {
+	if IsArmored(data) {
+		return armor.NewReader(bytes.NewReader(bytes.TrimSpace(data)))
+	}
+	return bytes.NewReader(data)
+}
+
+// stanzaProbe is an identity that matches no stanza, and records whether
+// the header it was shown has a scrypt stanza.
+type stanzaProbe struct {
+	called bool
+	scrypt bool
+}
+
+func (p *stanzaProbe) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
+	p.called = true
+	for _, s := range stanzas {
+		if s.Type == "scrypt" {
+			p.scrypt = true
+		}
+	}
+	return nil, age.ErrIncorrectIdentity
+}
@@ -0,0 +1,163 @@
+package age
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/zulfikawr/gotp/internal/crypto"
+)
+
+// exampleIdentity decrypts testdata/example.age, a file written by the age
+// command and shipped with filippo.io/age.
+const exampleIdentity = "AGE-SECRET-KEY-184JMZMVQH3E6U0PSL869004Y3U2NYV7R30EU99CSEDNPH02YUVFSZW44VU"
+
+func x25519Recipient(t *testing.T, priv *ecdh.PrivateKey) Recipient {
+	t.Helper()
+	r, err := NewX25519Recipient(priv.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func x25519Identity(t *testing.T, priv *ecdh.PrivateKey) Identity {
+	t.Helper()
+	id, err := NewX25519Identity(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func scryptIdentity(t *testing.T, passphrase string) Identity {
+	t.Helper()
+	id, err := NewScryptIdentity([]byte(passphrase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestStockAgeFile(t *testing.T) {
+	data, err := os.ReadFile("testdata/example.age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := crypto.ParseIdentity(exampleIdentity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, file := range map[string][]byte{"binary": data, "armored": Armor(data)} {
+		if !IsEncrypted(file) {
+			t.Errorf("%s: IsEncrypted = false", name)
+		}
+		if ok, err := HasPassphrase(file); err != nil || ok {
+			t.Errorf("%s: HasPassphrase = %v, %v", name, ok, err)
+		}
+		got, err := Decrypt(file, x25519Identity(t, priv))
+		if err != nil {
+			t.Fatalf("%s: Decrypt failed: %v", name, err)
+		}
+		if string(got) != "Black lives matter." {
+			t.Errorf("%s: got %q", name, got)
+		}
+	}
+}
+
+func TestX25519RoundTrip(t *testing.T) {
+	alice, _ := crypto.GenerateX25519Identity()
+	bob, _ := crypto.GenerateX25519Identity()
+	eve, _ := crypto.GenerateX25519Identity()
+
+	for _, size := range []int{0, 1, 64 * 1024, 3*64*1024 + 1} {
+		plaintext := bytes.Repeat([]byte{'x'}, size)
+		data, err := Encrypt(plaintext, x25519Recipient(t, alice), x25519Recipient(t, bob))
+		if err != nil {
+			t.Fatalf("size %d: Encrypt failed: %v", size, err)
+		}
+		if !IsEncrypted(data) || IsArmored(data) {
+			t.Errorf("size %d: expected a binary age file", size)
+		}
+
+		for _, priv := range []*ecdh.PrivateKey{alice, bob} {
+			got, err := Decrypt(data, x25519Identity(t, priv))
+			if err != nil {
+				t.Fatalf("size %d: Decrypt failed: %v", size, err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("size %d: plaintext mismatch", size)
+			}
+		}
+
+		if _, err := Decrypt(data, x25519Identity(t, eve)); !errors.Is(err, ErrIncorrectIdentity) {
+			t.Errorf("size %d: expected ErrIncorrectIdentity, got %v", size, err)
+		}
+	}
+}
+
+func TestScryptRoundTrip(t *testing.T) {
+	r, err := NewScryptRecipient([]byte("passphrase"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Encrypt([]byte("secret"), r)
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+
+	armored := Armor(data)
+	if !IsArmored(armored) || !IsEncrypted(armored) {
+		t.Fatal("Armored output not recognized")
+	}
+	for _, file := range [][]byte{data, armored} {
+		if ok, err := HasPassphrase(file); err != nil || !ok {
+			t.Errorf("HasPassphrase = %v, %v", ok, err)
+		}
+		got, err := Decrypt(file, scryptIdentity(t, "passphrase"))
+		if err != nil || string(got) != "secret" {
+			t.Fatalf("Decrypt = %q, %v", got, err)
+		}
+	}
+
+	if _, err := Decrypt(data, scryptIdentity(t, "wrong")); err == nil {
+		t.Error("Expected error for wrong passphrase")
+	}
+	if _, err := NewScryptRecipient(nil, 10); err == nil {
+		t.Error("Expected error for an empty passphrase")
+	}
+
+	// A passphrase can not be combined with other recipients.
+	identity, _ := crypto.GenerateX25519Identity()
+	if _, err := Encrypt([]byte("secret"), r, x25519Recipient(t, identity)); err == nil {
+		t.Error("Expected error mixing scrypt and X25519 recipients")
+	}
+}
+
+func TestTampering(t *testing.T) {
+	identity, _ := crypto.GenerateX25519Identity()
+	data, err := Encrypt([]byte("secret"), x25519Recipient(t, identity))
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+
+	// Flipping a byte of the intro line breaks parsing, of the header MAC
+	// or of the payload breaks authentication.
+	mac := bytes.Index(data, []byte("--- ")) + 5
+	for _, i := range []int{0, mac, len(data) - 1} {
+		tampered := append([]byte{}, data...)
+		tampered[i] ^= 1
+		if _, err := Decrypt(tampered, x25519Identity(t, identity)); err == nil {
+			t.Errorf("Expected error for tampered byte %d", i)
+		}
+	}
+	if _, err := Decrypt(data[:len(data)-1], x25519Identity(t, identity)); err == nil {
+		t.Error("Expected error for truncated file")
+	}
+	if _, err := HasPassphrase([]byte("not an age file")); err == nil {
+		t.Error("Expected error for a file that is not age")
+	}
+}
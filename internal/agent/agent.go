@@ -0,0 +1,300 @@
+// Package agent implements gotp agent, a daemon modeled on ssh-agent that
+// holds the master keys of unlocked vaults in locked memory and hands them
+// to gotp commands over a Unix socket, so that commands run shortly after
+// each other do not prompt for the password again. Keys are held per vault,
+// by its canonical path. The agent also keeps quick-unlock PINs (see
+// SetPIN). Nothing is written to disk: stopping the agent forgets the keys
+// and PINs.
+//
+// The socket lives in a directory only the user can enter, is itself only
+// accessible to the user, and the agent rejects connections from other
+// users where the platform reports the peer's credentials.
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/zulfikawr/gotp/internal/crypto"
+)
+
+// DefaultIdleTimeout is how long the agent keeps its keys without being
+// asked for one.
+const DefaultIdleTimeout = 15 * time.Minute
+
+// ioTimeout bounds a single request, so that a stuck client cannot block
+// the agent.
+const ioTimeout = 5 * time.Second
+
+// Requests the agent understands.
+const (
+	opAdd  = "add"
+	opGet  = "get"
+	opLock = "lock"
+	opList = "list"
+	opStop = "stop"
+
+	opSetPIN    = "set-pin"
+	opUnlockPIN = "unlock-pin"
+	opGetPIN    = "get-pin"
+	opRemovePIN = "remove-pin"
+)
+
+type request struct {
+	Op        string            `json:"op"`
+	Vault     string            `json:"vault,omitempty"`
+	Key       []byte            `json:"key,omitempty"`
+	TTL       time.Duration     `json:"ttl,omitempty"`
+	PIN       []byte            `json:"pin,omitempty"`
+	KDFParams *crypto.KDFParams `json:"kdf_params,omitempty"`
+	Attempts  int               `json:"attempts,omitempty"`
+}
+
+// timeout returns how long the request may take.
+func (r *request) timeout() time.Duration {
+	if r.Op == opSetPIN || r.Op == opUnlockPIN {
+		return kdfTimeout
+	}
+	return ioTimeout
+}
+
+type response struct {
+	Key      []byte    `json:"key,omitempty"`
+	Sessions []Session `json:"sessions,omitempty"`
+	PIN      *PINState `json:"pin,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Code     string    `json:"code,omitempty"`
+}
+
+// Session describes a vault whose key the agent holds.
+type Session struct {
+	Vault     string    `json:"vault"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type entry struct {
+	key       *crypto.SecureBuffer
+	expiresAt time.Time
+	expiry    *time.Timer
+}
+
+// Server is a running agent.
+type Server struct {
+	// IdleTimeout is how long the keys are kept without a request; zero
+	// keeps them until they expire.
+	IdleTimeout time.Duration
+
+	mu       sync.Mutex
+	keys     map[string]*entry
+	pins     map[string]*pinEntry
+	idle     *time.Timer
+	listener net.Listener
+	path     string
+	stopped  bool
+}
+
+// NewServer returns an agent that forgets its keys after idleTimeout
+// without a request.
+func NewServer(idleTimeout time.Duration) *Server {
+	return &Server{IdleTimeout: idleTimeout, keys: make(map[string]*entry), pins: make(map[string]*pinEntry)}
+}
+
+// Listen creates the agent's socket at path. It fails if another agent is
+// already listening there, and replaces a socket left behind by one that
+// did not shut down cleanly.
+func (s *Server) Listen(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("an agent is already listening on %s", path)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return err
+	}
+	s.listener, s.path = l, path
+	return nil
+}
+
+// Serve answers requests until the agent is stopped or closed. It returns
+// nil after a stop request.
+func (s *Server) Serve() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			stopped := s.stopped
+			s.mu.Unlock()
+			if stopped {
+				return nil
+			}
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// Close stops the agent: it wipes the keys and PINs and removes the socket.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return nil
+	}
+	s.stopped = true
+	s.lockAll()
+	for vault := range s.pins {
+		s.removePIN(vault)
+	}
+	if s.idle != nil {
+		s.idle.Stop()
+	}
+	err := s.listener.Close()
+	_ = os.Remove(s.path)
+	return err
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	if err := checkPeer(conn); err != nil {
+		return
+	}
+	_ = conn.SetDeadline(time.Now().Add(ioTimeout))
+
+	var req request
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+	defer crypto.ZeroBytes(req.Key)
+	defer crypto.ZeroBytes(req.PIN)
+	_ = conn.SetDeadline(time.Now().Add(req.timeout()))
+
+	var resp *response
+	var stop bool
+	switch req.Op {
+	case opSetPIN:
+		resp = s.setPIN(&req)
+	case opUnlockPIN:
+		resp = s.unlockPIN(&req)
+	default:
+		resp, stop = s.do(&req)
+	}
+	data, _ := json.Marshal(resp)
+	crypto.ZeroBytes(resp.Key)
+	_, _ = conn.Write(append(data, '\n'))
+	crypto.ZeroBytes(data)
+
+	if stop {
+		_ = s.Close()
+	}
+}
+
+// do performs a request. It reports whether the agent should stop.
+func (s *Server) do(req *request) (*response, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.touch()
+
+	switch req.Op {
+	case opAdd:
+		if req.Vault == "" || len(req.Key) == 0 || req.TTL <= 0 {
+			return &response{Error: "missing vault, key or lifetime"}, false
+		}
+		key, err := crypto.NewSecureBufferFrom(req.Key)
+		if err != nil {
+			return &response{Error: err.Error()}, false
+		}
+		s.lock(req.Vault)
+		e := &entry{key: key, expiresAt: time.Now().Add(req.TTL)}
+		e.expiry = time.AfterFunc(req.TTL, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.keys[req.Vault] == e {
+				s.lock(req.Vault)
+			}
+		})
+		s.keys[req.Vault] = e
+		return &response{}, false
+	case opGet:
+		e, ok := s.keys[req.Vault]
+		if !ok {
+			return &response{}, false
+		}
+		return &response{Key: append([]byte(nil), e.key.Bytes()...)}, false
+	case opLock:
+		if req.Vault == "" {
+			s.lockAll()
+		} else {
+			s.lock(req.Vault)
+		}
+		return &response{}, false
+	case opList:
+		sessions := make([]Session, 0, len(s.keys))
+		for vault, e := range s.keys {
+			sessions = append(sessions, Session{Vault: vault, ExpiresAt: e.expiresAt})
+		}
+		return &response{Sessions: sessions}, false
+	case opGetPIN:
+		e, ok := s.pins[req.Vault]
+		if !ok {
+			return &response{}, false
+		}
+		return &response{PIN: e.state()}, false
+	case opRemovePIN:
+		s.removePIN(req.Vault)
+		return &response{}, false
+	case opStop:
+		return &response{}, true
+	default:
+		return &response{Error: fmt.Sprintf("unknown request %q", req.Op)}, false
+	}
+}
+
+// touch restarts the idle timer. The caller must hold s.mu.
+func (s *Server) touch() {
+	if s.IdleTimeout <= 0 {
+		return
+	}
+	if s.idle == nil {
+		s.idle = time.AfterFunc(s.IdleTimeout, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.lockAll()
+		})
+		return
+	}
+	s.idle.Reset(s.IdleTimeout)
+}
+
+// lock wipes the key of a vault. The caller must hold s.mu.
+func (s *Server) lock(vault string) {
+	e, ok := s.keys[vault]
+	if !ok {
+		return
+	}
+	e.expiry.Stop()
+	e.key.Destroy()
+	delete(s.keys, vault)
+}
+
+// lockAll wipes every key. The caller must hold s.mu.
+func (s *Server) lockAll() {
+	for vault := range s.keys {
+		s.lock(vault)
+	}
+}
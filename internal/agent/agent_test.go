@@ -0,0 +1,229 @@
+package agent
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/gotp/internal/crypto"
+)
+
+// startAgent runs an agent on a socket in a temporary directory and points
+// the client at it.
+func startAgent(t *testing.T, idleTimeout time.Duration) *Server {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "gotp-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "agent.sock")
+	t.Setenv(SocketEnv, path)
+
+	server := NewServer(idleTimeout)
+	if err := server.Listen(path); err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- server.Serve() }()
+	t.Cleanup(func() {
+		_ = server.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve failed: %v", err)
+		}
+	})
+	return server
+}
+
+func TestAgent(t *testing.T) {
+	startAgent(t, 0)
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	if got, err := Get("/vault.enc"); err != nil || got != nil {
+		t.Fatalf("Expected no key, got %v, %v", got, err)
+	}
+	if err := Add("/vault.enc", key, time.Minute); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	got, err := Get("/vault.enc")
+	if err != nil || !bytes.Equal(got.Bytes(), key) {
+		t.Fatalf("Get returned %v, %v", got, err)
+	}
+	got.Destroy()
+
+	if err := Lock("/vault.enc"); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	if got, _ := Get("/vault.enc"); got != nil {
+		t.Error("Key should be forgotten after Lock")
+	}
+
+	if err := Add("/vault.enc", key, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got, _ := Get("/vault.enc"); got != nil {
+		t.Error("Key should expire")
+	}
+
+	// Keys are held per vault.
+	if err := Add("/other.enc", key, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := Add("/third.enc", key, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := Get("/vault.enc"); got != nil {
+		t.Error("Another vault's key should not be returned")
+	}
+	sessions, err := List()
+	if err != nil || len(sessions) != 2 || sessions[0].Vault != "/other.enc" || sessions[1].Vault != "/third.enc" {
+		t.Fatalf("List returned %v, %v", sessions, err)
+	}
+	if time.Until(sessions[0].ExpiresAt) <= 0 {
+		t.Errorf("Unexpected expiry %v", sessions[0].ExpiresAt)
+	}
+	if err := Lock("/other.enc"); err != nil {
+		t.Fatal(err)
+	}
+	if sessions, _ := List(); len(sessions) != 1 {
+		t.Errorf("Expected one session after Lock, got %v", sessions)
+	}
+	if err := LockAll(); err != nil {
+		t.Fatal(err)
+	}
+	if sessions, _ := List(); len(sessions) != 0 {
+		t.Errorf("Expected no sessions after LockAll, got %v", sessions)
+	}
+
+	if err := Add("/vault.enc", nil, time.Minute); err == nil {
+		t.Error("Expected error for a missing key")
+	}
+}
+
+func TestAgentPIN(t *testing.T) {
+	startAgent(t, 50*time.Millisecond)
+	key := []byte("0123456789abcdef0123456789abcdef")
+	params := crypto.KDFParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+	if state, err := GetPIN("/vault.enc"); err != nil || state != nil {
+		t.Fatalf("Expected no PIN, got %+v, %v", state, err)
+	}
+	if err := SetPIN("/vault.enc", key, []byte("123456"), params, time.Minute, 3); err != nil {
+		t.Fatalf("SetPIN failed: %v", err)
+	}
+	got, err := UnlockPIN("/vault.enc", []byte("123456"))
+	if err != nil || !bytes.Equal(got.Bytes(), key) {
+		t.Fatalf("UnlockPIN returned %v, %v", got, err)
+	}
+	got.Destroy()
+	if _, err := UnlockPIN("/other.enc", []byte("123456")); err == nil {
+		t.Error("Another vault's PIN should not unlock")
+	}
+
+	// The PIN outlives the idle timeout and LockAll, which forget keys.
+	time.Sleep(100 * time.Millisecond)
+	if err := LockAll(); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := GetPIN("/vault.enc"); state == nil || state.AttemptsLeft != 3 {
+		t.Fatalf("Expected the PIN to survive, got %+v", state)
+	}
+
+	// Concurrent wrong PINs are each counted, and cannot exceed the limit.
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		go func() {
+			_, err := UnlockPIN("/vault.enc", []byte("000000"))
+			errs <- err
+		}()
+	}
+	// Attempts after the limit find the PIN destroyed or gone.
+	wrong := 0
+	for i := 0; i < 5; i++ {
+		err := <-errs
+		if err == nil {
+			t.Error("A wrong PIN unlocked the vault")
+		}
+		if errors.Is(err, ErrWrongPIN) {
+			wrong++
+		}
+	}
+	if wrong > 2 {
+		t.Errorf("Expected at most 2 wrong PINs before the PIN is destroyed, got %d", wrong)
+	}
+	if state, _ := GetPIN("/vault.enc"); state != nil {
+		t.Errorf("The PIN should be destroyed, got %+v", state)
+	}
+	if _, err := UnlockPIN("/vault.enc", []byte("123456")); err == nil {
+		t.Error("A destroyed PIN should not unlock")
+	}
+
+	if err := SetPIN("/vault.enc", key, []byte("123456"), params, time.Minute, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemovePIN("/vault.enc"); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := GetPIN("/vault.enc"); state != nil {
+		t.Error("The PIN should be removed")
+	}
+	if err := SetPIN("/vault.enc", key, []byte("123456"), params, 0, 3); err == nil {
+		t.Error("Expected error for a missing lifetime")
+	}
+}
+
+func TestAgentIdleTimeout(t *testing.T) {
+	startAgent(t, 50*time.Millisecond)
+	if err := Add("/vault.enc", []byte("key"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got, _ := Get("/vault.enc"); got != nil {
+		t.Error("Key should be forgotten after the idle timeout")
+	}
+}
+
+func TestAgentStop(t *testing.T) {
+	startAgent(t, 0)
+	if err := Add("/vault.enc", []byte("key"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := Stop(); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, err := Get("/vault.enc"); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Expected ErrNotRunning after Stop, got %v", err)
+	}
+}
+
+func TestAgentNotRunning(t *testing.T) {
+	t.Setenv(SocketEnv, filepath.Join(t.TempDir(), "agent.sock"))
+	if err := Lock("/vault.enc"); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Expected ErrNotRunning, got %v", err)
+	}
+}
+
+func TestAgentSocketPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix permissions only")
+	}
+	startAgent(t, 0)
+	path := SocketPath()
+
+	if err := NewServer(0).Listen(path); err == nil {
+		t.Error("A second agent should not listen on the same socket")
+	}
+
+	if err := os.Chmod(path, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := Add("/vault.enc", []byte("key"), time.Minute); err == nil || errors.Is(err, ErrNotRunning) {
+		t.Errorf("Expected the key to be withheld from an accessible socket, got %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/zulfikawr/gotp/internal/config"
+	"github.com/zulfikawr/gotp/internal/crypto"
+)
+
+// SocketEnv names the environment variable that overrides the agent's
+// socket path, like SSH_AUTH_SOCK for ssh-agent.
+const SocketEnv = "GOTP_AGENT_SOCK"
+
+// ErrNotRunning is returned when no agent listens on the socket.
+var ErrNotRunning = errors.New("gotp agent is not running")
+
+// SocketPath returns the path of the agent's socket: $GOTP_AGENT_SOCK, or
+// agent.sock in the configuration directory.
+func SocketPath() string {
+	if path := os.Getenv(SocketEnv); path != "" {
+		return path
+	}
+	return filepath.Join(config.GetDefaultConfigDir(), "agent.sock")
+}
+
+// Add hands the master key of a vault to the agent, which keeps it for
+// ttl. The vault is identified by its canonical path.
+func Add(vault string, key []byte, ttl time.Duration) error {
+	_, err := call(&request{Op: opAdd, Vault: vault, Key: key, TTL: ttl})
+	return err
+}
+
+// Get returns the key of a vault held by the agent in locked memory, or
+// nil if it holds none. The caller must Destroy the buffer.
+func Get(vault string) (*crypto.SecureBuffer, error) {
+	resp, err := call(&request{Op: opGet, Vault: vault})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Key) == 0 {
+		return nil, nil
+	}
+	return crypto.NewSecureBufferFrom(resp.Key)
+}
+
+// Lock makes the agent forget the key of a vault.
+func Lock(vault string) error {
+	_, err := call(&request{Op: opLock, Vault: vault})
+	return err
+}
+
+// LockAll makes the agent forget every key.
+func LockAll() error {
+	_, err := call(&request{Op: opLock})
+	return err
+}
+
+// List returns the vaults whose keys the agent holds, sorted by path.
+func List() ([]Session, error) {
+	resp, err := call(&request{Op: opList})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(resp.Sessions, func(i, j int) bool {
+		return resp.Sessions[i].Vault < resp.Sessions[j].Vault
+	})
+	return resp.Sessions, nil
+}
+
+// Stop makes the agent forget its keys and exit.
+func Stop() error {
+	_, err := call(&request{Op: opStop})
+	return err
+}
+
+// call sends one request to the agent and reads its response.
+func call(req *request) (*response, error) {
+	path := SocketPath()
+	if err := checkSocket(path); err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return nil, ErrNotRunning
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(req.timeout()))
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.Write(append(data, '\n'))
+	crypto.ZeroBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach the agent: %w", err)
+	}
+
+	var resp response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to read the agent's response: %w", err)
+	}
+	if err := pinError(&resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("agent: %s", resp.Error)
+	}
+	return &resp, nil
+}
+
+// checkSocket makes sure the socket belongs to the user and cannot be
+// reached by anyone else before the key is sent to it.
+func checkSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return ErrNotRunning
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != os.ModeSocket {
+		return fmt.Errorf("%s is not a socket", path)
+	}
+	return checkPermissions(path, info)
+}
@@ -0,0 +1,12 @@
+//go:build !(linux || darwin || freebsd)
+
+package agent
+
+import "net"
+
+// checkPeer accepts every connection on platforms that do not report the
+// peer's credentials; the permissions of the socket and its directory
+// keep other users out.
+func checkPeer(conn net.Conn) error {
+	return nil
+}
@@ -0,0 +1,21 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package agent
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkPermissions makes sure the socket belongs to the user and is not
+// accessible to anyone else.
+func checkPermissions(path string, info os.FileInfo) error {
+	if info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("agent socket %s is accessible to other users", path)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("agent socket %s belongs to uid %d", path, stat.Uid)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zulfikawr/gotp/internal/crypto"
+)
+
+// A quick-unlock PIN wraps a copy of a vault's master key under a short PIN.
+// The agent keeps the wrapped copy and its count of wrong PINs in memory and
+// checks PINs itself, so the copy never leaves the agent: there is nothing
+// to copy and guess offline, and no counter to reset. Stopping the agent
+// forgets its PINs; they survive 'gotp lock' and the idle timeout, since
+// unlocking after those is what they are for.
+
+// pinKeyPurpose names the subkey that wraps the master key under a PIN.
+const pinKeyPurpose = "gotp quick-unlock pin"
+
+// kdfTimeout bounds a request that derives a key from a PIN, which takes as
+// long as the vault's key derivation.
+const kdfTimeout = time.Minute
+
+// ErrWrongPIN is returned for a PIN that does not unlock the vault.
+var ErrWrongPIN = errors.New("wrong PIN")
+
+// ErrPINDestroyed is returned when the last allowed attempt was wrong and
+// the PIN has been destroyed.
+var ErrPINDestroyed = errors.New("too many wrong PINs; the PIN was removed and the master password is required")
+
+// Error codes of responses that clients map to errors.
+const (
+	codeWrongPIN     = "wrong-pin"
+	codePINDestroyed = "pin-destroyed"
+)
+
+// PINState describes the quick-unlock PIN of a vault.
+type PINState struct {
+	ExpiresAt    time.Time `json:"expires_at"`
+	AttemptsLeft int       `json:"attempts_left"`
+}
+
+type pinEntry struct {
+	salt        []byte
+	params      crypto.KDFParams
+	key         []byte // Master key encrypted under the PIN
+	expiresAt   time.Time
+	maxAttempts int
+	failed      int
+	expiry      *time.Timer
+}
+
+func (e *pinEntry) state() *PINState {
+	return &PINState{ExpiresAt: e.expiresAt, AttemptsLeft: e.maxAttempts - e.failed}
+}
+
+// SetPIN hands the agent a copy of the master key of a vault to wrap under
+// pin, with the vault's KDF parameters, until ttl passes or attempts wrong
+// PINs are entered. It replaces any PIN of the vault.
+func SetPIN(vault string, key, pin []byte, params crypto.KDFParams, ttl time.Duration, attempts int) error {
+	_, err := call(&request{Op: opSetPIN, Vault: vault, Key: key, PIN: pin, KDFParams: &params, TTL: ttl, Attempts: attempts})
+	return err
+}
+
+// UnlockPIN returns the master key of a vault unwrapped with its PIN, in
+// locked memory. A wrong PIN returns ErrWrongPIN, or ErrPINDestroyed if it
+// was the last allowed. The caller must Destroy the buffer.
+func UnlockPIN(vault string, pin []byte) (*crypto.SecureBuffer, error) {
+	resp, err := call(&request{Op: opUnlockPIN, Vault: vault, PIN: pin})
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.ZeroBytes(resp.Key)
+	return crypto.NewSecureBufferFrom(resp.Key)
+}
+
+// GetPIN returns the state of the PIN of a vault, or nil if it has none.
+func GetPIN(vault string) (*PINState, error) {
+	resp, err := call(&request{Op: opGetPIN, Vault: vault})
+	if err != nil {
+		return nil, err
+	}
+	return resp.PIN, nil
+}
+
+// RemovePIN makes the agent destroy the PIN of a vault. It is not an error
+// if there is none.
+func RemovePIN(vault string) error {
+	_, err := call(&request{Op: opRemovePIN, Vault: vault})
+	return err
+}
+
+// setPIN wraps the key in req under its PIN. The key derivation runs without
+// holding s.mu.
+func (s *Server) setPIN(req *request) *response {
+	if req.Vault == "" || len(req.Key) == 0 || len(req.PIN) == 0 || req.KDFParams == nil || req.TTL <= 0 || req.Attempts < 1 {
+		return &response{Error: "missing vault, key, PIN, KDF parameters, lifetime or attempts"}
+	}
+	e := &pinEntry{params: *req.KDFParams, maxAttempts: req.Attempts}
+	if err := e.params.Validate(); err != nil {
+		return &response{Error: err.Error()}
+	}
+	var err error
+	if e.salt, err = crypto.GenerateSalt(e.params.SaltLength); err != nil {
+		return &response{Error: err.Error()}
+	}
+	key, err := e.deriveKey(req.PIN)
+	if err != nil {
+		return &response{Error: err.Error()}
+	}
+	defer crypto.ZeroBytes(key)
+	if e.key, err = crypto.Encrypt(req.Key, key, pinAD(req.Vault)); err != nil {
+		return &response{Error: err.Error()}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.touch()
+	s.removePIN(req.Vault)
+	e.expiresAt = time.Now().Add(req.TTL)
+	e.expiry = time.AfterFunc(req.TTL, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.pins[req.Vault] == e {
+			s.removePIN(req.Vault)
+		}
+	})
+	s.pins[req.Vault] = e
+	return &response{}
+}
+
+// unlockPIN checks the PIN in req. The attempt is counted before the key
+// derivation, which runs without holding s.mu, so that concurrent attempts
+// cannot exceed the limit.
+func (s *Server) unlockPIN(req *request) *response {
+	s.mu.Lock()
+	s.touch()
+	e, ok := s.pins[req.Vault]
+	if !ok {
+		s.mu.Unlock()
+		return &response{Error: "no PIN is set for this vault"}
+	}
+	if e.failed >= e.maxAttempts {
+		s.mu.Unlock()
+		return &response{Error: ErrPINDestroyed.Error(), Code: codePINDestroyed}
+	}
+	e.failed++
+	// removePIN may wipe e.key while the PIN is checked.
+	wrapped := append([]byte(nil), e.key...)
+	s.mu.Unlock()
+	defer crypto.ZeroBytes(wrapped)
+
+	var masterKey *crypto.SecureBuffer
+	key, err := e.deriveKey(req.PIN)
+	if err == nil {
+		masterKey, err = crypto.DecryptToBuffer(wrapped, key, pinAD(req.Vault))
+		crypto.ZeroBytes(key)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		defer masterKey.Destroy()
+		e.failed = 0
+		return &response{Key: append([]byte(nil), masterKey.Bytes()...)}
+	}
+	if left := e.maxAttempts - e.failed; left > 0 {
+		return &response{Error: ErrWrongPIN.Error(), Code: codeWrongPIN, PIN: e.state()}
+	}
+	if s.pins[req.Vault] == e {
+		s.removePIN(req.Vault)
+	}
+	return &response{Error: ErrPINDestroyed.Error(), Code: codePINDestroyed}
+}
+
+// removePIN destroys the PIN of a vault. The caller must hold s.mu.
+func (s *Server) removePIN(vault string) {
+	e, ok := s.pins[vault]
+	if !ok {
+		return
+	}
+	e.expiry.Stop()
+	crypto.ZeroBytes(e.key)
+	delete(s.pins, vault)
+}
+
+func (e *pinEntry) deriveKey(pin []byte) ([]byte, error) {
+	derived, err := crypto.DeriveKey(pin, e.salt, e.params)
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.ZeroBytes(derived)
+	return crypto.DeriveSubkey(derived, pinKeyPurpose)
+}
+
+// pinAD binds the wrapped key to its vault.
+func pinAD(vault string) []byte {
+	return []byte("gotp pin " + vault)
+}
+
+// pinError returns the error for a response that carries a PIN error code.
+func pinError(resp *response) error {
+	switch resp.Code {
+	case codeWrongPIN:
+		left := 0
+		if resp.PIN != nil {
+			left = resp.PIN.AttemptsLeft
+		}
+		return fmt.Errorf("%w (%d attempts left)", ErrWrongPIN, left)
+	case codePINDestroyed:
+		return ErrPINDestroyed
+	}
+	return nil
+}
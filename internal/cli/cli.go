@@ -4,18 +4,24 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/zulfikawr/gotp/internal/cli/commands"
 	"github.com/zulfikawr/gotp/internal/cli/ui"
 	"github.com/zulfikawr/gotp/internal/config"
+	"github.com/zulfikawr/gotp/internal/crypto"
+	"github.com/zulfikawr/gotp/internal/keyring"
+	"github.com/zulfikawr/gotp/internal/vault"
 	"golang.org/x/term"
 )
 
 var (
 	vaultPath  string
 	configPath string
+	keyfile    string
+	identity   string
 	jsonOutput bool
 	noColor    bool
 )
@@ -57,6 +63,41 @@ func NewRootCmd() *cobra.Command {
 			if noColor {
 				ui.SetColor(false)
 			}
+			// The --keyfile and --identity flags take precedence over
+			// security.keyfile and security.identity in the config file.
+			path := configPath
+			if path == "" {
+				path = config.GetConfigPath()
+			}
+			cfg, err := config.LoadConfig(path)
+			if err != nil {
+				cfg = config.DefaultConfig()
+			}
+			if keyfile != "" {
+				vault.SetKeyfile(keyfile)
+			} else if cfg.Security.Keyfile != "" {
+				vault.SetKeyfile(config.ExpandPath(cfg.Security.Keyfile))
+			}
+			if identity != "" {
+				vault.SetIdentity(identity)
+			} else if cfg.Security.Identity != "" {
+				vault.SetIdentity(config.ExpandPath(cfg.Security.Identity))
+			}
+			params := crypto.DefaultArgon2Params()
+			if cfg.Security.Argon2Memory != 0 {
+				params.Memory = cfg.Security.Argon2Memory
+			}
+			if cfg.Security.Argon2Iterations != 0 {
+				params.Iterations = cfg.Security.Argon2Iterations
+			}
+			if cfg.Security.Argon2Parallelism != 0 {
+				params.Parallelism = cfg.Security.Argon2Parallelism
+			}
+			if err := vault.SetKDFParams(params); err != nil {
+				fmt.Fprintf(ui.Out, "%sWarning: ignoring the argon2 settings in the config: %v%s\n", ui.WarningBright, err, ui.Reset)
+			}
+			vault.SetSessionTimeout(time.Duration(cfg.General.SessionTimeout) * time.Second)
+			vault.SetKeyStores(vault.AgentStore, keyring.SecretService{}, vault.FileStore)
 		},
 	}
 
@@ -147,6 +188,8 @@ func NewRootCmd() *cobra.Command {
 	// Persistent Flags (Global)
 	rootCmd.PersistentFlags().StringVarP(&vaultPath, "vault", "v", "", "Path to vault file")
 	rootCmd.PersistentFlags().StringVarP(&configPath, "config", "C", "", "Path to config file")
+	rootCmd.PersistentFlags().StringVar(&keyfile, "keyfile", "", "Keyfile to unlock the vault with (alone or with the password)")
+	rootCmd.PersistentFlags().StringVar(&identity, "identity", "", "Identity file to unlock a team vault with")
 	rootCmd.PersistentFlags().BoolVarP(&jsonOutput, "json", "j", false, "Output in JSON format")
 	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "Disable colored output")
 
@@ -155,12 +198,25 @@ func NewRootCmd() *cobra.Command {
 	rootCmd.AddCommand(commands.NewAddCmd())
 	rootCmd.AddCommand(commands.NewListCmd())
 	rootCmd.AddCommand(commands.NewGetCmd())
+	rootCmd.AddCommand(commands.NewResyncCmd())
+	rootCmd.AddCommand(commands.NewChallengeCmd())
+	rootCmd.AddCommand(commands.NewCalibrateCmd())
 	rootCmd.AddCommand(commands.NewRemoveCmd())
 	rootCmd.AddCommand(commands.NewEditCmd())
 	rootCmd.AddCommand(commands.NewExportCmd())
 	rootCmd.AddCommand(commands.NewImportCmd())
 	rootCmd.AddCommand(commands.NewPasswdCmd())
+	rootCmd.AddCommand(commands.NewRekeyCmd())
+	rootCmd.AddCommand(commands.NewSlotCmd())
+	rootCmd.AddCommand(commands.NewEscrowCmd())
+	rootCmd.AddCommand(commands.NewTeamCmd())
 	rootCmd.AddCommand(commands.NewQrCmd())
+	rootCmd.AddCommand(commands.NewAgentCmd())
+	rootCmd.AddCommand(commands.NewUnlockCmd())
+	rootCmd.AddCommand(commands.NewLockCmd())
+	rootCmd.AddCommand(commands.NewStatusCmd())
+	rootCmd.AddCommand(commands.NewPinCmd())
+	rootCmd.AddCommand(commands.NewKeyringCmd())
 	rootCmd.AddCommand(commands.NewCompletionCmd())
 
 	return rootCmd
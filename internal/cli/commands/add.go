@@ -15,14 +15,16 @@ import (
 )
 
 func NewAddCmd() *cobra.Command {
-	var secret, issuer, username, algo, uri string
+	var secret, issuer, username, algo, uri, otpType, encoder, motpPIN, ocraSuite string
 	var digits, period int
+	var counter uint64
+	var t0 int64
 	var tags []string
 
 	cmd := &cobra.Command{
 		Use:   "add [name]",
 		Short: "Add a new TOTP account",
-		Long:  `Add a new TOTP account to your secure vault. You can either provide the details manually via flags or interactive mode, or use an otpauth:// URI.`,
+		Long:  `Add a new TOTP or HOTP account to your secure vault. You can either provide the details manually via flags or interactive mode, or use an otpauth:// URI.`,
 		SilenceUsage:  true,
 		SilenceErrors: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -40,6 +42,7 @@ func NewAddCmd() *cobra.Command {
 				fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
 				return nil
 			}
+			defer v.Destroy()
 
 			var acc *vault.Account
 			if uri != "" {
@@ -76,27 +79,75 @@ func NewAddCmd() *cobra.Command {
 				acc = vault.NewAccount(name, []byte(secret))
 				acc.Issuer = issuer
 				acc.Username = username
+
+				acc.Encoder = totp.EncoderName(strings.ToLower(encoder))
+				acc.PIN = vault.Secret(motpPIN)
+				if _, err := acc.CodeEncoder(); err != nil {
+					fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+					fmt.Fprintf(ui.Out, "%sTip: Use 'rfc', 'steam', or 'motp'.%s\n", ui.TextMuted, ui.Reset)
+					return nil
+				}
+				switch acc.Encoder {
+				case totp.EncoderSteam:
+					acc.Digits = 5
+				case totp.EncoderMOTP:
+					acc.Period = 10
+					if len(acc.PIN) == 0 {
+						fmt.Fprintf(ui.Out, "%sError: mOTP accounts require a PIN%s\n", ui.DangerBright, ui.Reset)
+						fmt.Fprintf(ui.Out, "%sTip: Provide it with '%s--motp-pin%s'.%s\n", ui.TextMuted, ui.InfoBright, ui.TextMuted, ui.Reset)
+						return nil
+					}
+				}
+
 				if cmd.Flags().Changed("digits") {
 					acc.Digits = digits
 				}
 				if cmd.Flags().Changed("period") {
 					acc.Period = period
 				}
+				if cmd.Flags().Changed("t0") {
+					acc.T0 = t0
+				}
 				if cmd.Flags().Changed("algorithm") {
 					acc.Algorithm = totp.HashAlgorithm(strings.ToUpper(algo))
 				}
+				switch totp.OTPType(strings.ToLower(otpType)) {
+				case totp.TypeTOTP:
+				case totp.TypeHOTP:
+					acc.Type = totp.TypeHOTP
+					acc.Counter = counter
+				case totp.TypeOCRA:
+					suite, err := totp.ParseOCRASuite(ocraSuite)
+					if err != nil {
+						fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+						fmt.Fprintf(ui.Out, "%sTip: Provide a suite such as '%s--ocra-suite OCRA-1:HOTP-SHA1-6:QN08%s'.%s\n", ui.TextMuted, ui.InfoBright, ui.TextMuted, ui.Reset)
+						return nil
+					}
+					acc.Type = totp.TypeOCRA
+					acc.OCRASuite = suite.Raw
+					acc.Algorithm = suite.Algorithm
+					acc.Digits = suite.Digits
+					acc.Counter = counter
+				default:
+					fmt.Fprintf(ui.Out, "%sError: Unsupported type: %s%s\n", ui.DangerBright, otpType, ui.Reset)
+					fmt.Fprintf(ui.Out, "%sTip: Use 'totp', 'hotp', or 'ocra'.%s\n", ui.TextMuted, ui.Reset)
+					return nil
+				}
+
+				if err := acc.Validate(); err != nil {
+					fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+					return nil
+				}
 			}
 
 			acc.ID = uuid.New().String()
 			acc.Tags = tags
-			v.Accounts = append(v.Accounts, *acc)
-
-			if err := vault.CreateBackup(vaultPath, 3); err != nil {
-				fmt.Fprintf(ui.Out, "%sWarning: failed to create backup: %v%s\n", ui.WarningBright, err, ui.Reset)
-			}
-
-			if err := vault.SaveVaultWithKey(vaultPath, v, key); err != nil {
-				return err
+			ok := updateVault(vaultPath, key, func(v *vault.Vault) error {
+				v.Accounts = append(v.Accounts, *acc)
+				return nil
+			})
+			if !ok {
+				return nil
 			}
 
 			fmt.Fprintf(ui.Out, "%s✓ Added account: %s%s\n", ui.SuccessBright, acc.Name, ui.Reset)
@@ -109,8 +160,14 @@ func NewAddCmd() *cobra.Command {
 	cmd.Flags().StringVarP(&issuer, "issuer", "i", "", "Service issuer")
 	cmd.Flags().StringVarP(&username, "username", "u", "", "Username/Email")
 	cmd.Flags().StringVarP(&algo, "algorithm", "a", "SHA1", "Hash algorithm")
-	cmd.Flags().IntVarP(&digits, "digits", "d", 6, "Code digits")
+	cmd.Flags().IntVarP(&digits, "digits", "d", 6, "Code digits (1-10)")
 	cmd.Flags().IntVarP(&period, "period", "p", 30, "Time period")
+	cmd.Flags().Int64Var(&t0, "t0", 0, "Unix time TOTP steps are counted from")
+	cmd.Flags().StringVar(&otpType, "type", "totp", "OTP type (totp, hotp, ocra)")
+	cmd.Flags().Uint64Var(&counter, "counter", 0, "Initial HOTP counter")
+	cmd.Flags().StringVar(&encoder, "encoder", "rfc", "Code encoder (rfc, steam, motp)")
+	cmd.Flags().StringVar(&motpPIN, "motp-pin", "", "PIN for mOTP accounts")
+	cmd.Flags().StringVar(&ocraSuite, "ocra-suite", "", "OCRA suite for challenge-response accounts")
 	cmd.Flags().StringSliceVarP(&tags, "tags", "t", []string{}, "Comma-separated tags")
 
 	return cmd
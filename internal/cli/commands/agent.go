@@ -0,0 +1,84 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zulfikawr/gotp/internal/agent"
+	"github.com/zulfikawr/gotp/internal/cli/ui"
+)
+
+func NewAgentCmd() *cobra.Command {
+	var idleTimeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "agent",
+		Short: "Keep the unlocked vault key in memory",
+		Long: `Run gotp agent, which keeps the key of the unlocked vault in locked memory so that commands run shortly after each other do not prompt for the password again. Nothing is written to disk.
+
+The agent runs in the foreground and listens on a Unix socket that only you can access, at agent.sock in the configuration directory or at $GOTP_AGENT_SOCK. It forgets the key when it expires, after --idle-timeout without a request, on 'gotp lock', and when it stops. Without a running agent, every command prompts for the password.
+
+Examples:
+  gotp agent &
+  gotp agent --idle-timeout 5m
+  gotp agent stop`,
+		Args:  cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := agent.SocketPath()
+			server := agent.NewServer(idleTimeout)
+			if err := server.Listen(path); err != nil {
+				fmt.Fprintf(ui.Out, "%sError: Failed to start agent: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+			defer signal.Stop(signals)
+			go func() {
+				<-signals
+				_ = server.Close()
+			}()
+
+			fmt.Fprintf(ui.Out, "%s✓ gotp agent listening on %s%s\n", ui.SuccessBright, path, ui.Reset)
+			if err := server.Serve(); err != nil {
+				fmt.Fprintf(ui.Out, "%sError: Agent failed: %v%s\n", ui.DangerBright, err, ui.Reset)
+				_ = server.Close()
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&idleTimeout, "idle-timeout", agent.DefaultIdleTimeout, "Forget the key after this long without a request (0 to disable)")
+	cmd.AddCommand(newAgentStopCmd())
+	return cmd
+}
+
+func newAgentStopCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "stop",
+		Short: "Stop the agent",
+		Long:  `Stop the running gotp agent. It wipes the key it holds before exiting.`,
+		Args:  cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := agent.Stop(); err != nil {
+				if errors.Is(err, agent.ErrNotRunning) {
+					fmt.Fprintf(ui.Out, "%sgotp agent is not running.%s\n", ui.TextMuted, ui.Reset)
+					return nil
+				}
+				fmt.Fprintf(ui.Out, "%sError: Failed to stop agent: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			fmt.Fprintf(ui.Out, "%s✓ Stopped gotp agent%s\n", ui.SuccessBright, ui.Reset)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zulfikawr/gotp/internal/cli/ui"
+	"github.com/zulfikawr/gotp/internal/config"
+	"github.com/zulfikawr/gotp/internal/totp"
+	"github.com/zulfikawr/gotp/internal/vault"
+)
+
+func NewCalibrateCmd() *cobra.Command {
+	var window int
+
+	cmd := &cobra.Command{
+		Use:   "calibrate <account> <observed-code>",
+		Short: "Correct clock drift for a TOTP account",
+		Long:  `Infer the offset between the local clock and the service from a code the service currently accepts (for example, one shown by another device). Time steps on either side of the local clock are searched, and the matching offset is stored on the account and applied to every code it generates.`,
+		Args:  cobra.ExactArgs(2),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name, code := args[0], args[1]
+			vaultPath := config.GetVaultPath()
+
+			// Check if vault exists first
+			if _, err := os.Stat(vaultPath); os.IsNotExist(err) {
+				fmt.Fprintf(ui.Out, "%sError: Vault file not found at %s%s\n", ui.DangerBright, vaultPath, ui.Reset)
+				fmt.Fprintf(ui.Out, "%sTip: Run '%s%sgotp %sinit%s' to create a new secure vault.%s\n", ui.TextMuted, ui.Reset, ui.SuccessBright, ui.WarningBright, ui.TextMuted, ui.Reset)
+				return nil
+			}
+
+			v, key, err := vault.LoadVaultInteractive(vaultPath, ui.PromptPassword)
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			defer v.Destroy()
+
+			var target *vault.Account
+			for i := range v.Accounts {
+				if strings.EqualFold(v.Accounts[i].Name, name) {
+					target = &v.Accounts[i]
+					break
+				}
+			}
+
+			if target == nil {
+				fmt.Fprintf(ui.Out, "%sError: Account %q not found%s\n", ui.DangerBright, name, ui.Reset)
+				return nil
+			}
+
+			if target.IsHOTP() || target.IsOCRA() {
+				fmt.Fprintf(ui.Out, "%sError: Account %q is not time-based (TOTP)%s\n", ui.DangerBright, target.Name, ui.Reset)
+				if target.IsHOTP() {
+					fmt.Fprintf(ui.Out, "%sTip: Run '%s%sgotp %sresync%s <account> <code1> <code2>' to recover an HOTP counter.%s\n", ui.TextMuted, ui.Reset, ui.SuccessBright, ui.WarningBright, ui.TextMuted, ui.Reset)
+				}
+				return nil
+			}
+
+			secret, err := v.DecodeSecret(target)
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			defer secret.Destroy()
+
+			encoder, pin, err := v.CodeEncoder(target)
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			defer pin.Destroy()
+
+			params := target.TOTPParams(secret.Bytes(), time.Now(), encoder)
+			offset, ok, err := totp.CalibrateTOTP(code, params, window)
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: Failed to generate codes: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			if !ok {
+				fmt.Fprintf(ui.Out, "%sError: Code did not match within %d time steps of the local clock%s\n", ui.DangerBright, window, ui.Reset)
+				fmt.Fprintf(ui.Out, "%sTip: Use a code that is currently valid or increase '%s--window%s'.%s\n", ui.TextMuted, ui.InfoBright, ui.TextMuted, ui.Reset)
+				return nil
+			}
+
+			var previous int64
+			ok = updateVault(vaultPath, key, func(v *vault.Vault) error {
+				index := v.FindAccount(target.ID)
+				if index == -1 {
+					fmt.Fprintf(ui.Out, "%sError: Account %q not found%s\n", ui.DangerBright, target.Name, ui.Reset)
+					return errReported
+				}
+				previous = v.Accounts[index].TimeOffset
+				v.Accounts[index].TimeOffset = offset
+				return nil
+			})
+			if !ok {
+				return nil
+			}
+
+			fmt.Fprintf(ui.Out, "%s✓ Calibrated %s: time offset %+ds → %+ds%s\n", ui.SuccessBright, target.Name, previous, offset, ui.Reset)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&window, "window", "w", totp.DefaultCalibrationWindow, "Number of time steps to search on either side of the local clock")
+	return cmd
+}
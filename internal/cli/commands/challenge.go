@@ -0,0 +1,173 @@
+package commands
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zulfikawr/gotp/internal/cli/ui"
+	"github.com/zulfikawr/gotp/internal/config"
+	"github.com/zulfikawr/gotp/internal/crypto"
+	"github.com/zulfikawr/gotp/internal/totp"
+	"github.com/zulfikawr/gotp/internal/vault"
+)
+
+func NewChallengeCmd() *cobra.Command {
+	var session string
+	var copyToClipboard bool
+	var timeout int
+
+	cmd := &cobra.Command{
+		Use:   "challenge <account> <question>",
+		Short: "Answer an OCRA challenge",
+		Long:  `Compute the response to an OCRA (RFC 6287) challenge for a stored challenge-response account. Counter-based suites consume the next counter value, which is saved to the vault before the response is shown.`,
+		Args:  cobra.ExactArgs(2),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name, question := args[0], args[1]
+			vaultPath := config.GetVaultPath()
+			isJSON, _ := cmd.Flags().GetBool("json")
+
+			// Check if vault exists first
+			if _, err := os.Stat(vaultPath); os.IsNotExist(err) {
+				fmt.Fprintf(ui.Out, "%sError: Vault file not found at %s%s\n", ui.DangerBright, vaultPath, ui.Reset)
+				fmt.Fprintf(ui.Out, "%sTip: Run '%s%sgotp %sinit%s' to create a new secure vault.%s\n", ui.TextMuted, ui.Reset, ui.SuccessBright, ui.WarningBright, ui.TextMuted, ui.Reset)
+				return nil
+			}
+
+			v, key, err := vault.LoadVaultInteractive(vaultPath, ui.PromptPassword)
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			defer v.Destroy()
+
+			var target *vault.Account
+			for i := range v.Accounts {
+				if strings.EqualFold(v.Accounts[i].Name, name) {
+					target = &v.Accounts[i]
+					break
+				}
+			}
+
+			if target == nil {
+				fmt.Fprintf(ui.Out, "%sError: Account %q not found%s\n", ui.DangerBright, name, ui.Reset)
+				return nil
+			}
+
+			if !target.IsOCRA() {
+				fmt.Fprintf(ui.Out, "%sError: Account %q is not an OCRA challenge-response account%s\n", ui.DangerBright, target.Name, ui.Reset)
+				return nil
+			}
+
+			suite, err := totp.ParseOCRASuite(target.OCRASuite)
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+
+			secret, err := v.DecodeSecret(target)
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			defer secret.Destroy()
+
+			pin, err := v.OpenPIN(target)
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			defer pin.Destroy()
+
+			params := totp.OCRAParams{
+				Counter:   target.Counter,
+				Question:  question,
+				PIN:       pin.Bytes(),
+				Timestamp: time.Now(),
+			}
+
+			if suite.PINAlgorithm != "" && len(params.PIN) == 0 {
+				entered, err := ui.PromptPassword("Enter OCRA PIN: ")
+				if err != nil {
+					return err
+				}
+				defer crypto.ZeroBytes(entered)
+				params.PIN = entered
+			}
+
+			if suite.SessionLength > 0 {
+				params.SessionInfo, err = hex.DecodeString(session)
+				if err != nil {
+					fmt.Fprintf(ui.Out, "%sError: Session information must be hex encoded%s\n", ui.DangerBright, ui.Reset)
+					return nil
+				}
+			}
+
+			var response string
+			respond := func() error {
+				response, err = totp.GenerateOCRA(suite, secret.Bytes(), params)
+				if err != nil {
+					fmt.Fprintf(ui.Out, "%sError: Failed to compute response: %v%s\n", ui.DangerBright, err, ui.Reset)
+					return errReported
+				}
+				return nil
+			}
+
+			if suite.Counter {
+				// Take the counter from the vault as it is on disk now and
+				// persist the advanced counter before revealing the response.
+				ok := updateVault(vaultPath, key, func(v *vault.Vault) error {
+					index := v.FindAccount(target.ID)
+					if index == -1 {
+						fmt.Fprintf(ui.Out, "%sError: Account %q not found%s\n", ui.DangerBright, target.Name, ui.Reset)
+						return errReported
+					}
+					acc := &v.Accounts[index]
+					params.Counter = acc.Counter
+					if err := respond(); err != nil {
+						return err
+					}
+					acc.Counter++
+					acc.LastUsedAt = time.Now()
+					return nil
+				})
+				if !ok {
+					return nil
+				}
+			} else if respond() != nil {
+				return nil
+			}
+
+			if isJSON {
+				res := map[string]interface{}{
+					"account":  target.Name,
+					"suite":    suite.Raw,
+					"question": question,
+					"response": response,
+				}
+				if suite.Counter {
+					res["counter"] = params.Counter
+				}
+				data, _ := json.Marshal(res)
+				fmt.Fprintln(ui.Out, string(data))
+			} else {
+				fmt.Fprintf(ui.Out, "%s%s%s\n", ui.PrimaryBright+ui.Bold, target.Name, ui.Reset)
+				fmt.Fprintf(ui.Out, "%s└──  %s%s%s  |  %s%s%s\n", ui.TextMuted, ui.WarningBright+ui.Bold, response, ui.Reset, ui.TextMuted, suite.Raw, ui.Reset)
+			}
+
+			copyCode(response, copyToClipboard, timeout, isJSON)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&session, "session", "", "Session information (hex) for suites with an S input")
+	cmd.Flags().BoolVarP(&copyToClipboard, "copy", "c", false, "Copy response to clipboard")
+	cmd.Flags().IntVarP(&timeout, "timeout", "t", 30, "Clipboard clear timeout in seconds")
+	return cmd
+}
@@ -3,18 +3,58 @@ package commands
 import (
 	"bufio"
 	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"encoding/json"
 	"io"
+	"net"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/zulfikawr/gotp/internal/age"
+	"github.com/zulfikawr/gotp/internal/agent"
 	"github.com/zulfikawr/gotp/internal/cli/ui"
 	"github.com/zulfikawr/gotp/internal/config"
+	"github.com/zulfikawr/gotp/internal/crypto"
+	"github.com/zulfikawr/gotp/internal/keyring"
+	"github.com/zulfikawr/gotp/internal/totp"
 	"github.com/zulfikawr/gotp/internal/vault"
+	"github.com/zulfikawr/gotp/pkg/base32"
+	"golang.org/x/crypto/ssh"
+	sshagent "golang.org/x/crypto/ssh/agent"
 )
 
+// TestMain points the tests at an agent socket that does not exist, so
+// that every command prompts and the user's agent is left alone. The
+// user's ssh-agent is hidden as well.
+func TestMain(m *testing.M) {
+	// Run as a separate gotp process for runCommandProcess.
+	if args := os.Getenv("GOTP_TEST_COMMAND"); args != "" {
+		root := setupTestCLI(os.Getenv("GOTP_TEST_VAULT"), os.Getenv("GOTP_TEST_INPUT"))
+		out, _ := executeCommand(root, strings.Fields(args)...)
+		os.Stdout.WriteString(out)
+		os.Exit(0)
+	}
+
+	dir, err := os.MkdirTemp("", "gotp-agent")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv(agent.SocketEnv, filepath.Join(dir, "agent.sock"))
+	os.Unsetenv("SSH_AUTH_SOCK")
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 // executeCommand is a helper to run a cobra command and return all output.
 func executeCommand(root *cobra.Command, args ...string) (output string, err error) {
 	buf := new(bytes.Buffer)
@@ -57,7 +97,7 @@ func setupTestCLI(vaultPath string, input string) *cobra.Command {
 	ui.ResetScanner()
 
 	// Clear session for each test to ensure predictable prompts
-	_ = vault.ClearSession()
+	_ = vault.ClearSession(vaultPath)
 
 	root := &cobra.Command{Use: "gotp"}
 	root.PersistentFlags().BoolP("json", "j", false, "Output in JSON format")
@@ -65,11 +105,24 @@ func setupTestCLI(vaultPath string, input string) *cobra.Command {
 	root.AddCommand(NewAddCmd())
 	root.AddCommand(NewListCmd())
 	root.AddCommand(NewGetCmd())
+	root.AddCommand(NewResyncCmd())
+	root.AddCommand(NewChallengeCmd())
+	root.AddCommand(NewCalibrateCmd())
 	root.AddCommand(NewRemoveCmd())
 	root.AddCommand(NewEditCmd())
 	root.AddCommand(NewExportCmd())
 	root.AddCommand(NewImportCmd())
 	root.AddCommand(NewPasswdCmd())
+	root.AddCommand(NewRekeyCmd())
+	root.AddCommand(NewSlotCmd())
+	root.AddCommand(NewEscrowCmd())
+	root.AddCommand(NewTeamCmd())
+	root.AddCommand(NewAgentCmd())
+	root.AddCommand(NewUnlockCmd())
+	root.AddCommand(NewLockCmd())
+	root.AddCommand(NewStatusCmd())
+	root.AddCommand(NewPinCmd())
+	root.AddCommand(NewKeyringCmd())
 
 	return root
 }
@@ -147,3 +200,1194 @@ func TestCLIIntegration(t *testing.T) {
 		t.Error("Expected error output for password mismatch")
 	}
 }
+
+func TestCLIListJSON(t *testing.T) {
+	tmpDir, _ := os.MkdirTemp("", "gotp-cli-list-*")
+	defer os.RemoveAll(tmpDir)
+	vaultPath := filepath.Join(tmpDir, "vault.enc")
+
+	root := setupTestCLI(vaultPath, "password\npassword\n")
+	if _, err := executeCommand(root, "init"); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	root = setupTestCLI(vaultPath, "password\n")
+	_, err := executeCommand(root, "add", "Mobile", "--secret", "GEZDGNBVGY3TQOJQ", "--encoder", "motp", "--motp-pin", "4711", "--issuer", "Bank", "--username", "alice")
+	if err != nil {
+		t.Fatalf("Add mOTP failed: %v", err)
+	}
+
+	root = setupTestCLI(vaultPath, "password\n")
+	out, err := executeCommand(root, "list", "--json")
+	if err != nil {
+		t.Fatalf("List JSON failed: %v", err)
+	}
+	if !strings.Contains(out, `"name":"Mobile"`) {
+		t.Errorf("List JSON missing account. Got: %q", out)
+	}
+	for _, leak := range []string{"GEZDGNBVGY3TQOJQ", "4711", "secret", "pin"} {
+		if strings.Contains(out, leak) {
+			t.Errorf("List JSON contains %q: %q", leak, out)
+		}
+	}
+
+	// The sealed PIN still produces codes.
+	root = setupTestCLI(vaultPath, "password\n")
+	out, _ = executeCommand(root, "get", "Mobile", "--json")
+	if !strings.Contains(out, "code") || strings.Contains(out, "Error") {
+		t.Errorf("Get mOTP failed. Got: %q", out)
+	}
+}
+
+func TestCLIHOTP(t *testing.T) {
+	tmpDir, _ := os.MkdirTemp("", "gotp-cli-hotp-*")
+	defer os.RemoveAll(tmpDir)
+	vaultPath := filepath.Join(tmpDir, "vault.enc")
+
+	root := setupTestCLI(vaultPath, "password\npassword\n")
+	if _, err := executeCommand(root, "init"); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	// RFC 4226 test secret "12345678901234567890" in Base32.
+	root = setupTestCLI(vaultPath, "password\n")
+	_, err := executeCommand(root, "add", "Counter", "--type", "hotp", "--secret", "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", "--issuer", "Bank", "--username", "alice")
+	if err != nil {
+		t.Fatalf("Add HOTP failed: %v", err)
+	}
+
+	// Each get consumes the next counter value.
+	for _, want := range []string{"755224", "287082"} {
+		root = setupTestCLI(vaultPath, "password\n")
+		out, err := executeCommand(root, "get", "Counter", "--json")
+		if err != nil {
+			t.Fatalf("Get HOTP failed: %v", err)
+		}
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected HOTP code %s. Got: %q", want, out)
+		}
+	}
+
+	// Resync to counters 5 and 6; the next code must be for counter 7.
+	root = setupTestCLI(vaultPath, "password\n")
+	if _, err := executeCommand(root, "resync", "Counter", "254676", "287922"); err != nil {
+		t.Fatalf("Resync failed: %v", err)
+	}
+
+	root = setupTestCLI(vaultPath, "password\n")
+	out, _ := executeCommand(root, "get", "Counter", "--json")
+	if !strings.Contains(out, "162583") {
+		t.Errorf("Expected HOTP code for counter 7 after resync. Got: %q", out)
+	}
+}
+
+// runCommandProcess runs a command in a process of its own, as a separate
+// gotp invocation would, and returns its output.
+func runCommandProcess(vaultPath, input string, args ...string) (string, error) {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(),
+		"GOTP_TEST_COMMAND="+strings.Join(args, " "),
+		"GOTP_TEST_VAULT="+vaultPath,
+		"GOTP_TEST_INPUT="+input,
+	)
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+func TestCLIConcurrentHOTP(t *testing.T) {
+	tmpDir, _ := os.MkdirTemp("", "gotp-cli-hotp-*")
+	defer os.RemoveAll(tmpDir)
+	vaultPath := filepath.Join(tmpDir, "vault.enc")
+
+	root := setupTestCLI(vaultPath, "password\npassword\n")
+	if _, err := executeCommand(root, "init"); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	root = setupTestCLI(vaultPath, "password\n")
+	if _, err := executeCommand(root, "add", "Counter", "--type", "hotp", "--secret", "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"); err != nil {
+		t.Fatalf("Add HOTP failed: %v", err)
+	}
+
+	// Concurrent gets wait for each other instead of failing with a
+	// conflict, and each consumes a counter value of its own.
+	want := map[string]bool{"755224": true, "287082": true, "359152": true, "969429": true}
+	outputs := make(chan string, len(want))
+	n := len(want)
+	for i := 0; i < n; i++ {
+		go func() {
+			out, err := runCommandProcess(vaultPath, "password\n", "get", "Counter", "--json")
+			if err != nil {
+				out += err.Error()
+			}
+			outputs <- out
+		}()
+	}
+	for i := 0; i < n; i++ {
+		out := <-outputs
+		var res struct {
+			Code string `json:"code"`
+		}
+		if i := strings.Index(out, "{"); i == -1 || json.Unmarshal([]byte(out[i:]), &res) != nil {
+			t.Errorf("Expected a code. Got: %q", out)
+			continue
+		}
+		if !want[res.Code] {
+			t.Errorf("Unexpected or repeated code %s", res.Code)
+		}
+		delete(want, res.Code)
+	}
+
+	for i := 0; i < 3; i++ {
+	v, _, err := vault.LoadVaultInteractive(vaultPath, func(string) ([]byte, error) {
+		return []byte("password"), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("%d %+v", i, v.Accounts[0].Counter)
+	time.Sleep(100*time.Millisecond)
+	}
+	v, _, err := vault.LoadVaultInteractive(vaultPath, func(string) ([]byte, error) {
+		return []byte("password"), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Destroy()
+	if v.Accounts[0].Counter != 4 {
+		t.Errorf("Expected counter 4, got %d", v.Accounts[0].Counter)
+	}
+}
+
+func TestCLIChallenge(t *testing.T) {
+	tmpDir, _ := os.MkdirTemp("", "gotp-cli-ocra-*")
+	defer os.RemoveAll(tmpDir)
+	vaultPath := filepath.Join(tmpDir, "vault.enc")
+
+	root := setupTestCLI(vaultPath, "password\npassword\n")
+	if _, err := executeCommand(root, "init"); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	// RFC 6287 20-byte test key "12345678901234567890" in Base32.
+	root = setupTestCLI(vaultPath, "password\n")
+	_, err := executeCommand(root, "add", "Token", "--type", "ocra", "--ocra-suite", "OCRA-1:HOTP-SHA1-6:QN08", "--secret", "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", "--issuer", "Bank", "--username", "alice")
+	if err != nil {
+		t.Fatalf("Add OCRA failed: %v", err)
+	}
+
+	root = setupTestCLI(vaultPath, "password\n")
+	out, err := executeCommand(root, "challenge", "Token", "11111111", "--json")
+	if err != nil {
+		t.Fatalf("Challenge failed: %v", err)
+	}
+	if !strings.Contains(out, "243178") {
+		t.Errorf("Expected OCRA response 243178. Got: %q", out)
+	}
+
+	root = setupTestCLI(vaultPath, "password\n")
+	out, _ = executeCommand(root, "get", "Token")
+	if !strings.Contains(out, "challenge-response") {
+		t.Errorf("Expected get to reject OCRA account. Got: %q", out)
+	}
+}
+
+func TestCLIGetSchedule(t *testing.T) {
+	tmpDir, _ := os.MkdirTemp("", "gotp-cli-schedule-*")
+	defer os.RemoveAll(tmpDir)
+	vaultPath := filepath.Join(tmpDir, "vault.enc")
+
+	root := setupTestCLI(vaultPath, "password\npassword\n")
+	if _, err := executeCommand(root, "init"); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	// RFC 6238 SHA1 test secret with 8 digits.
+	root = setupTestCLI(vaultPath, "password\n")
+	if _, err := executeCommand(root, "add", "RFC", "--secret", "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", "--digits", "8"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	root = setupTestCLI(vaultPath, "password\n")
+	out, err := executeCommand(root, "get", "RFC", "--at", "2005-03-18T01:58:29Z", "--json")
+	if err != nil {
+		t.Fatalf("Get --at failed: %v", err)
+	}
+	if !strings.Contains(out, "07081804") || !strings.Contains(out, `"valid_until":"2005-03-18T01:58:30Z"`) {
+		t.Errorf("Expected RFC 6238 code 07081804 valid until 01:58:30. Got: %q", out)
+	}
+
+	root = setupTestCLI(vaultPath, "password\n")
+	out, _ = executeCommand(root, "get", "RFC", "--at", "59", "--prev", "1", "--next", "1", "--json")
+	var res struct {
+		Codes []struct {
+			Offset int    `json:"offset"`
+			Code   string `json:"code"`
+		} `json:"codes"`
+	}
+	// Skip the password prompt that precedes the JSON document.
+	if err := json.Unmarshal([]byte(out[strings.Index(out, "{"):]), &res); err != nil {
+		t.Fatalf("Failed to parse JSON: %v (%q)", err, out)
+	}
+	if len(res.Codes) != 3 || res.Codes[1].Offset != 0 || res.Codes[1].Code != "94287082" {
+		t.Errorf("Unexpected schedule: %+v", res.Codes)
+	}
+
+	root = setupTestCLI(vaultPath, "password\n")
+	out, _ = executeCommand(root, "get", "RFC", "--at", "59", "--next", "2")
+	if !strings.Contains(out, "VALID FROM") || !strings.Contains(out, "94287082") || !strings.Contains(out, "+2") {
+		t.Errorf("Expected schedule table. Got: %q", out)
+	}
+
+	root = setupTestCLI(vaultPath, "password\n")
+	out, _ = executeCommand(root, "get", "RFC", "--at", "tomorrow")
+	if !strings.Contains(out, "invalid time") {
+		t.Errorf("Expected invalid time error. Got: %q", out)
+	}
+}
+
+func TestCLIDigits(t *testing.T) {
+	tmpDir, _ := os.MkdirTemp("", "gotp-cli-digits-*")
+	defer os.RemoveAll(tmpDir)
+	vaultPath := filepath.Join(tmpDir, "vault.enc")
+
+	root := setupTestCLI(vaultPath, "password\npassword\n")
+	if _, err := executeCommand(root, "init"); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	root = setupTestCLI(vaultPath, "password\n")
+	if _, err := executeCommand(root, "add", "Long", "--secret", "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", "--digits", "10"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	// T = 1 (Unix time 59) gives the 31-bit value 1094287082.
+	root = setupTestCLI(vaultPath, "password\n")
+	out, _ := executeCommand(root, "get", "Long", "--at", "59", "--json")
+	if !strings.Contains(out, `"code":"1094287082"`) {
+		t.Errorf("Expected 10-digit code 1094287082. Got: %q", out)
+	}
+
+	root = setupTestCLI(vaultPath, "password\n")
+	out, _ = executeCommand(root, "add", "TooLong", "--secret", "JBSWY3DPEHPK3PXP", "--digits", "11")
+	if !strings.Contains(out, "digits must be between 1 and 10") {
+		t.Errorf("Expected digits error from add. Got: %q", out)
+	}
+
+	root = setupTestCLI(vaultPath, "password\n")
+	out, _ = executeCommand(root, "edit", "Long", "--digits", "0")
+	if !strings.Contains(out, "digits must be between 1 and 10") {
+		t.Errorf("Expected digits error from edit. Got: %q", out)
+	}
+
+	// An account stored with an invalid length is reported, not shown as a code.
+	v, err := vault.LoadVault(vaultPath, []byte("password"))
+	if err != nil {
+		t.Fatalf("LoadVault failed: %v", err)
+	}
+	v.Accounts[0].Digits = 12
+	if err := vault.SaveVault(vaultPath, v, []byte("password")); err != nil {
+		t.Fatalf("SaveVault failed: %v", err)
+	}
+
+	root = setupTestCLI(vaultPath, "password\n")
+	out, _ = executeCommand(root, "list", "--with-codes")
+	if strings.Contains(out, "ERROR") || !strings.Contains(out, "Long: digits must be between 1 and 10") {
+		t.Errorf("Expected a clear error in list output. Got: %q", out)
+	}
+}
+
+func TestCLICalibrate(t *testing.T) {
+	tmpDir, _ := os.MkdirTemp("", "gotp-cli-calibrate-*")
+	defer os.RemoveAll(tmpDir)
+	vaultPath := filepath.Join(tmpDir, "vault.enc")
+
+	root := setupTestCLI(vaultPath, "password\npassword\n")
+	if _, err := executeCommand(root, "init"); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	root = setupTestCLI(vaultPath, "password\n")
+	if _, err := executeCommand(root, "add", "Drift", "--secret", "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	// The service's clock runs 90 seconds ahead of ours.
+	secret, _ := base32.Decode("JBSWY3DPEHPK3PXP")
+	observed, _ := totp.GenerateTOTP(totp.TOTPParams{
+		Secret:    secret,
+		Timestamp: time.Now().Add(90 * time.Second),
+	})
+
+	root = setupTestCLI(vaultPath, "password\n")
+	out, err := executeCommand(root, "calibrate", "Drift", observed)
+	if err != nil {
+		t.Fatalf("Calibrate failed: %v", err)
+	}
+	if !strings.Contains(out, "Calibrated") {
+		t.Fatalf("Expected calibration success. Got: %q", out)
+	}
+
+	v, err := vault.LoadVault(vaultPath, []byte("password"))
+	if err != nil {
+		t.Fatalf("LoadVault failed: %v", err)
+	}
+	// A step boundary between generating and calibrating shifts the match by one period.
+	if off := v.Accounts[0].TimeOffset; off < 60 || off > 120 {
+		t.Errorf("Expected a time offset of about 90s, got %d", off)
+	}
+
+	root = setupTestCLI(vaultPath, "password\n")
+	out, _ = executeCommand(root, "calibrate", "Drift", "000000", "--window", "0")
+	if !strings.Contains(out, "did not match") {
+		t.Errorf("Expected calibration mismatch. Got: %q", out)
+	}
+}
+
+func TestCLISlots(t *testing.T) {
+	tmpDir, _ := os.MkdirTemp("", "gotp-cli-slots-*")
+	defer os.RemoveAll(tmpDir)
+	vaultPath := filepath.Join(tmpDir, "vault.enc")
+
+	root := setupTestCLI(vaultPath, "password\npassword\n")
+	if _, err := executeCommand(root, "init"); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	root = setupTestCLI(vaultPath, "password\nJBSWY3DPEHPK3PXP\n\n\n")
+	if _, err := executeCommand(root, "add", "GitHub"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	// Recovery key
+	root = setupTestCLI(vaultPath, "password\n")
+	out, err := executeCommand(root, "slot", "add", "recovery", "--label", "paper")
+	if err != nil {
+		t.Fatalf("Slot add recovery failed: %v", err)
+	}
+	recoveryKey := regexp.MustCompile(`[A-Z2-7]{4}(-[A-Z2-7]{4}){7}`).FindString(out)
+	if recoveryKey == "" {
+		t.Fatalf("Expected a recovery key in output. Got: %q", out)
+	}
+
+	// Second password
+	root = setupTestCLI(vaultPath, "password\nsecond\nsecond\n")
+	if _, err := executeCommand(root, "slot", "add", "password"); err != nil {
+		t.Fatalf("Slot add password failed: %v", err)
+	}
+
+	// Keyfile, generated because it does not exist yet
+	keyfilePath := filepath.Join(tmpDir, "gotp.key")
+	root = setupTestCLI(vaultPath, "password\n")
+	out, _ = executeCommand(root, "slot", "add", "keyfile", keyfilePath)
+	if !strings.Contains(out, "Generated new keyfile") {
+		t.Fatalf("Expected keyfile to be generated. Got: %q", out)
+	}
+
+	root = setupTestCLI(vaultPath, "password\n")
+	out, _ = executeCommand(root, "slot", "list", "--json")
+	var slots []struct {
+		ID    string `json:"id"`
+		Type  string `json:"type"`
+		Label string `json:"label"`
+	}
+	if err := json.Unmarshal([]byte(out[strings.Index(out, "[{"):]), &slots); err != nil {
+		t.Fatalf("Failed to parse slot list: %v (%q)", err, out)
+	}
+	if len(slots) != 4 || slots[1].Type != "recovery" || slots[1].Label != "paper" {
+		t.Fatalf("Unexpected slots: %+v", slots)
+	}
+
+	// Every slot unlocks the vault.
+	for _, secret := range []string{"second", strings.ToLower(recoveryKey)} {
+		root = setupTestCLI(vaultPath, secret+"\n")
+		out, _ = executeCommand(root, "get", "GitHub")
+		if strings.Contains(out, "Error") {
+			t.Errorf("Unlock with %q failed: %q", secret, out)
+		}
+	}
+	root = setupTestCLI(vaultPath, "")
+	vault.SetKeyfile(keyfilePath)
+	out, _ = executeCommand(root, "get", "GitHub")
+	vault.SetKeyfile("")
+	if strings.Contains(out, "Error") || strings.Contains(out, "password") {
+		t.Errorf("Unlock with keyfile failed: %q", out)
+	}
+
+	// With two password slots, passwd needs to know which one to change.
+	root = setupTestCLI(vaultPath, "password\nnew\nnew\n")
+	out, _ = executeCommand(root, "passwd")
+	if !strings.Contains(out, "several password slots") {
+		t.Errorf("Expected passwd to ask for a slot. Got: %q", out)
+	}
+	root = setupTestCLI(vaultPath, "password\nnew\nnew\n")
+	if _, err := executeCommand(root, "passwd", "--slot", slots[0].ID); err != nil {
+		t.Fatalf("Passwd failed: %v", err)
+	}
+	if _, err := vault.LoadVault(vaultPath, []byte("password")); err == nil {
+		t.Error("Old password should no longer unlock the vault")
+	}
+	if v, err := vault.LoadVault(vaultPath, []byte("new")); err != nil || len(v.Slots) != 4 {
+		t.Errorf("New password should unlock the vault with all slots kept: %v", err)
+	}
+
+	// Removing the second password slot.
+	root = setupTestCLI(vaultPath, "new\n")
+	if _, err := executeCommand(root, "slot", "remove", slots[2].ID, "--force"); err != nil {
+		t.Fatalf("Slot remove failed: %v", err)
+	}
+	if _, err := vault.LoadVault(vaultPath, []byte("second")); err == nil {
+		t.Error("Removed password slot should no longer unlock the vault")
+	}
+}
+
+func TestCLIInitKeyfile(t *testing.T) {
+	tmpDir, _ := os.MkdirTemp("", "gotp-cli-keyfile-*")
+	defer os.RemoveAll(tmpDir)
+	vaultPath := filepath.Join(tmpDir, "vault.enc")
+	keyfilePath := filepath.Join(tmpDir, "gotp.key")
+
+	root := setupTestCLI(vaultPath, "password\npassword\n")
+	out, err := executeCommand(root, "init", "--keyfile", keyfilePath)
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if !strings.Contains(out, "Generated new keyfile") {
+		t.Fatalf("Expected keyfile to be generated. Got: %q", out)
+	}
+	if info, err := os.Stat(keyfilePath); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected keyfile with 0600 permissions: %v", err)
+	}
+
+	// Without the keyfile, unlocking fails before the password prompt.
+	root = setupTestCLI(vaultPath, "password\n")
+	out, _ = executeCommand(root, "list")
+	if !strings.Contains(out, "requires a keyfile") || strings.Contains(out, "Enter master password") {
+		t.Errorf("Expected a keyfile required error. Got: %q", out)
+	}
+
+	// With the keyfile but a wrong password.
+	vault.SetKeyfile(keyfilePath)
+	defer vault.SetKeyfile("")
+	root = setupTestCLI(vaultPath, "wrong\n")
+	out, _ = executeCommand(root, "list")
+	if !strings.Contains(out, "invalid master password or keyfile") {
+		t.Errorf("Expected an invalid password error. Got: %q", out)
+	}
+
+	root = setupTestCLI(vaultPath, "password\nJBSWY3DPEHPK3PXP\n\n\n")
+	if _, err := executeCommand(root, "add", "GitHub"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	// passwd keeps the slot bound to the keyfile.
+	root = setupTestCLI(vaultPath, "password\nnew\nnew\n")
+	out, _ = executeCommand(root, "passwd")
+	if !strings.Contains(out, "changed successfully") {
+		t.Fatalf("Passwd failed: %q", out)
+	}
+	if _, err := vault.LoadVault(vaultPath, []byte("new")); !errors.Is(err, vault.ErrKeyfileRequired) {
+		t.Errorf("Expected ErrKeyfileRequired without the keyfile, got %v", err)
+	}
+	keyfile, _ := os.ReadFile(keyfilePath)
+	if v, err := vault.LoadVaultWithKeyfile(vaultPath, []byte("new"), keyfile); err != nil || len(v.Accounts) != 1 {
+		t.Errorf("New password with keyfile should unlock the vault: %v", err)
+	}
+}
+
+func TestCLIRekey(t *testing.T) {
+	tmpDir, _ := os.MkdirTemp("", "gotp-cli-rekey-*")
+	defer os.RemoveAll(tmpDir)
+	vaultPath := filepath.Join(tmpDir, "vault.enc")
+
+	defer vault.SetKDFParams(vault.KDFParams())
+	fast := crypto.KDFParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	if err := vault.SetKDFParams(fast); err != nil {
+		t.Fatalf("SetKDFParams failed: %v", err)
+	}
+
+	root := setupTestCLI(vaultPath, "password\npassword\n")
+	if _, err := executeCommand(root, "init"); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	v, err := vault.LoadVault(vaultPath, []byte("password"))
+	if err != nil || v.Slots[0].KDFParams != fast {
+		t.Fatalf("Expected init to use the configured parameters: %v", err)
+	}
+	oldSalt := v.Slots[0].Salt
+
+	root = setupTestCLI(vaultPath, "password\nwrong\n")
+	out, _ := executeCommand(root, "rekey")
+	if !strings.Contains(out, "invalid master password") {
+		t.Errorf("Expected an invalid password error. Got: %q", out)
+	}
+
+	stronger := fast
+	stronger.Iterations = 2
+	vault.SetKDFParams(stronger)
+	root = setupTestCLI(vaultPath, "password\npassword\n")
+	out, _ = executeCommand(root, "rekey")
+	if !strings.Contains(out, "Rekeyed 1 password slot") {
+		t.Fatalf("Rekey failed: %q", out)
+	}
+	v, err = vault.LoadVault(vaultPath, []byte("password"))
+	if err != nil {
+		t.Fatalf("Rekeyed vault should unlock with the password: %v", err)
+	}
+	if v.Slots[0].KDFParams != stronger || bytes.Equal(v.Slots[0].Salt, oldSalt) {
+		t.Errorf("Expected a fresh salt and the configured parameters, got %+v", v.Slots[0])
+	}
+
+	root = setupTestCLI(vaultPath, "password\npassword\n")
+	out, _ = executeCommand(root, "rekey", "--calibrate", "1ms")
+	if !strings.Contains(out, "Calibrating") || !strings.Contains(out, "Rekeyed 1 password slot") {
+		t.Fatalf("Calibrated rekey failed: %q", out)
+	}
+	if _, err := vault.LoadVault(vaultPath, []byte("password")); err != nil {
+		t.Errorf("Calibrated vault should unlock with the password: %v", err)
+	}
+}
+
+func TestCLICipherAndKDF(t *testing.T) {
+	tmpDir, _ := os.MkdirTemp("", "gotp-cli-agility-*")
+	defer os.RemoveAll(tmpDir)
+	vaultPath := filepath.Join(tmpDir, "vault.enc")
+
+	defer vault.SetKDFParams(vault.KDFParams())
+	fast := crypto.KDFParams{Algorithm: crypto.KDFArgon2id, Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	vault.SetKDFParams(fast)
+
+	root := setupTestCLI(vaultPath, "")
+	out, _ := executeCommand(root, "init", "--cipher", "rot13")
+	if !strings.Contains(out, "unsupported cipher") {
+		t.Errorf("Expected an unsupported cipher error. Got: %q", out)
+	}
+
+	root = setupTestCLI(vaultPath, "password\npassword\n")
+	if _, err := executeCommand(root, "init", "--cipher", "xchacha20-poly1305", "--kdf", "scrypt"); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	var metadata vault.VaultMetadata
+	data, _ := os.ReadFile(vaultPath)
+	json.Unmarshal(data, &metadata)
+	if metadata.Cipher != crypto.CipherXChaCha20Poly1305 || metadata.Slots[0].KDFParams != crypto.DefaultScryptParams() {
+		t.Fatalf("Expected an XChaCha20-Poly1305 vault with a scrypt slot, got %q and %+v", metadata.Cipher, metadata.Slots[0].KDFParams)
+	}
+
+	root = setupTestCLI(vaultPath, "password\nJBSWY3DPEHPK3PXP\n\n\n")
+	if _, err := executeCommand(root, "add", "GitHub"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	root = setupTestCLI(vaultPath, "password\npassword\n")
+	out, _ = executeCommand(root, "rekey", "--cipher", "aes-256-gcm", "--kdf", "argon2id")
+	if !strings.Contains(out, "Rekeyed 1 password slot") || !strings.Contains(out, "re-encrypted with aes-256-gcm") {
+		t.Fatalf("Rekey failed: %q", out)
+	}
+	data, _ = os.ReadFile(vaultPath)
+	metadata = vault.VaultMetadata{}
+	json.Unmarshal(data, &metadata)
+	if metadata.Cipher != crypto.CipherAES256GCM || metadata.Slots[0].KDFParams != fast {
+		t.Errorf("Expected an AES-256-GCM vault with an Argon2id slot, got %q and %+v", metadata.Cipher, metadata.Slots[0].KDFParams)
+	}
+
+	root = setupTestCLI(vaultPath, "password\n")
+	out, _ = executeCommand(root, "get", "GitHub")
+	if !regexp.MustCompile(`\d{3} ?\d{3}`).MatchString(out) {
+		t.Errorf("Expected a code after changing the cipher. Got: %q", out)
+	}
+}
+
+func TestCLIEscrow(t *testing.T) {
+	tmpDir, _ := os.MkdirTemp("", "gotp-cli-escrow-*")
+	defer os.RemoveAll(tmpDir)
+	vaultPath := filepath.Join(tmpDir, "vault.enc")
+
+	root := setupTestCLI(vaultPath, "password\npassword\n")
+	if _, err := executeCommand(root, "init"); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	root = setupTestCLI(vaultPath, "password\nJBSWY3DPEHPK3PXP\n\n\n")
+	if _, err := executeCommand(root, "add", "GitHub"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	root = setupTestCLI(vaultPath, "password\n")
+	out, _ := executeCommand(root, "escrow", "split", "--shares", "5", "--threshold", "3", "--json")
+	var shares []struct {
+		Index int    `json:"index"`
+		Share string `json:"share"`
+	}
+	if err := json.Unmarshal([]byte(out[strings.Index(out, "[{"):]), &shares); err != nil {
+		t.Fatalf("Failed to parse shares: %v. Output: %q", err, out)
+	}
+	if len(shares) != 5 {
+		t.Fatalf("Expected 5 shares, got %d", len(shares))
+	}
+
+	// Two shares are not enough; the third is prompted for.
+	root = setupTestCLI(vaultPath, "garbage\n")
+	out, _ = executeCommand(root, "escrow", "recover", shares[0].Share, shares[4].Share)
+	if !strings.Contains(out, "invalid share") {
+		t.Errorf("Expected an invalid share error. Got: %q", out)
+	}
+
+	// Shares are accepted from files, including QR code images.
+	qrDir := filepath.Join(tmpDir, "shares")
+	root = setupTestCLI(vaultPath, "password\n")
+	if _, err := executeCommand(root, "escrow", "split", "--format", "qr", "--output-dir", qrDir); err != nil {
+		t.Fatalf("Split to QR failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(qrDir, "share-2-of-5.png")); err != nil {
+		t.Fatalf("Expected QR share files: %v", err)
+	}
+
+	root = setupTestCLI(vaultPath, strings.ToLower(shares[2].Share)+"\nrecovered\nrecovered\n")
+	out, _ = executeCommand(root, "escrow", "recover", shares[0].Share, shares[4].Share)
+	if !strings.Contains(out, "vault is recovered") {
+		t.Fatalf("Recover failed: %q", out)
+	}
+	if _, err := vault.LoadVault(vaultPath, []byte("password")); err == nil {
+		t.Error("Old password should no longer unlock the vault")
+	}
+	if v, err := vault.LoadVault(vaultPath, []byte("recovered")); err != nil || len(v.Accounts) != 1 {
+		t.Errorf("New password should unlock the recovered vault: %v", err)
+	}
+
+	// Shares from a different split are rejected; QR files from the split
+	// above still match the same key.
+	root = setupTestCLI(vaultPath, "new\nnew\n")
+	out, _ = executeCommand(root, "escrow", "recover",
+		filepath.Join(qrDir, "share-1-of-5.png"), filepath.Join(qrDir, "share-2-of-5.png"), filepath.Join(qrDir, "share-3-of-5.png"))
+	if !strings.Contains(out, "vault is recovered") {
+		t.Errorf("Recover from QR files failed: %q", out)
+	}
+	root = setupTestCLI(vaultPath, "")
+	out, _ = executeCommand(root, "escrow", "recover",
+		filepath.Join(qrDir, "share-1-of-5.png"), shares[1].Share, shares[2].Share)
+	if !strings.Contains(out, "different split") {
+		t.Errorf("Expected mixed shares to be rejected. Got: %q", out)
+	}
+}
+
+func TestCLITeam(t *testing.T) {
+	tmpDir, _ := os.MkdirTemp("", "gotp-cli-team-*")
+	defer os.RemoveAll(tmpDir)
+	vaultPath := filepath.Join(tmpDir, "vault.enc")
+
+	root := setupTestCLI(vaultPath, "password\npassword\n")
+	if _, err := executeCommand(root, "init"); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	root = setupTestCLI(vaultPath, "password\nJBSWY3DPEHPK3PXP\n\n\n")
+	if _, err := executeCommand(root, "add", "GitHub"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	recipients := map[string]string{}
+	for _, name := range []string{"alice", "bob"} {
+		path := filepath.Join(tmpDir, name+".txt")
+		root = setupTestCLI(vaultPath, "")
+		out, _ := executeCommand(root, "team", "keygen", "-o", path)
+		recipient := regexp.MustCompile(`age1[a-z0-9]+`).FindString(out)
+		if recipient == "" {
+			t.Fatalf("Expected a public key in output. Got: %q", out)
+		}
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+			t.Fatalf("Expected identity file with 0600 permissions: %v", err)
+		}
+		recipients[name] = recipient
+
+		root = setupTestCLI(vaultPath, "password\n")
+		out, _ = executeCommand(root, "team", "add-recipient", recipient, "--label", name)
+		if !strings.Contains(out, "Added recipient") {
+			t.Fatalf("Add recipient failed: %q", out)
+		}
+	}
+
+	root = setupTestCLI(vaultPath, "")
+	out, _ := executeCommand(root, "team", "keygen", "-o", filepath.Join(tmpDir, "alice.txt"))
+	if !strings.Contains(out, "Error") {
+		t.Errorf("Keygen should not overwrite an identity file. Got: %q", out)
+	}
+	root = setupTestCLI(vaultPath, "password\n")
+	out, _ = executeCommand(root, "team", "add-recipient", recipients["alice"])
+	if !strings.Contains(out, "already a recipient") {
+		t.Errorf("Expected a duplicate recipient error. Got: %q", out)
+	}
+
+	// Each member unlocks with their own identity.
+	for _, name := range []string{"alice", "bob"} {
+		vault.SetIdentity(filepath.Join(tmpDir, name+".txt"))
+		root = setupTestCLI(vaultPath, "")
+		out, _ = executeCommand(root, "get", "GitHub")
+		vault.SetIdentity("")
+		if strings.Contains(out, "Error") || strings.Contains(out, "password") {
+			t.Errorf("Unlock with %s's identity failed: %q", name, out)
+		}
+	}
+
+	// Removing bob rotates the key; alice and the password keep working.
+	before, _ := os.ReadFile(vaultPath)
+	root = setupTestCLI(vaultPath, "password\nrotated\nrotated\n")
+	out, _ = executeCommand(root, "team", "remove-recipient", recipients["bob"], "--force")
+	if !strings.Contains(out, "rotated the vault key") {
+		t.Fatalf("Remove recipient failed: %q", out)
+	}
+	after, _ := os.ReadFile(vaultPath)
+	var m1, m2 vault.VaultMetadata
+	json.Unmarshal(before, &m1)
+	json.Unmarshal(after, &m2)
+	if bytes.Equal(m1.Ciphertext, m2.Ciphertext) {
+		t.Error("Removing a recipient should re-encrypt the vault")
+	}
+
+	bob, _ := vault.ReadIdentityFile(filepath.Join(tmpDir, "bob.txt"))
+	if _, err := vault.LoadVaultWithIdentity(vaultPath, bob); err == nil {
+		t.Error("Removed recipient should no longer unlock the vault")
+	}
+	alice, _ := vault.ReadIdentityFile(filepath.Join(tmpDir, "alice.txt"))
+	if v, err := vault.LoadVaultWithIdentity(vaultPath, alice); err != nil || len(v.Accounts) != 1 {
+		t.Errorf("Remaining recipient should unlock the rotated vault: %v", err)
+	}
+	if _, err := vault.LoadVault(vaultPath, []byte("rotated")); err != nil {
+		t.Errorf("New password should unlock the rotated vault: %v", err)
+	}
+}
+
+func TestCLIAgeExportImport(t *testing.T) {
+	tmpDir, _ := os.MkdirTemp("", "gotp-cli-age-*")
+	defer os.RemoveAll(tmpDir)
+	vaultPath := filepath.Join(tmpDir, "vault.enc")
+	ageWorkFactor = 10
+	defer func() { ageWorkFactor = age.DefaultScryptWorkFactor }()
+
+	root := setupTestCLI(vaultPath, "password\npassword\n")
+	if _, err := executeCommand(root, "init"); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	root = setupTestCLI(vaultPath, "password\nJBSWY3DPEHPK3PXP\n\n\n")
+	if _, err := executeCommand(root, "add", "GitHub"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	// Passphrase export to stdout is armored.
+	root = setupTestCLI(vaultPath, "password\nexport-pass\nexport-pass\n")
+	out, _ := executeCommand(root, "export", "--format", "age")
+	start := strings.Index(out, "-----BEGIN AGE ENCRYPTED FILE-----")
+	if start == -1 {
+		t.Fatalf("Expected an armored age file. Got: %q", out)
+	}
+	armored := filepath.Join(tmpDir, "export.age.asc")
+	os.WriteFile(armored, []byte(out[start:]), 0600)
+
+	otherPath := filepath.Join(tmpDir, "other.enc")
+	root = setupTestCLI(otherPath, "password\npassword\n")
+	executeCommand(root, "init")
+
+	root = setupTestCLI(otherPath, "password\nwrong\n")
+	out, _ = executeCommand(root, "import", armored)
+	if !strings.Contains(out, "age import failed") {
+		t.Errorf("Expected failure with a wrong passphrase. Got: %q", out)
+	}
+	root = setupTestCLI(otherPath, "password\nexport-pass\n")
+	out, _ = executeCommand(root, "import", armored)
+	if !strings.Contains(out, "Imported 1 accounts") {
+		t.Fatalf("Passphrase import failed: %q", out)
+	}
+
+	// Recipient export to a file is binary.
+	identityPath := filepath.Join(tmpDir, "identity.txt")
+	root = setupTestCLI(vaultPath, "")
+	out, _ = executeCommand(root, "team", "keygen", "-o", identityPath)
+	recipient := regexp.MustCompile(`age1[a-z0-9]+`).FindString(out)
+
+	exportPath := filepath.Join(tmpDir, "export.age")
+	root = setupTestCLI(vaultPath, "password\n")
+	out, _ = executeCommand(root, "export", "--format", "age", "-r", recipient, "-o", exportPath)
+	if !strings.Contains(out, "Exported 1 accounts") {
+		t.Fatalf("Recipient export failed: %q", out)
+	}
+	data, _ := os.ReadFile(exportPath)
+	if !bytes.HasPrefix(data, []byte("age-encryption.org/v1\n")) {
+		t.Errorf("Expected a binary age file. Got: %q", data)
+	}
+
+	thirdPath := filepath.Join(tmpDir, "third.enc")
+	root = setupTestCLI(thirdPath, "password\npassword\n")
+	executeCommand(root, "init")
+
+	root = setupTestCLI(thirdPath, "password\n")
+	out, _ = executeCommand(root, "import", exportPath)
+	if !strings.Contains(out, "--age-identity") {
+		t.Errorf("Expected a missing identity error. Got: %q", out)
+	}
+	root = setupTestCLI(thirdPath, "password\n")
+	out, _ = executeCommand(root, "import", exportPath, "--format", "age", "--age-identity", identityPath)
+	if !strings.Contains(out, "Imported 1 accounts") {
+		t.Fatalf("Identity import failed: %q", out)
+	}
+	v, err := vault.LoadVault(thirdPath, []byte("password"))
+	if err != nil || len(v.Accounts) != 1 {
+		t.Fatalf("Imported account mismatch: %v", err)
+	}
+	if secret, err := v.OpenSecret(&v.Accounts[0]); err != nil || string(secret.Bytes()) != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("Imported secret mismatch: %v", err)
+	}
+}
+
+func TestCLIAgent(t *testing.T) {
+	tmpDir := t.TempDir()
+	vaultPath := filepath.Join(tmpDir, "vault.enc")
+
+	root := setupTestCLI(vaultPath, "")
+	out, _ := executeCommand(root, "lock")
+	if !strings.Contains(out, "not running") {
+		t.Errorf("Expected the agent to be reported as not running. Got: %q", out)
+	}
+
+	agentDir, _ := os.MkdirTemp("", "gotp-agent")
+	defer os.RemoveAll(agentDir)
+	socketPath := filepath.Join(agentDir, "agent.sock")
+	t.Setenv(agent.SocketEnv, socketPath)
+	server := agent.NewServer(0)
+	if err := server.Listen(socketPath); err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.Serve()
+	}()
+
+	root = setupTestCLI(vaultPath, "password\npassword\n")
+	executeCommand(root, "init")
+	root = setupTestCLI(vaultPath, "password\n")
+	executeCommand(root, "add", "GitHub", "--secret", "JBSWY3DPEHPK3PXP")
+
+	// The agent holds the key, so the next command does not prompt.
+	ui.In = strings.NewReader("")
+	ui.Out = new(bytes.Buffer)
+	out, _ = executeCommand(root, "get", "GitHub")
+	if !regexp.MustCompile(`\d{6}`).MatchString(out) {
+		t.Errorf("Expected a code from the agent's key. Got: %q", out)
+	}
+
+	// Sessions are per vault.
+	otherPath := filepath.Join(tmpDir, "other.enc")
+	root = setupTestCLI(otherPath, "other\nother\n")
+	executeCommand(root, "init")
+	if key, _ := vault.GetSession(otherPath); key != nil {
+		t.Error("Another vault should not share the session")
+	}
+	root = setupTestCLI(otherPath, "other\n")
+	out, _ = executeCommand(root, "unlock", "--for", "1h")
+	if !strings.Contains(out, "unlocked until") {
+		t.Fatalf("Expected the vault to be unlocked. Got: %q", out)
+	}
+
+	config.SetVaultPathOverride(vaultPath)
+	ui.Out = new(bytes.Buffer)
+	out, _ = executeCommand(root, "status")
+	if !strings.Contains(out, "vault.enc (current)") || !strings.Contains(out, "other.enc") || !strings.Contains(out, "Total: 2") {
+		t.Errorf("Expected both vaults in the status. Got: %q", out)
+	}
+
+	ui.Out = new(bytes.Buffer)
+	out, _ = executeCommand(root, "lock")
+	if !strings.Contains(out, "vault.enc locked") {
+		t.Errorf("Expected the vault to be locked. Got: %q", out)
+	}
+	if key, _ := vault.GetSession(vaultPath); key != nil {
+		t.Error("The agent should forget the key on lock")
+	}
+	key, _ := vault.GetSession(otherPath)
+	if key == nil {
+		t.Error("Locking one vault should leave the other unlocked")
+	}
+	key.Destroy()
+
+	ui.Out = new(bytes.Buffer)
+	out, _ = executeCommand(root, "lock", "--all")
+	if !strings.Contains(out, "All vaults locked") {
+		t.Errorf("Expected all vaults to be locked. Got: %q", out)
+	}
+	ui.Out = new(bytes.Buffer)
+	out, _ = executeCommand(root, "status", "--json")
+	if !strings.Contains(out, `"agent_running":true`) || !strings.Contains(out, `"sessions":[]`) {
+		t.Errorf("Expected no sessions. Got: %q", out)
+	}
+
+	// A session timeout of zero disables sessions.
+	vault.SetSessionTimeout(0)
+	root = setupTestCLI(vaultPath, "password\n")
+	executeCommand(root, "list")
+	vault.SetSessionTimeout(vault.DefaultSessionTimeout)
+	if key, _ := vault.GetSession(vaultPath); key != nil {
+		t.Error("No session should be saved with a zero timeout")
+	}
+
+	ui.Out = new(bytes.Buffer)
+	out, _ = executeCommand(root, "agent", "stop")
+	if !strings.Contains(out, "Stopped gotp agent") {
+		t.Errorf("Expected the agent to stop. Got: %q", out)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The agent did not exit")
+	}
+}
+
+func TestCLIPin(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	vaultPath := filepath.Join(t.TempDir(), "vault.enc")
+
+	root := setupTestCLI(vaultPath, "password\npassword\n")
+	executeCommand(root, "init")
+	root = setupTestCLI(vaultPath, "password\n")
+	executeCommand(root, "add", "GitHub", "--secret", "JBSWY3DPEHPK3PXP")
+
+	// The PIN is kept by the agent.
+	root = setupTestCLI(vaultPath, "password\n246813\n246813\n")
+	out, _ := executeCommand(root, "pin", "set")
+	if !strings.Contains(out, "gotp agent") || !strings.Contains(out, "not running") {
+		t.Errorf("Expected an error without an agent. Got: %q", out)
+	}
+
+	agentDir, _ := os.MkdirTemp("", "gotp-agent")
+	defer os.RemoveAll(agentDir)
+	socketPath := filepath.Join(agentDir, "agent.sock")
+	t.Setenv(agent.SocketEnv, socketPath)
+	server := agent.NewServer(0)
+	if err := server.Listen(socketPath); err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	go server.Serve()
+	defer server.Close()
+
+	// get runs with the session cleared, as after it expires.
+	get := func(input string) string {
+		_ = vault.ClearSession(vaultPath)
+		root := setupTestCLI(vaultPath, input)
+		out, _ := executeCommand(root, "get", "GitHub")
+		return out
+	}
+
+	root = setupTestCLI(vaultPath, "password\n246813\n135724\n")
+	out, _ = executeCommand(root, "pin", "set")
+	if !strings.Contains(out, "PINs do not match") {
+		t.Errorf("Expected a mismatch error. Got: %q", out)
+	}
+	root = setupTestCLI(vaultPath, "password\n246813\n246813\n")
+	out, _ = executeCommand(root, "pin", "set", "--for", "1h", "--attempts", "2")
+	if !strings.Contains(out, "PIN set until") {
+		t.Fatalf("Expected the PIN to be set. Got: %q", out)
+	}
+
+	if out := get("246813\n"); !regexp.MustCompile(`\d{6}`).MatchString(out) {
+		t.Errorf("Expected a code after unlocking with the PIN. Got: %q", out)
+	}
+	if out := get("000000\n"); !strings.Contains(out, "wrong PIN (1 attempts left)") {
+		t.Errorf("Expected a wrong PIN error. Got: %q", out)
+	}
+	if out := get("000000\n"); !strings.Contains(out, "too many wrong PINs") {
+		t.Errorf("Expected the PIN to be destroyed. Got: %q", out)
+	}
+	if state, _ := vault.GetPIN(vaultPath); state != nil {
+		t.Error("The PIN should be destroyed")
+	}
+
+	root = setupTestCLI(vaultPath, "password\n246813\n246813\n")
+	executeCommand(root, "pin", "set")
+	root = setupTestCLI(vaultPath, "")
+	out, _ = executeCommand(root, "pin", "remove")
+	if !strings.Contains(out, "PIN removed") {
+		t.Errorf("Expected the PIN to be removed. Got: %q", out)
+	}
+	if state, _ := vault.GetPIN(vaultPath); state != nil {
+		t.Error("The PIN should be removed")
+	}
+}
+
+// memKeyring stands in for the desktop keyring.
+type memKeyring struct {
+	keys map[string][]byte
+	err  error
+}
+
+func (k *memKeyring) Name() string { return "keyring" }
+
+func (k *memKeyring) Get(vault string) (*crypto.SecureBuffer, error) {
+	if key, ok := k.keys[vault]; ok {
+		return crypto.NewSecureBufferFrom(key)
+	}
+	return nil, nil
+}
+
+func (k *memKeyring) Put(vault string, key []byte, _ time.Duration) error {
+	if k.err != nil {
+		return k.err
+	}
+	k.keys[vault] = append([]byte(nil), key...)
+	return nil
+}
+
+func (k *memKeyring) Delete(vault string) error {
+	delete(k.keys, vault)
+	return nil
+}
+
+func TestCLIKeyring(t *testing.T) {
+	vaultPath := filepath.Join(t.TempDir(), "vault.enc")
+	store := &memKeyring{keys: make(map[string][]byte)}
+	keyringStore = store
+	vault.SetKeyStores(vault.AgentStore, store)
+	t.Cleanup(func() {
+		keyringStore = keyring.SecretService{}
+		vault.SetKeyStores(vault.AgentStore)
+	})
+
+	root := setupTestCLI(vaultPath, "password\npassword\n")
+	executeCommand(root, "init")
+	root = setupTestCLI(vaultPath, "password\n")
+	executeCommand(root, "add", "GitHub", "--secret", "JBSWY3DPEHPK3PXP")
+
+	root = setupTestCLI(vaultPath, "wrong\n")
+	out, _ := executeCommand(root, "keyring", "enable")
+	if !strings.Contains(out, "invalid master password") || len(store.keys) != 0 {
+		t.Errorf("Expected enable to require the password. Got: %q", out)
+	}
+
+	root = setupTestCLI(vaultPath, "password\n")
+	out, _ = executeCommand(root, "keyring", "enable")
+	if !strings.Contains(out, "Vault key stored in the keyring") {
+		t.Fatalf("Expected the key to be stored. Got: %q", out)
+	}
+
+	// The keyring opens the vault without a prompt.
+	root = setupTestCLI(vaultPath, "")
+	out, _ = executeCommand(root, "get", "GitHub")
+	if !regexp.MustCompile(`\d{6}`).MatchString(out) || strings.Contains(out, "Error") {
+		t.Errorf("Expected a code without a password. Got: %q", out)
+	}
+
+	root = setupTestCLI(vaultPath, "")
+	out, _ = executeCommand(root, "keyring", "disable")
+	if !strings.Contains(out, "Vault key removed from the keyring") || len(store.keys) != 0 {
+		t.Errorf("Expected the key to be removed. Got: %q", out)
+	}
+	root = setupTestCLI(vaultPath, "")
+	out, _ = executeCommand(root, "get", "GitHub")
+	if !strings.Contains(out, "Error") {
+		t.Errorf("Expected a password prompt after disable. Got: %q", out)
+	}
+
+	// Without a desktop keyring, the key goes to a session file.
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(vault.SessionKeyEnv, "")
+	vault.SetKeyStores(vault.AgentStore, store, vault.FileStore)
+	store.err = keyring.ErrUnavailable
+	root = setupTestCLI(vaultPath, "password\n")
+	out, _ = executeCommand(root, "keyring", "enable", "--for", "1h")
+	if !strings.Contains(out, "Vault key stored in a session file") || !strings.Contains(out, "export "+vault.SessionKeyEnv+"=") {
+		t.Errorf("Expected the session file fallback. Got: %q", out)
+	}
+	root = setupTestCLI(vaultPath, "")
+	out, _ = executeCommand(root, "get", "GitHub")
+	if !regexp.MustCompile(`\d{6}`).MatchString(out) || strings.Contains(out, "Error") {
+		t.Errorf("Expected a code from the session file. Got: %q", out)
+	}
+
+	// Another shell without the session key is prompted.
+	t.Setenv(vault.SessionKeyEnv, "")
+	root = setupTestCLI(vaultPath, "")
+	out, _ = executeCommand(root, "get", "GitHub")
+	if !strings.Contains(out, "Error") {
+		t.Errorf("Expected a password prompt without the session key. Got: %q", out)
+	}
+}
+
+func TestCLISSHAgentSlot(t *testing.T) {
+	vaultPath := filepath.Join(t.TempDir(), "vault.enc")
+	root := setupTestCLI(vaultPath, "password\npassword\n")
+	executeCommand(root, "init")
+	root = setupTestCLI(vaultPath, "password\n")
+	executeCommand(root, "add", "GitHub", "--secret", "JBSWY3DPEHPK3PXP")
+
+	root = setupTestCLI(vaultPath, "password\n")
+	out, _ := executeCommand(root, "slot", "add", "ssh-agent")
+	if !strings.Contains(out, "no ssh-agent is running") {
+		t.Errorf("Expected an error without ssh-agent. Got: %q", out)
+	}
+
+	// Serve an in-memory ssh-agent.
+	sockPath := filepath.Join(t.TempDir(), "ssh-agent.sock")
+	l, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	keyring := sshagent.NewKeyring()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = sshagent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", sockPath)
+
+	root = setupTestCLI(vaultPath, "password\n")
+	out, _ = executeCommand(root, "slot", "add", "ssh-agent")
+	if !strings.Contains(out, "ssh-agent holds no Ed25519 key") {
+		t.Errorf("Expected an error without Ed25519 keys. Got: %q", out)
+	}
+
+	for _, comment := range []string{"alice@laptop", "alice@desktop"} {
+		_, priv, _ := ed25519.GenerateKey(rand.Reader)
+		_ = keyring.Add(sshagent.AddedKey{PrivateKey: priv, Comment: comment})
+	}
+	root = setupTestCLI(vaultPath, "password\n")
+	out, _ = executeCommand(root, "slot", "add", "ssh-agent")
+	if !strings.Contains(out, "several Ed25519 keys") {
+		t.Errorf("Expected a choice between keys. Got: %q", out)
+	}
+	root = setupTestCLI(vaultPath, "password\n")
+	out, _ = executeCommand(root, "slot", "add", "ssh-agent", "--ssh-key", "alice@laptop")
+	if !strings.Contains(out, "Added ssh-agent slot") {
+		t.Fatalf("Expected the slot to be added. Got: %q", out)
+	}
+
+	root = setupTestCLI(vaultPath, "password\n")
+	out, _ = executeCommand(root, "slot", "list")
+	if !strings.Contains(out, "ssh-agent") || !strings.Contains(out, "alice@laptop") {
+		t.Errorf("Expected the slot to be listed. Got: %q", out)
+	}
+
+	// The agent unlocks the vault without a prompt.
+	root = setupTestCLI(vaultPath, "")
+	out, _ = executeCommand(root, "get", "GitHub")
+	if !regexp.MustCompile(`\d{6}`).MatchString(out) || strings.Contains(out, "Error") {
+		t.Errorf("Expected a code without a password. Got: %q", out)
+	}
+
+	// Without the key in the agent, the password is needed.
+	keys, _ := keyring.List()
+	for _, k := range keys {
+		if k.Comment == "alice@laptop" {
+			pub, _ := ssh.ParsePublicKey(k.Marshal())
+			_ = keyring.Remove(pub)
+		}
+	}
+	root = setupTestCLI(vaultPath, "")
+	out, _ = executeCommand(root, "get", "GitHub")
+	if !strings.Contains(out, "Error") {
+		t.Errorf("Expected a password prompt without the key. Got: %q", out)
+	}
+}
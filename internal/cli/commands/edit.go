@@ -14,6 +14,7 @@ import (
 
 func NewEditCmd() *cobra.Command {
 	var newName, username, issuer, secret string
+	var digits int
 	var tags, addTags, removeTags []string
 
 	cmd := &cobra.Command{
@@ -39,6 +40,7 @@ func NewEditCmd() *cobra.Command {
 				fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
 				return nil
 			}
+			defer v.Destroy()
 
 			index := -1
 			for i := range v.Accounts {
@@ -59,6 +61,7 @@ func NewEditCmd() *cobra.Command {
 				cmd.Flags().Changed("username") ||
 				cmd.Flags().Changed("issuer") ||
 				cmd.Flags().Changed("secret") ||
+				cmd.Flags().Changed("digits") ||
 				cmd.Flags().Changed("tags") ||
 				cmd.Flags().Changed("add-tag") ||
 				cmd.Flags().Changed("remove-tag")
@@ -120,6 +123,17 @@ func NewEditCmd() *cobra.Command {
 						acc.Secret = vault.Secret(strings.ToUpper(strings.ReplaceAll(secret, " ", "")))
 					}
 				}
+				if cmd.Flags().Changed("digits") {
+					if acc.IsOCRA() {
+						fmt.Fprintf(ui.Out, "%sError: The response length of an OCRA account is set by its suite%s\n", ui.DangerBright, ui.Reset)
+						return nil
+					}
+					acc.Digits = digits
+					if err := acc.Validate(); err != nil {
+						fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+						return nil
+					}
+				}
 				if len(tags) > 0 {
 					acc.Tags = tags
 				}
@@ -146,8 +160,27 @@ func NewEditCmd() *cobra.Command {
 			}
 
 		save:
-			if err := vault.SaveVaultWithKey(vaultPath, v, key); err != nil {
-				fmt.Fprintf(ui.Out, "%sError: Failed to save vault: %v%s\n", ui.DangerBright, err, ui.Reset)
+			// Apply the edited fields to the account as it is on disk now.
+			edited := *acc
+			ok := updateVault(vaultPath, key, func(v *vault.Vault) error {
+				index := v.FindAccount(edited.ID)
+				if index == -1 {
+					fmt.Fprintf(ui.Out, "%sError: Account %q not found%s\n", ui.DangerBright, name, ui.Reset)
+					return errReported
+				}
+				acc := &v.Accounts[index]
+				acc.Name = edited.Name
+				acc.Issuer = edited.Issuer
+				acc.Username = edited.Username
+				acc.Digits = edited.Digits
+				acc.Tags = edited.Tags
+				if len(edited.Secret) > 0 {
+					acc.Secret = edited.Secret
+					acc.SealedSecret = nil
+				}
+				return nil
+			})
+			if !ok {
 				return nil
 			}
 
@@ -160,6 +193,7 @@ func NewEditCmd() *cobra.Command {
 	cmd.Flags().StringVar(&username, "username", "", "New username")
 	cmd.Flags().StringVar(&issuer, "issuer", "", "New issuer")
 	cmd.Flags().StringVar(&secret, "secret", "", "New secret")
+	cmd.Flags().IntVar(&digits, "digits", 0, "New number of code digits (1-10)")
 	cmd.Flags().StringSliceVar(&tags, "tags", []string{}, "Replace tags")
 	cmd.Flags().StringSliceVar(&addTags, "add-tag", []string{}, "Add tags")
 	cmd.Flags().StringSliceVar(&removeTags, "remove-tag", []string{}, "Remove tags")
@@ -0,0 +1,267 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/zulfikawr/gotp/internal/cli/ui"
+	"github.com/zulfikawr/gotp/internal/config"
+	"github.com/zulfikawr/gotp/internal/crypto"
+	"github.com/zulfikawr/gotp/internal/qr"
+	"github.com/zulfikawr/gotp/internal/vault"
+)
+
+func NewEscrowCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "escrow",
+		Short: "Split the vault key for emergency access",
+		Long:  `Split the vault's master key into Shamir shares for break-glass access, and recover the vault from them. Any threshold of the shares recovers the key; fewer reveal nothing about it. Everything happens offline.`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+
+	cmd.AddCommand(newEscrowSplitCmd())
+	cmd.AddCommand(newEscrowRecoverCmd())
+	return cmd
+}
+
+func newEscrowSplitCmd() *cobra.Command {
+	var shares, threshold int
+	var format, outputDir string
+
+	cmd := &cobra.Command{
+		Use:   "split",
+		Short: "Split the vault key into shares",
+		Long: `Split the vault's master key into Shamir shares, any threshold of which recover the vault with 'gotp escrow recover'. Give each share to a different person and store it offline.
+
+Shares are printed as text, or with --format qr as QR codes. With --output-dir, each share is written to its own file instead.
+
+Examples:
+  gotp escrow split --shares 5 --threshold 3
+  gotp escrow split --shares 5 --threshold 3 --format qr --output-dir ./shares`,
+		Args:  cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			isJSON, _ := cmd.Flags().GetBool("json")
+
+			if format != "text" && format != "qr" {
+				fmt.Fprintf(ui.Out, "%sError: Unsupported format: %s%s\n", ui.DangerBright, format, ui.Reset)
+				fmt.Fprintf(ui.Out, "%sTip: Use 'text' or 'qr'.%s\n", ui.TextMuted, ui.Reset)
+				return nil
+			}
+
+			v, key, _ := loadSlotVault()
+			if v == nil {
+				return nil
+			}
+			defer v.Destroy()
+
+			encoded, err := vault.SplitKey(key, shares, threshold)
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: Failed to split the vault key: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+
+			if outputDir != "" {
+				if err := os.MkdirAll(outputDir, 0700); err != nil {
+					fmt.Fprintf(ui.Out, "%sError: Failed to create output directory: %v%s\n", ui.DangerBright, err, ui.Reset)
+					return nil
+				}
+				for i, share := range encoded {
+					var data []byte
+					name := fmt.Sprintf("share-%d-of-%d", i+1, shares)
+					if format == "qr" {
+						name += ".png"
+						data, err = qr.GenerateQRCode(share, 512)
+						if err != nil {
+							fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+							return nil
+						}
+					} else {
+						name += ".txt"
+						data = []byte(share + "\n")
+					}
+					path := filepath.Join(outputDir, name)
+					if err := os.WriteFile(path, data, 0600); err != nil {
+						fmt.Fprintf(ui.Out, "%sError: Failed to write share: %v%s\n", ui.DangerBright, err, ui.Reset)
+						return nil
+					}
+					fmt.Fprintf(ui.Out, "%s✓ Wrote share %d to %s%s\n", ui.SuccessBright, i+1, path, ui.Reset)
+				}
+			} else if isJSON {
+				type shareInfo struct {
+					Index     int    `json:"index"`
+					Threshold int    `json:"threshold"`
+					Share     string `json:"share"`
+				}
+				var out []shareInfo
+				for i, share := range encoded {
+					out = append(out, shareInfo{i + 1, threshold, share})
+				}
+				data, _ := json.Marshal(out)
+				fmt.Fprintln(ui.Out, string(data))
+				return nil
+			} else {
+				for i, share := range encoded {
+					fmt.Fprintf(ui.Out, "\n%sShare %d of %d%s\n", ui.PrimaryBright+ui.Bold, i+1, shares, ui.Reset)
+					if format == "qr" {
+						if err := qr.GenerateQRCodeToTerminal(share); err != nil {
+							fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+							return nil
+						}
+					}
+					fmt.Fprintln(ui.Out, share)
+				}
+				fmt.Fprintln(ui.Out)
+			}
+
+			fmt.Fprintf(ui.Out, "%sAny %d of these %d shares recover the vault. Hand them to different people and keep them offline; they stay valid until the vault key changes.%s\n", ui.WarningBright, threshold, shares, ui.Reset)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&shares, "shares", 5, "Number of shares to create")
+	cmd.Flags().IntVar(&threshold, "threshold", 3, "Number of shares needed to recover")
+	cmd.Flags().StringVar(&format, "format", "text", "Share format (text, qr)")
+	cmd.Flags().StringVarP(&outputDir, "output-dir", "o", "", "Write each share to a file in this directory")
+	return cmd
+}
+
+func newEscrowRecoverCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "recover [share|file...]",
+		Short: "Recover the vault from shares",
+		Long: `Recover the vault's master key from escrow shares and set a new master password. Each argument is a share, a text file holding one, or a QR code image of one; missing shares are prompted for. The new password replaces the vault's password slots; recovery key and keyfile slots are kept.
+
+Examples:
+  gotp escrow recover
+  gotp escrow recover share-1-of-5.png share-3-of-5.txt`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vaultPath := config.GetVaultPath()
+
+			// Check if vault exists first
+			if _, err := os.Stat(vaultPath); os.IsNotExist(err) {
+				fmt.Fprintf(ui.Out, "%sError: Vault file not found at %s%s\n", ui.DangerBright, vaultPath, ui.Reset)
+				fmt.Fprintf(ui.Out, "%sTip: Run '%s%sgotp %sinit%s' to create a new secure vault.%s\n", ui.TextMuted, ui.Reset, ui.SuccessBright, ui.WarningBright, ui.TextMuted, ui.Reset)
+				return nil
+			}
+
+			var shares []*vault.EscrowShare
+			seen := map[int]bool{}
+			addShare := func(s string) bool {
+				share, err := vault.ParseShare(s)
+				if err != nil {
+					fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+					return false
+				}
+				if seen[share.Index] {
+					fmt.Fprintf(ui.Out, "%sWarning: share %d was already given%s\n", ui.WarningBright, share.Index, ui.Reset)
+					return true
+				}
+				seen[share.Index] = true
+				shares = append(shares, share)
+				return true
+			}
+
+			for _, arg := range args {
+				text, err := readShareArg(arg)
+				if err != nil {
+					fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+					return nil
+				}
+				if !addShare(text) {
+					return nil
+				}
+			}
+
+			for len(shares) == 0 || len(shares) < shares[0].Threshold {
+				prompt := "Enter share: "
+				if len(shares) > 0 {
+					prompt = fmt.Sprintf("Enter share %d of %d: ", len(shares)+1, shares[0].Threshold)
+				}
+				input, err := ui.PromptPassword(prompt)
+				if err != nil {
+					return err
+				}
+				if !addShare(string(input)) {
+					return nil
+				}
+			}
+
+			key, err := vault.CombineShares(shares)
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			defer crypto.ZeroBytes(key)
+
+			v, err := vault.LoadVaultWithKey(vaultPath, key)
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: The shares do not unlock this vault: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			fmt.Fprintf(ui.Out, "%s✓ Vault key recovered from %d shares%s\n", ui.SuccessBright, len(shares), ui.Reset)
+
+			newPassword, err := ui.PromptPassword("Enter new master password: ")
+			if err != nil {
+				return err
+			}
+			confirm, err := ui.PromptPassword("Confirm new master password: ")
+			if err != nil {
+				return err
+			}
+			if !crypto.SecureCompare(newPassword, confirm) {
+				fmt.Fprintf(ui.Out, "%sError: Passwords do not match%s\n", ui.DangerBright, ui.Reset)
+				return nil
+			}
+
+			slot, err := vault.NewPasswordSlot(key, newPassword, v.KDFParams)
+			crypto.ZeroBytes(newPassword)
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: Failed to create password slot: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			ok := updateVault(vaultPath, key, func(v *vault.Vault) error {
+				slots := []vault.KeySlot{*slot}
+				for _, s := range v.Slots {
+					if s.Type != vault.SlotPassword {
+						slots = append(slots, s)
+					}
+				}
+				v.Slots = slots
+				return nil
+			})
+			if !ok {
+				return nil
+			}
+			_ = vault.ClearSession(vaultPath)
+
+			fmt.Fprintf(ui.Out, "%s✓ Master password set; the vault is recovered%s\n", ui.SuccessBright, ui.Reset)
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// readShareArg returns the share given as an argument: the argument itself,
+// or the contents of the text file or QR code image it names.
+func readShareArg(arg string) (string, error) {
+	if _, err := os.Stat(arg); err != nil {
+		return arg, nil
+	}
+	if text, err := qr.ParseImageFile(arg); err == nil {
+		return text, nil
+	}
+	data, err := os.ReadFile(arg)
+	if err != nil {
+		return "", fmt.Errorf("failed to read share file: %w", err)
+	}
+	return string(data), nil
+}
@@ -6,19 +6,28 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
+	"github.com/zulfikawr/gotp/internal/age"
 	"github.com/zulfikawr/gotp/internal/cli/ui"
 	"github.com/zulfikawr/gotp/internal/config"
 	"github.com/zulfikawr/gotp/internal/crypto"
 	"github.com/zulfikawr/gotp/internal/vault"
 )
 
+// ageWorkFactor is the scrypt work factor of passphrase-protected age
+// exports.
+var ageWorkFactor = age.DefaultScryptWorkFactor
+
 func NewExportCmd() *cobra.Command {
 	var format, outputPath string
+	var recipients []string
+	var armor bool
 
 	cmd := &cobra.Command{
 		Use:   "export",
 		Short: "Export accounts for backup",
-		Long:  `Export your stored accounts for backup or migration. Supports JSON, otpauth:// URIs, and password-protected encrypted formats.`,
+		Long:  `Export your stored accounts for backup or migration. Supports JSON, otpauth:// URIs, password-protected encrypted formats, and age.
+
+The age format encrypts the JSON export with a passphrase, or to the X25519 public keys given with --recipient, so that it can be decrypted with stock age tooling. It is ASCII armored when written to stdout.`,
 		SilenceUsage:  true,
 		SilenceErrors: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -31,11 +40,42 @@ func NewExportCmd() *cobra.Command {
 				return nil
 			}
 
+			var ageRecipients []age.Recipient
+			for _, r := range recipients {
+				pub, err := crypto.ParseRecipient(r)
+				if err != nil {
+					fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+					return nil
+				}
+				recipient, err := age.NewX25519Recipient(pub)
+				if err != nil {
+					fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+					return nil
+				}
+				ageRecipients = append(ageRecipients, recipient)
+			}
+			if len(ageRecipients) > 0 && format != "age" {
+				fmt.Fprintf(ui.Out, "%sError: --recipient requires --format age%s\n", ui.DangerBright, ui.Reset)
+				return nil
+			}
+
 			v, _, err := vault.LoadVaultInteractive(vaultPath, ui.PromptPassword)
 			if err != nil {
 				fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
 				return nil
 			}
+			defer v.Destroy()
+
+			accounts, err := v.RevealAccounts()
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			defer func() {
+				for i := range accounts {
+					crypto.ZeroBytes(accounts[i].Secret)
+				}
+			}()
 
 			var output []byte
 			switch format {
@@ -44,7 +84,7 @@ func NewExportCmd() *cobra.Command {
 					fmt.Fprintln(ui.Out, "Export cancelled.")
 					return nil
 				}
-				output, err = json.MarshalIndent(v.Accounts, "", "  ")
+				output, err = json.MarshalIndent(accounts, "", "  ")
 				if err != nil {
 					fmt.Fprintf(ui.Out, "%sError: Failed to marshal JSON: %v%s\n", ui.DangerBright, err, ui.Reset)
 					return nil
@@ -55,7 +95,7 @@ func NewExportCmd() *cobra.Command {
 					return nil
 				}
 				var uris string
-				for _, acc := range v.Accounts {
+				for _, acc := range accounts {
 					uris += acc.ToURI() + "\n"
 				}
 				output = []byte(uris)
@@ -72,24 +112,56 @@ func NewExportCmd() *cobra.Command {
 
 				salt, _ := crypto.GenerateSalt(16)
 				exportVault := vault.NewVault(salt)
-				exportVault.Accounts = v.Accounts
+				exportVault.Accounts = accounts
 
-				ciphertext, err := exportVault.Marshal(exportPass)
+				metadata, err := exportVault.SealWithPassword(exportPass)
 				if err != nil {
 					fmt.Fprintf(ui.Out, "%sError: Encryption failed: %v%s\n", ui.DangerBright, err, ui.Reset)
 					return nil
 				}
+				output, _ = json.Marshal(metadata)
 
-				metadata := vault.VaultMetadata{
-					Salt:       exportVault.Salt,
-					KDFParams:  exportVault.KDFParams,
-					Ciphertext: ciphertext,
+			case "age":
+				if len(ageRecipients) == 0 {
+					exportPass, err := ui.PromptPassword("Enter passphrase for age export: ")
+					if err != nil {
+						return err
+					}
+					confirmPass, _ := ui.PromptPassword("Confirm export passphrase: ")
+					if !crypto.SecureCompare(exportPass, confirmPass) {
+						fmt.Fprintf(ui.Out, "%sError: Passphrases do not match%s\n", ui.DangerBright, ui.Reset)
+						return nil
+					}
+					if len(exportPass) == 0 {
+						fmt.Fprintf(ui.Out, "%sError: Passphrase cannot be empty%s\n", ui.DangerBright, ui.Reset)
+						return nil
+					}
+					r, err := age.NewScryptRecipient(exportPass, ageWorkFactor)
+					if err != nil {
+						fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+						return nil
+					}
+					ageRecipients = append(ageRecipients, r)
+				}
+
+				plaintext, err := json.MarshalIndent(accounts, "", "  ")
+				if err != nil {
+					fmt.Fprintf(ui.Out, "%sError: Failed to marshal JSON: %v%s\n", ui.DangerBright, err, ui.Reset)
+					return nil
+				}
+				output, err = age.Encrypt(plaintext, ageRecipients...)
+				crypto.ZeroBytes(plaintext)
+				if err != nil {
+					fmt.Fprintf(ui.Out, "%sError: Encryption failed: %v%s\n", ui.DangerBright, err, ui.Reset)
+					return nil
+				}
+				if armor || outputPath == "" {
+					output = age.Armor(output)
 				}
-				output, _ = json.Marshal(metadata)
 
 			default:
 				fmt.Fprintf(ui.Out, "%sError: Unsupported format: %s%s\n", ui.DangerBright, format, ui.Reset)
-				fmt.Fprintf(ui.Out, "%sTip: Use 'json', 'uri', or 'encrypted'.%s\n", ui.TextMuted, ui.Reset)
+				fmt.Fprintf(ui.Out, "%sTip: Use 'json', 'uri', 'encrypted', or 'age'.%s\n", ui.TextMuted, ui.Reset)
 				return nil
 			}
 
@@ -100,6 +172,8 @@ func NewExportCmd() *cobra.Command {
 					return nil
 				}
 				fmt.Fprintf(ui.Out, "%s✓ Exported %d accounts to %s%s\n", ui.SuccessBright, len(v.Accounts), outputPath, ui.Reset)
+			} else if format == "age" {
+				fmt.Fprint(ui.Out, string(output))
 			} else {
 				fmt.Fprintln(ui.Out, string(output))
 			}
@@ -107,8 +181,10 @@ func NewExportCmd() *cobra.Command {
 		},
 	}
 
-	cmd.Flags().StringVar(&format, "format", "json", "Export format (json, uri, encrypted)")
+	cmd.Flags().StringVar(&format, "format", "json", "Export format (json, uri, encrypted, age)")
 	cmd.Flags().StringVarP(&outputPath, "output", "o", "", "Output file path (default: stdout)")
+	cmd.Flags().StringArrayVarP(&recipients, "recipient", "r", nil, "Encrypt an age export to this X25519 public key instead of a passphrase (repeatable)")
+	cmd.Flags().BoolVarP(&armor, "armor", "a", false, "ASCII armor an age export written to a file")
 
 	return cmd
 }
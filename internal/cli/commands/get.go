@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,20 +13,20 @@ import (
 	"github.com/zulfikawr/gotp/internal/cli/ui"
 	"github.com/zulfikawr/gotp/internal/clipboard"
 	"github.com/zulfikawr/gotp/internal/config"
-	"github.com/zulfikawr/gotp/internal/totp"
 	"github.com/zulfikawr/gotp/internal/vault"
-	"github.com/zulfikawr/gotp/pkg/base32"
 )
 
 func NewGetCmd() *cobra.Command {
 	var copyToClipboard bool
 	var timeout int
 	var watch bool
+	var at string
+	var next, prev int
 
 	cmd := &cobra.Command{
 		Use:   "get <name>",
 		Short: "Get TOTP code for an account",
-		Long:  `Generate and display the current Time-based One-Time Password (TOTP) code for a stored account. Includes a live-updating watch mode and clipboard integration.`,
+		Long:  `Generate and display the current Time-based One-Time Password (TOTP) code for a stored account. Includes a live-updating watch mode and clipboard integration. For counter-based (HOTP) accounts, each call consumes the next counter value and saves it to the vault before the code is shown. Use --at, --next and --prev to print a schedule of codes with their validity windows.`,
 		Args:  cobra.ExactArgs(1),
 		SilenceUsage:  true,
 		SilenceErrors: true,
@@ -41,11 +42,12 @@ func NewGetCmd() *cobra.Command {
 				return nil
 			}
 
-			v, _, err := vault.LoadVaultInteractive(vaultPath, ui.PromptPassword)
+			v, key, err := vault.LoadVaultInteractive(vaultPath, ui.PromptPassword)
 			if err != nil {
 				fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
 				return nil
 			}
+			defer v.Destroy()
 
 			var target *vault.Account
 			for i := range v.Accounts {
@@ -60,9 +62,130 @@ func NewGetCmd() *cobra.Command {
 				return nil
 			}
 
-			secretBytes, err := base32.Decode(string(target.Secret))
+			schedule := cmd.Flags().Changed("at") || next > 0 || prev > 0
+			if next < 0 || prev < 0 {
+				fmt.Fprintf(ui.Out, "%sError: --next and --prev must not be negative%s\n", ui.DangerBright, ui.Reset)
+				return nil
+			}
+			if schedule && watch {
+				fmt.Fprintf(ui.Out, "%sError: Watch mode is not compatible with --at, --next or --prev%s\n", ui.DangerBright, ui.Reset)
+				return nil
+			}
+
+			if target.IsOCRA() {
+				fmt.Fprintf(ui.Out, "%sError: Account %q is an OCRA challenge-response account%s\n", ui.DangerBright, target.Name, ui.Reset)
+				fmt.Fprintf(ui.Out, "%sTip: Run '%s%sgotp %schallenge%s <account> <question>' to answer a challenge.%s\n", ui.TextMuted, ui.Reset, ui.SuccessBright, ui.WarningBright, ui.TextMuted, ui.Reset)
+				return nil
+			}
+
+			gen, err := v.Generator(target)
 			if err != nil {
-				fmt.Fprintf(ui.Out, "%sError: Failed to decode secret: %v%s\n", ui.DangerBright, err, ui.Reset)
+				fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			defer gen.Destroy()
+
+			if target.IsHOTP() {
+				if watch {
+					fmt.Fprintf(ui.Out, "%sError: Watch mode is not available for counter-based (HOTP) accounts%s\n", ui.DangerBright, ui.Reset)
+					return nil
+				}
+				if schedule {
+					fmt.Fprintf(ui.Out, "%sError: --at, --next and --prev are only available for time-based (TOTP) accounts%s\n", ui.DangerBright, ui.Reset)
+					return nil
+				}
+
+				// Take the counter from the vault as it is on disk now and
+				// persist the advanced counter before revealing the code, so a
+				// code is never shown for a counter value the vault has not
+				// consumed, nor twice for the same value.
+				var counter uint64
+				var code string
+				ok := updateVault(vaultPath, key, func(v *vault.Vault) error {
+					index := v.FindAccount(target.ID)
+					if index == -1 {
+						fmt.Fprintf(ui.Out, "%sError: Account %q not found%s\n", ui.DangerBright, target.Name, ui.Reset)
+						return errReported
+					}
+					acc := &v.Accounts[index]
+					counter = acc.Counter
+					if code, err = gen.GenerateCounter(counter); err != nil {
+						fmt.Fprintf(ui.Out, "%sError: Failed to generate code: %v%s\n", ui.DangerBright, err, ui.Reset)
+						return errReported
+					}
+					acc.Counter = counter + 1
+					acc.LastUsedAt = time.Now()
+					return nil
+				})
+				if !ok {
+					return nil
+				}
+
+				if isJSON {
+					res := map[string]interface{}{
+						"account": target.Name,
+						"code":    code,
+						"counter": counter,
+					}
+					data, _ := json.Marshal(res)
+					fmt.Fprintln(ui.Out, string(data))
+				} else {
+					ui.PrintHOTPDisplay(target.Name, code, counter)
+				}
+
+				copyCode(code, copyToClipboard, timeout, isJSON)
+				return nil
+			}
+
+			if schedule {
+				base := time.Now()
+				if at != "" {
+					base, err = parseTimeFlag(at)
+					if err != nil {
+						fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+						fmt.Fprintf(ui.Out, "%sTip: Use an RFC 3339 time such as '%s2026-03-01T14:02:30Z%s' or a Unix timestamp.%s\n", ui.TextMuted, ui.InfoBright, ui.TextMuted, ui.Reset)
+						return nil
+					}
+				}
+
+				var current string
+				codes := []map[string]interface{}{}
+				rows := [][]string{}
+				for i := -prev; i <= next; i++ {
+					params := gen.Params(base.Add(time.Duration(i*target.Period) * time.Second))
+					code, err := gen.Generate(params.Timestamp)
+					if err != nil {
+						fmt.Fprintf(ui.Out, "%sError: Failed to generate code: %v%s\n", ui.DangerBright, err, ui.Reset)
+						return nil
+					}
+					if i == 0 {
+						current = code
+					}
+
+					from, until := params.ValidityWindow()
+					codes = append(codes, map[string]interface{}{
+						"offset":      i,
+						"code":        code,
+						"valid_from":  from.Format(time.RFC3339),
+						"valid_until": until.Format(time.RFC3339),
+					})
+					rows = append(rows, []string{fmt.Sprintf("%+d", i), code, from.Format(time.RFC3339), until.Format(time.RFC3339)})
+				}
+
+				if isJSON {
+					res := map[string]interface{}{
+						"account": target.Name,
+						"at":      base.Format(time.RFC3339),
+						"codes":   codes,
+					}
+					data, _ := json.Marshal(res)
+					fmt.Fprintln(ui.Out, string(data))
+				} else {
+					fmt.Fprintf(ui.Out, "%s%s%s\n", ui.PrimaryBright+ui.Bold, target.Name, ui.Reset)
+					ui.PrintTable([]string{"STEP", "CODE", "VALID FROM", "VALID UNTIL"}, rows)
+				}
+
+				copyCode(current, copyToClipboard, timeout, isJSON)
 				return nil
 			}
 
@@ -105,14 +228,8 @@ func NewGetCmd() *cobra.Command {
 						return nil
 					default:
 						now := time.Now()
-						code, _ := totp.GenerateTOTP(totp.TOTPParams{
-							Secret:    secretBytes,
-							Timestamp: now,
-							Period:    target.Period,
-							Digits:    target.Digits,
-							Algorithm: target.Algorithm,
-						})
-						remaining := totp.RemainingSeconds(now, target.Period)
+						code, _ := gen.Generate(now)
+						remaining := gen.Params(now).RemainingSeconds()
 
 						// Move to start of line, clear to end of screen, then print
 						fmt.Fprintf(ui.Out, "\r\033[J")
@@ -124,14 +241,8 @@ func NewGetCmd() *cobra.Command {
 				}
 			}
 
-			now := time.Now()
-			code, err := totp.GenerateTOTP(totp.TOTPParams{
-				Secret:    secretBytes,
-				Timestamp: now,
-				Period:    target.Period,
-				Digits:    target.Digits,
-				Algorithm: target.Algorithm,
-			})
+			params := gen.Params(time.Now())
+			code, err := gen.Generate(params.Timestamp)
 			if err != nil {
 				fmt.Fprintf(ui.Out, "%sError: Failed to generate code: %v%s\n", ui.DangerBright, err, ui.Reset)
 				return nil
@@ -145,17 +256,10 @@ func NewGetCmd() *cobra.Command {
 				data, _ := json.Marshal(res)
 				fmt.Fprintln(ui.Out, string(data))
 			} else {
-				remaining := totp.RemainingSeconds(now, target.Period)
-				ui.PrintCodeDisplay(target.Name, code, remaining, target.Period)
+				ui.PrintCodeDisplay(target.Name, code, params.RemainingSeconds(), target.Period)
 			}
 
-			if copyToClipboard {
-				if err := clipboard.WriteWithTimeout(code, time.Duration(timeout)*time.Second); err != nil {
-					fmt.Fprintf(ui.Out, "%sWarning: failed to copy to clipboard: %v%s\n", ui.WarningBright, err, ui.Reset)
-				} else if !isJSON {
-					fmt.Fprintf(ui.Out, "%s✓ Code copied to clipboard (clears in %ds)%s\n", ui.SuccessBright, timeout, ui.Reset)
-				}
-			}
+			copyCode(code, copyToClipboard, timeout, isJSON)
 			return nil
 		},
 	}
@@ -163,5 +267,32 @@ func NewGetCmd() *cobra.Command {
 	cmd.Flags().BoolVarP(&copyToClipboard, "copy", "c", false, "Copy code to clipboard")
 	cmd.Flags().IntVarP(&timeout, "timeout", "t", 30, "Clipboard clear timeout in seconds")
 	cmd.Flags().BoolVarP(&watch, "watch", "w", false, "Watch mode (continuous update)")
+	cmd.Flags().StringVar(&at, "at", "", "Generate codes for a fixed time (RFC 3339 or Unix timestamp)")
+	cmd.Flags().IntVar(&next, "next", 0, "Also show the next N codes")
+	cmd.Flags().IntVar(&prev, "prev", 0, "Also show the previous N codes")
 	return cmd
 }
+
+// parseTimeFlag parses a time given as RFC 3339 or as Unix seconds.
+func parseTimeFlag(s string) (time.Time, error) {
+	if unix, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", s)
+	}
+	return t, nil
+}
+
+// copyCode copies a generated code to the clipboard when requested.
+func copyCode(code string, copyToClipboard bool, timeout int, isJSON bool) {
+	if !copyToClipboard {
+		return
+	}
+	if err := clipboard.WriteWithTimeout(code, time.Duration(timeout)*time.Second); err != nil {
+		fmt.Fprintf(ui.Out, "%sWarning: failed to copy to clipboard: %v%s\n", ui.WarningBright, err, ui.Reset)
+	} else if !isJSON {
+		fmt.Fprintf(ui.Out, "%s✓ Code copied to clipboard (clears in %ds)%s\n", ui.SuccessBright, timeout, ui.Reset)
+	}
+}
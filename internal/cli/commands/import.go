@@ -3,25 +3,30 @@ package commands
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
+	"github.com/zulfikawr/gotp/internal/age"
 	"github.com/zulfikawr/gotp/internal/cli/ui"
 	"github.com/zulfikawr/gotp/internal/config"
+	"github.com/zulfikawr/gotp/internal/crypto"
 	"github.com/zulfikawr/gotp/internal/importers"
 	"github.com/zulfikawr/gotp/internal/vault"
 )
 
 func NewImportCmd() *cobra.Command {
-	var format string
+	var format, ageIdentity string
 
 	cmd := &cobra.Command{
 		Use:   "import <file>",
 		Short: "Import accounts from a file",
-		Long:  `Import TOTP accounts into your secure vault from a file. Supports Aegis, Authy, Google Authenticator, JSON, otpauth:// URIs, and password-protected encrypted exports.`,
+		Long:  `Import TOTP accounts into your secure vault from a file. Supports Aegis, Authy, Google Authenticator, JSON, otpauth:// URIs, password-protected encrypted exports, and age files.
+
+An age file, binary or armored, holds a JSON export. It is decrypted with a passphrase, or with the identity file given by --age-identity.`,
 		Args:  cobra.ExactArgs(1),
 		SilenceUsage:  true,
 		SilenceErrors: true,
@@ -41,6 +46,7 @@ func NewImportCmd() *cobra.Command {
 				fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
 				return nil
 			}
+			defer v.Destroy()
 
 			data, err := os.ReadFile(filePath)
 			if err != nil {
@@ -48,6 +54,11 @@ func NewImportCmd() *cobra.Command {
 				return nil
 			}
 
+			if format == "auto" && age.IsEncrypted(data) {
+				format = "age"
+				fmt.Fprintf(ui.Out, "%sDetected format: age%s\n", ui.InfoBright, ui.Reset)
+			}
+
 			var importedAccounts []vault.Account
 			switch format {
 			case "json":
@@ -93,12 +104,23 @@ func NewImportCmd() *cobra.Command {
 					return nil
 				}
 
-				impVault, err := vault.UnmarshalVault(metadata.Ciphertext, exportPass, metadata.Salt, metadata.KDFParams)
+				impVault, err := metadata.Decrypt(exportPass)
+				if err != nil {
+					fmt.Fprintf(ui.Out, "%sError: Import decryption failed: %v%s\n", ui.DangerBright, err, ui.Reset)
+					return nil
+				}
+				importedAccounts, err = impVault.RevealAccounts()
 				if err != nil {
 					fmt.Fprintf(ui.Out, "%sError: Import decryption failed: %v%s\n", ui.DangerBright, err, ui.Reset)
 					return nil
 				}
-				importedAccounts = impVault.Accounts
+
+			case "age":
+				importedAccounts, err = decryptAgeImport(data, ageIdentity)
+				if err != nil {
+					fmt.Fprintf(ui.Out, "%sError: age import failed: %v%s\n", ui.DangerBright, err, ui.Reset)
+					return nil
+				}
 
 			case "aegis":
 				importedAccounts, err = importers.ImportData(data, importers.FormatAegis)
@@ -136,48 +158,107 @@ func NewImportCmd() *cobra.Command {
 				return nil
 			}
 
-			count := 0
-			skipped := 0
+			var valid []vault.Account
 			for _, impAcc := range importedAccounts {
-				isDuplicate := false
-				for _, existing := range v.Accounts {
-					if strings.EqualFold(existing.Name, impAcc.Name) &&
-						strings.EqualFold(existing.Issuer, impAcc.Issuer) &&
-						strings.EqualFold(existing.Username, impAcc.Username) {
-						isDuplicate = true
-						break
-					}
-				}
-
-				if isDuplicate {
-					skipped++
+				if err := impAcc.Validate(); err != nil {
+					fmt.Fprintf(ui.Out, "%sWarning: skipping %q: %v%s\n", ui.WarningBright, impAcc.Name, err, ui.Reset)
 					continue
 				}
+				valid = append(valid, impAcc)
+			}
 
-				if impAcc.ID == "" {
-					impAcc.ID = uuid.New().String()
-				}
-				v.Accounts = append(v.Accounts, impAcc)
-				count++
+			count := 0
+			skipped := 0
+			summary := func() {
+				fmt.Fprintf(ui.Out, "%s✓ Imported %d accounts, skipped %d duplicates.%s\n", ui.SuccessBright, count, skipped, ui.Reset)
 			}
 
-			if count > 0 {
-				if err := vault.CreateBackup(vaultPath, 3); err != nil {
-					fmt.Fprintf(ui.Out, "%sWarning: failed to create backup: %v%s\n", ui.WarningBright, err, ui.Reset)
-				}
+			// Look for duplicates in the vault as it is on disk now.
+			ok := updateVault(vaultPath, key, func(v *vault.Vault) error {
+				for _, impAcc := range valid {
+					isDuplicate := false
+					for _, existing := range v.Accounts {
+						if strings.EqualFold(existing.Name, impAcc.Name) &&
+							strings.EqualFold(existing.Issuer, impAcc.Issuer) &&
+							strings.EqualFold(existing.Username, impAcc.Username) {
+							isDuplicate = true
+							break
+						}
+					}
 
-				if err := vault.SaveVaultWithKey(vaultPath, v, key); err != nil {
-					fmt.Fprintf(ui.Out, "%sError: Failed to save vault: %v%s\n", ui.DangerBright, err, ui.Reset)
-					return nil
+					if isDuplicate {
+						skipped++
+						continue
+					}
+
+					if impAcc.ID == "" {
+						impAcc.ID = uuid.New().String()
+					}
+					v.Accounts = append(v.Accounts, impAcc)
+					count++
 				}
+				if count == 0 {
+					// Nothing to save.
+					summary()
+					return errReported
+				}
+				return nil
+			})
+			if !ok {
+				return nil
 			}
 
-			fmt.Fprintf(ui.Out, "%s✓ Imported %d accounts, skipped %d duplicates.%s\n", ui.SuccessBright, count, skipped, ui.Reset)
+			summary()
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVar(&format, "format", "auto", "Import format (auto, json, uri, encrypted, aegis, authy, google)")
+	cmd.Flags().StringVar(&format, "format", "auto", "Import format (auto, json, uri, encrypted, age, aegis, authy, google)")
+	cmd.Flags().StringVar(&ageIdentity, "age-identity", "", "Identity file to decrypt an age import with")
 
 	return cmd
 }
+
+// decryptAgeImport decrypts an age file holding a JSON export, with a
+// prompted passphrase or with the identity file at identityPath.
+func decryptAgeImport(data []byte, identityPath string) ([]vault.Account, error) {
+	passphrase, err := age.HasPassphrase(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var identity age.Identity
+	if passphrase {
+		pass, err := ui.PromptPassword("Enter passphrase for age import: ")
+		if err != nil {
+			return nil, err
+		}
+		defer crypto.ZeroBytes(pass)
+		if identity, err = age.NewScryptIdentity(pass); err != nil {
+			return nil, err
+		}
+	} else {
+		if identityPath == "" {
+			return nil, errors.New("the file is encrypted to recipients; pass an identity file with --age-identity")
+		}
+		priv, err := vault.ReadIdentityFile(config.ExpandPath(identityPath))
+		if err != nil {
+			return nil, err
+		}
+		if identity, err = age.NewX25519Identity(priv); err != nil {
+			return nil, err
+		}
+	}
+
+	plaintext, err := age.Decrypt(data, identity)
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.ZeroBytes(plaintext)
+
+	var accounts []vault.Account
+	if err := json.Unmarshal(plaintext, &accounts); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	return accounts, nil
+}
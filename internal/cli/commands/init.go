@@ -3,6 +3,7 @@ package commands
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/zulfikawr/gotp/internal/cli/ui"
@@ -13,11 +14,14 @@ import (
 
 func NewInitCmd() *cobra.Command {
 	var force bool
+	var keyfilePath string
+	var calibrate time.Duration
+	var cipherName, kdfName string
 
 	cmd := &cobra.Command{
 		Use:   "init",
 		Short: "Initialize a new vault",
-		Long:  `Create a new secure vault for storing your TOTP accounts. Requires a master password that will be used for encryption and authentication.`,
+		Long:  `Create a new secure vault for storing your TOTP accounts. Requires a master password that will be used for encryption and authentication. With --keyfile, the vault is unlocked by the password combined with a keyfile, which is generated if it does not exist; both are then needed to open the vault. With --calibrate, the KDF parameters are benchmarked on this machine so that unlocking takes about the given time, instead of taking them from the config. --cipher chooses aes-256-gcm (the default) or xchacha20-poly1305, and --kdf argon2id (the default) or scrypt.`,
 		SilenceUsage:  true,
 		SilenceErrors: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -29,6 +33,11 @@ func NewInitCmd() *cobra.Command {
 				return nil
 			}
 
+			c, kdf, ok := parseAlgorithms(cipherName, kdfName)
+			if !ok {
+				return nil
+			}
+
 			password, err := ui.PromptPassword("Enter master password: ")
 			if err != nil {
 				return err
@@ -50,17 +59,83 @@ func NewInitCmd() *cobra.Command {
 			}
 
 			v := vault.NewVault(salt)
-			err = vault.SaveVault(vaultPath, v, password)
+			if c != "" {
+				v.Cipher = c
+			}
+			if kdf != "" {
+				v.KDFParams = kdfParamsFor(kdf)
+			}
+			if calibrate != 0 {
+				v.KDFParams, err = calibrateKDFParams(calibrate, v.KDFParams)
+				if err != nil {
+					fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+					return nil
+				}
+				fmt.Fprintf(ui.Out, "%sUsing %s%s\n", ui.TextMuted, formatKDFParams(v.KDFParams), ui.Reset)
+			}
+			if keyfilePath == "" {
+				err = vault.SaveVault(vaultPath, v, password)
+				if err != nil {
+					fmt.Fprintf(ui.Out, "%sError: Failed to save vault: %v%s\n", ui.DangerBright, err, ui.Reset)
+					return nil
+				}
+
+				fmt.Fprintf(ui.Out, "%s✓ Vault created successfully at %s%s\n", ui.SuccessBright, vaultPath, ui.Reset)
+				return nil
+			}
+
+			var keyfile []byte
+			generated := false
+			if _, statErr := os.Stat(keyfilePath); os.IsNotExist(statErr) {
+				keyfile, err = vault.GenerateKeyfile()
+				if err == nil {
+					err = os.WriteFile(keyfilePath, keyfile, 0600)
+				}
+				if err != nil {
+					fmt.Fprintf(ui.Out, "%sError: Failed to create keyfile: %v%s\n", ui.DangerBright, err, ui.Reset)
+					return nil
+				}
+				generated = true
+			} else {
+				keyfile, err = vault.ReadKeyfile(keyfilePath)
+				if err != nil {
+					fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+					return nil
+				}
+			}
+			defer crypto.ZeroBytes(keyfile)
+
+			key, err := vault.NewMasterKey()
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: Failed to generate master key: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			defer crypto.ZeroBytes(key)
+
+			slot, err := vault.NewTwoFactorSlot(key, password, keyfile, v.KDFParams)
+			crypto.ZeroBytes(password)
+			if err == nil {
+				v.Slots = []vault.KeySlot{*slot}
+				err = vault.SaveVaultWithKey(vaultPath, v, key)
+			}
 			if err != nil {
 				fmt.Fprintf(ui.Out, "%sError: Failed to save vault: %v%s\n", ui.DangerBright, err, ui.Reset)
 				return nil
 			}
 
 			fmt.Fprintf(ui.Out, "%s✓ Vault created successfully at %s%s\n", ui.SuccessBright, vaultPath, ui.Reset)
+			if generated {
+				fmt.Fprintf(ui.Out, "%s✓ Generated new keyfile at %s%s\n", ui.SuccessBright, keyfilePath, ui.Reset)
+			}
+			fmt.Fprintf(ui.Out, "%sThe vault needs both the password and this keyfile to unlock. Keep a copy of the keyfile somewhere safe; pass it with --keyfile or set security.keyfile in the config.%s\n", ui.WarningBright, ui.Reset)
 			return nil
 		},
 	}
 
 	cmd.Flags().BoolVarP(&force, "force", "f", false, "Overwrite existing vault")
+	cmd.Flags().DurationVar(&calibrate, "calibrate", 0, "Benchmark the KDF parameters to take this long to unlock (e.g. 1s)")
+	cmd.Flags().StringVar(&cipherName, "cipher", "", "Cipher for the vault (aes-256-gcm, xchacha20-poly1305)")
+	cmd.Flags().StringVar(&kdfName, "kdf", "", "Key derivation function for the password (argon2id, scrypt)")
+	cmd.Flags().StringVar(&keyfilePath, "keyfile", "", "Require this keyfile with the password (generated if missing)")
 	return cmd
 }
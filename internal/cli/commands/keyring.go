@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zulfikawr/gotp/internal/cli/ui"
+	"github.com/zulfikawr/gotp/internal/config"
+	"github.com/zulfikawr/gotp/internal/keyring"
+	"github.com/zulfikawr/gotp/internal/vault"
+)
+
+// keyringStore is the desktop keyring 'gotp keyring' manages.
+var keyringStore vault.KeyStore = keyring.SecretService{}
+
+func NewKeyringCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "keyring",
+		Short: "Keep the vault key in the desktop keyring",
+		Long:  `Store the vault key in the desktop keyring (GNOME Keyring, KWallet, KeePassXC) through the freedesktop Secret Service API, so that the vault opens without the master password while the keyring is unlocked. The keyring is asked after gotp agent and before any prompt. Without a desktop keyring, the key is kept in a session file instead.`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+
+	cmd.AddCommand(newKeyringEnableCmd())
+	cmd.AddCommand(newKeyringDisableCmd())
+	return cmd
+}
+
+func newKeyringEnableCmd() *cobra.Command {
+	var duration time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "enable",
+		Short: "Store the vault key in the keyring",
+		Long: `Unlock the vault and store its key in the default collection of the desktop keyring. The key stays there until 'gotp keyring disable'; 'gotp lock' does not remove it.
+
+Without a desktop keyring, the key is stored in a session file instead: a file readable only by you, encrypted under a session key kept in the GOTP_SESSION environment variable and removed after --for. Export the printed GOTP_SESSION in your shell to use it.
+
+Examples:
+  gotp keyring enable
+  gotp keyring enable --for 2h`,
+		Args:  cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if duration <= 0 {
+				fmt.Fprintf(ui.Out, "%sError: --for must be positive%s\n", ui.DangerBright, ui.Reset)
+				return nil
+			}
+
+			v, key, vaultPath := loadSlotVault()
+			if v == nil {
+				return nil
+			}
+			defer v.Destroy()
+
+			canonical := vault.CanonicalPath(vaultPath)
+			err := keyringStore.Put(canonical, key, 0)
+			if errors.Is(err, keyring.ErrUnavailable) {
+				storeSessionFile(canonical, key, duration)
+				return nil
+			}
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: Failed to store the key in the keyring: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+
+			fmt.Fprintf(ui.Out, "%s✓ Vault key stored in the keyring%s\n", ui.SuccessBright, ui.Reset)
+			fmt.Fprintf(ui.Out, "%sThe vault opens without the master password while the keyring is unlocked.%s\n", ui.TextMuted, ui.Reset)
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&duration, "for", vault.DefaultFileStoreTTL, "How long a session file keeps the key when there is no desktop keyring")
+	return cmd
+}
+
+// storeSessionFile stores the key in the session file store, starting a
+// session if the environment holds no session key.
+func storeSessionFile(vaultPath string, key []byte, duration time.Duration) {
+	var sessionKey string
+	err := vault.FileStore.Put(vaultPath, key, duration)
+	if errors.Is(err, vault.ErrNoSessionKey) {
+		if sessionKey, err = vault.NewSessionKey(); err == nil {
+			os.Setenv(vault.SessionKeyEnv, sessionKey)
+			err = vault.FileStore.Put(vaultPath, key, duration)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(ui.Out, "%sError: Failed to store the key in a session file: %v%s\n", ui.DangerBright, err, ui.Reset)
+		return
+	}
+
+	fmt.Fprintf(ui.Out, "%s✓ Vault key stored in a session file until %s%s\n", ui.SuccessBright, time.Now().Add(duration).Format("2006-01-02 15:04"), ui.Reset)
+	fmt.Fprintf(ui.Out, "%sNo desktop keyring is available; the vault opens without the master password in shells with this %s.%s\n", ui.TextMuted, vault.SessionKeyEnv, ui.Reset)
+	if sessionKey != "" {
+		fmt.Fprintf(ui.Out, "\n  export %s=%s\n\n", vault.SessionKeyEnv, sessionKey)
+		fmt.Fprintf(ui.Out, "%sTip: Run the line above in your shell to start the session.%s\n", ui.TextMuted, ui.Reset)
+	}
+}
+
+func newKeyringDisableCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "disable",
+		Short: "Remove the vault key from the keyring",
+		Long:  `Delete the vault key from the desktop keyring and any session file, so that the master password is required again once the session ends.`,
+		Args:  cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			canonical := vault.CanonicalPath(config.GetVaultPath())
+			if err := vault.FileStore.Delete(canonical); err != nil {
+				fmt.Fprintf(ui.Out, "%sError: Failed to remove the session file: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			if err := keyringStore.Delete(canonical); err != nil && !errors.Is(err, keyring.ErrUnavailable) {
+				fmt.Fprintf(ui.Out, "%sError: Failed to remove the key from the keyring: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			fmt.Fprintf(ui.Out, "%s✓ Vault key removed from the keyring%s\n", ui.SuccessBright, ui.Reset)
+			return nil
+		},
+	}
+}
@@ -11,9 +11,7 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/zulfikawr/gotp/internal/cli/ui"
 	"github.com/zulfikawr/gotp/internal/config"
-	"github.com/zulfikawr/gotp/internal/totp"
 	"github.com/zulfikawr/gotp/internal/vault"
-	"github.com/zulfikawr/gotp/pkg/base32"
 )
 
 func NewListCmd() *cobra.Command {
@@ -46,6 +44,7 @@ func NewListCmd() *cobra.Command {
 				fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
 				return nil
 			}
+			defer v.Destroy()
 
 			accounts := v.Accounts
 
@@ -74,7 +73,11 @@ func NewListCmd() *cobra.Command {
 			})
 
 			if isJSON {
-				data, _ := json.Marshal(accounts)
+				infos := make([]vault.AccountInfo, len(accounts))
+				for i := range accounts {
+					infos[i] = accounts[i].Info()
+				}
+				data, _ := json.Marshal(infos)
 				fmt.Fprintln(ui.Out, string(data))
 				return nil
 			}
@@ -90,24 +93,31 @@ func NewListCmd() *cobra.Command {
 			}
 			headers = append(headers, "TAGS")
 
-			rows := [][]string{}
-			now := time.Now()
+			// Generate all TOTP codes in one parallel batch.
+			codes := make([]string, len(accounts))
+			var codeErrors []string
+			if withCodes {
+				for i, res := range v.GenerateAll(accounts, time.Now()) {
+					switch acc := &accounts[i]; {
+					case acc.IsHOTP():
+						// Showing an HOTP code would require consuming a counter value.
+						codes[i] = "(hotp)"
+					case acc.IsOCRA():
+						codes[i] = "(ocra)"
+					case res.Err != nil:
+						codes[i] = "-"
+						codeErrors = append(codeErrors, fmt.Sprintf("%s: %v", acc.Name, res.Err))
+					default:
+						codes[i] = res.Code
+					}
+				}
+			}
 
-			for _, acc := range accounts {
+			rows := [][]string{}
+			for i, acc := range accounts {
 				row := []string{acc.Name, acc.Issuer, acc.Username}
 				if withCodes {
-					code := "ERROR"
-					secretBytes, err := base32.Decode(string(acc.Secret))
-					if err == nil {
-						code, _ = totp.GenerateTOTP(totp.TOTPParams{
-							Secret:    secretBytes,
-							Timestamp: now,
-							Period:    acc.Period,
-							Digits:    acc.Digits,
-							Algorithm: acc.Algorithm,
-						})
-					}
-					row = append(row, code)
+					row = append(row, codes[i])
 				}
 				row = append(row, strings.Join(acc.Tags, ", "))
 				rows = append(rows, row)
@@ -115,6 +125,9 @@ func NewListCmd() *cobra.Command {
 
 			ui.PrintTable(headers, rows)
 			fmt.Fprintf(ui.Out, "\nTotal: %d accounts\n", len(accounts))
+			for _, msg := range codeErrors {
+				fmt.Fprintf(ui.Out, "%sError: %s%s\n", ui.DangerBright, msg, ui.Reset)
+			}
 			return nil
 		},
 	}
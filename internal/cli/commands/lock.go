@@ -0,0 +1,53 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/zulfikawr/gotp/internal/agent"
+	"github.com/zulfikawr/gotp/internal/cli/ui"
+	"github.com/zulfikawr/gotp/internal/config"
+	"github.com/zulfikawr/gotp/internal/vault"
+)
+
+func NewLockCmd() *cobra.Command {
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Lock the vault",
+		Long:  `Make gotp agent forget the key of the vault, so that the next command prompts for the password again. With --all, every vault the agent holds is locked.`,
+		Args:  cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vaultPath := config.GetVaultPath()
+
+			var err error
+			if all {
+				err = agent.LockAll()
+			} else {
+				err = agent.Lock(vault.CanonicalPath(vaultPath))
+			}
+			if err != nil {
+				if errors.Is(err, agent.ErrNotRunning) {
+					fmt.Fprintf(ui.Out, "%sgotp agent is not running; all vaults are locked.%s\n", ui.TextMuted, ui.Reset)
+					return nil
+				}
+				fmt.Fprintf(ui.Out, "%sError: Failed to lock: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+
+			if all {
+				fmt.Fprintf(ui.Out, "%s✓ All vaults locked%s\n", ui.SuccessBright, ui.Reset)
+			} else {
+				fmt.Fprintf(ui.Out, "%s✓ Vault %s locked%s\n", ui.SuccessBright, vaultPath, ui.Reset)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&all, "all", false, "Lock every vault held by the agent")
+	return cmd
+}
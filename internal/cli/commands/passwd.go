@@ -12,10 +12,12 @@ import (
 )
 
 func NewPasswdCmd() *cobra.Command {
+	var slotID string
+
 	cmd := &cobra.Command{
 		Use:   "passwd",
 		Short: "Change master password",
-		Long:  `Securely update the master password for your secure vault. This will re-encrypt all stored accounts using the new password.`,
+		Long:  `Securely update the master password for your secure vault. Only the password key slot is rewrapped; the vault's master key and stored accounts are unchanged, and other key slots keep working. A password slot that also requires a keyfile stays bound to it, so pass the keyfile with --keyfile.`,
 		SilenceUsage:  true,
 		SilenceErrors: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -28,11 +30,50 @@ func NewPasswdCmd() *cobra.Command {
 				return nil
 			}
 
-			v, _, err := vault.LoadVaultInteractive(vaultPath, ui.PromptPassword)
+			v, key, err := vault.LoadVaultInteractive(vaultPath, ui.PromptPassword)
 			if err != nil {
 				fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
 				return nil
 			}
+			defer v.Destroy()
+
+			index := -1
+			if slotID != "" {
+				index = v.FindSlot(slotID)
+				if index == -1 || v.Slots[index].Type != vault.SlotPassword {
+					fmt.Fprintf(ui.Out, "%sError: Password slot %q not found%s\n", ui.DangerBright, slotID, ui.Reset)
+					return nil
+				}
+			} else {
+				for i := range v.Slots {
+					if v.Slots[i].Type != vault.SlotPassword {
+						continue
+					}
+					if index != -1 {
+						fmt.Fprintf(ui.Out, "%sError: The vault has several password slots%s\n", ui.DangerBright, ui.Reset)
+						fmt.Fprintf(ui.Out, "%sTip: Use '%s--slot%s' to choose one; see '%s%sgotp %sslot list%s'.%s\n", ui.TextMuted, ui.InfoBright, ui.TextMuted, ui.Reset, ui.SuccessBright, ui.WarningBright, ui.TextMuted, ui.Reset)
+						return nil
+					}
+					index = i
+				}
+			}
+
+			// A two-factor slot stays bound to its keyfile, so the keyfile
+			// is needed to rewrap it.
+			var keyfile []byte
+			if index != -1 && v.Slots[index].RequiresKeyfile {
+				if vault.KeyfilePath() == "" {
+					fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, vault.ErrKeyfileRequired, ui.Reset)
+					fmt.Fprintf(ui.Out, "%sTip: Pass the keyfile with '%s--keyfile%s'.%s\n", ui.TextMuted, ui.InfoBright, ui.TextMuted, ui.Reset)
+					return nil
+				}
+				keyfile, err = vault.ReadKeyfile(vault.KeyfilePath())
+				if err != nil {
+					fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+					return nil
+				}
+				defer crypto.ZeroBytes(keyfile)
+			}
 
 			newPassword, err := ui.PromptPassword("Enter new master password: ")
 			if err != nil {
@@ -40,30 +81,58 @@ func NewPasswdCmd() *cobra.Command {
 			}
 			confirm, err := ui.PromptPassword("Confirm new master password: ")
 			if err != nil {
+				crypto.ZeroBytes(newPassword)
 				return err
 			}
 
-			if !crypto.SecureCompare(newPassword, confirm) {
+			match := crypto.SecureCompare(newPassword, confirm)
+			crypto.ZeroBytes(confirm)
+			if !match {
+				crypto.ZeroBytes(newPassword)
 				fmt.Fprintf(ui.Out, "%sError: Passwords do not match%s\n", ui.DangerBright, ui.Reset)
 				return nil
 			}
 
-			if err := vault.CreateBackup(vaultPath, 3); err != nil {
-				fmt.Fprintf(ui.Out, "%sWarning: failed to create backup: %v%s\n", ui.WarningBright, err, ui.Reset)
+			var slot *vault.KeySlot
+			if index == -1 {
+				// No password slot yet, e.g. a vault opened with a keyfile.
+				slot, err = vault.NewPasswordSlot(key, newPassword, v.KDFParams)
+			} else {
+				changed := v.Slots[index]
+				slot = &changed
+				err = slot.SetPassword(key, newPassword, keyfile, v.KDFParams)
+			}
+			crypto.ZeroBytes(newPassword)
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: Failed to update password slot: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
 			}
 
-			if err := vault.SaveVault(vaultPath, v, newPassword); err != nil {
-				fmt.Fprintf(ui.Out, "%sError: Failed to save vault: %v%s\n", ui.DangerBright, err, ui.Reset)
+			ok := updateVault(vaultPath, key, func(v *vault.Vault) error {
+				if index == -1 {
+					v.Slots = append(v.Slots, *slot)
+					return nil
+				}
+				i := v.FindSlot(slot.ID)
+				if i == -1 {
+					fmt.Fprintf(ui.Out, "%sError: Password slot %q not found%s\n", ui.DangerBright, slot.ID, ui.Reset)
+					return errReported
+				}
+				v.Slots[i] = *slot
+				return nil
+			})
+			if !ok {
 				return nil
 			}
 
 			// Clear session on password change
-			_ = vault.ClearSession()
+			_ = vault.ClearSession(vaultPath)
 
 			fmt.Fprintf(ui.Out, "%s✓ Master password changed successfully%s\n", ui.SuccessBright, ui.Reset)
 			return nil
 		},
 	}
 
+	cmd.Flags().StringVar(&slotID, "slot", "", "ID of the password slot to change")
 	return cmd
 }
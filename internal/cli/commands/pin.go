@@ -0,0 +1,111 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zulfikawr/gotp/internal/cli/ui"
+	"github.com/zulfikawr/gotp/internal/config"
+	"github.com/zulfikawr/gotp/internal/crypto"
+	"github.com/zulfikawr/gotp/internal/vault"
+)
+
+func NewPinCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pin",
+		Short: "Manage the quick-unlock PIN",
+		Long:  `Set a short PIN that unlocks the vault for a bounded period instead of the master password. A separately wrapped copy of the vault key is kept in the memory of gotp agent, which checks the PIN, until the PIN expires or the agent stops. After too many wrong PINs, the copy is destroyed and the master password is required again.`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+
+	cmd.AddCommand(newPinSetCmd())
+	cmd.AddCommand(newPinRemoveCmd())
+	return cmd
+}
+
+func newPinSetCmd() *cobra.Command {
+	var duration time.Duration
+	var attempts int
+
+	cmd := &cobra.Command{
+		Use:   "set",
+		Short: "Set the quick-unlock PIN",
+		Long: `Unlock the vault with the master password and set a PIN that unlocks it until the PIN expires. Any previous PIN is replaced. The PIN needs a running gotp agent.
+
+Examples:
+  gotp pin set
+  gotp pin set --for 4h --attempts 3`,
+		Args:  cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if duration <= 0 || attempts < 1 {
+				fmt.Fprintf(ui.Out, "%sError: --for and --attempts must be positive%s\n", ui.DangerBright, ui.Reset)
+				return nil
+			}
+
+			v, key, vaultPath := loadSlotVault()
+			if v == nil {
+				return nil
+			}
+			defer v.Destroy()
+
+			pin, err := ui.PromptPassword("Enter new PIN: ")
+			if err != nil {
+				return err
+			}
+			defer crypto.ZeroBytes(pin)
+			confirm, err := ui.PromptPassword("Confirm PIN: ")
+			if err != nil {
+				return err
+			}
+			defer crypto.ZeroBytes(confirm)
+			if !crypto.SecureCompare(pin, confirm) {
+				fmt.Fprintf(ui.Out, "%sError: PINs do not match%s\n", ui.DangerBright, ui.Reset)
+				return nil
+			}
+
+			err = vault.SetPIN(vaultPath, key, pin, v.KDFParams, duration, attempts)
+			if errors.Is(err, vault.ErrPINNeedsAgent) {
+				fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+				fmt.Fprintf(ui.Out, "%sTip: Start it with '%sgotp agent &%s'.%s\n", ui.TextMuted, ui.InfoBright, ui.TextMuted, ui.Reset)
+				return nil
+			}
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: Failed to set PIN: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+
+			fmt.Fprintf(ui.Out, "%s✓ PIN set until %s%s\n", ui.SuccessBright, time.Now().Add(duration).Format("2006-01-02 15:04"), ui.Reset)
+			fmt.Fprintf(ui.Out, "%s%d wrong PINs remove it; the master password is then required.%s\n", ui.TextMuted, attempts, ui.Reset)
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&duration, "for", vault.DefaultPINDuration, "How long the PIN unlocks the vault")
+	cmd.Flags().IntVar(&attempts, "attempts", vault.DefaultPINAttempts, "Number of wrong PINs that remove the PIN")
+	return cmd
+}
+
+func newPinRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove",
+		Short: "Remove the quick-unlock PIN",
+		Long:  `Destroy the PIN-wrapped copy of the vault key, so that only the master password unlocks the vault.`,
+		Args:  cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vaultPath := config.GetVaultPath()
+			if err := vault.RemovePIN(vaultPath); err != nil {
+				fmt.Fprintf(ui.Out, "%sError: Failed to remove PIN: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			fmt.Fprintf(ui.Out, "%s✓ PIN removed%s\n", ui.SuccessBright, ui.Reset)
+			return nil
+		},
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/zulfikawr/gotp/internal/cli/ui"
 	"github.com/zulfikawr/gotp/internal/config"
+	"github.com/zulfikawr/gotp/internal/crypto"
 	"github.com/zulfikawr/gotp/internal/qr"
 	"github.com/zulfikawr/gotp/internal/vault"
 )
@@ -89,6 +90,7 @@ Examples:
 				fmt.Fprintf(ui.Out, "%s✗ Failed to load vault: %v%s\n", ui.DangerBright, err, ui.Reset)
 				return nil
 			}
+			defer v.Destroy()
 
 			// Find account
 			var targetAccount *vault.Account
@@ -105,7 +107,13 @@ Examples:
 			}
 
 			// Generate URI
-			uri := targetAccount.ToURI()
+			revealed, err := v.Reveal(targetAccount)
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%s✗ %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			uri := revealed.ToURI()
+			crypto.ZeroBytes(revealed.Secret)
 
 			// Terminal mode
 			if terminal {
@@ -0,0 +1,153 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zulfikawr/gotp/internal/cli/ui"
+	"github.com/zulfikawr/gotp/internal/crypto"
+	"github.com/zulfikawr/gotp/internal/vault"
+)
+
+func NewRekeyCmd() *cobra.Command {
+	var calibrate time.Duration
+	var cipherName, kdfName string
+
+	cmd := &cobra.Command{
+		Use:   "rekey",
+		Short: "Re-derive the password slots with new KDF parameters",
+		Long:  `Rewrap the password slots opened by the master password under a fresh salt and new KDF parameters, then re-encrypt the vault. Argon2id parameters come from the config (security.argon2_memory, argon2_iterations and argon2_parallelism); with --calibrate, they are instead benchmarked on this machine to take about the given time to unlock. --kdf switches the slots between argon2id and scrypt, and --cipher re-encrypts the vault with aes-256-gcm or xchacha20-poly1305. The master key is unchanged, so other key slots keep working with their own parameters.`,
+		Args:  cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, kdf, ok := parseAlgorithms(cipherName, kdfName)
+			if !ok {
+				return nil
+			}
+
+			v, key, vaultPath := loadSlotVault()
+			if v == nil {
+				return nil
+			}
+			defer v.Destroy()
+
+			if kdf == "" {
+				kdf = v.KDFParams.KDF()
+			}
+			params := kdfParamsFor(kdf)
+			if calibrate != 0 {
+				var err error
+				params, err = calibrateKDFParams(calibrate, params)
+				if err != nil {
+					fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+					return nil
+				}
+			}
+
+			var keyfile []byte
+			if vault.KeyfilePath() != "" {
+				var err error
+				keyfile, err = vault.ReadKeyfile(vault.KeyfilePath())
+				if err != nil {
+					fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+					return nil
+				}
+				defer crypto.ZeroBytes(keyfile)
+			}
+
+			password, err := ui.PromptPassword("Enter master password: ")
+			if err != nil {
+				return err
+			}
+			defer crypto.ZeroBytes(password)
+
+			var n int
+			ok = updateVault(vaultPath, key, func(v *vault.Vault) error {
+				var err error
+				n, err = v.Rekey(key, password, keyfile, params)
+				if err != nil {
+					switch {
+					case errors.Is(err, vault.ErrNoMatchingSlot):
+						fmt.Fprintf(ui.Out, "%sError: invalid master password%s\n", ui.DangerBright, ui.Reset)
+					case errors.Is(err, vault.ErrKeyfileRequired):
+						fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+						fmt.Fprintf(ui.Out, "%sTip: Pass the keyfile with '%s--keyfile%s'.%s\n", ui.TextMuted, ui.InfoBright, ui.TextMuted, ui.Reset)
+					default:
+						fmt.Fprintf(ui.Out, "%sError: Failed to rekey: %v%s\n", ui.DangerBright, err, ui.Reset)
+					}
+					return errReported
+				}
+				if c != "" {
+					v.Cipher = c
+				}
+				return nil
+			})
+			if !ok {
+				return nil
+			}
+
+			fmt.Fprintf(ui.Out, "%s✓ Rekeyed %d password slot(s) with %s%s\n", ui.SuccessBright, n, formatKDFParams(params), ui.Reset)
+			if c != "" {
+				fmt.Fprintf(ui.Out, "%s✓ Vault re-encrypted with %s%s\n", ui.SuccessBright, c, ui.Reset)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&calibrate, "calibrate", 0, "Benchmark the KDF parameters to take this long to unlock (e.g. 1s)")
+	cmd.Flags().StringVar(&cipherName, "cipher", "", "Re-encrypt the vault with this cipher (aes-256-gcm, xchacha20-poly1305)")
+	cmd.Flags().StringVar(&kdfName, "kdf", "", "Key derivation function for the password slots (argon2id, scrypt)")
+	return cmd
+}
+
+// parseAlgorithms parses the --cipher and --kdf flags, either of which may
+// be empty, and reports an unsupported name.
+func parseAlgorithms(cipherName, kdfName string) (crypto.Cipher, crypto.KDF, bool) {
+	var c crypto.Cipher
+	var kdf crypto.KDF
+	var err error
+	if cipherName != "" {
+		if c, err = crypto.ParseCipher(cipherName); err != nil {
+			fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+			return "", "", false
+		}
+	}
+	if kdfName != "" {
+		if kdf, err = crypto.ParseKDF(kdfName); err != nil {
+			fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+			return "", "", false
+		}
+	}
+	return c, kdf, true
+}
+
+// kdfParamsFor returns the parameters for new password slots with kdf: the
+// configured ones for Argon2id and the defaults for scrypt.
+func kdfParamsFor(kdf crypto.KDF) crypto.KDFParams {
+	if kdf == crypto.KDFScrypt {
+		return crypto.DefaultScryptParams()
+	}
+	return vault.KDFParams()
+}
+
+// calibrateKDFParams benchmarks the KDF of base on this machine, starting
+// from base.
+func calibrateKDFParams(target time.Duration, base crypto.KDFParams) (crypto.KDFParams, error) {
+	fmt.Fprintf(ui.Out, "%sCalibrating %s for %s...%s\n", ui.TextMuted, base.KDF(), target, ui.Reset)
+	if base.KDF() == crypto.KDFScrypt {
+		return crypto.CalibrateScrypt(target, base)
+	}
+	return crypto.CalibrateArgon2(target, base)
+}
+
+// formatKDFParams describes KDF parameters, e.g. "Argon2id (64 MiB, 3
+// iterations, 4 threads)" or "scrypt (N=32768, r=8, p=1)".
+func formatKDFParams(p crypto.KDFParams) string {
+	if p.KDF() == crypto.KDFScrypt {
+		return fmt.Sprintf("scrypt (N=%d, r=%d, p=%d)", p.N, p.R, p.Parallelism)
+	}
+	return fmt.Sprintf("Argon2id (%d MiB, %d iterations, %d threads)", p.Memory/1024, p.Iterations, p.Parallelism)
+}
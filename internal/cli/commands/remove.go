@@ -37,6 +37,7 @@ func NewRemoveCmd() *cobra.Command {
 				fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
 				return nil
 			}
+			defer v.Destroy()
 
 			index := -1
 			for i := range v.Accounts {
@@ -59,14 +60,17 @@ func NewRemoveCmd() *cobra.Command {
 				}
 			}
 
-			v.Accounts = append(v.Accounts[:index], v.Accounts[index+1:]...)
-
-			if err := vault.CreateBackup(vaultPath, 3); err != nil {
-				fmt.Fprintf(ui.Out, "%sWarning: failed to create backup: %v%s\n", ui.WarningBright, err, ui.Reset)
-			}
-
-			if err := vault.SaveVaultWithKey(vaultPath, v, key); err != nil {
-				fmt.Fprintf(ui.Out, "%sError: Failed to save vault: %v%s\n", ui.DangerBright, err, ui.Reset)
+			id := v.Accounts[index].ID
+			ok := updateVault(vaultPath, key, func(v *vault.Vault) error {
+				index := v.FindAccount(id)
+				if index == -1 {
+					fmt.Fprintf(ui.Out, "%sError: Account %q not found%s\n", ui.DangerBright, name, ui.Reset)
+					return errReported
+				}
+				v.Accounts = append(v.Accounts[:index], v.Accounts[index+1:]...)
+				return nil
+			})
+			if !ok {
 				return nil
 			}
 
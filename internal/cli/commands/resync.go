@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zulfikawr/gotp/internal/cli/ui"
+	"github.com/zulfikawr/gotp/internal/config"
+	"github.com/zulfikawr/gotp/internal/totp"
+	"github.com/zulfikawr/gotp/internal/vault"
+)
+
+func NewResyncCmd() *cobra.Command {
+	var window int
+
+	cmd := &cobra.Command{
+		Use:   "resync <account> <code1> <code2>",
+		Short: "Resynchronize an HOTP counter",
+		Long:  `Resynchronize the counter of a counter-based (HOTP) account using two consecutive codes from the token or service. The stored counter is searched forward within a look-ahead window and updated when both codes match.`,
+		Args:  cobra.ExactArgs(3),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name, code1, code2 := args[0], args[1], args[2]
+			vaultPath := config.GetVaultPath()
+
+			// Check if vault exists first
+			if _, err := os.Stat(vaultPath); os.IsNotExist(err) {
+				fmt.Fprintf(ui.Out, "%sError: Vault file not found at %s%s\n", ui.DangerBright, vaultPath, ui.Reset)
+				fmt.Fprintf(ui.Out, "%sTip: Run '%s%sgotp %sinit%s' to create a new secure vault.%s\n", ui.TextMuted, ui.Reset, ui.SuccessBright, ui.WarningBright, ui.TextMuted, ui.Reset)
+				return nil
+			}
+
+			v, key, err := vault.LoadVaultInteractive(vaultPath, ui.PromptPassword)
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			defer v.Destroy()
+
+			var target *vault.Account
+			for i := range v.Accounts {
+				if strings.EqualFold(v.Accounts[i].Name, name) {
+					target = &v.Accounts[i]
+					break
+				}
+			}
+
+			if target == nil {
+				fmt.Fprintf(ui.Out, "%sError: Account %q not found%s\n", ui.DangerBright, name, ui.Reset)
+				return nil
+			}
+
+			if !target.IsHOTP() {
+				fmt.Fprintf(ui.Out, "%sError: Account %q is not a counter-based (HOTP) account%s\n", ui.DangerBright, target.Name, ui.Reset)
+				return nil
+			}
+
+			secret, err := v.DecodeSecret(target)
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			defer secret.Destroy()
+
+			next, ok, err := totp.ResyncHOTP(secret.Bytes(), target.Counter, window, target.Digits, target.Algorithm, code1, code2)
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: Failed to generate codes: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			if !ok {
+				fmt.Fprintf(ui.Out, "%sError: Codes did not match within %d counter values of %d%s\n", ui.DangerBright, window, target.Counter, ui.Reset)
+				fmt.Fprintf(ui.Out, "%sTip: Generate two fresh consecutive codes or increase '%s--window%s'.%s\n", ui.TextMuted, ui.InfoBright, ui.TextMuted, ui.Reset)
+				return nil
+			}
+
+			var previous uint64
+			ok = updateVault(vaultPath, key, func(v *vault.Vault) error {
+				index := v.FindAccount(target.ID)
+				if index == -1 {
+					fmt.Fprintf(ui.Out, "%sError: Account %q not found%s\n", ui.DangerBright, target.Name, ui.Reset)
+					return errReported
+				}
+				previous = v.Accounts[index].Counter
+				v.Accounts[index].Counter = next
+				return nil
+			})
+			if !ok {
+				return nil
+			}
+
+			fmt.Fprintf(ui.Out, "%s✓ Resynchronized %s: counter %d → %d%s\n", ui.SuccessBright, target.Name, previous, next, ui.Reset)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&window, "window", "w", totp.DefaultResyncWindow, "Number of counter values to search ahead")
+	return cmd
+}
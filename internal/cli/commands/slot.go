@@ -0,0 +1,333 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zulfikawr/gotp/internal/cli/ui"
+	"github.com/zulfikawr/gotp/internal/config"
+	"github.com/zulfikawr/gotp/internal/crypto"
+	"github.com/zulfikawr/gotp/internal/vault"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func NewSlotCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "slot",
+		Short: "Manage vault key slots",
+		Long:  `Manage the key slots that unlock your vault. Each slot wraps the vault's master key under a password, a recovery key, a keyfile or an SSH key held by ssh-agent, so that any one of them can open the vault.`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+
+	cmd.AddCommand(newSlotAddCmd())
+	cmd.AddCommand(newSlotListCmd())
+	cmd.AddCommand(newSlotRemoveCmd())
+	return cmd
+}
+
+// loadSlotVault loads the vault for a slot command, printing any error.
+// It returns a nil vault if the command should stop.
+func loadSlotVault() (*vault.Vault, []byte, string) {
+	vaultPath := config.GetVaultPath()
+
+	// Check if vault exists first
+	if _, err := os.Stat(vaultPath); os.IsNotExist(err) {
+		fmt.Fprintf(ui.Out, "%sError: Vault file not found at %s%s\n", ui.DangerBright, vaultPath, ui.Reset)
+		fmt.Fprintf(ui.Out, "%sTip: Run '%s%sgotp %sinit%s' to create a new secure vault.%s\n", ui.TextMuted, ui.Reset, ui.SuccessBright, ui.WarningBright, ui.TextMuted, ui.Reset)
+		return nil, nil, ""
+	}
+
+	v, key, err := vault.LoadVaultInteractive(vaultPath, ui.PromptPassword)
+	if err != nil {
+		fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+		return nil, nil, ""
+	}
+	return v, key, vaultPath
+}
+
+func newSlotAddCmd() *cobra.Command {
+	var label string
+	var sshKey string
+
+	cmd := &cobra.Command{
+		Use:   "add <password|recovery|keyfile|ssh-agent> [keyfile-path]",
+		Short: "Add a key slot",
+		Long:  `Add a key slot that unlocks the vault. A password slot prompts for a new password. A recovery slot generates a recovery key that is shown once and can be entered at the password prompt. A keyfile slot uses the given file, which is created with random contents if it does not exist; unlock with it using the --keyfile flag. An ssh-agent slot is unlocked by a signature from an Ed25519 key held by ssh-agent, so the vault opens without a prompt whenever the agent holds the key.`,
+		Args:  cobra.RangeArgs(1, 2),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			slotType := vault.SlotType(args[0])
+			switch slotType {
+			case vault.SlotPassword, vault.SlotRecovery, vault.SlotSSHAgent:
+				if len(args) != 1 {
+					fmt.Fprintf(ui.Out, "%sError: A %s slot takes no file argument%s\n", ui.DangerBright, slotType, ui.Reset)
+					return nil
+				}
+			case vault.SlotKeyfile:
+				if len(args) != 2 {
+					fmt.Fprintf(ui.Out, "%sError: A keyfile slot requires the path of the keyfile%s\n", ui.DangerBright, ui.Reset)
+					return nil
+				}
+			default:
+				fmt.Fprintf(ui.Out, "%sError: Unsupported slot type: %s%s\n", ui.DangerBright, args[0], ui.Reset)
+				fmt.Fprintf(ui.Out, "%sTip: Use 'password', 'recovery', 'keyfile' or 'ssh-agent'.%s\n", ui.TextMuted, ui.Reset)
+				return nil
+			}
+
+			v, key, vaultPath := loadSlotVault()
+			if v == nil {
+				return nil
+			}
+			defer v.Destroy()
+
+			var slot *vault.KeySlot
+			var recoveryKey string
+			var err error
+
+			switch slotType {
+			case vault.SlotPassword:
+				password, err := ui.PromptPassword("Enter password for the new slot: ")
+				if err != nil {
+					return err
+				}
+				confirm, err := ui.PromptPassword("Confirm password: ")
+				if err != nil {
+					return err
+				}
+				if !crypto.SecureCompare(password, confirm) {
+					fmt.Fprintf(ui.Out, "%sError: Passwords do not match%s\n", ui.DangerBright, ui.Reset)
+					return nil
+				}
+				slot, err = vault.NewPasswordSlot(key, password, v.KDFParams)
+				crypto.ZeroBytes(password)
+				if err != nil {
+					fmt.Fprintf(ui.Out, "%sError: Failed to create slot: %v%s\n", ui.DangerBright, err, ui.Reset)
+					return nil
+				}
+
+			case vault.SlotRecovery:
+				slot, recoveryKey, err = vault.NewRecoverySlot(key, v.KDFParams)
+
+			case vault.SlotKeyfile:
+				path := args[1]
+				var keyfile []byte
+				if _, statErr := os.Stat(path); os.IsNotExist(statErr) {
+					keyfile, err = vault.GenerateKeyfile()
+					if err == nil {
+						err = os.WriteFile(path, keyfile, 0600)
+					}
+					if err != nil {
+						fmt.Fprintf(ui.Out, "%sError: Failed to create keyfile: %v%s\n", ui.DangerBright, err, ui.Reset)
+						return nil
+					}
+					fmt.Fprintf(ui.Out, "%s✓ Generated new keyfile at %s%s\n", ui.SuccessBright, path, ui.Reset)
+				} else {
+					keyfile, err = vault.ReadKeyfile(path)
+					if err != nil {
+						fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+						return nil
+					}
+				}
+				slot, err = vault.NewKeyfileSlot(key, keyfile, v.KDFParams)
+
+			case vault.SlotSSHAgent:
+				a, conn, dialErr := crypto.DialSSHAgent()
+				if dialErr != nil {
+					fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, dialErr, ui.Reset)
+					fmt.Fprintf(ui.Out, "%sTip: Start ssh-agent and load an Ed25519 key with 'ssh-add'.%s\n", ui.TextMuted, ui.Reset)
+					return nil
+				}
+				defer conn.Close()
+				chosen, chooseErr := chooseSSHKey(a, sshKey)
+				if chooseErr != nil {
+					fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, chooseErr, ui.Reset)
+					return nil
+				}
+				if label == "" {
+					label = chosen.Comment
+				}
+				slot, err = vault.NewSSHAgentSlot(key, a, chosen)
+			}
+
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: Failed to create slot: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			slot.Label = label
+			ok := updateVault(vaultPath, key, func(v *vault.Vault) error {
+				v.Slots = append(v.Slots, *slot)
+				return nil
+			})
+			if !ok {
+				return nil
+			}
+
+			fmt.Fprintf(ui.Out, "%s✓ Added %s slot %s%s\n", ui.SuccessBright, slot.Type, slot.ID, ui.Reset)
+			if recoveryKey != "" {
+				fmt.Fprintf(ui.Out, "\nRecovery key: %s%s%s\n", ui.Bold, recoveryKey, ui.Reset)
+				fmt.Fprintf(ui.Out, "%sStore it somewhere safe. It will not be shown again and can be entered at the password prompt.%s\n", ui.WarningBright, ui.Reset)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&label, "label", "", "Label to identify the slot")
+	cmd.Flags().StringVar(&sshKey, "ssh-key", "", "Fingerprint or comment of the ssh-agent key (ssh-agent)")
+	return cmd
+}
+
+// chooseSSHKey returns the Ed25519 key of the agent matching want, a
+// SHA256 fingerprint or a comment, or its only Ed25519 key if want is
+// empty.
+func chooseSSHKey(a agent.Agent, want string) (*agent.Key, error) {
+	keys, err := a.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ssh-agent keys: %w", err)
+	}
+	var candidates []*agent.Key
+	for _, k := range keys {
+		if k.Type() != ssh.KeyAlgoED25519 {
+			continue
+		}
+		if want == "" || want == ssh.FingerprintSHA256(k) || want == k.Comment {
+			candidates = append(candidates, k)
+		}
+	}
+	switch {
+	case len(candidates) == 1:
+		return candidates[0], nil
+	case len(candidates) == 0 && want != "":
+		return nil, fmt.Errorf("ssh-agent holds no Ed25519 key matching %q", want)
+	case len(candidates) == 0:
+		return nil, fmt.Errorf("ssh-agent holds no Ed25519 key")
+	default:
+		return nil, fmt.Errorf("ssh-agent holds several Ed25519 keys; choose one with --ssh-key <fingerprint|comment>")
+	}
+}
+
+func newSlotListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List key slots",
+		Long:  `List the key slots that unlock the vault.`,
+		Args:  cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			isJSON, _ := cmd.Flags().GetBool("json")
+
+			v, _, _ := loadSlotVault()
+			if v == nil {
+				return nil
+			}
+			defer v.Destroy()
+
+			if isJSON {
+				type slotInfo struct {
+					ID        string         `json:"id"`
+					Type      vault.SlotType `json:"type"`
+					Label     string         `json:"label,omitempty"`
+					Recipient string         `json:"recipient,omitempty"`
+					SSHKey    string         `json:"ssh_key,omitempty"`
+					CreatedAt time.Time      `json:"created_at"`
+				}
+				var slots []slotInfo
+				for _, s := range v.Slots {
+					slots = append(slots, slotInfo{s.ID, s.Type, s.Label, s.Recipient, s.SSHKey, s.CreatedAt})
+				}
+				data, _ := json.Marshal(slots)
+				fmt.Fprintln(ui.Out, string(data))
+				return nil
+			}
+
+			rows := [][]string{}
+			for _, s := range v.Slots {
+				label := s.Label
+				if label == "" {
+					label = s.Recipient
+				}
+				if label == "" && s.Type == vault.SlotSSHAgent {
+					if key, err := s.SSHPublicKey(); err == nil {
+						label = ssh.FingerprintSHA256(key)
+					}
+				}
+				rows = append(rows, []string{s.ID, string(s.Type), label, s.CreatedAt.Format("2006-01-02 15:04")})
+			}
+			ui.PrintTable([]string{"ID", "TYPE", "LABEL", "CREATED"}, rows)
+			fmt.Fprintf(ui.Out, "\nTotal: %d slots\n", len(v.Slots))
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func newSlotRemoveCmd() *cobra.Command {
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "remove <id>",
+		Short: "Remove a key slot",
+		Long:  `Remove a key slot so that its password, recovery key, keyfile or SSH key no longer unlocks the vault. The last slot cannot be removed.`,
+		Args:  cobra.ExactArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id := args[0]
+
+			v, key, vaultPath := loadSlotVault()
+			if v == nil {
+				return nil
+			}
+			defer v.Destroy()
+
+			index := v.FindSlot(id)
+			if index == -1 {
+				fmt.Fprintf(ui.Out, "%sError: Key slot %q not found%s\n", ui.DangerBright, id, ui.Reset)
+				fmt.Fprintf(ui.Out, "%sTip: Run '%s%sgotp %sslot list%s' to see the slot IDs.%s\n", ui.TextMuted, ui.Reset, ui.SuccessBright, ui.WarningBright, ui.TextMuted, ui.Reset)
+				return nil
+			}
+			if len(v.Slots) == 1 {
+				fmt.Fprintf(ui.Out, "%sError: Cannot remove the last key slot%s\n", ui.DangerBright, ui.Reset)
+				return nil
+			}
+
+			if !force {
+				confirm := ui.PromptConfirm(fmt.Sprintf("Are you sure you want to remove %s slot %s?", v.Slots[index].Type, id), false)
+				if !confirm {
+					fmt.Fprintln(ui.Out, "Operation cancelled.")
+					return nil
+				}
+			}
+
+			ok := updateVault(vaultPath, key, func(v *vault.Vault) error {
+				index := v.FindSlot(id)
+				if index == -1 {
+					fmt.Fprintf(ui.Out, "%sError: Key slot %q not found%s\n", ui.DangerBright, id, ui.Reset)
+					return errReported
+				}
+				if len(v.Slots) == 1 {
+					fmt.Fprintf(ui.Out, "%sError: Cannot remove the last key slot%s\n", ui.DangerBright, ui.Reset)
+					return errReported
+				}
+				v.Slots = append(v.Slots[:index], v.Slots[index+1:]...)
+				return nil
+			})
+			if !ok {
+				return nil
+			}
+
+			fmt.Fprintf(ui.Out, "%s✓ Removed key slot %s%s\n", ui.SuccessBright, id, ui.Reset)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Skip confirmation")
+	return cmd
+}
@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zulfikawr/gotp/internal/agent"
+	"github.com/zulfikawr/gotp/internal/cli/ui"
+	"github.com/zulfikawr/gotp/internal/config"
+	"github.com/zulfikawr/gotp/internal/vault"
+)
+
+func NewStatusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show which vaults are unlocked",
+		Long:  `Show whether gotp agent is running, which vaults it holds unlocked, and until when.`,
+		Args:  cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			isJSON, _ := cmd.Flags().GetBool("json")
+
+			sessions, err := agent.List()
+			running := !errors.Is(err, agent.ErrNotRunning)
+			if err != nil && running {
+				fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+
+			if isJSON {
+				type status struct {
+					AgentRunning bool            `json:"agent_running"`
+					Socket       string          `json:"socket"`
+					Sessions     []agent.Session `json:"sessions"`
+				}
+				if sessions == nil {
+					sessions = []agent.Session{}
+				}
+				data, _ := json.Marshal(status{running, agent.SocketPath(), sessions})
+				fmt.Fprintln(ui.Out, string(data))
+				return nil
+			}
+
+			if !running {
+				fmt.Fprintf(ui.Out, "%sgotp agent is not running; all vaults are locked.%s\n", ui.TextMuted, ui.Reset)
+				fmt.Fprintf(ui.Out, "%sTip: Start it with '%s%sgotp %sagent &%s'.%s\n", ui.TextMuted, ui.Reset, ui.SuccessBright, ui.WarningBright, ui.TextMuted, ui.Reset)
+				return nil
+			}
+
+			fmt.Fprintf(ui.Out, "gotp agent is running on %s\n\n", agent.SocketPath())
+			if len(sessions) == 0 {
+				fmt.Fprintf(ui.Out, "%sNo vaults are unlocked.%s\n", ui.TextMuted, ui.Reset)
+				return nil
+			}
+
+			current := vault.CanonicalPath(config.GetVaultPath())
+			rows := [][]string{}
+			for _, s := range sessions {
+				name := s.Vault
+				if s.Vault == current {
+					name += " (current)"
+				}
+				remaining := time.Until(s.ExpiresAt).Round(time.Second)
+				rows = append(rows, []string{name, s.ExpiresAt.Format("15:04:05"), remaining.String()})
+			}
+			ui.PrintTable([]string{"VAULT", "UNLOCKED UNTIL", "REMAINING"}, rows)
+			fmt.Fprintf(ui.Out, "\nTotal: %d unlocked vaults\n", len(sessions))
+			return nil
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,310 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zulfikawr/gotp/internal/cli/ui"
+	"github.com/zulfikawr/gotp/internal/crypto"
+	"github.com/zulfikawr/gotp/internal/vault"
+)
+
+func NewTeamCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "team",
+		Short: "Share the vault with team members",
+		Long:  `Share the vault with team members through their X25519 public keys, in the spirit of age. The vault key is wrapped once per recipient, and each member unlocks the vault with their own identity file using --identity.`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+
+	cmd.AddCommand(newTeamKeygenCmd())
+	cmd.AddCommand(newTeamAddRecipientCmd())
+	cmd.AddCommand(newTeamRemoveRecipientCmd())
+	return cmd
+}
+
+func newTeamKeygenCmd() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "keygen",
+		Short: "Generate an identity",
+		Long:  `Generate an X25519 identity and print its public key. The identity file has the same format as age-keygen, so age identities can be used as well. Share the public key ("age1...") with whoever adds you to a vault, and keep the identity file private.`,
+		Args:  cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			identity, err := crypto.GenerateX25519Identity()
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: Failed to generate identity: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			recipient := crypto.FormatRecipient(identity.PublicKey())
+			content := fmt.Sprintf("# created: %s\n# public key: %s\n%s\n", time.Now().Format(time.RFC3339), recipient, crypto.FormatIdentity(identity))
+
+			if output == "" {
+				fmt.Fprint(ui.Out, content)
+				return nil
+			}
+
+			f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: Failed to create identity file: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			_, err = f.WriteString(content)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: Failed to write identity file: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+
+			fmt.Fprintf(ui.Out, "%s✓ Wrote identity to %s%s\n", ui.SuccessBright, output, ui.Reset)
+			fmt.Fprintf(ui.Out, "Public key: %s%s%s\n", ui.Bold, recipient, ui.Reset)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write the identity to this file (default: stdout)")
+	return cmd
+}
+
+func newTeamAddRecipientCmd() *cobra.Command {
+	var label string
+
+	cmd := &cobra.Command{
+		Use:   "add-recipient <age1...>",
+		Short: "Give a team member access to the vault",
+		Long:  `Wrap the vault key for a team member's X25519 public key, as printed by 'gotp team keygen' or age-keygen. They can then unlock the vault with their identity file using --identity.`,
+		Args:  cobra.ExactArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			recipient, err := crypto.ParseRecipient(args[0])
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+				fmt.Fprintf(ui.Out, "%sTip: Recipients are public keys starting with 'age1'; see '%s%sgotp %steam keygen%s'.%s\n", ui.TextMuted, ui.Reset, ui.SuccessBright, ui.WarningBright, ui.TextMuted, ui.Reset)
+				return nil
+			}
+
+			v, key, vaultPath := loadSlotVault()
+			if v == nil {
+				return nil
+			}
+			defer v.Destroy()
+
+			if v.FindRecipient(crypto.FormatRecipient(recipient)) != -1 {
+				fmt.Fprintf(ui.Out, "%sError: %s is already a recipient%s\n", ui.DangerBright, args[0], ui.Reset)
+				return nil
+			}
+
+			slot, err := vault.NewRecipientSlot(key, recipient)
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: Failed to create slot: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			slot.Label = label
+			ok := updateVault(vaultPath, key, func(v *vault.Vault) error {
+				if v.FindRecipient(slot.Recipient) != -1 {
+					fmt.Fprintf(ui.Out, "%sError: %s is already a recipient%s\n", ui.DangerBright, args[0], ui.Reset)
+					return errReported
+				}
+				v.Slots = append(v.Slots, *slot)
+				return nil
+			})
+			if !ok {
+				return nil
+			}
+
+			fmt.Fprintf(ui.Out, "%s✓ Added recipient %s (slot %s)%s\n", ui.SuccessBright, slot.Recipient, slot.ID, ui.Reset)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&label, "label", "", "Label to identify the recipient")
+	return cmd
+}
+
+func newTeamRemoveRecipientCmd() *cobra.Command {
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "remove-recipient <age1...|slot-id>",
+		Short: "Revoke a team member's access and rotate the vault key",
+		Long: `Remove a recipient and rotate the vault key, so that a copy of the removed member's identity no longer opens future versions of the vault.
+
+The accounts are re-encrypted under a new key and the remaining recipients are rewrapped automatically. Password slots are replaced by one slot for a master password you enter. Recovery key and keyfile slots cannot be rewrapped without their secrets and are removed; add them again with 'gotp slot add'. Escrow shares of the old key stop working.`,
+		Args:  cobra.ExactArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v, key, vaultPath := loadSlotVault()
+			if v == nil {
+				return nil
+			}
+			defer v.Destroy()
+
+			index := findRecipientSlot(v, args[0])
+			if index == -1 {
+				fmt.Fprintf(ui.Out, "%sError: Recipient %q not found%s\n", ui.DangerBright, args[0], ui.Reset)
+				fmt.Fprintf(ui.Out, "%sTip: Run '%s%sgotp %sslot list%s' to see the recipients.%s\n", ui.TextMuted, ui.Reset, ui.SuccessBright, ui.WarningBright, ui.TextMuted, ui.Reset)
+				return nil
+			}
+			removed := v.Slots[index]
+
+			recipients, dropped, hasPassword, twoFactor := splitSlots(v.Slots, index)
+			if len(recipients) == 0 && !hasPassword {
+				fmt.Fprintf(ui.Out, "%sError: Cannot remove the last recipient of a vault without a password%s\n", ui.DangerBright, ui.Reset)
+				return nil
+			}
+
+			var keyfile []byte
+			if twoFactor {
+				if vault.KeyfilePath() == "" {
+					fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, vault.ErrKeyfileRequired, ui.Reset)
+					fmt.Fprintf(ui.Out, "%sTip: Pass the keyfile with '%s--keyfile%s' to keep the password slot bound to it.%s\n", ui.TextMuted, ui.InfoBright, ui.TextMuted, ui.Reset)
+					return nil
+				}
+				var err error
+				keyfile, err = vault.ReadKeyfile(vault.KeyfilePath())
+				if err != nil {
+					fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+					return nil
+				}
+				defer crypto.ZeroBytes(keyfile)
+			}
+
+			if !force {
+				msg := fmt.Sprintf("Remove recipient %s and rotate the vault key?", removed.Recipient)
+				if len(dropped) > 0 {
+					msg = fmt.Sprintf("Remove recipient %s and rotate the vault key? %d recovery key, keyfile or ssh-agent slot(s) will also be removed.", removed.Recipient, len(dropped))
+				}
+				if !ui.PromptConfirm(msg, false) {
+					fmt.Fprintln(ui.Out, "Operation cancelled.")
+					return nil
+				}
+			}
+
+			var password []byte
+			if hasPassword {
+				var err error
+				password, err = ui.PromptPassword("Enter master password for the rotated vault: ")
+				if err != nil {
+					return err
+				}
+				confirm, err := ui.PromptPassword("Confirm master password: ")
+				if err != nil {
+					return err
+				}
+				if !crypto.SecureCompare(password, confirm) {
+					fmt.Fprintf(ui.Out, "%sError: Passwords do not match%s\n", ui.DangerBright, ui.Reset)
+					return nil
+				}
+				defer crypto.ZeroBytes(password)
+			}
+
+			newKey, err := vault.NewMasterKey()
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: Failed to generate vault key: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			defer crypto.ZeroBytes(newKey)
+
+			ok := updateVaultKey(vaultPath, key, func(v *vault.Vault) ([]byte, error) {
+				// Split the slots again as they are on disk now; the
+				// password prompted for must still be the one needed.
+				index := findRecipientSlot(v, args[0])
+				if index == -1 {
+					fmt.Fprintf(ui.Out, "%sError: Recipient %q not found%s\n", ui.DangerBright, args[0], ui.Reset)
+					return nil, errReported
+				}
+				var stillPassword, stillTwoFactor bool
+				recipients, dropped, stillPassword, stillTwoFactor = splitSlots(v.Slots, index)
+				if stillPassword != hasPassword || stillTwoFactor != twoFactor || (len(recipients) == 0 && !hasPassword) {
+					fmt.Fprintf(ui.Out, "%sError: The key slots of the vault were changed by another gotp process; run the command again%s\n", ui.DangerBright, ui.Reset)
+					return nil, errReported
+				}
+
+				var slots []vault.KeySlot
+				if hasPassword {
+					var slot *vault.KeySlot
+					var err error
+					if twoFactor {
+						slot, err = vault.NewTwoFactorSlot(newKey, password, keyfile, v.KDFParams)
+					} else {
+						slot, err = vault.NewPasswordSlot(newKey, password, v.KDFParams)
+					}
+					if err != nil {
+						fmt.Fprintf(ui.Out, "%sError: Failed to create password slot: %v%s\n", ui.DangerBright, err, ui.Reset)
+						return nil, errReported
+					}
+					slots = append(slots, *slot)
+				}
+				for _, s := range recipients {
+					if err := s.SetRecipientKey(newKey); err != nil {
+						fmt.Fprintf(ui.Out, "%sError: Failed to rewrap recipient %s: %v%s\n", ui.DangerBright, s.Recipient, err, ui.Reset)
+						return nil, errReported
+					}
+					slots = append(slots, s)
+				}
+				v.Slots = slots
+				return newKey, nil
+			})
+			if !ok {
+				return nil
+			}
+
+			// The session, the keyring and the PIN hold the old key.
+			_ = vault.ForgetKey(vaultPath)
+			_ = vault.RemovePIN(vaultPath)
+
+			fmt.Fprintf(ui.Out, "%s✓ Removed recipient %s and rotated the vault key%s\n", ui.SuccessBright, removed.Recipient, ui.Reset)
+			for _, s := range dropped {
+				fmt.Fprintf(ui.Out, "%sRemoved %s slot %s; add it again with 'gotp slot add'.%s\n", ui.WarningBright, s.Type, strings.TrimSpace(s.ID+" "+s.Label), ui.Reset)
+			}
+			fmt.Fprintf(ui.Out, "%sEscrow shares of the old key no longer work; create new ones with 'gotp escrow split'.%s\n", ui.WarningBright, ui.Reset)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Skip confirmation")
+	return cmd
+}
+
+// findRecipientSlot returns the index of the recipient slot for an age1...
+// recipient or a slot ID, or -1.
+func findRecipientSlot(v *vault.Vault, recipient string) int {
+	if i := v.FindRecipient(recipient); i != -1 {
+		return i
+	}
+	if i := v.FindSlot(recipient); i != -1 && v.Slots[i].Type == vault.SlotRecipient {
+		return i
+	}
+	return -1
+}
+
+// splitSlots sorts the slots other than the one at index into the
+// recipients that are rewrapped when the vault key is rotated and the
+// recovery key, keyfile and ssh-agent slots that are dropped, and reports
+// whether there is a password slot and whether it requires a keyfile.
+func splitSlots(slots []vault.KeySlot, index int) (recipients, dropped []vault.KeySlot, hasPassword, twoFactor bool) {
+	for i, s := range slots {
+		switch {
+		case i == index:
+		case s.Type == vault.SlotRecipient:
+			recipients = append(recipients, s)
+		case s.Type == vault.SlotPassword:
+			hasPassword = true
+			twoFactor = twoFactor || s.RequiresKeyfile
+		default:
+			dropped = append(dropped, s)
+		}
+	}
+	return recipients, dropped, hasPassword, twoFactor
+}
@@ -0,0 +1,81 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zulfikawr/gotp/internal/agent"
+	"github.com/zulfikawr/gotp/internal/cli/ui"
+	"github.com/zulfikawr/gotp/internal/config"
+	"github.com/zulfikawr/gotp/internal/vault"
+)
+
+func NewUnlockCmd() *cobra.Command {
+	var duration time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "unlock",
+		Short: "Unlock the vault for a while",
+		Long: `Unlock the vault and hand its key to gotp agent, so that commands do not prompt for the password until the session expires. The session lasts general.session_timeout from the configuration (default: 5 minutes), or as long as --for says.
+
+Examples:
+  gotp unlock
+  gotp unlock --for 15m`,
+		Args:  cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vaultPath := config.GetVaultPath()
+
+			if duration == 0 {
+				duration = vault.SessionTimeout()
+			}
+			if duration <= 0 {
+				fmt.Fprintf(ui.Out, "%sError: Sessions are disabled%s\n", ui.DangerBright, ui.Reset)
+				fmt.Fprintf(ui.Out, "%sTip: Set general.session_timeout in the config, or pass '%s--for%s'.%s\n", ui.TextMuted, ui.InfoBright, ui.TextMuted, ui.Reset)
+				return nil
+			}
+
+			// Check if vault exists first
+			if _, err := os.Stat(vaultPath); os.IsNotExist(err) {
+				fmt.Fprintf(ui.Out, "%sError: Vault file not found at %s%s\n", ui.DangerBright, vaultPath, ui.Reset)
+				fmt.Fprintf(ui.Out, "%sTip: Run '%s%sgotp %sinit%s' to create a new secure vault.%s\n", ui.TextMuted, ui.Reset, ui.SuccessBright, ui.WarningBright, ui.TextMuted, ui.Reset)
+				return nil
+			}
+
+			// Without an agent there is nowhere to keep the key, so do not
+			// ask for the password.
+			if _, err := agent.List(); err != nil {
+				if errors.Is(err, agent.ErrNotRunning) {
+					fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+					fmt.Fprintf(ui.Out, "%sTip: Start it with '%s%sgotp %sagent &%s'.%s\n", ui.TextMuted, ui.Reset, ui.SuccessBright, ui.WarningBright, ui.TextMuted, ui.Reset)
+					return nil
+				}
+				fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+
+			v, key, err := vault.LoadVaultInteractive(vaultPath, ui.PromptPassword)
+			if err != nil {
+				fmt.Fprintf(ui.Out, "%sError: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+			defer v.Destroy()
+
+			if err := vault.SaveSession(vaultPath, key, duration); err != nil {
+				fmt.Fprintf(ui.Out, "%sError: Failed to unlock: %v%s\n", ui.DangerBright, err, ui.Reset)
+				return nil
+			}
+
+			until := time.Now().Add(duration)
+			fmt.Fprintf(ui.Out, "%s✓ Vault %s unlocked until %s%s\n", ui.SuccessBright, vaultPath, until.Format("15:04:05"), ui.Reset)
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&duration, "for", 0, "How long to keep the vault unlocked (default: general.session_timeout)")
+	return cmd
+}
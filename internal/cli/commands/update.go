@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/zulfikawr/gotp/internal/cli/ui"
+	"github.com/zulfikawr/gotp/internal/vault"
+)
+
+// errReported stops an update whose function has already told the user
+// why.
+var errReported = errors.New("update stopped")
+
+// updateVault applies fn to the vault under the vault lock, backs it up
+// and saves it; see vault.Update. Errors from fn other than errReported
+// are reported as a failure to save.
+func updateVault(vaultPath string, key []byte, fn func(*vault.Vault) error) bool {
+	return updateVaultKey(vaultPath, key, func(v *vault.Vault) ([]byte, error) {
+		return key, fn(v)
+	})
+}
+
+// updateVaultKey is like updateVault, but saves the vault with the master
+// key fn returns; see vault.UpdateKey.
+func updateVaultKey(vaultPath string, key []byte, fn func(*vault.Vault) ([]byte, error)) bool {
+	err := vault.UpdateKey(vaultPath, key, func(v *vault.Vault) ([]byte, error) {
+		newKey, err := fn(v)
+		if err != nil {
+			return nil, err
+		}
+		if err := vault.CreateBackup(vaultPath, 3); err != nil {
+			fmt.Fprintf(ui.Out, "%sWarning: failed to create backup: %v%s\n", ui.WarningBright, err, ui.Reset)
+		}
+		return newKey, nil
+	})
+	if err != nil && !errors.Is(err, errReported) {
+		fmt.Fprintf(ui.Out, "%sError: Failed to save vault: %v%s\n", ui.DangerBright, err, ui.Reset)
+	}
+	return err == nil
+}
@@ -35,3 +35,9 @@ func PrintCodeDisplay(name, code string, remaining, total int) {
 	fmt.Fprintf(Out, "%s%s%s\n", PrimaryBright+Bold, name, Reset)
 	fmt.Fprintf(Out, "%s└──  %s%s%s  |  %s %s%d%ss remaining...\n", TextMuted, WarningBright+Bold, code, Reset, ProgressBar(remaining, total, 10), TextMuted, remaining, Reset)
 }
+
+// PrintHOTPDisplay displays a counter-based (HOTP) code with the counter value it was generated for.
+func PrintHOTPDisplay(name, code string, counter uint64) {
+	fmt.Fprintf(Out, "%s%s%s\n", PrimaryBright+Bold, name, Reset)
+	fmt.Fprintf(Out, "%s└──  %s%s%s  |  %scounter %d%s\n", TextMuted, WarningBright+Bold, code, Reset, TextMuted, counter, Reset)
+}
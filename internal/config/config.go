@@ -45,6 +45,8 @@ type SecurityConfig struct {
 	BackupCount       int    `yaml:"backup_count"`
 	AutoLock          bool   `yaml:"auto_lock"`
 	AutoLockTimeout   int    `yaml:"auto_lock_timeout"`
+	Keyfile           string `yaml:"keyfile"`
+	Identity          string `yaml:"identity"`
 }
 
 // DefaultConfig returns the default configuration.
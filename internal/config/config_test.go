@@ -25,6 +25,18 @@ func TestConfig_Basics(t *testing.T) {
 	if cfg2.TUI.Theme != cfg.TUI.Theme {
 		t.Error("Loaded config mismatch")
 	}
+
+	os.WriteFile(configPath, []byte("security:\n  keyfile: ~/gotp.key\n  identity: ~/gotp.id\n"), 0600)
+	cfg3, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg3.Security.Keyfile != "~/gotp.key" || cfg3.Security.Identity != "~/gotp.id" {
+		t.Errorf("Unexpected keyfile %q and identity %q", cfg3.Security.Keyfile, cfg3.Security.Identity)
+	}
+	if cfg3.Security.BackupCount != 3 {
+		t.Error("Expected defaults for unset fields")
+	}
 }
 
 func TestPaths(t *testing.T) {
@@ -38,4 +50,12 @@ func TestPaths(t *testing.T) {
 	if dir == "" {
 		t.Error("Config dir should not be empty")
 	}
+
+	home, _ := os.UserHomeDir()
+	if got := ExpandPath("~/gotp.key"); got != filepath.Join(home, "gotp.key") {
+		t.Errorf("ExpandPath(~/gotp.key) = %q", got)
+	}
+	if got := ExpandPath("/tmp/gotp.key"); got != "/tmp/gotp.key" {
+		t.Errorf("ExpandPath(/tmp/gotp.key) = %q", got)
+	}
 }
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 )
 
 var vaultPathOverride string
@@ -38,6 +39,19 @@ func GetVaultPath() string {
 	return filepath.Join(GetDefaultConfigDir(), "vault.enc")
 }
 
+// ExpandPath expands a leading "~" in a path from the configuration file to
+// the user's home directory.
+func ExpandPath(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
 // GetConfigPath returns the full path to the default configuration file.
 func GetConfigPath() string {
 	return filepath.Join(GetDefaultConfigDir(), "config.yaml")
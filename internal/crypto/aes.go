@@ -1,53 +1,23 @@
 package crypto
 
-import (
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
-	"errors"
-	"io"
-)
-
 // Encrypt encrypts data using AES-256-GCM with a random nonce.
-// The nonce is prepended to the ciphertext.
-func Encrypt(plaintext []byte, key []byte) ([]byte, error) {
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, err
-	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, err
-	}
-
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return nil, err
-	}
-
-	// Seal appends the ciphertext to the nonce.
-	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+// The nonce is prepended to the ciphertext. The additional data is
+// authenticated but not encrypted, and must be passed unchanged to Decrypt;
+// it may be nil.
+func Encrypt(plaintext []byte, key []byte, additionalData []byte) ([]byte, error) {
+	return CipherAES256GCM.Encrypt(plaintext, key, additionalData)
 }
 
 // Decrypt decrypts data encrypted with AES-256-GCM.
-// It expects the nonce to be prepended to the ciphertext.
-func Decrypt(ciphertext []byte, key []byte) ([]byte, error) {
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, err
-	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, err
-	}
-
-	nonceSize := gcm.NonceSize()
-	if len(ciphertext) < nonceSize {
-		return nil, errors.New("ciphertext too short")
-	}
+// It expects the nonce to be prepended to the ciphertext, and fails unless
+// additionalData matches the data given to Encrypt.
+func Decrypt(ciphertext []byte, key []byte, additionalData []byte) ([]byte, error) {
+	return CipherAES256GCM.Decrypt(ciphertext, key, additionalData)
+}
 
-	nonce, actualCiphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
-	return gcm.Open(nil, nonce, actualCiphertext, nil)
+// DecryptToBuffer is like Decrypt, but opens the plaintext directly into a
+// SecureBuffer, so that it never sits in heap memory. The caller must
+// Destroy the buffer.
+func DecryptToBuffer(ciphertext []byte, key []byte, additionalData []byte) (*SecureBuffer, error) {
+	return CipherAES256GCM.DecryptToBuffer(ciphertext, key, additionalData)
 }
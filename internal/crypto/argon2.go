@@ -2,23 +2,15 @@ package crypto
 
 import (
 	"crypto/rand"
+	"fmt"
 	"io"
-
-	"golang.org/x/crypto/argon2"
+	"time"
 )
 
-// Argon2Params defines the parameters for the Argon2id key derivation function.
-type Argon2Params struct {
-	Memory      uint32 `json:"memory"`
-	Iterations  uint32 `json:"iterations"`
-	Parallelism uint8  `json:"parallelism"`
-	SaltLength  uint32 `json:"salt_length"`
-	KeyLength   uint32 `json:"key_length"`
-}
-
 // DefaultArgon2Params returns the recommended parameters for Argon2id.
-func DefaultArgon2Params() Argon2Params {
-	return Argon2Params{
+func DefaultArgon2Params() KDFParams {
+	return KDFParams{
+		Algorithm:   KDFArgon2id,
 		Memory:      65536, // 64MB
 		Iterations:  3,
 		Parallelism: 4,
@@ -27,16 +19,78 @@ func DefaultArgon2Params() Argon2Params {
 	}
 }
 
-// DeriveKey derives a cryptographic key from a password and salt using Argon2id.
-func DeriveKey(password []byte, salt []byte, params Argon2Params) []byte {
-	return argon2.IDKey(
-		password,
-		salt,
-		params.Iterations,
-		params.Memory,
-		params.Parallelism,
-		params.KeyLength,
-	)
+// maxArgon2Memory (KiB) and maxArgon2Iterations bound the cost of Argon2id,
+// so that parameters read from a tampered file cannot exhaust memory or
+// make unlocking take hours.
+const (
+	maxArgon2Memory     = 4 << 20 // 4 GiB, as maxScryptMemory
+	maxArgon2Iterations = 1024
+)
+
+func (p KDFParams) validateArgon2() error {
+	if p.Iterations < 1 {
+		return fmt.Errorf("argon2 iterations must be at least 1")
+	}
+	if p.Iterations > maxArgon2Iterations {
+		return fmt.Errorf("argon2 iterations must be at most %d", maxArgon2Iterations)
+	}
+	if p.Parallelism < 1 {
+		return fmt.Errorf("argon2 parallelism must be at least 1")
+	}
+	if p.Memory < 8*uint32(p.Parallelism) {
+		return fmt.Errorf("argon2 memory must be at least 8 KiB per thread")
+	}
+	if p.Memory > maxArgon2Memory {
+		return fmt.Errorf("argon2 memory must be at most %d MiB", maxArgon2Memory/1024)
+	}
+	return nil
+}
+
+// MinCalibratedMemory is the least memory, in KiB, CalibrateArgon2 reduces
+// the parameters to (19 MiB, the OWASP minimum for Argon2id).
+const MinCalibratedMemory = 19 * 1024
+
+// CalibrateArgon2 benchmarks Argon2id on this machine and returns base with
+// as many iterations as fit in target, up to the most Validate accepts. If
+// a single iteration takes longer than target, the memory is halved until
+// it fits, but not below MinCalibratedMemory.
+func CalibrateArgon2(target time.Duration, base KDFParams) (KDFParams, error) {
+	if target <= 0 {
+		return base, fmt.Errorf("the calibration target must be positive")
+	}
+	if base.KDF() != KDFArgon2id {
+		return base, fmt.Errorf("cannot calibrate %s parameters as Argon2id", base.KDF())
+	}
+	p := base
+	p.Iterations = 1
+	if err := p.Validate(); err != nil {
+		return base, err
+	}
+
+	elapsed, err := timeKDF(p)
+	if err != nil {
+		return base, err
+	}
+	for elapsed > target && p.Memory/2 >= MinCalibratedMemory && p.Memory/2 >= 8*uint32(p.Parallelism) {
+		p.Memory /= 2
+		if elapsed, err = timeKDF(p); err != nil {
+			return base, err
+		}
+	}
+	if elapsed > 0 && elapsed < target {
+		p.Iterations = uint32(min(target/elapsed, maxArgon2Iterations))
+	}
+	return p, nil
+}
+
+// timeKDF measures one key derivation with p.
+func timeKDF(p KDFParams) (time.Duration, error) {
+	salt := make([]byte, p.SaltLength)
+	start := time.Now()
+	key, err := DeriveKey([]byte("gotp calibration"), salt, p)
+	elapsed := time.Since(start)
+	ZeroBytes(key)
+	return elapsed, err
 }
 
 // GenerateSalt generates a random salt of the specified length.
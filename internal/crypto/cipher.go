@@ -0,0 +1,109 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Cipher identifies an authenticated encryption algorithm. The empty
+// Cipher is AES-256-GCM, the only cipher before ciphers were selectable.
+type Cipher string
+
+const (
+	// CipherAES256GCM is AES-256 in GCM mode with a 12-byte random nonce.
+	CipherAES256GCM Cipher = "aes-256-gcm"
+	// CipherXChaCha20Poly1305 is XChaCha20-Poly1305 with a 24-byte random
+	// nonce, which is long enough never to repeat and fast without AES
+	// hardware support.
+	CipherXChaCha20Poly1305 Cipher = "xchacha20-poly1305"
+)
+
+// ParseCipher returns the cipher named s.
+func ParseCipher(s string) (Cipher, error) {
+	switch c := Cipher(s); c {
+	case CipherAES256GCM, CipherXChaCha20Poly1305:
+		return c, nil
+	}
+	return "", fmt.Errorf("unsupported cipher %q (use %s or %s)", s, CipherAES256GCM, CipherXChaCha20Poly1305)
+}
+
+func (c Cipher) aead(key []byte) (cipher.AEAD, error) {
+	switch c {
+	case "", CipherAES256GCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case CipherXChaCha20Poly1305:
+		return chacha20poly1305.NewX(key)
+	}
+	return nil, fmt.Errorf("unsupported cipher %q", string(c))
+}
+
+// Encrypt encrypts data with the cipher and a random nonce, which is
+// prepended to the ciphertext. The additional data is authenticated but not
+// encrypted, and must be passed unchanged to Decrypt; it may be nil.
+func (c Cipher) Encrypt(plaintext []byte, key []byte, additionalData []byte) ([]byte, error) {
+	aead, err := c.aead(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	// Seal appends the ciphertext to the nonce.
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// Decrypt decrypts data encrypted with the cipher. It expects the nonce to
+// be prepended to the ciphertext, and fails unless additionalData matches
+// the data given to Encrypt.
+func (c Cipher) Decrypt(ciphertext []byte, key []byte, additionalData []byte) ([]byte, error) {
+	aead, err := c.aead(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := aead.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce, actualCiphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
+	return aead.Open(nil, nonce, actualCiphertext, additionalData)
+}
+
+// DecryptToBuffer is like Decrypt, but opens the plaintext directly into a
+// SecureBuffer, so that it never sits in heap memory. The caller must
+// Destroy the buffer.
+func (c Cipher) DecryptToBuffer(ciphertext []byte, key []byte, additionalData []byte) (*SecureBuffer, error) {
+	aead, err := c.aead(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aead.NonceSize()+aead.Overhead() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce, actualCiphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	buf, err := NewSecureBuffer(len(actualCiphertext) - aead.Overhead())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := aead.Open(buf.Bytes()[:0], nonce, actualCiphertext, additionalData); err != nil {
+		buf.Destroy()
+		return nil, err
+	}
+	return buf, nil
+}
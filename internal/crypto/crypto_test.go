@@ -2,7 +2,17 @@ package crypto
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"math"
+	"strings"
 	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
 func TestZeroBytes(t *testing.T) {
@@ -20,15 +30,18 @@ func TestEncryptionRoundtrip(t *testing.T) {
 	salt, _ := GenerateSalt(16)
 	params := DefaultArgon2Params()
 
-	key := DeriveKey(password, salt, params)
+	key, err := DeriveKey(password, salt, params)
+	if err != nil {
+		t.Fatalf("DeriveKey failed: %v", err)
+	}
 	plaintext := []byte("secret account data")
 
-	ciphertext, err := Encrypt(plaintext, key)
+	ciphertext, err := Encrypt(plaintext, key, nil)
 	if err != nil {
 		t.Fatalf("Encryption failed: %v", err)
 	}
 
-	decrypted, err := Decrypt(ciphertext, key)
+	decrypted, err := Decrypt(ciphertext, key, nil)
 	if err != nil {
 		t.Fatalf("Decryption failed: %v", err)
 	}
@@ -38,20 +51,266 @@ func TestEncryptionRoundtrip(t *testing.T) {
 	}
 }
 
+func TestCiphers(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	plaintext := []byte("secret account data")
+
+	for _, c := range []Cipher{CipherAES256GCM, CipherXChaCha20Poly1305} {
+		if parsed, err := ParseCipher(string(c)); err != nil || parsed != c {
+			t.Errorf("ParseCipher(%q) = %q, %v", c, parsed, err)
+		}
+		ciphertext, err := c.Encrypt(plaintext, key, []byte("ad"))
+		if err != nil {
+			t.Fatalf("%s: Encrypt failed: %v", c, err)
+		}
+		decrypted, err := c.Decrypt(ciphertext, key, []byte("ad"))
+		if err != nil || !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("%s: Decrypt failed: %v", c, err)
+		}
+		buf, err := c.DecryptToBuffer(ciphertext, key, []byte("ad"))
+		if err != nil || !bytes.Equal(buf.Bytes(), plaintext) {
+			t.Errorf("%s: DecryptToBuffer failed: %v", c, err)
+		}
+		buf.Destroy()
+		if _, err := c.Decrypt(ciphertext, key, []byte("other")); err == nil {
+			t.Errorf("%s: expected an error for changed associated data", c)
+		}
+	}
+
+	// The nonce lengths differ, so each cipher rejects the other's output.
+	ciphertext, _ := CipherXChaCha20Poly1305.Encrypt(plaintext, key, nil)
+	if _, err := CipherAES256GCM.Decrypt(ciphertext, key, nil); err == nil {
+		t.Error("Expected AES-256-GCM to reject an XChaCha20-Poly1305 ciphertext")
+	}
+	// The empty cipher is AES-256-GCM.
+	ciphertext, _ = Encrypt(plaintext, key, nil)
+	if _, err := Cipher("").Decrypt(ciphertext, key, nil); err != nil {
+		t.Errorf("Expected the empty cipher to decrypt AES-256-GCM: %v", err)
+	}
+
+	if _, err := ParseCipher("rot13"); err == nil {
+		t.Error("Expected an error for an unsupported cipher")
+	}
+	if _, err := Cipher("rot13").Encrypt(plaintext, key, nil); err == nil {
+		t.Error("Expected Encrypt to reject an unsupported cipher")
+	}
+}
+
 func TestDecryptionFailure(t *testing.T) {
 	key := make([]byte, 32)
 	wrongKey := make([]byte, 32)
 	wrongKey[0] = 1
 
 	plaintext := []byte("data")
-	ciphertext, _ := Encrypt(plaintext, key)
+	ciphertext, _ := Encrypt(plaintext, key, nil)
 
-	_, err := Decrypt(ciphertext, wrongKey)
+	_, err := Decrypt(ciphertext, wrongKey, nil)
 	if err == nil {
 		t.Error("Expected error for decryption with wrong key, got nil")
 	}
 }
 
+func TestAdditionalData(t *testing.T) {
+	key := make([]byte, 32)
+	plaintext := []byte("data")
+
+	ciphertext, err := Encrypt(plaintext, key, []byte("header"))
+	if err != nil {
+		t.Fatalf("Encryption failed: %v", err)
+	}
+
+	decrypted, err := Decrypt(ciphertext, key, []byte("header"))
+	if err != nil || !bytes.Equal(decrypted, plaintext) {
+		t.Fatalf("Decryption with matching additional data failed: %v", err)
+	}
+	if _, err := Decrypt(ciphertext, key, []byte("HEADER")); err == nil {
+		t.Error("Expected error for modified additional data")
+	}
+	if _, err := Decrypt(ciphertext, key, nil); err == nil {
+		t.Error("Expected error for missing additional data")
+	}
+}
+
+func TestMAC(t *testing.T) {
+	key, err := DeriveSubkey(make([]byte, 32), "test")
+	if err != nil {
+		t.Fatalf("DeriveSubkey failed: %v", err)
+	}
+	other, _ := DeriveSubkey(make([]byte, 32), "other")
+	if len(key) != 32 || bytes.Equal(key, other) {
+		t.Fatal("Expected distinct 32-byte subkeys for different purposes")
+	}
+
+	mac := MAC(key, []byte("header"))
+	if !VerifyMAC(key, []byte("header"), mac) {
+		t.Error("Expected MAC to verify")
+	}
+	if VerifyMAC(key, []byte("header2"), mac) || VerifyMAC(other, []byte("header"), mac) {
+		t.Error("Expected MAC to fail for different data or key")
+	}
+}
+
+func TestArgon2ParamsValidate(t *testing.T) {
+	if err := DefaultArgon2Params().Validate(); err != nil {
+		t.Errorf("Default parameters should be valid: %v", err)
+	}
+	for _, salt := range []uint32{16, 64} {
+		p := DefaultArgon2Params()
+		p.SaltLength = salt
+		if err := p.Validate(); err != nil {
+			t.Errorf("A %d-byte salt should be valid: %v", salt, err)
+		}
+	}
+
+	invalid := []KDFParams{
+		{},
+		{Memory: 65536, Iterations: 0, Parallelism: 4, KeyLength: 32},
+		{Memory: 65536, Iterations: 3, Parallelism: 0, KeyLength: 32},
+		{Memory: 16, Iterations: 3, Parallelism: 4, KeyLength: 32},
+		{Memory: 65536, Iterations: 3, Parallelism: 4, KeyLength: 8},
+		{Memory: maxArgon2Memory + 1, Iterations: 3, Parallelism: 4, KeyLength: 32},
+		{Memory: 65536, Iterations: maxArgon2Iterations + 1, Parallelism: 4, KeyLength: 32},
+		{Memory: math.MaxUint32, Iterations: math.MaxUint32, Parallelism: 4, KeyLength: 32},
+		{Memory: 65536, Iterations: 3, Parallelism: 4, SaltLength: 16, KeyLength: 64},
+		{Memory: 65536, Iterations: 3, Parallelism: 4, SaltLength: 16, KeyLength: math.MaxUint32},
+		{Memory: 65536, Iterations: 3, Parallelism: 4, SaltLength: 0, KeyLength: 32},
+		{Memory: 65536, Iterations: 3, Parallelism: 4, SaltLength: 8, KeyLength: 32},
+		{Memory: 65536, Iterations: 3, Parallelism: 4, SaltLength: 65, KeyLength: 32},
+		{Memory: 65536, Iterations: 3, Parallelism: 4, SaltLength: math.MaxUint32, KeyLength: 32},
+	}
+	for _, p := range invalid {
+		if err := p.Validate(); err == nil {
+			t.Errorf("Expected error for parameters %+v", p)
+		}
+	}
+}
+
+func TestCalibrateArgon2(t *testing.T) {
+	base := KDFParams{Memory: MinCalibratedMemory, Iterations: 5, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+	p, err := CalibrateArgon2(time.Nanosecond, base)
+	if err != nil {
+		t.Fatalf("CalibrateArgon2 failed: %v", err)
+	}
+	if p.Iterations != 1 || p.Memory != MinCalibratedMemory {
+		t.Errorf("Expected one iteration at the minimum memory for an unreachable target, got %+v", p)
+	}
+	if err := p.Validate(); err != nil {
+		t.Errorf("Calibrated parameters should be valid: %v", err)
+	}
+
+	p, err = CalibrateArgon2(time.Minute, base)
+	if err != nil {
+		t.Fatalf("CalibrateArgon2 failed: %v", err)
+	}
+	if p.Iterations <= 1 || p.Memory != base.Memory || p.Parallelism != base.Parallelism {
+		t.Errorf("Expected more iterations at the base memory for a long target, got %+v", p)
+	}
+	if err := p.Validate(); err != nil {
+		t.Errorf("Parameters calibrated for a long target should be valid: %v", err)
+	}
+
+	if _, err := CalibrateArgon2(0, base); err == nil {
+		t.Error("Expected an error for a zero target")
+	}
+	if _, err := CalibrateArgon2(time.Second, KDFParams{}); err == nil {
+		t.Error("Expected an error for invalid base parameters")
+	}
+}
+
+func TestScrypt(t *testing.T) {
+	if err := DefaultScryptParams().Validate(); err != nil {
+		t.Errorf("Default scrypt parameters should be valid: %v", err)
+	}
+	if kdf, err := ParseKDF("scrypt"); err != nil || kdf != KDFScrypt {
+		t.Errorf("ParseKDF(scrypt) = %q, %v", kdf, err)
+	}
+	if _, err := ParseKDF("pbkdf2"); err == nil {
+		t.Error("Expected an error for an unsupported KDF")
+	}
+
+	params := KDFParams{Algorithm: KDFScrypt, N: 1024, R: 8, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	salt := make([]byte, 16)
+	key := deriveKey(t, []byte("password"), salt, params)
+	if len(key) != 32 || !bytes.Equal(key, deriveKey(t, []byte("password"), salt, params)) {
+		t.Error("Expected a deterministic 32-byte key")
+	}
+	argon := KDFParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	if bytes.Equal(key, deriveKey(t, []byte("password"), salt, argon)) {
+		t.Error("Expected scrypt and Argon2id to derive different keys")
+	}
+	if argon.KDF() != KDFArgon2id {
+		t.Error("Expected parameters without an algorithm to be Argon2id")
+	}
+
+	invalid := []KDFParams{
+		{Algorithm: KDFScrypt, N: 1000, R: 8, Parallelism: 1, KeyLength: 32},
+		{Algorithm: KDFScrypt, N: 1, R: 8, Parallelism: 1, KeyLength: 32},
+		{Algorithm: KDFScrypt, N: 1024, R: 0, Parallelism: 1, KeyLength: 32},
+		{Algorithm: KDFScrypt, N: 1024, R: 8, Parallelism: 0, KeyLength: 32},
+		{Algorithm: KDFScrypt, N: 1 << 30, R: 8, Parallelism: 1, KeyLength: 32},
+		{Algorithm: "pbkdf2", Iterations: 1000, Parallelism: 1, KeyLength: 32},
+		{Algorithm: KDFScrypt, N: 1024, R: 8, Parallelism: 1, SaltLength: 16, KeyLength: 1 << 30},
+		{Algorithm: KDFScrypt, N: 1024, R: 8, Parallelism: 1, SaltLength: 1 << 30, KeyLength: 32},
+	}
+	for _, p := range invalid {
+		if err := p.Validate(); err == nil {
+			t.Errorf("Expected error for parameters %+v", p)
+		}
+		// Invalid parameters are an error rather than a panic in the KDF.
+		if _, err := DeriveKey([]byte("password"), salt, p); err == nil {
+			t.Errorf("Expected DeriveKey to reject parameters %+v", p)
+		}
+	}
+
+	p, err := CalibrateScrypt(time.Nanosecond, KDFParams{Algorithm: KDFScrypt, N: MinCalibratedScryptN, R: 8, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	if err != nil || p.N != MinCalibratedScryptN {
+		t.Errorf("Expected the minimum N for an unreachable target, got %+v, %v", p, err)
+	}
+	if _, err := CalibrateScrypt(time.Second, DefaultArgon2Params()); err == nil {
+		t.Error("Expected CalibrateScrypt to reject Argon2id parameters")
+	}
+}
+
+func TestDeriveKeyWithKeyfile(t *testing.T) {
+	params := KDFParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	salt := make([]byte, 16)
+	password := []byte("password")
+
+	withKeyfile := func(password, keyfile []byte) []byte {
+		key, err := DeriveKeyWithKeyfile(password, keyfile, salt, params)
+		if err != nil {
+			t.Fatalf("DeriveKeyWithKeyfile failed: %v", err)
+		}
+		return key
+	}
+
+	key := withKeyfile(password, []byte("keyfile"))
+	if !bytes.Equal(key, withKeyfile(password, []byte("keyfile"))) {
+		t.Error("Expected a deterministic key")
+	}
+	if bytes.Equal(key, deriveKey(t, password, salt, params)) {
+		t.Error("Expected the keyfile to change the key")
+	}
+	if bytes.Equal(key, withKeyfile(password, []byte("other"))) {
+		t.Error("Expected a different keyfile to change the key")
+	}
+	if bytes.Equal(key, withKeyfile([]byte("other"), []byte("keyfile"))) {
+		t.Error("Expected a different password to change the key")
+	}
+}
+
+// deriveKey calls DeriveKey and fails the test on an error.
+func deriveKey(t *testing.T, password, salt []byte, params KDFParams) []byte {
+	t.Helper()
+	key, err := DeriveKey(password, salt, params)
+	if err != nil {
+		t.Fatalf("DeriveKey failed: %v", err)
+	}
+	return key
+}
+
 func TestSecureCompare(t *testing.T) {
 	a := []byte("hello")
 	b := []byte("hello")
@@ -77,19 +336,198 @@ func TestGenerateSalt(t *testing.T) {
 
 func TestEncryptionErrorCases(t *testing.T) {
 	// Invalid key size
-	_, err := Encrypt([]byte("data"), []byte("short"))
+	_, err := Encrypt([]byte("data"), []byte("short"), nil)
 	if err == nil {
 		t.Error("Expected error for invalid key size in Encrypt")
 	}
 
-	_, err = Decrypt([]byte("data"), []byte("short"))
+	_, err = Decrypt([]byte("data"), []byte("short"), nil)
 	if err == nil {
 		t.Error("Expected error for invalid key size in Decrypt")
 	}
 
 	// Ciphertext too short
-	_, err = Decrypt([]byte("abc"), make([]byte, 32))
+	_, err = Decrypt([]byte("abc"), make([]byte, 32), nil)
 	if err == nil {
 		t.Error("Expected error for short ciphertext in Decrypt")
 	}
 }
+
+func TestShamir(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	shares, err := SplitSecret(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("SplitSecret failed: %v", err)
+	}
+	if len(shares) != 5 {
+		t.Fatalf("Expected 5 shares, got %d", len(shares))
+	}
+
+	// Every combination of 3 shares reconstructs the secret.
+	for a := 0; a < 5; a++ {
+		for b := a + 1; b < 5; b++ {
+			for c := b + 1; c < 5; c++ {
+				got, err := CombineShares([]Share{shares[c], shares[a], shares[b]})
+				if err != nil {
+					t.Fatalf("CombineShares failed: %v", err)
+				}
+				if !bytes.Equal(got, secret) {
+					t.Errorf("Shares %d, %d, %d did not reconstruct the secret", a+1, b+1, c+1)
+				}
+			}
+		}
+	}
+
+	if got, _ := CombineShares(shares[:2]); bytes.Equal(got, secret) {
+		t.Error("Two shares should not reconstruct the secret")
+	}
+	if _, err := CombineShares([]Share{shares[0], shares[0], shares[1]}); err == nil {
+		t.Error("Expected an error for duplicate shares")
+	}
+
+	for _, tc := range []struct{ n, threshold int }{{5, 1}, {2, 3}, {256, 3}} {
+		if _, err := SplitSecret(secret, tc.n, tc.threshold); err == nil {
+			t.Errorf("Expected an error for %d shares with threshold %d", tc.n, tc.threshold)
+		}
+	}
+
+	for a := 1; a < 256; a++ {
+		if gfMul(byte(a), gfInverse(byte(a))) != 1 {
+			t.Fatalf("gfInverse(%d) is wrong", a)
+		}
+	}
+}
+
+func TestBech32(t *testing.T) {
+	for _, s := range []string{"A12UEL5L", "abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw"} {
+		if _, _, err := bech32Decode(s); err != nil {
+			t.Errorf("bech32Decode(%q) failed: %v", s, err)
+		}
+	}
+	for _, s := range []string{"A12UEL5l", "abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxx", "1qzzfhee"} {
+		if _, _, err := bech32Decode(s); err == nil {
+			t.Errorf("bech32Decode(%q) should fail", s)
+		}
+	}
+}
+
+func TestX25519Keys(t *testing.T) {
+	alice, err := GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity failed: %v", err)
+	}
+	bob, _ := GenerateX25519Identity()
+
+	recipient := FormatRecipient(alice.PublicKey())
+	if !strings.HasPrefix(recipient, "age1") {
+		t.Errorf("Unexpected recipient %q", recipient)
+	}
+	pub, err := ParseRecipient(recipient)
+	if err != nil || !pub.Equal(alice.PublicKey()) {
+		t.Fatalf("ParseRecipient round trip failed: %v", err)
+	}
+
+	identity := FormatIdentity(alice)
+	if !strings.HasPrefix(identity, "AGE-SECRET-KEY-1") {
+		t.Errorf("Unexpected identity %q", identity)
+	}
+	priv, err := ParseIdentity(identity)
+	if err != nil || !priv.Equal(alice) {
+		t.Fatalf("ParseIdentity round trip failed: %v", err)
+	}
+	if _, err := ParseRecipient(identity); err == nil {
+		t.Error("An identity should not parse as a recipient")
+	}
+
+	k1, err := X25519SharedKey(alice, bob.PublicKey(), []byte("salt"), "test")
+	if err != nil {
+		t.Fatalf("X25519SharedKey failed: %v", err)
+	}
+	k2, _ := X25519SharedKey(bob, alice.PublicKey(), []byte("salt"), "test")
+	if !bytes.Equal(k1, k2) || len(k1) != 32 {
+		t.Error("Both sides should derive the same key")
+	}
+}
+
+func TestSecureBuffer(t *testing.T) {
+	src := []byte("secret key material")
+	want := append([]byte(nil), src...)
+
+	buf, err := NewSecureBufferFrom(src)
+	if err != nil {
+		t.Fatalf("NewSecureBufferFrom failed: %v", err)
+	}
+	if !bytes.Equal(src, make([]byte, len(src))) {
+		t.Error("Source should be wiped")
+	}
+	if !bytes.Equal(buf.Bytes(), want) || buf.Len() != len(want) {
+		t.Errorf("Buffer holds %q, want %q", buf.Bytes(), want)
+	}
+	if cap(buf.Bytes()) != len(want) {
+		t.Errorf("Capacity %d should equal length %d", cap(buf.Bytes()), len(want))
+	}
+
+	buf.Destroy()
+	if buf.Bytes() != nil || buf.Locked() {
+		t.Error("Destroyed buffer should be empty")
+	}
+	buf.Destroy()
+
+	var nilBuf *SecureBuffer
+	nilBuf.Destroy()
+
+	empty, err := NewSecureBuffer(0)
+	if err != nil || empty.Len() != 0 {
+		t.Fatalf("Empty buffer failed: %v", err)
+	}
+	empty.Destroy()
+
+	key := make([]byte, 32)
+	ciphertext, _ := Encrypt(want, key, []byte("ad"))
+	decrypted, err := DecryptToBuffer(ciphertext, key, []byte("ad"))
+	if err != nil {
+		t.Fatalf("DecryptToBuffer failed: %v", err)
+	}
+	defer decrypted.Destroy()
+	if !bytes.Equal(decrypted.Bytes(), want) {
+		t.Error("DecryptToBuffer round trip failed")
+	}
+	if _, err := DecryptToBuffer(ciphertext, key, nil); err == nil {
+		t.Error("Expected error for wrong additional data")
+	}
+}
+
+func TestDeriveKeyFromSSHAgent(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: priv, Comment: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	signer, _ := ssh.NewSignerFromKey(priv)
+	pub := signer.PublicKey()
+
+	k1, err := DeriveKeyFromSSHAgent(keyring, pub, []byte("challenge"))
+	if err != nil {
+		t.Fatalf("DeriveKeyFromSSHAgent failed: %v", err)
+	}
+	k2, _ := DeriveKeyFromSSHAgent(keyring, pub, []byte("challenge"))
+	if len(k1) != 32 || !bytes.Equal(k1, k2) {
+		t.Error("Ed25519 signatures should derive the same key every time")
+	}
+	if k3, _ := DeriveKeyFromSSHAgent(keyring, pub, []byte("other")); bytes.Equal(k1, k3) {
+		t.Error("Another challenge should derive another key")
+	}
+
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	otherSigner, _ := ssh.NewSignerFromKey(other)
+	if _, err := DeriveKeyFromSSHAgent(keyring, otherSigner.PublicKey(), []byte("challenge")); err == nil {
+		t.Error("Expected error for a key the agent does not hold")
+	}
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_ = keyring.Add(agent.AddedKey{PrivateKey: ecKey})
+	ecSigner, _ := ssh.NewSignerFromKey(ecKey)
+	if _, err := DeriveKeyFromSSHAgent(keyring, ecSigner.PublicKey(), []byte("challenge")); err == nil || !strings.Contains(err.Error(), "Ed25519") {
+		t.Errorf("Expected non-Ed25519 keys to be rejected, got %v", err)
+	}
+}
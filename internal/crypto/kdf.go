@@ -0,0 +1,115 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// KDF identifies a password-based key derivation function.
+type KDF string
+
+const (
+	// KDFArgon2id is Argon2id (RFC 9106), the default.
+	KDFArgon2id KDF = "argon2id"
+	// KDFScrypt is scrypt (RFC 7914), as used by Aegis and age.
+	KDFScrypt KDF = "scrypt"
+)
+
+// ParseKDF returns the KDF named s.
+func ParseKDF(s string) (KDF, error) {
+	switch k := KDF(s); k {
+	case KDFArgon2id, KDFScrypt:
+		return k, nil
+	}
+	return "", fmt.Errorf("unsupported KDF %q (use %s or %s)", s, KDFArgon2id, KDFScrypt)
+}
+
+// KDFParams defines the key derivation function and its parameters.
+// Parameters without an Algorithm predate scrypt support and are Argon2id.
+//
+// Argon2id uses Memory (KiB), Iterations and Parallelism; scrypt uses N,
+// R and Parallelism (p).
+type KDFParams struct {
+	Algorithm   KDF    `json:"algorithm,omitempty"`
+	Memory      uint32 `json:"memory,omitempty"`
+	Iterations  uint32 `json:"iterations,omitempty"`
+	N           uint32 `json:"n,omitempty"`
+	R           uint32 `json:"r,omitempty"`
+	Parallelism uint8  `json:"parallelism"`
+	SaltLength  uint32 `json:"salt_length"`
+	KeyLength   uint32 `json:"key_length"`
+}
+
+// KDF returns the key derivation function of the parameters.
+func (p KDFParams) KDF() KDF {
+	if p.Algorithm == "" {
+		return KDFArgon2id
+	}
+	return p.Algorithm
+}
+
+// keyLength is the length of every derived key, the key size of the
+// ciphers. minSaltLength and maxSaltLength bound the salt.
+const (
+	keyLength     = 32
+	minSaltLength = 16
+	maxSaltLength = 64
+)
+
+// Validate checks that the parameters can be used with their KDF. It guards
+// against parameters read from a damaged or tampered file, which would
+// otherwise make key derivation panic.
+func (p KDFParams) Validate() error {
+	if p.KeyLength != keyLength {
+		return fmt.Errorf("key length must be %d bytes", keyLength)
+	}
+	if p.SaltLength < minSaltLength || p.SaltLength > maxSaltLength {
+		return fmt.Errorf("salt length must be between %d and %d bytes", minSaltLength, maxSaltLength)
+	}
+	switch p.KDF() {
+	case KDFArgon2id:
+		return p.validateArgon2()
+	case KDFScrypt:
+		return p.validateScrypt()
+	}
+	return fmt.Errorf("unsupported KDF %q", p.Algorithm)
+}
+
+// DeriveKey derives a cryptographic key from a password and salt with the
+// KDF of params. Invalid parameters are rejected with the error of
+// Validate rather than passed to the KDF.
+func DeriveKey(password []byte, salt []byte, params KDFParams) ([]byte, error) {
+	if err := params.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid KDF parameters: %w", err)
+	}
+	if params.KDF() == KDFScrypt {
+		key, err := scrypt.Key(password, salt, int(params.N), int(params.R), int(params.Parallelism), int(params.KeyLength))
+		if err != nil {
+			return nil, fmt.Errorf("scrypt: %w", err)
+		}
+		return key, nil
+	}
+	return argon2.IDKey(
+		password,
+		salt,
+		params.Iterations,
+		params.Memory,
+		params.Parallelism,
+		params.KeyLength,
+	), nil
+}
+
+// DeriveKeyWithKeyfile derives a key from both a password and a keyfile.
+// The SHA-256 hash of the keyfile is prepended to the password before key
+// derivation, so neither secret alone yields the key.
+func DeriveKeyWithKeyfile(password []byte, keyfile []byte, salt []byte, params KDFParams) ([]byte, error) {
+	hash := sha256.Sum256(keyfile)
+	input := make([]byte, 0, len(hash)+len(password))
+	input = append(input, hash[:]...)
+	input = append(input, password...)
+	defer ZeroBytes(input)
+	return DeriveKey(input, salt, params)
+}
@@ -0,0 +1,27 @@
+package crypto
+
+import (
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+)
+
+// DeriveSubkey derives an independent 32-byte key for the named purpose from
+// a master key using HKDF-SHA256, so that one derived key is never used for
+// two different algorithms.
+func DeriveSubkey(key []byte, purpose string) ([]byte, error) {
+	return hkdf.Key(sha256.New, key, nil, purpose, 32)
+}
+
+// MAC returns the HMAC-SHA256 of data under key.
+func MAC(key []byte, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// VerifyMAC reports, in constant time, whether mac is the HMAC-SHA256 of
+// data under key.
+func VerifyMAC(key []byte, data []byte, mac []byte) bool {
+	return hmac.Equal(MAC(key, data), mac)
+}
@@ -0,0 +1,81 @@
+package crypto
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// DefaultScryptParams returns the scrypt parameters for new key slots:
+// N=2^15, r=8, p=1, as used by Aegis.
+func DefaultScryptParams() KDFParams {
+	return KDFParams{
+		Algorithm:   KDFScrypt,
+		N:           1 << 15,
+		R:           8,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+// maxScryptMemory bounds the memory scrypt may use (128 * N * r bytes), so
+// that parameters read from a tampered file cannot exhaust memory.
+const maxScryptMemory = 1 << 32
+
+func (p KDFParams) validateScrypt() error {
+	if p.N < 2 || p.N&(p.N-1) != 0 {
+		return fmt.Errorf("scrypt N must be a power of two greater than 1")
+	}
+	if p.R < 1 {
+		return fmt.Errorf("scrypt r must be at least 1")
+	}
+	if p.Parallelism < 1 {
+		return fmt.Errorf("scrypt parallelism must be at least 1")
+	}
+	if uint64(p.R)*uint64(p.Parallelism) >= 1<<30 {
+		return fmt.Errorf("scrypt r * p must be less than 2^30")
+	}
+	if 128*uint64(p.N)*uint64(p.R) > maxScryptMemory || 128*uint64(p.R)*uint64(p.Parallelism) > math.MaxInt32 {
+		return fmt.Errorf("scrypt parameters need too much memory")
+	}
+	return nil
+}
+
+// MinCalibratedScryptN is the least N CalibrateScrypt reduces the
+// parameters to.
+const MinCalibratedScryptN = 1 << 14
+
+// CalibrateScrypt benchmarks scrypt on this machine and returns base with
+// N doubled or halved to the largest power of two that fits in target, but
+// not below MinCalibratedScryptN.
+func CalibrateScrypt(target time.Duration, base KDFParams) (KDFParams, error) {
+	if target <= 0 {
+		return base, fmt.Errorf("the calibration target must be positive")
+	}
+	if base.KDF() != KDFScrypt {
+		return base, fmt.Errorf("cannot calibrate %s parameters as scrypt", base.KDF())
+	}
+	if err := base.Validate(); err != nil {
+		return base, err
+	}
+
+	p := base
+	elapsed, err := timeKDF(p)
+	if err != nil {
+		return base, err
+	}
+	for elapsed > target && p.N/2 >= MinCalibratedScryptN {
+		p.N /= 2
+		if elapsed, err = timeKDF(p); err != nil {
+			return base, err
+		}
+	}
+	// scrypt's cost is linear in N, so the time of larger N is estimated
+	// rather than measured.
+	for elapsed > 0 && 2*elapsed <= target && 128*2*uint64(p.N)*uint64(p.R) <= maxScryptMemory {
+		p.N *= 2
+		elapsed *= 2
+	}
+	return p, nil
+}
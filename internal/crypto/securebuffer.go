@@ -0,0 +1,70 @@
+package crypto
+
+// SecureBuffer holds a key or secret outside the Go heap, in memory that is
+// locked so that it is never swapped to disk and that sits between
+// inaccessible guard pages, so that an overflow faults instead of reading
+// or corrupting neighbouring data. The data is at the end of its pages,
+// right before the trailing guard page.
+//
+// A SecureBuffer must be released with Destroy, which wipes and unmaps it.
+// Slices returned by Bytes must not be used afterwards. Where locking is
+// not permitted (for example beyond RLIMIT_MEMLOCK) the buffer still has
+// its guard pages and Locked reports false. On platforms without mmap it
+// falls back to ordinary memory that Destroy still wipes.
+type SecureBuffer struct {
+	memory []byte
+	data   []byte
+	locked bool
+}
+
+// NewSecureBuffer allocates a zeroed SecureBuffer of size bytes.
+func NewSecureBuffer(size int) (*SecureBuffer, error) {
+	memory, data, locked, err := allocate(size)
+	if err != nil {
+		return nil, err
+	}
+	return &SecureBuffer{memory: memory, data: data, locked: locked}, nil
+}
+
+// NewSecureBufferFrom moves src into a new SecureBuffer: src is copied and
+// then wiped.
+func NewSecureBufferFrom(src []byte) (*SecureBuffer, error) {
+	b, err := NewSecureBuffer(len(src))
+	if err != nil {
+		return nil, err
+	}
+	copy(b.data, src)
+	ZeroBytes(src)
+	return b, nil
+}
+
+// Bytes returns the buffer's data. Its capacity is its length, so an append
+// copies it to the heap instead of writing into the guard page. It returns
+// nil once the buffer is destroyed.
+func (b *SecureBuffer) Bytes() []byte {
+	if b == nil {
+		return nil
+	}
+	return b.data
+}
+
+// Len returns the size of the buffer's data.
+func (b *SecureBuffer) Len() int {
+	return len(b.Bytes())
+}
+
+// Locked reports whether the buffer's memory is locked against swapping.
+func (b *SecureBuffer) Locked() bool {
+	return b != nil && b.locked
+}
+
+// Destroy wipes and releases the buffer. It is safe to call more than once
+// and on a nil buffer.
+func (b *SecureBuffer) Destroy() {
+	if b == nil || b.memory == nil {
+		return
+	}
+	ZeroBytes(b.data)
+	release(b.memory, b.locked)
+	b.memory, b.data, b.locked = nil, nil, false
+}
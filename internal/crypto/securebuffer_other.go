@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package crypto
+
+// allocate falls back to ordinary memory, without locking or guard pages,
+// on platforms without mmap.
+func allocate(size int) (memory, data []byte, locked bool, err error) {
+	memory = make([]byte, size)
+	return memory, memory[:size:size], false, nil
+}
+
+// release is a no-op for ordinary memory, which Destroy has already wiped.
+func release(memory []byte, locked bool) {}
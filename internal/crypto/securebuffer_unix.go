@@ -0,0 +1,44 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package crypto
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+var pageSize = unix.Getpagesize()
+
+// allocate maps the pages for size bytes between two guard pages and locks
+// them into memory. The data is placed right before the trailing guard
+// page.
+func allocate(size int) (memory, data []byte, locked bool, err error) {
+	inner := (size + pageSize - 1) / pageSize * pageSize
+	if inner == 0 {
+		inner = pageSize
+	}
+
+	memory, err = unix.Mmap(-1, 0, inner+2*pageSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANON)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	end := pageSize + inner
+	if err := unix.Mprotect(memory[:pageSize], unix.PROT_NONE); err != nil {
+		_ = unix.Munmap(memory)
+		return nil, nil, false, err
+	}
+	if err := unix.Mprotect(memory[end:], unix.PROT_NONE); err != nil {
+		_ = unix.Munmap(memory)
+		return nil, nil, false, err
+	}
+
+	locked = unix.Mlock(memory[pageSize:end]) == nil
+	return memory, memory[end-size : end : end], locked, nil
+}
+
+// release unlocks and unmaps memory returned by allocate.
+func release(memory []byte, locked bool) {
+	if locked {
+		_ = unix.Munlock(memory[pageSize : len(memory)-pageSize])
+	}
+	_ = unix.Munmap(memory)
+}
@@ -0,0 +1,126 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// Share is one share of a secret split with SplitSecret. Index is the
+// x-coordinate of the share (1-255) and Value holds one byte of the share
+// for each byte of the secret.
+type Share struct {
+	Index byte
+	Value []byte
+}
+
+// SplitSecret splits secret into n shares using Shamir's secret sharing
+// over GF(2^8), so that any threshold of them reconstruct it with
+// CombineShares and fewer reveal nothing about it.
+func SplitSecret(secret []byte, n, threshold int) ([]Share, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("secret is empty")
+	}
+	if threshold < 2 {
+		return nil, fmt.Errorf("threshold must be at least 2, got %d", threshold)
+	}
+	if n < threshold {
+		return nil, fmt.Errorf("number of shares (%d) must be at least the threshold (%d)", n, threshold)
+	}
+	if n > 255 {
+		return nil, fmt.Errorf("number of shares must be at most 255, got %d", n)
+	}
+
+	shares := make([]Share, n)
+	for i := range shares {
+		shares[i] = Share{Index: byte(i + 1), Value: make([]byte, len(secret))}
+	}
+
+	// One random polynomial of degree threshold-1 per secret byte, with the
+	// secret byte as its constant term.
+	coeffs := make([]byte, threshold)
+	defer ZeroBytes(coeffs)
+	for b, s := range secret {
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, err
+		}
+		coeffs[0] = s
+		for i := range shares {
+			shares[i].Value[b] = evalPolynomial(coeffs, shares[i].Index)
+		}
+	}
+	return shares, nil
+}
+
+// CombineShares reconstructs a secret from shares created by SplitSecret.
+// Given fewer shares than the threshold, it returns a wrong secret without
+// an error; callers must verify the result.
+func CombineShares(shares []Share) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, errors.New("at least 2 shares are required")
+	}
+	length := len(shares[0].Value)
+	seen := make(map[byte]bool, len(shares))
+	for _, s := range shares {
+		if s.Index == 0 {
+			return nil, errors.New("invalid share index 0")
+		}
+		if seen[s.Index] {
+			return nil, fmt.Errorf("share %d was given more than once", s.Index)
+		}
+		seen[s.Index] = true
+		if len(s.Value) != length || length == 0 {
+			return nil, errors.New("shares have different lengths")
+		}
+	}
+
+	// Lagrange interpolation at x = 0.
+	secret := make([]byte, length)
+	for i, si := range shares {
+		basis := byte(1)
+		for j, sj := range shares {
+			if i == j {
+				continue
+			}
+			// sj.Index / (sj.Index - si.Index); subtraction is XOR.
+			basis = gfMul(basis, gfMul(sj.Index, gfInverse(sj.Index^si.Index)))
+		}
+		for b := range secret {
+			secret[b] ^= gfMul(si.Value[b], basis)
+		}
+	}
+	return secret, nil
+}
+
+// evalPolynomial evaluates the polynomial with the given coefficients,
+// lowest degree first, at x using Horner's method.
+func evalPolynomial(coeffs []byte, x byte) byte {
+	var y byte
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ coeffs[i]
+	}
+	return y
+}
+
+// gfMul multiplies in GF(2^8) with the AES polynomial x^8+x^4+x^3+x+1. It
+// uses no secret-dependent branches or table lookups.
+func gfMul(a, b byte) byte {
+	var p byte
+	for i := 0; i < 8; i++ {
+		p ^= -(b & 1) & a
+		a = a<<1 ^ (-(a >> 7) & 0x1b)
+		b >>= 1
+	}
+	return p
+}
+
+// gfInverse returns the multiplicative inverse of a non-zero a, computed
+// as a^254.
+func gfInverse(a byte) byte {
+	result := byte(1)
+	for i := 0; i < 7; i++ {
+		a = gfMul(a, a)
+		result = gfMul(result, a)
+	}
+	return result
+}
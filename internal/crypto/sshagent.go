@@ -0,0 +1,53 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// sshSignaturePurpose names the key derived from an ssh-agent signature.
+const sshSignaturePurpose = "gotp ssh-agent signature"
+
+// ErrNoSSHAgent is returned when SSH_AUTH_SOCK does not point at a running
+// ssh-agent.
+var ErrNoSSHAgent = errors.New("no ssh-agent is running (SSH_AUTH_SOCK is not set or unreachable)")
+
+// DialSSHAgent connects to the user's ssh-agent through SSH_AUTH_SOCK. The
+// caller must close the returned connection.
+func DialSSHAgent() (agent.ExtendedAgent, io.Closer, error) {
+	path := os.Getenv("SSH_AUTH_SOCK")
+	if path == "" {
+		return nil, nil, ErrNoSSHAgent
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, nil, ErrNoSSHAgent
+	}
+	return agent.NewClient(conn), conn, nil
+}
+
+// DeriveKeyFromSSHAgent derives a 32-byte key from the signature the agent
+// makes over challenge with an Ed25519 key. Ed25519 signatures are
+// deterministic, so the same key and challenge always give the same key
+// without the private key ever leaving the agent. The signature is verified
+// against the public key before it is used.
+func DeriveKeyFromSSHAgent(a agent.Agent, key ssh.PublicKey, challenge []byte) ([]byte, error) {
+	if key.Type() != ssh.KeyAlgoED25519 {
+		return nil, fmt.Errorf("%s keys do not give deterministic signatures; use an Ed25519 key", key.Type())
+	}
+	sig, err := a.Sign(key, challenge)
+	if err != nil {
+		return nil, fmt.Errorf("ssh-agent refused to sign: %w", err)
+	}
+	if err := key.Verify(challenge, sig); err != nil {
+		return nil, fmt.Errorf("ssh-agent returned an invalid signature: %w", err)
+	}
+	defer ZeroBytes(sig.Blob)
+	return DeriveSubkey(sig.Blob, sshSignaturePurpose)
+}
@@ -0,0 +1,78 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// X25519 recipients and identities use the same encodings as age, so keys
+// generated by gotp and by age-keygen are interchangeable.
+const (
+	recipientHRP = "age"
+	identityHRP  = "AGE-SECRET-KEY-"
+)
+
+// GenerateX25519Identity generates a new X25519 private key.
+func GenerateX25519Identity() (*ecdh.PrivateKey, error) {
+	return ecdh.X25519().GenerateKey(rand.Reader)
+}
+
+// FormatRecipient encodes a public key as an "age1..." recipient string.
+func FormatRecipient(pub *ecdh.PublicKey) string {
+	s, _ := bech32Encode(recipientHRP, pub.Bytes())
+	return s
+}
+
+// FormatIdentity encodes a private key as an "AGE-SECRET-KEY-1..." string.
+func FormatIdentity(priv *ecdh.PrivateKey) string {
+	s, _ := bech32Encode(identityHRP, priv.Bytes())
+	return strings.ToUpper(s)
+}
+
+// ParseRecipient decodes an "age1..." recipient string.
+func ParseRecipient(s string) (*ecdh.PublicKey, error) {
+	hrp, data, err := bech32Decode(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+	if hrp != recipientHRP {
+		return nil, fmt.Errorf("invalid recipient: unexpected prefix %q", hrp)
+	}
+	pub, err := ecdh.X25519().NewPublicKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+	return pub, nil
+}
+
+// ParseIdentity decodes an "AGE-SECRET-KEY-1..." identity string.
+func ParseIdentity(s string) (*ecdh.PrivateKey, error) {
+	hrp, data, err := bech32Decode(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity: %w", err)
+	}
+	if hrp != strings.ToLower(identityHRP) {
+		return nil, fmt.Errorf("invalid identity: unexpected prefix %q", strings.ToUpper(hrp))
+	}
+	priv, err := ecdh.X25519().NewPrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity: %w", err)
+	}
+	return priv, nil
+}
+
+// X25519SharedKey performs an X25519 key agreement between priv and peer
+// and derives a 32-byte key from the shared secret with HKDF-SHA256, using
+// salt and the purpose as info. An all-zero shared secret is rejected.
+func X25519SharedKey(priv *ecdh.PrivateKey, peer *ecdh.PublicKey, salt []byte, purpose string) ([]byte, error) {
+	shared, err := priv.ECDH(peer)
+	if err != nil {
+		return nil, err
+	}
+	defer ZeroBytes(shared)
+	return hkdf.Key(sha256.New, shared, salt, purpose, 32)
+}
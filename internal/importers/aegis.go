@@ -41,6 +41,8 @@ type AegisEntry struct {
 	Algorithm string            `json:"algorithm"`
 	Digits    int               `json:"digits"`
 	Period    int               `json:"period"`
+	Counter   uint64            `json:"counter"`
+	PIN       string            `json:"pin"`
 	Note      string            `json:"note"`
 	Favorite  bool              `json:"favorite"`
 	Icon      string            `json:"icon"`
@@ -62,8 +64,10 @@ func ParseAegisBackup(data []byte) ([]vault.Account, error) {
 
 	var accounts []vault.Account
 	for _, entry := range backup.Entries {
-		if entry.Type != "totp" {
-			continue // Skip non-TOTP entries
+		switch entry.Type {
+		case "totp", "hotp", "steam", "motp":
+		default:
+			continue // Skip unsupported entry types
 		}
 
 		acc := vault.NewAccount(entry.Name, []byte(entry.Secret))
@@ -74,6 +78,19 @@ func ParseAegisBackup(data []byte) ([]vault.Account, error) {
 		acc.Issuer = entry.Issuer
 		acc.Username = entry.Username
 
+		switch entry.Type {
+		case "hotp":
+			acc.Type = totp.TypeHOTP
+			acc.Counter = entry.Counter
+		case "steam":
+			acc.Encoder = totp.EncoderSteam
+			acc.Digits = 5
+		case "motp":
+			acc.Encoder = totp.EncoderMOTP
+			acc.Period = 10
+			acc.PIN = vault.Secret(entry.PIN)
+		}
+
 		// Parse algorithm
 		switch strings.ToUpper(entry.Algorithm) {
 		case "SHA1":
@@ -114,6 +131,10 @@ func ParseAegisBackup(data []byte) ([]vault.Account, error) {
 			acc.Tags = append(acc.Tags, "note:"+entry.Note)
 		}
 
+		if err := acc.Validate(); err != nil {
+			return nil, fmt.Errorf("entry %q: %w", entry.Name, err)
+		}
+
 		accounts = append(accounts, *acc)
 	}
 
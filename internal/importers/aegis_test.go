@@ -1,7 +1,10 @@
 package importers
 
 import (
+	"strings"
 	"testing"
+
+	"github.com/zulfikawr/gotp/internal/totp"
 )
 
 func TestParseAegisBackup(t *testing.T) {
@@ -41,6 +44,78 @@ func TestParseAegisBackup(t *testing.T) {
 	}
 }
 
+func TestParseAegisBackup_HOTP(t *testing.T) {
+	aegisJSON := `{
+		"version": 1,
+		"entries": [
+			{
+				"id": "hotp-id",
+				"name": "Counter Account",
+				"secret": "JBSWY3DPEHPK3PXP",
+				"type": "hotp",
+				"digits": 6,
+				"counter": 17
+			}
+		],
+		"header": {"slots": []}
+	}`
+
+	accounts, err := ParseAegisBackup([]byte(aegisJSON))
+	if err != nil {
+		t.Fatalf("ParseAegisBackup() error = %v", err)
+	}
+	if len(accounts) != 1 {
+		t.Fatalf("ParseAegisBackup() returned %d accounts, want 1", len(accounts))
+	}
+	if !accounts[0].IsHOTP() || accounts[0].Counter != 17 {
+		t.Errorf("ParseAegisBackup() type = %q counter = %d, want hotp 17", accounts[0].Type, accounts[0].Counter)
+	}
+}
+
+func TestParseAegisBackup_Steam(t *testing.T) {
+	aegisJSON := `{
+		"version": 1,
+		"entries": [
+			{
+				"id": "steam-id",
+				"name": "Steam",
+				"secret": "JBSWY3DPEHPK3PXP",
+				"type": "steam",
+				"algorithm": "SHA1",
+				"digits": 5,
+				"period": 30
+			}
+		],
+		"header": {"slots": []}
+	}`
+
+	accounts, err := ParseAegisBackup([]byte(aegisJSON))
+	if err != nil {
+		t.Fatalf("ParseAegisBackup() error = %v", err)
+	}
+	if len(accounts) != 1 {
+		t.Fatalf("ParseAegisBackup() returned %d accounts, want 1", len(accounts))
+	}
+	if accounts[0].Encoder != totp.EncoderSteam || accounts[0].Digits != 5 {
+		t.Errorf("ParseAegisBackup() encoder = %q digits = %d, want steam 5", accounts[0].Encoder, accounts[0].Digits)
+	}
+}
+
+func TestParseAegisBackup_InvalidDigits(t *testing.T) {
+	aegisJSON := `{
+		"version": 1,
+		"entries": [
+			{"name": "Token", "secret": "JBSWY3DPEHPK3PXP", "type": "totp", "algorithm": "SHA1", "digits": 12, "period": 30}
+		],
+		"header": {"slots": []}
+	}`
+
+	_, err := ParseAegisBackup([]byte(aegisJSON))
+	if err == nil || !strings.Contains(err.Error(), "Token") {
+		t.Errorf("ParseAegisBackup() error = %v, want error naming the entry", err)
+	}
+}
+
 func TestParseAegisBackup_InvalidJSON(t *testing.T) {
 	invalidJSON := `{invalid json}`
 
@@ -87,6 +87,10 @@ func ParseAuthyExport(data []byte) ([]vault.Account, error) {
 			vaultAcc.Tags = []string{"authy"}
 		}
 
+		if err := vaultAcc.Validate(); err != nil {
+			return nil, fmt.Errorf("account %q: %w", acc.Name, err)
+		}
+
 		accounts = append(accounts, *vaultAcc)
 	}
 
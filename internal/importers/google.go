@@ -111,6 +111,10 @@ func parseGoogleJSONExport(export GoogleExport) ([]vault.Account, error) {
 		// Add google-specific tag
 		vaultAcc.Tags = []string{"google"}
 
+		if err := vaultAcc.Validate(); err != nil {
+			return nil, fmt.Errorf("account %q: %w", acc.Name, err)
+		}
+
 		accounts = append(accounts, *vaultAcc)
 	}
 
@@ -273,6 +277,12 @@ func parseGoogleMigrationURIs(migrationURI string) ([]vault.Account, error) {
 		// Period (0=Unspecified)
 		acc.Period = 30 // Default to 30 as Google migration usually doesn't provide it reliably
 
+		// Type (0=Unspecified, 1=HOTP, 2=TOTP). HOTP entries carry their counter.
+		if otpAcc.Type == OtpType_HOTP {
+			acc.Type = totp.TypeHOTP
+			acc.Counter = uint64(otpAcc.Counter)
+		}
+
 		// Add google-specific tags
 		acc.Tags = []string{"google", "migration"}
 
@@ -57,3 +57,35 @@ func TestParseGoogleMigrationURIs_RealData(t *testing.T) {
 		}
 	}
 }
+
+// TestParseGoogleMigrationURIs_HOTP verifies HOTP entries keep their type and counter.
+func TestParseGoogleMigrationURIs_HOTP(t *testing.T) {
+	payload := &MigrationPayload{
+		OtpAccounts: []*OTPAccount{
+			{
+				Secret:  []byte("12345678901234567890"),
+				Name:    "Bank:alice",
+				Issuer:  "Bank",
+				Type:    OtpType_HOTP,
+				Counter: 9,
+			},
+		},
+	}
+
+	data, err := proto.Marshal(payload)
+	if err != nil {
+		t.Fatalf("Failed to marshal protobuf: %v", err)
+	}
+
+	accounts, err := parseGoogleMigrationURIs("otpauth-migration://offline?data=" + base64.RawURLEncoding.EncodeToString(data))
+	if err != nil {
+		t.Fatalf("Failed to parse migration URI: %v", err)
+	}
+
+	if len(accounts) != 1 {
+		t.Fatalf("Expected 1 account, got %d", len(accounts))
+	}
+	if !accounts[0].IsHOTP() || accounts[0].Counter != 9 {
+		t.Errorf("Expected HOTP account with counter 9, got type %q counter %d", accounts[0].Type, accounts[0].Counter)
+	}
+}
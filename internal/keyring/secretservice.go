@@ -0,0 +1,320 @@
+// Package keyring stores vault keys in the desktop keyring through the
+// freedesktop Secret Service API, which GNOME Keyring, KWallet and
+// KeePassXC provide on the D-Bus session bus. A vault key stored there is
+// unlocked together with the user's login and survives restarts, so that
+// the vault opens without the master password.
+//
+// The bus is spoken through github.com/godbus/dbus. Keys are sent to the
+// service with the "plain" transfer algorithm; the service keeps them
+// encrypted at rest under its own password.
+package keyring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/zulfikawr/gotp/internal/crypto"
+)
+
+const (
+	serviceName   = "org.freedesktop.secrets"
+	servicePath   = dbus.ObjectPath("/org/freedesktop/secrets")
+	serviceIface  = "org.freedesktop.Secret.Service"
+	collectionIfc = "org.freedesktop.Secret.Collection"
+	itemIface     = "org.freedesktop.Secret.Item"
+	sessionIface  = "org.freedesktop.Secret.Session"
+	promptIface   = "org.freedesktop.Secret.Prompt"
+
+	// algorithm is the transfer encoding of secrets. The session bus only
+	// connects processes of the user, who can read the unlocked keyring
+	// anyway, so secrets are not encrypted again on it.
+	algorithm = "plain"
+
+	// noPrompt is the object path returned when no prompt is needed.
+	noPrompt = dbus.ObjectPath("/")
+
+	// callWait bounds how long a method call may take.
+	callWait = 10 * time.Second
+	// promptWait bounds how long the user has to answer an unlock prompt.
+	promptWait = 2 * time.Minute
+)
+
+// ErrUnavailable is returned when no Secret Service is running on the
+// session bus.
+var ErrUnavailable = errors.New("no Secret Service keyring is available")
+
+// secret is the Secret struct of the API, (oayays).
+type secret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// SecretService keeps vault keys in the default collection of the desktop
+// keyring, one item per vault, identified by its canonical path. Keys stay
+// there until they are deleted; the TTL passed to Put is ignored.
+type SecretService struct{}
+
+// Name describes the store in messages.
+func (SecretService) Name() string {
+	return "keyring"
+}
+
+// Get returns the key stored for the vault in locked memory, or nil if the
+// keyring holds none or no keyring is running. A running keyring that is
+// locked asks the user to unlock it. The caller must Destroy the buffer.
+func (SecretService) Get(vault string) (*crypto.SecureBuffer, error) {
+	c, err := dial(false)
+	if errors.Is(err, ErrUnavailable) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	items, err := c.search(vault)
+	if errors.Is(err, ErrUnavailable) {
+		return nil, nil
+	}
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	if err := c.openSession(); err != nil {
+		return nil, err
+	}
+	var s secret
+	if err := c.call(items[0], itemIface+".GetSecret", []any{&s}, c.session); err != nil {
+		return nil, err
+	}
+	defer crypto.ZeroBytes(s.Value)
+	return crypto.NewSecureBufferFrom(s.Value)
+}
+
+// Put stores the key of the vault, replacing any key stored for it.
+func (SecretService) Put(vault string, key []byte, _ time.Duration) error {
+	c, err := dial(true)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	var collection dbus.ObjectPath
+	if err := c.call(servicePath, serviceIface+".ReadAlias", []any{&collection}, "default"); err != nil {
+		return err
+	}
+	if collection == noPrompt {
+		return errors.New("the keyring has no default collection")
+	}
+	if _, err := c.unlock([]dbus.ObjectPath{collection}); err != nil {
+		return err
+	}
+	if err := c.openSession(); err != nil {
+		return err
+	}
+
+	properties := map[string]dbus.Variant{
+		itemIface + ".Label":      dbus.MakeVariant("gotp vault key (" + vault + ")"),
+		itemIface + ".Attributes": dbus.MakeVariant(attributes(vault)),
+	}
+	value := secret{Session: c.session, Parameters: []byte{}, Value: key, ContentType: "application/octet-stream"}
+	var item, prompt dbus.ObjectPath
+	if err := c.call(collection, collectionIfc+".CreateItem", []any{&item, &prompt}, properties, value, true); err != nil {
+		return err
+	}
+	if prompt != noPrompt {
+		_, err = c.prompt(prompt)
+	}
+	return err
+}
+
+// Delete removes the key stored for the vault. It is not an error if the
+// keyring holds none.
+func (SecretService) Delete(vault string) error {
+	c, err := dial(true)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	items, err := c.search(vault)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		var prompt dbus.ObjectPath
+		if err := c.call(item, itemIface+".Delete", []any{&prompt}); err != nil {
+			return err
+		}
+		if prompt != noPrompt {
+			if _, err := c.prompt(prompt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// attributes identify the item holding a vault's key.
+func attributes(vault string) map[string]string {
+	return map[string]string{"application": "gotp", "vault": vault}
+}
+
+// client is a connection to the Secret Service.
+type client struct {
+	conn    *dbus.Conn
+	flags   dbus.Flags
+	session dbus.ObjectPath
+}
+
+// sessionBusAddress returns the address of the session bus. Unlike godbus,
+// it never launches a bus that is not running.
+func sessionBusAddress() string {
+	if addr := os.Getenv("DBUS_SESSION_BUS_ADDRESS"); addr != "" {
+		return addr
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		if _, err := os.Stat(dir + "/bus"); err == nil {
+			return "unix:path=" + dir + "/bus"
+		}
+	}
+	return ""
+}
+
+// dial connects to the session bus. Unless autoStart is set, the bus is
+// asked not to start a keyring that is not already running.
+func dial(autoStart bool) (*client, error) {
+	addr := sessionBusAddress()
+	if addr == "" {
+		return nil, ErrUnavailable
+	}
+	conn, err := dbus.Connect(addr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	c := &client{conn: conn}
+	if !autoStart {
+		c.flags = dbus.FlagNoAutoStart
+	}
+	return c, nil
+}
+
+// call calls a method of the Secret Service and stores its results in ret.
+func (c *client) call(path dbus.ObjectPath, method string, ret []any, args ...any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), callWait)
+	defer cancel()
+	call := c.conn.Object(serviceName, path).CallWithContext(ctx, method, c.flags, args...)
+	var e dbus.Error
+	if errors.As(call.Err, &e) && (e.Name == "org.freedesktop.DBus.Error.ServiceUnknown" || e.Name == "org.freedesktop.DBus.Error.NameHasNoOwner") {
+		return ErrUnavailable
+	}
+	if call.Err != nil {
+		return fmt.Errorf("keyring: %w", call.Err)
+	}
+	if len(ret) == 0 {
+		return nil
+	}
+	if err := call.Store(ret...); err != nil {
+		return fmt.Errorf("keyring: %w", err)
+	}
+	return nil
+}
+
+func (c *client) Close() error {
+	if c.session != "" {
+		_ = c.call(c.session, sessionIface+".Close", nil)
+	}
+	return c.conn.Close()
+}
+
+// search returns the items holding the vault's key, unlocking them if
+// needed.
+func (c *client) search(vault string) ([]dbus.ObjectPath, error) {
+	var items, locked []dbus.ObjectPath
+	if err := c.call(servicePath, serviceIface+".SearchItems", []any{&items, &locked}, attributes(vault)); err != nil {
+		return nil, err
+	}
+	if len(locked) > 0 {
+		unlocked, err := c.unlock(locked)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, unlocked...)
+	}
+	return items, nil
+}
+
+// unlock unlocks items or collections, prompting the user if the service
+// asks to, and returns the objects that were unlocked.
+func (c *client) unlock(objects []dbus.ObjectPath) ([]dbus.ObjectPath, error) {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	if err := c.call(servicePath, serviceIface+".Unlock", []any{&unlocked, &prompt}, objects); err != nil {
+		return nil, err
+	}
+	if prompt != noPrompt {
+		result, err := c.prompt(prompt)
+		if err != nil {
+			return nil, err
+		}
+		var prompted []dbus.ObjectPath
+		if err := result.Store(&prompted); err != nil {
+			return nil, fmt.Errorf("keyring prompt: %w", err)
+		}
+		unlocked = append(unlocked, prompted...)
+	}
+	return unlocked, nil
+}
+
+// prompt shows a prompt of the service and waits for the user to answer
+// it. It returns the result of the prompted operation.
+func (c *client) prompt(prompt dbus.ObjectPath) (dbus.Variant, error) {
+	match := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(prompt),
+		dbus.WithMatchInterface(promptIface),
+		dbus.WithMatchMember("Completed"),
+	}
+	if err := c.conn.AddMatchSignal(match...); err != nil {
+		return dbus.Variant{}, err
+	}
+	defer c.conn.RemoveMatchSignal(match...)
+	signals := make(chan *dbus.Signal, 4)
+	c.conn.Signal(signals)
+	defer c.conn.RemoveSignal(signals)
+
+	if err := c.call(prompt, promptIface+".Prompt", nil, ""); err != nil {
+		return dbus.Variant{}, err
+	}
+	timeout := time.NewTimer(promptWait)
+	defer timeout.Stop()
+	for {
+		select {
+		case signal := <-signals:
+			if signal.Path != prompt || signal.Name != promptIface+".Completed" {
+				continue
+			}
+			var dismissed bool
+			var result dbus.Variant
+			if err := dbus.Store(signal.Body, &dismissed, &result); err != nil {
+				return dbus.Variant{}, fmt.Errorf("keyring prompt: %w", err)
+			}
+			if dismissed {
+				return dbus.Variant{}, errors.New("the keyring prompt was dismissed")
+			}
+			return result, nil
+		case <-timeout.C:
+			return dbus.Variant{}, errors.New("keyring prompt: timed out")
+		}
+	}
+}
+
+// openSession opens the session that secrets are transferred in.
+func (c *client) openSession() error {
+	var output dbus.Variant
+	return c.call(servicePath, serviceIface+".OpenSession", []any{&output, &c.session}, algorithm, dbus.MakeVariant(""))
+}
@@ -0,0 +1,423 @@
+package keyring
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// fakeService is a stand-in session bus with a Secret Service on it. Each
+// client gets a godbus connection of its own over a Unix socket. The
+// service is only started by calls that allow auto-starting, and asks for
+// a prompt to unlock its collection.
+type fakeService struct {
+	mu       sync.Mutex
+	running  bool
+	locked   bool
+	prompts  int
+	items    map[dbus.ObjectPath]*fakeItem
+	sessions map[dbus.ObjectPath]bool
+	pending  map[dbus.ObjectPath][]dbus.ObjectPath // Objects unlocked by each prompt
+	next     int
+}
+
+type fakeItem struct {
+	attributes map[string]string
+	secret     []byte
+}
+
+const (
+	fakeCollection = dbus.ObjectPath("/org/freedesktop/secrets/collection/login")
+	fakeGUID       = "0123456789abcdef0123456789abcdef"
+)
+
+// startFakeService listens on a socket in a temporary directory and points
+// the session bus address at it.
+func startFakeService(t *testing.T) *fakeService {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "gotp-dbus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "bus")
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "unix:path="+path)
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	s := &fakeService{
+		locked:   true,
+		items:    make(map[dbus.ObjectPath]*fakeItem),
+		sessions: make(map[dbus.ObjectPath]bool),
+		pending:  make(map[dbus.ObjectPath][]dbus.ObjectPath),
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// serve accepts the client's EXTERNAL authentication and then answers its
+// calls through a godbus connection.
+func (s *fakeService) serve(nc net.Conn) {
+	if !acceptAuth(nc) {
+		nc.Close()
+		return
+	}
+	// godbus only reads messages once it has authenticated itself, so it
+	// is given the replies of a bus that accepts it at once.
+	tr := &serverTransport{
+		Reader: io.MultiReader(strings.NewReader("REJECTED EXTERNAL\r\nOK "+fakeGUID+"\r\n"), nc),
+		conn:   nc,
+	}
+	conn, err := dbus.NewConn(tr)
+	if err != nil {
+		nc.Close()
+		return
+	}
+	fc := &fakeConn{fakeService: s, conn: conn}
+	_ = conn.Export(fakeBus{}, "/org/freedesktop/DBus", "org.freedesktop.DBus")
+	for _, iface := range []string{serviceIface, collectionIfc, itemIface, sessionIface, promptIface} {
+		_ = conn.ExportSubtree(fc, servicePath, iface)
+	}
+	if err := conn.Auth([]dbus.Auth{dbus.AuthExternal("0")}); err != nil {
+		conn.Close()
+	}
+}
+
+// acceptAuth reads the client's side of the authentication, one byte at a
+// time so that no message is read ahead.
+func acceptAuth(nc net.Conn) bool {
+	readLine := func() (string, error) {
+		var line []byte
+		b := make([]byte, 1)
+		for {
+			if _, err := nc.Read(b); err != nil {
+				return "", err
+			}
+			if b[0] == '\n' {
+				return strings.TrimSuffix(string(line), "\r"), nil
+			}
+			line = append(line, b[0])
+		}
+	}
+
+	b := make([]byte, 1)
+	if _, err := nc.Read(b); err != nil || b[0] != 0 {
+		return false
+	}
+	for {
+		line, err := readLine()
+		if err != nil {
+			return false
+		}
+		var reply string
+		switch {
+		case line == "BEGIN":
+			return true
+		case strings.HasPrefix(line, "AUTH EXTERNAL"):
+			reply = "OK " + fakeGUID
+		case line == "AUTH":
+			reply = "REJECTED EXTERNAL"
+		default:
+			reply = "ERROR"
+		}
+		if _, err := io.WriteString(nc, reply+"\r\n"); err != nil {
+			return false
+		}
+	}
+}
+
+// serverTransport discards what godbus writes until it has authenticated.
+type serverTransport struct {
+	io.Reader
+	conn  net.Conn
+	ready bool
+}
+
+func (t *serverTransport) Write(p []byte) (int, error) {
+	if !t.ready {
+		t.ready = bytes.HasPrefix(p, []byte("BEGIN"))
+		return len(p), nil
+	}
+	return t.conn.Write(p)
+}
+
+func (t *serverTransport) Close() error {
+	return t.conn.Close()
+}
+
+// fakeBus answers the calls a client makes to the bus itself.
+type fakeBus struct{}
+
+func (fakeBus) Hello() (string, *dbus.Error) {
+	return ":1.1", nil
+}
+
+func (fakeBus) AddMatch(string) *dbus.Error {
+	return nil
+}
+
+func (fakeBus) RemoveMatch(string) *dbus.Error {
+	return nil
+}
+
+// fakeConn exports the Secret Service on one client connection.
+type fakeConn struct {
+	*fakeService
+	conn *dbus.Conn
+}
+
+// start starts the service unless the call asks the bus not to. The
+// caller must hold s.mu.
+func (s *fakeService) start(msg dbus.Message) *dbus.Error {
+	if !s.running {
+		if msg.Flags&dbus.FlagNoAutoStart != 0 {
+			return dbus.NewError("org.freedesktop.DBus.Error.ServiceUnknown", []any{"not running"})
+		}
+		s.running = true
+	}
+	return nil
+}
+
+func (s *fakeService) newPath(kind string) dbus.ObjectPath {
+	s.next++
+	return dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/secrets/%s/%d", kind, s.next))
+}
+
+func objectPath(msg dbus.Message) dbus.ObjectPath {
+	path, _ := msg.Headers[dbus.FieldPath].Value().(dbus.ObjectPath)
+	return path
+}
+
+func (c *fakeConn) OpenSession(msg dbus.Message, algorithm string, _ dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.start(msg); err != nil {
+		return dbus.Variant{}, "", err
+	}
+	if algorithm != "plain" {
+		return dbus.Variant{}, "", dbus.NewError("org.freedesktop.DBus.Error.NotSupported", []any{algorithm})
+	}
+	path := c.newPath("session")
+	c.sessions[path] = true
+	return dbus.MakeVariant(""), path, nil
+}
+
+func (c *fakeConn) ReadAlias(msg dbus.Message, _ string) (dbus.ObjectPath, *dbus.Error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.start(msg); err != nil {
+		return "", err
+	}
+	return fakeCollection, nil
+}
+
+func (c *fakeConn) SearchItems(msg dbus.Message, want map[string]string) ([]dbus.ObjectPath, []dbus.ObjectPath, *dbus.Error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.start(msg); err != nil {
+		return nil, nil, err
+	}
+	found := []dbus.ObjectPath{}
+	for path, item := range c.items {
+		if reflect.DeepEqual(item.attributes, want) {
+			found = append(found, path)
+		}
+	}
+	if c.locked {
+		return []dbus.ObjectPath{}, found, nil
+	}
+	return found, []dbus.ObjectPath{}, nil
+}
+
+func (c *fakeConn) Unlock(msg dbus.Message, objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.start(msg); err != nil {
+		return nil, "", err
+	}
+	if !c.locked {
+		return objects, noPrompt, nil
+	}
+	prompt := c.newPath("prompt")
+	c.pending[prompt] = objects
+	return []dbus.ObjectPath{}, prompt, nil
+}
+
+func (c *fakeConn) Prompt(msg dbus.Message, _ string) *dbus.Error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	path := objectPath(msg)
+	c.locked = false
+	c.prompts++
+	_ = c.conn.Emit(path, promptIface+".Completed", false, dbus.MakeVariant(c.pending[path]))
+	return nil
+}
+
+func (c *fakeConn) CreateItem(msg dbus.Message, properties map[string]dbus.Variant, value secret, _ bool) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.locked {
+		return "", "", dbus.NewError("org.freedesktop.Secret.Error.IsLocked", []any{"locked"})
+	}
+	if !c.sessions[value.Session] {
+		return "", "", dbus.NewError("org.freedesktop.Secret.Error.NoSession", []any{"no session"})
+	}
+	var attrs map[string]string
+	if err := properties[itemIface+".Attributes"].Store(&attrs); err != nil {
+		return "", "", dbus.NewError("org.freedesktop.DBus.Error.InvalidArgs", []any{err.Error()})
+	}
+	for path, item := range c.items {
+		if reflect.DeepEqual(item.attributes, attrs) {
+			delete(c.items, path)
+		}
+	}
+	path := c.newPath("collection/login/item")
+	c.items[path] = &fakeItem{attributes: attrs, secret: value.Value}
+	return path, noPrompt, nil
+}
+
+func (c *fakeConn) GetSecret(msg dbus.Message, session dbus.ObjectPath) (secret, *dbus.Error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	item, ok := c.items[objectPath(msg)]
+	if !ok || c.locked || !c.sessions[session] {
+		return secret{}, dbus.NewError("org.freedesktop.Secret.Error.NoSuchObject", []any{"no item"})
+	}
+	return secret{Session: session, Parameters: []byte{}, Value: item.secret, ContentType: "application/octet-stream"}, nil
+}
+
+func (c *fakeConn) Delete(msg dbus.Message) (dbus.ObjectPath, *dbus.Error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.items, objectPath(msg))
+	return noPrompt, nil
+}
+
+func (c *fakeConn) Close(msg dbus.Message) *dbus.Error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.sessions, objectPath(msg))
+	return nil
+}
+
+func TestSecretService(t *testing.T) {
+	s := startFakeService(t)
+	store := SecretService{}
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	// Looking a key up does not start a keyring.
+	if got, err := store.Get("/vault.enc"); err != nil || got != nil {
+		t.Fatalf("Expected no key, got %v, %v", got, err)
+	}
+	s.mu.Lock()
+	running := s.running
+	s.mu.Unlock()
+	if running {
+		t.Fatal("Get should not start the keyring")
+	}
+
+	// Storing a key unlocks the collection through a prompt.
+	if err := store.Put("/vault.enc", key, 0); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	s.mu.Lock()
+	if s.prompts != 1 || len(s.items) != 1 {
+		t.Fatalf("Expected one prompt and one item, got %d and %d", s.prompts, len(s.items))
+	}
+	for _, item := range s.items {
+		if !bytes.Equal(item.secret, key) || item.attributes["vault"] != "/vault.enc" {
+			t.Errorf("Unexpected item %+v", item)
+		}
+	}
+	s.mu.Unlock()
+
+	got, err := store.Get("/vault.enc")
+	if err != nil || got == nil || !bytes.Equal(got.Bytes(), key) {
+		t.Fatalf("Get returned %v, %v", got, err)
+	}
+	got.Destroy()
+	if got, _ := store.Get("/other.enc"); got != nil {
+		t.Error("Another vault's key should not be returned")
+	}
+
+	// A locked keyring is unlocked to read the key.
+	s.mu.Lock()
+	s.locked = true
+	s.mu.Unlock()
+	got, err = store.Get("/vault.enc")
+	if err != nil || got == nil || !bytes.Equal(got.Bytes(), key) {
+		t.Fatalf("Get from a locked keyring returned %v, %v", got, err)
+	}
+	got.Destroy()
+
+	// Storing again replaces the key.
+	newKey := []byte("fedcba9876543210fedcba9876543210")
+	if err := store.Put("/vault.enc", newKey, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.Get("/vault.enc"); got == nil || !bytes.Equal(got.Bytes(), newKey) {
+		t.Fatal("Put should replace the stored key")
+	}
+	s.mu.Lock()
+	if len(s.items) != 1 {
+		t.Errorf("Expected one item, got %d", len(s.items))
+	}
+	if len(s.sessions) != 0 {
+		t.Errorf("Sessions should be closed, %d left", len(s.sessions))
+	}
+	s.mu.Unlock()
+
+	if err := store.Delete("/vault.enc"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if got, _ := store.Get("/vault.enc"); got != nil {
+		t.Error("Key should be gone after Delete")
+	}
+	if err := store.Delete("/vault.enc"); err != nil {
+		t.Errorf("Deleting a missing key should succeed: %v", err)
+	}
+}
+
+func TestSecretServiceUnavailable(t *testing.T) {
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "")
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	store := SecretService{}
+
+	if got, err := store.Get("/vault.enc"); err != nil || got != nil {
+		t.Errorf("Get without a bus returned %v, %v", got, err)
+	}
+	if err := store.Put("/vault.enc", []byte("key"), 0); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Expected ErrUnavailable, got %v", err)
+	}
+
+	// A bus without a Secret Service.
+	s := startFakeService(t)
+	s.mu.Lock()
+	s.running = false
+	s.mu.Unlock()
+	if got, err := store.Get("/vault.enc"); err != nil || got != nil {
+		t.Errorf("Get without a keyring returned %v, %v", got, err)
+	}
+}
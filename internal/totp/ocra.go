@@ -0,0 +1,273 @@
+package totp
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ocraQuestionSize is the fixed size of the question field in the OCRA
+// data input (RFC 6287 section 5.1).
+const ocraQuestionSize = 128
+
+// OCRASuite is a parsed OCRA suite string as defined in RFC 6287 section 6,
+// for example "OCRA-1:HOTP-SHA1-6:QN08" or "OCRA-1:HOTP-SHA512-8:C-QN08-T1M".
+type OCRASuite struct {
+	// Raw is the original suite string. It is part of the HMAC input.
+	Raw string
+	// Algorithm is the HMAC hash function of the crypto function.
+	Algorithm HashAlgorithm
+	// Digits is the truncation length; 0 means the full HMAC is returned as hex.
+	Digits int
+	// Counter reports whether the data input includes a counter (C).
+	Counter bool
+	// QuestionFormat is 'A' (alphanumeric), 'N' (numeric) or 'H' (hexadecimal).
+	QuestionFormat byte
+	// QuestionLength is the maximum challenge length (4 to 64).
+	QuestionLength int
+	// PINAlgorithm is the hash used for the PIN input (P), or empty if none.
+	PINAlgorithm HashAlgorithm
+	// SessionLength is the session information length in bytes (S), or 0.
+	SessionLength int
+	// TimeStep is the timestamp granularity (T), or 0 if no timestamp is used.
+	TimeStep time.Duration
+}
+
+// OCRAParams holds the data inputs for a single OCRA computation.
+// Only the inputs required by the suite are used.
+type OCRAParams struct {
+	// Counter is the moving factor (C).
+	Counter uint64
+	// Question is the challenge (Q), encoded according to the suite's format.
+	Question string
+	// PIN is the plaintext PIN (P); it is hashed with the suite's PIN algorithm.
+	PIN []byte
+	// SessionInfo is the session information (S), left-padded with zeros.
+	SessionInfo []byte
+	// Timestamp is the time for the timestamp input (T).
+	Timestamp time.Time
+}
+
+// ParseOCRASuite parses and validates an OCRA suite string.
+func ParseOCRASuite(suite string) (*OCRASuite, error) {
+	parts := strings.Split(suite, ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid OCRA suite %q: expected <algorithm>:<crypto function>:<data input>", suite)
+	}
+	if parts[0] != "OCRA-1" {
+		return nil, fmt.Errorf("unsupported OCRA version: %s", parts[0])
+	}
+
+	s := &OCRASuite{Raw: suite}
+
+	// Crypto function: HOTP-SHAx-t
+	cf := strings.Split(parts[1], "-")
+	if len(cf) != 3 || cf[0] != "HOTP" {
+		return nil, fmt.Errorf("invalid OCRA crypto function: %s", parts[1])
+	}
+	algo, err := parseSHA(cf[1])
+	if err != nil {
+		return nil, err
+	}
+	s.Algorithm = algo
+
+	digits, err := strconv.Atoi(cf[2])
+	if err != nil || (digits != 0 && (digits < 4 || digits > 10)) {
+		return nil, fmt.Errorf("invalid OCRA truncation length: %s", cf[2])
+	}
+	s.Digits = digits
+
+	// Data input: [C] | QFxx | [PH | Snnn | TG]
+	inputs := strings.Split(parts[2], "-")
+	if inputs[0] == "C" {
+		s.Counter = true
+		inputs = inputs[1:]
+	}
+
+	if len(inputs) == 0 || len(inputs[0]) != 4 || inputs[0][0] != 'Q' {
+		return nil, fmt.Errorf("invalid OCRA data input %q: a question (QFxx) is required", parts[2])
+	}
+	s.QuestionFormat = inputs[0][1]
+	if s.QuestionFormat != 'A' && s.QuestionFormat != 'N' && s.QuestionFormat != 'H' {
+		return nil, fmt.Errorf("invalid OCRA question format: %c", s.QuestionFormat)
+	}
+	s.QuestionLength, err = strconv.Atoi(inputs[0][2:])
+	if err != nil || s.QuestionLength < 4 || s.QuestionLength > 64 {
+		return nil, fmt.Errorf("invalid OCRA question length: %s", inputs[0][2:])
+	}
+
+	for _, in := range inputs[1:] {
+		switch {
+		case strings.HasPrefix(in, "P") && s.PINAlgorithm == "":
+			if s.PINAlgorithm, err = parseSHA(in[1:]); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(in, "S") && s.SessionLength == 0:
+			if s.SessionLength, err = strconv.Atoi(in[1:]); err != nil || len(in) != 4 || s.SessionLength == 0 {
+				return nil, fmt.Errorf("invalid OCRA session information length: %s", in)
+			}
+		case strings.HasPrefix(in, "T") && s.TimeStep == 0:
+			if s.TimeStep, err = parseOCRATimeStep(in[1:]); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("invalid OCRA data input: %s", in)
+		}
+	}
+
+	return s, nil
+}
+
+// parseSHA maps an OCRA hash name (SHA1, SHA256, SHA512) to a HashAlgorithm.
+func parseSHA(name string) (HashAlgorithm, error) {
+	switch HashAlgorithm(name) {
+	case SHA1, SHA256, SHA512:
+		return HashAlgorithm(name), nil
+	default:
+		return "", fmt.Errorf("unsupported OCRA hash function: %s", name)
+	}
+}
+
+// parseOCRATimeStep parses the G in a TG timestamp input: [1-59]S, [1-59]M or [0-48]H.
+func parseOCRATimeStep(g string) (time.Duration, error) {
+	if len(g) < 2 {
+		return 0, fmt.Errorf("invalid OCRA time step: %s", g)
+	}
+	n, err := strconv.Atoi(g[:len(g)-1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid OCRA time step: %s", g)
+	}
+	switch g[len(g)-1] {
+	case 'S':
+		if n >= 1 && n <= 59 {
+			return time.Duration(n) * time.Second, nil
+		}
+	case 'M':
+		if n >= 1 && n <= 59 {
+			return time.Duration(n) * time.Minute, nil
+		}
+	case 'H':
+		if n >= 1 && n <= 48 {
+			return time.Duration(n) * time.Hour, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid OCRA time step: %s", g)
+}
+
+// GenerateOCRA computes an OCRA response as defined in RFC 6287 section 5.
+// The HMAC input is the suite string, a zero byte, and the data inputs the
+// suite declares, in order: counter, question, PIN hash, session
+// information and timestamp.
+func GenerateOCRA(suite *OCRASuite, key []byte, params OCRAParams) (string, error) {
+	msg := append([]byte(suite.Raw), 0x00)
+
+	if suite.Counter {
+		c := make([]byte, 8)
+		binary.BigEndian.PutUint64(c, params.Counter)
+		msg = append(msg, c...)
+	}
+
+	question, err := suite.encodeQuestion(params.Question)
+	if err != nil {
+		return "", err
+	}
+	msg = append(msg, question...)
+
+	if suite.PINAlgorithm != "" {
+		if len(params.PIN) == 0 {
+			return "", fmt.Errorf("OCRA suite %s requires a PIN", suite.Raw)
+		}
+		msg = append(msg, hashPIN(params.PIN, suite.PINAlgorithm)...)
+	}
+
+	if suite.SessionLength > 0 {
+		if len(params.SessionInfo) > suite.SessionLength {
+			return "", fmt.Errorf("session information exceeds %d bytes", suite.SessionLength)
+		}
+		session := make([]byte, suite.SessionLength)
+		copy(session[suite.SessionLength-len(params.SessionInfo):], params.SessionInfo)
+		msg = append(msg, session...)
+	}
+
+	if suite.TimeStep > 0 {
+		steps := params.Timestamp.Unix() / int64(suite.TimeStep/time.Second)
+		ts := make([]byte, 8)
+		binary.BigEndian.PutUint64(ts, uint64(steps))
+		msg = append(msg, ts...)
+	}
+
+	hs := HMAC(key, msg, suite.Algorithm)
+	if suite.Digits == 0 {
+		return hex.EncodeToString(hs), nil
+	}
+
+	otp := uint64(DynamicTruncate(hs)) % uint64(math.Pow10(suite.Digits))
+	return fmt.Sprintf("%0*d", suite.Digits, otp), nil
+}
+
+// encodeQuestion validates the challenge against the suite and encodes it
+// into the fixed 128-byte question field. The suite's question length is not
+// enforced as an upper bound: mutual challenge-response concatenates the
+// client and server challenges into a single question.
+func (s *OCRASuite) encodeQuestion(q string) ([]byte, error) {
+	if len(q) < 4 {
+		return nil, fmt.Errorf("challenge must be at least 4 characters")
+	}
+
+	var raw []byte
+	switch s.QuestionFormat {
+	case 'N':
+		n, ok := new(big.Int).SetString(q, 10)
+		if !ok || n.Sign() < 0 {
+			return nil, fmt.Errorf("challenge must be numeric")
+		}
+		// The decimal challenge is converted to hex and left-aligned.
+		h := strings.ToUpper(n.Text(16))
+		if len(h)%2 == 1 {
+			h += "0"
+		}
+		raw, _ = hex.DecodeString(h)
+	case 'H':
+		h := q
+		if len(h)%2 == 1 {
+			h += "0"
+		}
+		decoded, err := hex.DecodeString(h)
+		if err != nil {
+			return nil, fmt.Errorf("challenge must be hexadecimal")
+		}
+		raw = decoded
+	default: // 'A'
+		raw = []byte(q)
+	}
+
+	if len(raw) > ocraQuestionSize {
+		return nil, fmt.Errorf("challenge too long")
+	}
+	field := make([]byte, ocraQuestionSize)
+	copy(field, raw)
+	return field, nil
+}
+
+// hashPIN hashes the PIN with the suite's PIN hash function.
+func hashPIN(pin []byte, algo HashAlgorithm) []byte {
+	switch algo {
+	case SHA256:
+		sum := sha256.Sum256(pin)
+		return sum[:]
+	case SHA512:
+		sum := sha512.Sum512(pin)
+		return sum[:]
+	default:
+		sum := sha1.Sum(pin)
+		return sum[:]
+	}
+}
@@ -0,0 +1,76 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOCRA_RFC6287(t *testing.T) {
+	key20 := []byte("12345678901234567890")
+	key32 := []byte("12345678901234567890123456789012")
+	key64 := []byte("1234567890123456789012345678901234567890123456789012345678901234")
+	pin := []byte("1234")
+	ts := time.Unix(0x132d0b6*60, 0)
+
+	tests := []struct {
+		suite    string
+		key      []byte
+		params   OCRAParams
+		expected string
+	}{
+		{"OCRA-1:HOTP-SHA1-6:QN08", key20, OCRAParams{Question: "00000000"}, "237653"},
+		{"OCRA-1:HOTP-SHA1-6:QN08", key20, OCRAParams{Question: "11111111"}, "243178"},
+		{"OCRA-1:HOTP-SHA1-6:QN08", key20, OCRAParams{Question: "55555555"}, "388898"},
+		{"OCRA-1:HOTP-SHA1-6:QN08", key20, OCRAParams{Question: "99999999"}, "294470"},
+		{"OCRA-1:HOTP-SHA256-8:C-QN08-PSHA1", key32, OCRAParams{Counter: 0, Question: "12345678", PIN: pin}, "65347737"},
+		{"OCRA-1:HOTP-SHA256-8:C-QN08-PSHA1", key32, OCRAParams{Counter: 1, Question: "12345678", PIN: pin}, "86775851"},
+		{"OCRA-1:HOTP-SHA256-8:C-QN08-PSHA1", key32, OCRAParams{Counter: 9, Question: "12345678", PIN: pin}, "08522129"},
+		{"OCRA-1:HOTP-SHA256-8:QN08-PSHA1", key32, OCRAParams{Question: "00000000", PIN: pin}, "83238735"},
+		{"OCRA-1:HOTP-SHA256-8:QN08-PSHA1", key32, OCRAParams{Question: "44444444", PIN: pin}, "86807031"},
+		{"OCRA-1:HOTP-SHA512-8:C-QN08", key64, OCRAParams{Counter: 0, Question: "00000000"}, "07016083"},
+		{"OCRA-1:HOTP-SHA512-8:C-QN08", key64, OCRAParams{Counter: 5, Question: "55555555"}, "34205738"},
+		{"OCRA-1:HOTP-SHA512-8:QN08-T1M", key64, OCRAParams{Question: "00000000", Timestamp: ts}, "95209754"},
+		{"OCRA-1:HOTP-SHA512-8:QN08-T1M", key64, OCRAParams{Question: "44444444", Timestamp: ts}, "36209546"},
+		{"OCRA-1:HOTP-SHA256-8:QA08", key32, OCRAParams{Question: "CLI22220SRV11110"}, "28247970"},
+		{"OCRA-1:HOTP-SHA256-8:QA08", key32, OCRAParams{Question: "SIG10000"}, "53095496"},
+		{"OCRA-1:HOTP-SHA512-8:QA10-T1M", key64, OCRAParams{Question: "SIG1000000", Timestamp: ts}, "77537423"},
+	}
+
+	for _, tt := range tests {
+		suite, err := ParseOCRASuite(tt.suite)
+		if err != nil {
+			t.Fatalf("ParseOCRASuite(%q) failed: %v", tt.suite, err)
+		}
+		got, err := GenerateOCRA(suite, tt.key, tt.params)
+		if err != nil {
+			t.Errorf("GenerateOCRA(%s, %q) failed: %v", tt.suite, tt.params.Question, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("GenerateOCRA(%s, %q) = %s, want %s", tt.suite, tt.params.Question, got, tt.expected)
+		}
+	}
+}
+
+func TestParseOCRASuite_Invalid(t *testing.T) {
+	for _, suite := range []string{
+		"",
+		"OCRA-2:HOTP-SHA1-6:QN08",
+		"OCRA-1:HOTP-MD5-6:QN08",
+		"OCRA-1:HOTP-SHA1-3:QN08",
+		"OCRA-1:HOTP-SHA1-6:C",
+		"OCRA-1:HOTP-SHA1-6:QX08",
+		"OCRA-1:HOTP-SHA1-6:QN99",
+		"OCRA-1:HOTP-SHA1-6:QN08-T0M",
+		"OCRA-1:HOTP-SHA1-6:QN08-Z",
+	} {
+		if _, err := ParseOCRASuite(suite); err == nil {
+			t.Errorf("Expected error for suite %q", suite)
+		}
+	}
+
+	suite, _ := ParseOCRASuite("OCRA-1:HOTP-SHA1-6:QN08-PSHA1")
+	if _, err := GenerateOCRA(suite, []byte("key"), OCRAParams{Question: "12345678"}); err == nil {
+		t.Error("Expected error for missing PIN")
+	}
+}
@@ -1,89 +1,127 @@
+// Package totp adapts the public pkg/otp engine to gotp's vault accounts and
+// adds OCRA challenge-response (RFC 6287). Generation and verification are
+// implemented in pkg/otp; this package re-exports them under the names the
+// rest of gotp uses.
 package totp
 
 import (
-	"crypto/subtle"
 	"time"
+
+	"github.com/zulfikawr/gotp/pkg/otp"
+)
+
+// OTPType identifies whether an account produces time-based, counter-based
+// or challenge-response one-time passwords.
+type OTPType string
+
+const (
+	// TypeTOTP is a time-based account (RFC 6238). It is the default.
+	TypeTOTP OTPType = "totp"
+	// TypeHOTP is a counter-based account (RFC 4226).
+	TypeHOTP OTPType = "hotp"
+	// TypeOCRA is a challenge-response account (RFC 6287).
+	TypeOCRA OTPType = "ocra"
+)
+
+type (
+	// HashAlgorithm is the HMAC hash function; see otp.HashAlgorithm.
+	HashAlgorithm = otp.HashAlgorithm
+	// TOTPParams holds TOTP generation parameters; see otp.TOTPParams.
+	TOTPParams = otp.TOTPParams
+	// Encoder renders codes; see otp.Encoder.
+	Encoder = otp.Encoder
+	// EncoderName identifies an encoder; see otp.EncoderName.
+	EncoderName = otp.EncoderName
+	// RFCEncoder produces RFC 4226 decimal codes.
+	RFCEncoder = otp.RFCEncoder
+	// SteamEncoder produces Steam Guard codes.
+	SteamEncoder = otp.SteamEncoder
+	// MOTPEncoder produces Mobile-OTP codes.
+	MOTPEncoder = otp.MOTPEncoder
+	// Generator produces codes from a precomputed key; see otp.Generator.
+	Generator = otp.Generator
+	// Code is one result of GenerateAll.
+	Code = otp.Code
+)
+
+// Hash algorithms, encoders and defaults re-exported from pkg/otp.
+const (
+	SHA1   = otp.SHA1
+	SHA256 = otp.SHA256
+	SHA512 = otp.SHA512
+
+	EncoderRFC   = otp.EncoderRFC
+	EncoderSteam = otp.EncoderSteam
+	EncoderMOTP  = otp.EncoderMOTP
+
+	MinDigits = otp.MinDigits
+	MaxDigits = otp.MaxDigits
+
+	DefaultResyncWindow      = otp.DefaultResyncWindow
+	DefaultCalibrationWindow = otp.DefaultCalibrationWindow
 )
 
-// TOTPParams holds the configuration parameters for generating or
-// validating a Time-based One-Time Password (TOTP).
-type TOTPParams struct {
-	// Secret is the Base32-decoded secret key.
-	Secret []byte
-	// Timestamp is the time for which the OTP is generated (usually time.Now()).
-	Timestamp time.Time
-	// Period is the time step in seconds (usually 30 or 60).
-	Period int
-	// Digits is the number of digits in the generated code (6, 7, or 8).
-	Digits int
-	// Algorithm is the hash function to use (SHA1, SHA256, or SHA512).
-	Algorithm HashAlgorithm
+// HMAC computes an HMAC with the given hash algorithm.
+func HMAC(key []byte, message []byte, algo HashAlgorithm) []byte {
+	return otp.HMAC(key, message, algo)
 }
 
-// GenerateTOTP generates a Time-based One-Time Password (TOTP) as defined in RFC 6238.
-// It calculates the time step counter based on the provided timestamp and period,
-// then calls GenerateHOTP to produce the code.
+// DynamicTruncate extracts the RFC 4226 31-bit value from an HMAC result.
+func DynamicTruncate(hs []byte) uint32 {
+	return otp.DynamicTruncate(hs)
+}
+
+// GenerateHOTP generates an RFC 4226 HOTP code.
+func GenerateHOTP(secret []byte, counter uint64, digits int, algo HashAlgorithm) (string, error) {
+	return otp.GenerateHOTP(secret, counter, digits, algo)
+}
+
+// ResyncHOTP recovers an HOTP counter from two consecutive codes.
+func ResyncHOTP(secret []byte, counter uint64, window int, digits int, algo HashAlgorithm, code1, code2 string) (uint64, bool, error) {
+	return otp.ResyncHOTP(secret, counter, window, digits, algo, code1, code2)
+}
+
+// ValidateDigits checks that the named encoder supports a code length.
+func ValidateDigits(name EncoderName, digits int) error {
+	return otp.ValidateDigits(name, digits)
+}
+
+// NewEncoder returns the encoder registered under name.
+func NewEncoder(name EncoderName, pin []byte) (Encoder, error) {
+	return otp.NewEncoder(name, pin)
+}
+
+// GenerateTOTP generates an RFC 6238 TOTP code.
 func GenerateTOTP(params TOTPParams) (string, error) {
-	// Apply default values if not specified.
-	if params.Period <= 0 {
-		params.Period = 30
-	}
-	if params.Digits == 0 {
-		params.Digits = 6
-	}
-	if params.Algorithm == "" {
-		params.Algorithm = SHA1
-	}
-
-	// T = (Current Unix Time - T0) / X
-	// T0 is usually 0 (Unix epoch). X is the time step (Period).
-	counter := uint64(params.Timestamp.Unix() / int64(params.Period))
-
-	return GenerateHOTP(params.Secret, counter, params.Digits, params.Algorithm)
+	return otp.GenerateTOTP(params)
 }
 
-// ValidateTOTP validates a TOTP code with a given time window tolerance.
-// A window of 1 allows for the current, previous, and next time steps to be valid,
-// helping to account for clock drift between the client and server.
+// NewGenerator prepares a reusable Generator with a cached HMAC key.
+func NewGenerator(params TOTPParams) (*Generator, error) {
+	return otp.NewGenerator(params)
+}
+
+// GenerateAll generates the code at t for every generator in parallel.
+func GenerateAll(generators []*Generator, t time.Time) []Code {
+	return otp.GenerateAll(generators, t)
+}
+
+// ValidateTOTP reports whether code is valid within window steps of params.Timestamp.
 func ValidateTOTP(code string, params TOTPParams, window int) (bool, error) {
-	if params.Period <= 0 {
-		params.Period = 30
-	}
-
-	// Check the codes within the specified window of time steps.
-	for i := -window; i <= window; i++ {
-		t := params.Timestamp.Add(time.Duration(i*params.Period) * time.Second)
-		p := params
-		p.Timestamp = t
-
-		generated, err := GenerateTOTP(p)
-		if err != nil {
-			return false, err
-		}
-
-		// Use constant-time comparison to prevent timing attacks.
-		if subtle.ConstantTimeCompare([]byte(generated), []byte(code)) == 1 {
-			return true, nil
-		}
-	}
-
-	return false, nil
+	return otp.ValidateTOTP(code, params, window)
+}
+
+// CalibrateTOTP infers the time offset at which code is produced.
+func CalibrateTOTP(code string, params TOTPParams, window int) (int64, bool, error) {
+	return otp.CalibrateTOTP(code, params, window)
 }
 
-// RemainingSeconds returns the number of seconds remaining until the
-// TOTP code generated for the given timestamp expires.
+// RemainingSeconds returns the seconds until the code for timestamp expires.
 func RemainingSeconds(timestamp time.Time, period int) int {
-	if period <= 0 {
-		period = 30
-	}
-	return period - int(timestamp.Unix()%int64(period))
+	return otp.RemainingSeconds(timestamp, period)
 }
 
-// NextExpiration returns the absolute time when the current TOTP period will end.
+// NextExpiration returns the time at which the current period ends.
 func NextExpiration(timestamp time.Time, period int) time.Time {
-	if period <= 0 {
-		period = 30
-	}
-	remaining := RemainingSeconds(timestamp, period)
-	return timestamp.Truncate(time.Second).Add(time.Duration(remaining) * time.Second)
+	return otp.NextExpiration(timestamp, period)
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -30,21 +31,30 @@ func (s *Secret) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-// Account represents a single TOTP account entry in the vault.
+// Account represents a single TOTP or HOTP account entry in the vault.
 type Account struct {
-	ID         string             `json:"id"`
-	Name       string             `json:"name"`
-	Issuer     string             `json:"issuer"`
-	Username   string             `json:"username"`
-	Secret     Secret             `json:"secret"` // Encrypted Base32 secret (stored as bytes for memory safety)
-	Algorithm  totp.HashAlgorithm `json:"algorithm"`
-	Digits     int                `json:"digits"`
-	Period     int                `json:"period"`
-	Tags       []string           `json:"tags"`
-	Icon       string             `json:"icon"`
-	SortOrder  int                `json:"sort_order"`
-	CreatedAt  time.Time          `json:"created_at"`
-	LastUsedAt time.Time          `json:"last_used_at"`
+	ID           string             `json:"id"`
+	Name         string             `json:"name"`
+	Issuer       string             `json:"issuer"`
+	Username     string             `json:"username"`
+	Secret       Secret             `json:"secret,omitempty"`        // Plaintext Base32 secret, only until the account is sealed
+	SealedSecret []byte             `json:"sealed_secret,omitempty"` // Secret encrypted under the vault's secret subkey
+	Type         totp.OTPType       `json:"type,omitempty"`
+	Algorithm    totp.HashAlgorithm `json:"algorithm"`
+	Digits       int                `json:"digits"`
+	Period       int                `json:"period"`
+	Counter      uint64             `json:"counter,omitempty"` // Next HOTP counter value
+	Encoder      totp.EncoderName   `json:"encoder,omitempty"`
+	PIN          Secret             `json:"pin,omitempty"`        // Plaintext mOTP PIN or OCRA PIN input, only until the account is sealed
+	SealedPIN    []byte             `json:"sealed_pin,omitempty"` // PIN encrypted under the vault's secret subkey
+	OCRASuite    string             `json:"ocra_suite,omitempty"`
+	T0           int64              `json:"t0,omitempty"`          // Unix time TOTP steps are counted from
+	TimeOffset   int64              `json:"time_offset,omitempty"` // Seconds added to the local clock (see gotp calibrate)
+	Tags         []string           `json:"tags"`
+	Icon         string             `json:"icon"`
+	SortOrder    int                `json:"sort_order"`
+	CreatedAt    time.Time          `json:"created_at"`
+	LastUsedAt   time.Time          `json:"last_used_at"`
 }
 
 // NewAccount creates a new account with default values.
@@ -53,6 +63,8 @@ func NewAccount(name string, secret []byte) *Account {
 	return &Account{
 		Name:       name,
 		Secret:     Secret(secret),
+		Type:       totp.TypeTOTP,
+		Encoder:    totp.EncoderRFC,
 		Algorithm:  totp.SHA1,
 		Digits:     6,
 		Period:     30,
@@ -62,16 +74,142 @@ func NewAccount(name string, secret []byte) *Account {
 	}
 }
 
+// AccountInfo is the metadata of an account without its secret or PIN,
+// sealed or not, for listings that leave the vault such as gotp list --json.
+type AccountInfo struct {
+	ID         string             `json:"id"`
+	Name       string             `json:"name"`
+	Issuer     string             `json:"issuer"`
+	Username   string             `json:"username"`
+	Type       totp.OTPType       `json:"type,omitempty"`
+	Algorithm  totp.HashAlgorithm `json:"algorithm"`
+	Digits     int                `json:"digits"`
+	Period     int                `json:"period"`
+	Counter    uint64             `json:"counter,omitempty"`
+	Encoder    totp.EncoderName   `json:"encoder,omitempty"`
+	OCRASuite  string             `json:"ocra_suite,omitempty"`
+	T0         int64              `json:"t0,omitempty"`
+	TimeOffset int64              `json:"time_offset,omitempty"`
+	Tags       []string           `json:"tags"`
+	Icon       string             `json:"icon"`
+	SortOrder  int                `json:"sort_order"`
+	CreatedAt  time.Time          `json:"created_at"`
+	LastUsedAt time.Time          `json:"last_used_at"`
+}
+
+// Info returns the account's metadata.
+func (a *Account) Info() AccountInfo {
+	return AccountInfo{
+		ID:         a.ID,
+		Name:       a.Name,
+		Issuer:     a.Issuer,
+		Username:   a.Username,
+		Type:       a.Type,
+		Algorithm:  a.Algorithm,
+		Digits:     a.Digits,
+		Period:     a.Period,
+		Counter:    a.Counter,
+		Encoder:    a.Encoder,
+		OCRASuite:  a.OCRASuite,
+		T0:         a.T0,
+		TimeOffset: a.TimeOffset,
+		Tags:       a.Tags,
+		Icon:       a.Icon,
+		SortOrder:  a.SortOrder,
+		CreatedAt:  a.CreatedAt,
+		LastUsedAt: a.LastUsedAt,
+	}
+}
+
+// IsHOTP reports whether the account is counter-based.
+func (a *Account) IsHOTP() bool {
+	return a.Type == totp.TypeHOTP
+}
+
+// IsOCRA reports whether the account is an OCRA challenge-response account.
+func (a *Account) IsOCRA() bool {
+	return a.Type == totp.TypeOCRA
+}
+
+// Validate checks that the account's parameters can produce codes.
+func (a *Account) Validate() error {
+	if a.IsOCRA() {
+		_, err := totp.ParseOCRASuite(a.OCRASuite)
+		return err
+	}
+	return totp.ValidateDigits(a.Encoder, a.Digits)
+}
+
+// CodeEncoder returns the encoder used to render this account's codes. It
+// uses the plaintext PIN of an unsealed account; see Vault.CodeEncoder.
+func (a *Account) CodeEncoder() (totp.Encoder, error) {
+	return totp.NewEncoder(a.Encoder, a.PIN)
+}
+
+// TOTPParams returns the parameters for generating this account's TOTP code
+// at timestamp t, including its T0 and calibrated time offset.
+func (a *Account) TOTPParams(secret []byte, t time.Time, encoder totp.Encoder) totp.TOTPParams {
+	return totp.TOTPParams{
+		Secret:     secret,
+		Timestamp:  t,
+		Period:     a.Period,
+		Digits:     a.Digits,
+		Algorithm:  a.Algorithm,
+		Encoder:    encoder,
+		T0:         a.T0,
+		TimeOffset: a.TimeOffset,
+	}
+}
+
 // ToURI returns the otpauth:// URI representation of the account.
+// Non-RFC encoders are recorded in an "encoder" parameter.
 func (a *Account) ToURI() string {
-	return fmt.Sprintf("otpauth://totp/%s:%s?secret=%s&issuer=%s&algorithm=%s&digits=%d&period=%d",
-		a.Issuer, a.Username, string(a.Secret), a.Issuer, a.Algorithm, a.Digits, a.Period)
+	var uri string
+	if a.IsOCRA() {
+		uri = fmt.Sprintf("otpauth://ocra/%s:%s?secret=%s&issuer=%s&suite=%s&counter=%d",
+			a.Issuer, a.Username, string(a.Secret), a.Issuer, url.QueryEscape(a.OCRASuite), a.Counter)
+		if len(a.PIN) > 0 {
+			uri += "&pin=" + url.QueryEscape(string(a.PIN))
+		}
+		return uri
+	}
+	if a.IsHOTP() {
+		uri = fmt.Sprintf("otpauth://hotp/%s:%s?secret=%s&issuer=%s&algorithm=%s&digits=%d&counter=%d",
+			a.Issuer, a.Username, string(a.Secret), a.Issuer, a.Algorithm, a.Digits, a.Counter)
+	} else {
+		uri = fmt.Sprintf("otpauth://totp/%s:%s?secret=%s&issuer=%s&algorithm=%s&digits=%d&period=%d",
+			a.Issuer, a.Username, string(a.Secret), a.Issuer, a.Algorithm, a.Digits, a.Period)
+		if a.T0 != 0 {
+			uri += fmt.Sprintf("&t0=%d", a.T0)
+		}
+	}
+	if a.Encoder != "" && a.Encoder != totp.EncoderRFC {
+		uri += "&encoder=" + string(a.Encoder)
+		if len(a.PIN) > 0 {
+			uri += "&pin=" + url.QueryEscape(string(a.PIN))
+		}
+	}
+	return uri
 }
 
 // FromURI parses an otpauth:// URI into an Account.
+// The "otpauth://steam/" and "otpauth://motp/" forms used by some
+// authenticators are accepted as TOTP accounts with the matching encoder.
 func FromURI(uriStr string) (*Account, error) {
-	if !strings.HasPrefix(uriStr, "otpauth://totp/") {
-		return nil, fmt.Errorf("invalid URI format: must start with otpauth://totp/")
+	otpType := totp.TypeTOTP
+	encoder := totp.EncoderRFC
+	switch {
+	case strings.HasPrefix(uriStr, "otpauth://totp/"):
+	case strings.HasPrefix(uriStr, "otpauth://hotp/"):
+		otpType = totp.TypeHOTP
+	case strings.HasPrefix(uriStr, "otpauth://ocra/"):
+		otpType = totp.TypeOCRA
+	case strings.HasPrefix(uriStr, "otpauth://steam/"):
+		encoder = totp.EncoderSteam
+	case strings.HasPrefix(uriStr, "otpauth://motp/"):
+		encoder = totp.EncoderMOTP
+	default:
+		return nil, fmt.Errorf("invalid URI format: must start with otpauth://totp/, otpauth://hotp/, otpauth://ocra/, otpauth://steam/ or otpauth://motp/")
 	}
 
 	u, err := url.Parse(uriStr)
@@ -100,26 +238,74 @@ func FromURI(uriStr string) (*Account, error) {
 		algo = totp.SHA1
 	}
 
-	digits := 6
+	if e := u.Query().Get("encoder"); e != "" {
+		encoder = totp.EncoderName(strings.ToLower(e))
+	}
+	if _, err := totp.NewEncoder(encoder, nil); err != nil {
+		return nil, err
+	}
+
+	digits, period := 6, 30
+	switch encoder {
+	case totp.EncoderSteam:
+		digits = 5
+	case totp.EncoderMOTP:
+		period = 10
+	}
+
 	if d := u.Query().Get("digits"); d != "" {
-		if _, err := fmt.Sscanf(d, "%d", &digits); err != nil {
-			return nil, fmt.Errorf("invalid digits: %v", err)
+		if digits, err = strconv.Atoi(d); err != nil {
+			return nil, fmt.Errorf("invalid digits %q", d)
 		}
 	}
 
-	period := 30
 	if p := u.Query().Get("period"); p != "" {
-		if _, err := fmt.Sscanf(p, "%d", &period); err != nil {
-			return nil, fmt.Errorf("invalid period: %v", err)
+		if period, err = strconv.Atoi(p); err != nil {
+			return nil, fmt.Errorf("invalid period %q", p)
+		}
+	}
+
+	var counter uint64
+	if c := u.Query().Get("counter"); c != "" {
+		if counter, err = strconv.ParseUint(c, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid counter %q", c)
+		}
+	}
+
+	var t0 int64
+	if t := u.Query().Get("t0"); t != "" {
+		if t0, err = strconv.ParseInt(t, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid t0 %q", t)
 		}
 	}
 
 	acc := NewAccount(username, []byte(secret))
 	acc.Issuer = issuer
 	acc.Username = username
+	acc.Type = otpType
 	acc.Algorithm = algo
 	acc.Digits = digits
 	acc.Period = period
+	acc.Counter = counter
+	acc.T0 = t0
+	acc.Encoder = encoder
+	if pin := u.Query().Get("pin"); pin != "" {
+		acc.PIN = Secret(pin)
+	}
+
+	if otpType == totp.TypeOCRA {
+		suite, err := totp.ParseOCRASuite(u.Query().Get("suite"))
+		if err != nil {
+			return nil, err
+		}
+		acc.OCRASuite = suite.Raw
+		acc.Algorithm = suite.Algorithm
+		acc.Digits = suite.Digits
+	}
+
+	if err := acc.Validate(); err != nil {
+		return nil, err
+	}
 
 	return acc, nil
 }
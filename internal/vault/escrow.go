@@ -0,0 +1,153 @@
+package vault
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/zulfikawr/gotp/internal/crypto"
+)
+
+// escrowShareVersion is the encoding version of escrow shares.
+const escrowShareVersion = 1
+
+// escrowCheckPurpose names the subkey whose prefix identifies the master
+// key a share belongs to.
+const escrowCheckPurpose = "gotp escrow check"
+
+// SharePrefix starts the text form of every escrow share.
+const SharePrefix = "gotp-share-"
+
+// ErrShareMismatch is returned when shares do not reconstruct the master
+// key they were split from, for example because they come from different
+// splits.
+var ErrShareMismatch = errors.New("the shares do not reconstruct the vault key")
+
+// EscrowShare is one Shamir share of a vault's master key, for emergency
+// access when every password is lost.
+type EscrowShare struct {
+	Index     int
+	Threshold int
+	splitID   []byte
+	check     []byte
+	value     []byte
+}
+
+// SplitKey splits masterKey into n escrow shares, any threshold of which
+// recover it with CombineShares. The shares are returned in text form.
+func SplitKey(masterKey []byte, n, threshold int) ([]string, error) {
+	check, err := keyCheck(masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	shares, err := crypto.SplitSecret(masterKey, n, threshold)
+	if err != nil {
+		return nil, err
+	}
+	splitID := make([]byte, 2)
+	if _, err := rand.Read(splitID); err != nil {
+		return nil, err
+	}
+
+	encoded := make([]string, len(shares))
+	for i, s := range shares {
+		share := &EscrowShare{Index: int(s.Index), Threshold: threshold, splitID: splitID, check: check, value: s.Value}
+		encoded[i] = share.String()
+		crypto.ZeroBytes(s.Value)
+	}
+	return encoded, nil
+}
+
+// ParseShare parses the text form of an escrow share. Dashes, spaces and
+// case are ignored, and a checksum catches typing mistakes.
+func ParseShare(s string) (*EscrowShare, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < len(SharePrefix) || !strings.EqualFold(s[:len(SharePrefix)], SharePrefix) {
+		return nil, fmt.Errorf("invalid share: missing %q prefix", SharePrefix)
+	}
+
+	data, err := parseRecoveryKey(s[len(SharePrefix):])
+	if err != nil {
+		return nil, fmt.Errorf("invalid share: %w", err)
+	}
+	// version, threshold, index, 2-byte split ID, 4-byte key check, value,
+	// 4-byte checksum
+	if len(data) < 3+2+4+1+4 {
+		return nil, errors.New("invalid share: too short")
+	}
+	body, sum := data[:len(data)-4], data[len(data)-4:]
+	if expected := sha256.Sum256(body); !crypto.SecureCompare(expected[:4], sum) {
+		return nil, errors.New("invalid share: checksum mismatch (check for typing mistakes)")
+	}
+	if body[0] != escrowShareVersion {
+		return nil, fmt.Errorf("invalid share: unsupported version %d", body[0])
+	}
+	if body[1] < 2 || body[2] == 0 {
+		return nil, errors.New("invalid share: bad threshold or index")
+	}
+
+	return &EscrowShare{
+		Threshold: int(body[1]),
+		Index:     int(body[2]),
+		splitID:   body[3:5],
+		check:     body[5:9],
+		value:     body[9:],
+	}, nil
+}
+
+// CombineShares recovers the master key from at least threshold escrow
+// shares of the same split.
+func CombineShares(shares []*EscrowShare) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("no shares given")
+	}
+	first := shares[0]
+	if len(shares) < first.Threshold {
+		return nil, fmt.Errorf("%d of %d required shares given", len(shares), first.Threshold)
+	}
+
+	parts := make([]crypto.Share, len(shares))
+	for i, s := range shares {
+		if s.Threshold != first.Threshold || !crypto.SecureCompare(s.splitID, first.splitID) || !crypto.SecureCompare(s.check, first.check) {
+			return nil, fmt.Errorf("%w: share %d comes from a different split", ErrShareMismatch, s.Index)
+		}
+		parts[i] = crypto.Share{Index: byte(s.Index), Value: s.value}
+	}
+
+	key, err := crypto.CombineShares(parts)
+	if err != nil {
+		return nil, err
+	}
+	check, err := keyCheck(key)
+	if err != nil {
+		return nil, err
+	}
+	if !crypto.SecureCompare(check, first.check) {
+		crypto.ZeroBytes(key)
+		return nil, ErrShareMismatch
+	}
+	return key, nil
+}
+
+// String returns the text form of the share.
+func (s *EscrowShare) String() string {
+	body := []byte{escrowShareVersion, byte(s.Threshold), byte(s.Index)}
+	body = append(body, s.splitID...)
+	body = append(body, s.check...)
+	body = append(body, s.value...)
+	sum := sha256.Sum256(body)
+	return SharePrefix + formatRecoveryKey(append(body, sum[:4]...))
+}
+
+// keyCheck returns a short value derived from masterKey that lets shares
+// be matched to it without revealing it.
+func keyCheck(masterKey []byte) ([]byte, error) {
+	sub, err := crypto.DeriveSubkey(masterKey, escrowCheckPurpose)
+	if err != nil {
+		return nil, err
+	}
+	return sub[:4], nil
+}
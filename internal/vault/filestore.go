@@ -0,0 +1,169 @@
+package vault
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/zulfikawr/gotp/internal/config"
+	"github.com/zulfikawr/gotp/internal/crypto"
+)
+
+// The session file store is the fallback for systems without a desktop
+// keyring. It keeps the master key in the configuration directory,
+// encrypted under a random session key that lives only in the environment
+// of the shell that created it, like SSH_AUTH_SOCK for ssh-agent. Without
+// the session key the file is useless, and it is removed once it expires.
+
+const (
+	// SessionKeyEnv names the environment variable holding the session key.
+	SessionKeyEnv = "GOTP_SESSION"
+	// DefaultFileStoreTTL is how long the session file store keeps a key
+	// when none is given.
+	DefaultFileStoreTTL = 8 * time.Hour
+)
+
+// ErrNoSessionKey is returned by FileStore.Put when SessionKeyEnv is not
+// set to a valid session key.
+var ErrNoSessionKey = errors.New(SessionKeyEnv + " is not set to a session key")
+
+// FileStore keeps keys in files readable only by the user, wrapped under
+// the session key in SessionKeyEnv. Without the session key it holds no
+// keys.
+var FileStore KeyStore = fileStore{}
+
+// sessionFile is the on-disk form of a key in the session file store.
+type sessionFile struct {
+	Vault     string    `json:"vault"`
+	Key       []byte    `json:"key"` // Master key encrypted under the session key
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewSessionKey returns a new random session key, encoded for
+// SessionKeyEnv.
+func NewSessionKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	defer crypto.ZeroBytes(key)
+	return base64.RawURLEncoding.EncodeToString(key), nil
+}
+
+// sessionKey returns the session key in SessionKeyEnv, or nil if it is not
+// set to a valid key.
+func sessionKey() []byte {
+	key, err := base64.RawURLEncoding.DecodeString(os.Getenv(SessionKeyEnv))
+	if err != nil || len(key) != 32 {
+		return nil
+	}
+	return key
+}
+
+// sessionFilePath returns the file holding the key of the vault.
+func sessionFilePath(vault string) string {
+	sum := sha256.Sum256([]byte(vault))
+	return filepath.Join(config.GetDefaultConfigDir(), "sessions", hex.EncodeToString(sum[:16])+".json")
+}
+
+type fileStore struct{}
+
+func (fileStore) Name() string {
+	return "session file"
+}
+
+func (fileStore) Get(vault string) (*crypto.SecureBuffer, error) {
+	key := sessionKey()
+	if key == nil {
+		return nil, nil
+	}
+	defer crypto.ZeroBytes(key)
+
+	path := sessionFilePath(vault)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f sessionFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse session file: %w", err)
+	}
+	if f.Vault != vault || time.Now().After(f.ExpiresAt) {
+		return nil, removeSessionFile(path)
+	}
+	// A key wrapped by another session is not an error; that session may
+	// still use it.
+	buf, err := crypto.DecryptToBuffer(f.Key, key, f.ad())
+	if err != nil {
+		return nil, nil
+	}
+	return buf, nil
+}
+
+func (fileStore) Put(vault string, masterKey []byte, ttl time.Duration) error {
+	key := sessionKey()
+	if key == nil {
+		return ErrNoSessionKey
+	}
+	defer crypto.ZeroBytes(key)
+	if ttl <= 0 {
+		ttl = DefaultFileStoreTTL
+	}
+
+	f := &sessionFile{
+		Vault:     vault,
+		ExpiresAt: time.Now().Add(ttl).UTC().Truncate(time.Second),
+	}
+	var err error
+	if f.Key, err = crypto.Encrypt(masterKey, key, f.ad()); err != nil {
+		return err
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	path := sessionFilePath(vault)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file.
+	return os.Chmod(path, 0600)
+}
+
+func (fileStore) Delete(vault string) error {
+	return removeSessionFile(sessionFilePath(vault))
+}
+
+// removeSessionFile overwrites and removes a session file. It is not an
+// error if there is none.
+func removeSessionFile(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_ = os.WriteFile(path, make([]byte, info.Size()), 0600)
+	return os.Remove(path)
+}
+
+// ad binds the wrapped key to its vault and expiry, so that editing them in
+// the file makes the key fail.
+func (f *sessionFile) ad() []byte {
+	return []byte("gotp session " + f.Vault + " " + strconv.FormatInt(f.ExpiresAt.Unix(), 10))
+}
@@ -0,0 +1,109 @@
+package vault
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/zulfikawr/gotp/internal/crypto"
+)
+
+// authenticatedHeaderVersion is the first format version whose header
+// (format version, salt and KDF parameters) is bound to the ciphertext as
+// associated data and protected by a header MAC.
+const authenticatedHeaderVersion = 3
+
+// keySlotVersion is the first format version in which a random master key
+// encrypts the payload and key slots wrap it. From this version on, the
+// header MAC also covers the slots, while the associated data is limited to
+// the format version so that slots can be rewrapped without re-encrypting
+// the payload.
+const keySlotVersion = 4
+
+// cipherVersion is the first format version that records the cipher of the
+// payload in the header. It is part of the prefix, and so bound to the
+// payload as associated data.
+const cipherVersion = 6
+
+// headerMACPurpose names the subkey used for the header MAC, keeping it
+// independent of the key that encrypts the payload.
+const headerMACPurpose = "gotp vault header mac"
+
+// prefix returns the fixed part of the header: a magic string, the format
+// version and, from cipherVersion, the cipher.
+func (m *VaultMetadata) prefix() []byte {
+	b := []byte("gotp-vault")
+	b = binary.BigEndian.AppendUint32(b, uint32(m.formatVersion()))
+	if m.formatVersion() >= cipherVersion {
+		b = appendField(b, []byte(m.Cipher))
+	}
+	return b
+}
+
+// header returns the canonical encoding of the unencrypted vault header.
+// It is the input to the header MAC, so any change to the cipher, salt, KDF
+// parameters or key slots is detected.
+func (m *VaultMetadata) header() []byte {
+	b := m.prefix()
+	if m.formatVersion() < keySlotVersion {
+		b = appendField(b, m.Salt)
+		return appendKDFParams(b, m.KDFParams)
+	}
+
+	b = binary.BigEndian.AppendUint32(b, uint32(len(m.Slots)))
+	for i := range m.Slots {
+		b = append(b, m.Slots[i].header()...)
+		b = appendField(b, []byte(m.Slots[i].Label))
+		b = appendField(b, m.Slots[i].Key)
+	}
+	return b
+}
+
+// additionalData returns the associated data the payload is sealed with:
+// the whole header for format version 3, the prefix from version 4, and
+// nothing for older formats.
+func (m *VaultMetadata) additionalData() []byte {
+	switch v := m.formatVersion(); {
+	case v < authenticatedHeaderVersion:
+		return nil
+	case v < keySlotVersion:
+		return m.header()
+	default:
+		return m.prefix()
+	}
+}
+
+// sign sets the header MAC using a subkey of the vault key.
+func (m *VaultMetadata) sign(key []byte) error {
+	macKey, err := crypto.DeriveSubkey(key, headerMACPurpose)
+	if err != nil {
+		return err
+	}
+	defer crypto.ZeroBytes(macKey)
+
+	m.HeaderMAC = crypto.MAC(macKey, m.header())
+	return nil
+}
+
+// verifyHeader checks the header MAC before the key is used to decrypt the
+// payload. A wrong password and a modified header are indistinguishable
+// here, since the key itself is derived from the header's parameters.
+// Formats older than authenticatedHeaderVersion carry no MAC.
+func (m *VaultMetadata) verifyHeader(key []byte) error {
+	if m.formatVersion() < authenticatedHeaderVersion {
+		return nil
+	}
+	if len(m.HeaderMAC) == 0 {
+		return fmt.Errorf("vault header is not authenticated (missing header MAC)")
+	}
+
+	macKey, err := crypto.DeriveSubkey(key, headerMACPurpose)
+	if err != nil {
+		return err
+	}
+	defer crypto.ZeroBytes(macKey)
+
+	if !crypto.VerifyMAC(macKey, m.header(), m.HeaderMAC) {
+		return fmt.Errorf("%w: vault header authentication failed", errDecrypt)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package vault
+
+import (
+	"errors"
+	"time"
+
+	"github.com/zulfikawr/gotp/internal/agent"
+	"github.com/zulfikawr/gotp/internal/crypto"
+)
+
+// KeyStore keeps the master keys of vaults outside the vault file, so that
+// LoadVaultInteractive can open a vault without prompting. Vaults are
+// identified by their canonical path.
+type KeyStore interface {
+	// Name describes the store in messages.
+	Name() string
+	// Get returns the key stored for the vault in locked memory, or nil if
+	// the store holds none or is not available. The caller must Destroy
+	// the buffer.
+	Get(vault string) (*crypto.SecureBuffer, error)
+	// Put stores the key of the vault. Stores that forget keys keep it for
+	// ttl.
+	Put(vault string, key []byte, ttl time.Duration) error
+	// Delete removes the key stored for the vault. It is not an error if
+	// the store holds none.
+	Delete(vault string) error
+}
+
+// AgentStore keeps keys in gotp agent; they are forgotten when their
+// session expires or the agent stops. Without a running agent it holds no
+// keys.
+var AgentStore KeyStore = agentStore{}
+
+type agentStore struct{}
+
+func (agentStore) Name() string {
+	return "agent"
+}
+
+func (agentStore) Get(vault string) (*crypto.SecureBuffer, error) {
+	key, err := agent.Get(vault)
+	if errors.Is(err, agent.ErrNotRunning) {
+		return nil, nil
+	}
+	return key, err
+}
+
+func (agentStore) Put(vault string, key []byte, ttl time.Duration) error {
+	return agent.Add(vault, key, ttl)
+}
+
+func (agentStore) Delete(vault string) error {
+	if err := agent.Lock(vault); err != nil && !errors.Is(err, agent.ErrNotRunning) {
+		return err
+	}
+	return nil
+}
+
+// keyStores are asked in order for the key of a vault before
+// LoadVaultInteractive prompts. The first holds the session.
+var keyStores = []KeyStore{AgentStore}
+
+// SetKeyStores sets the stores LoadVaultInteractive takes keys from, in
+// order. The session is kept in AgentStore whatever the stores.
+func SetKeyStores(stores ...KeyStore) {
+	keyStores = stores
+}
+
+// storedKey returns the first key held for the vault at path that opens it,
+// along with the store it came from. A key that no longer decrypts the
+// vault is deleted from its store.
+func storedKey(path string) (*Vault, *crypto.SecureBuffer, KeyStore) {
+	canonical := CanonicalPath(path)
+	for _, store := range keyStores {
+		key, _ := store.Get(canonical)
+		if key == nil {
+			continue
+		}
+		v, err := LoadVaultWithKey(path, key.Bytes())
+		if err == nil {
+			return v, key, store
+		}
+		key.Destroy()
+		if errors.Is(err, errDecrypt) {
+			_ = store.Delete(canonical)
+		}
+	}
+	return nil, nil, nil
+}
+
+// ForgetKey deletes the key of the vault at path from every key store,
+// e.g. after the master key has been rotated.
+func ForgetKey(path string) error {
+	canonical := CanonicalPath(path)
+	var errs []error
+	for _, store := range keyStores {
+		if err := store.Delete(canonical); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
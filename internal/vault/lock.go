@@ -0,0 +1,111 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrConflict is returned when a vault is saved after another process has
+// written the file since the vault was loaded. Saving would discard that
+// process's changes, so the vault must be loaded again instead.
+var ErrConflict = errors.New("the vault was changed by another gotp process since it was opened; run the command again")
+
+// lockPath returns the lock file of the vault at path. The vault file itself
+// cannot be locked, since every save replaces it with a new file.
+func lockPath(path string) string {
+	return path + ".lock"
+}
+
+// lockVault takes an exclusive advisory lock on the vault at path, waiting
+// for other gotp processes to release it, and returns the function that
+// releases it.
+func lockVault(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(lockPath(path), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the vault lock: %w", err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock the vault: %w", err)
+	}
+	return func() {
+		_ = unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// Update loads the vault at path with its master key, applies fn to it and
+// saves the result, holding the vault lock from the read to the write so
+// that no other gotp process can save the vault in between. If fn returns
+// an error, nothing is saved and the error is returned. fn must not save
+// the vault itself, nor keep it: it is destroyed when Update returns.
+func Update(path string, key []byte, fn func(*Vault) error) error {
+	return UpdateKey(path, key, func(v *Vault) ([]byte, error) {
+		return key, fn(v)
+	})
+}
+
+// UpdateKey is like Update, but saves the vault with the master key fn
+// returns, such as a new key when fn rotates it.
+func UpdateKey(path string, key []byte, fn func(*Vault) ([]byte, error)) error {
+	unlock, err := lockVault(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	metadata, err := readMetadata(path)
+	if err != nil {
+		return err
+	}
+	v, err := loadWithKey(path, metadata, key, true)
+	if err != nil {
+		return err
+	}
+	defer v.Destroy()
+
+	newKey, err := fn(v)
+	if err != nil {
+		return err
+	}
+	return SaveVaultWithKey(path, v, newKey)
+}
+
+// commit writes metadata as the next generation of the vault file, under the
+// vault lock, which it takes unless the vault is being updated by Update.
+// If v was loaded from the file and the file has been written since, it
+// returns ErrConflict and leaves the file alone. A vault that was not
+// loaded, such as a new one, replaces the file.
+func (v *Vault) commit(path string, metadata *VaultMetadata) error {
+	if !v.locked {
+		unlock, err := lockVault(path)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	current, err := readMetadata(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		current = &VaultMetadata{}
+	case err != nil:
+		return err
+	}
+	if v.loaded && current.Generation != v.generation {
+		return ErrConflict
+	}
+
+	metadata.Generation = current.Generation + 1
+	if err := writeMetadata(path, metadata); err != nil {
+		return err
+	}
+	v.generation = metadata.Generation
+	v.loaded = true
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly || windows)
+
+package vault
+
+import "os"
+
+// lockFile is a no-op on platforms without file locking. Saves are still
+// checked against the generation of the file, but not serialized.
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
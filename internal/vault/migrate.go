@@ -0,0 +1,184 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// FormatVersion is the on-disk vault format written by this build. It is
+// stored unencrypted in VaultMetadata so that the format can be checked
+// before a key is derived.
+//
+// Version 1 is the original format, which carried no version in the
+// metadata and a "version": "1.0" string inside the encrypted payload.
+const FormatVersion = 7
+
+// ErrNewerFormat is returned when a vault was written by a newer gotp that
+// uses a format this build does not understand.
+var ErrNewerFormat = errors.New("vault was written by a newer version of gotp")
+
+// migration upgrades the decrypted vault document from format version from
+// to from+1. The document is the generic JSON form of the payload so that a
+// migration does not depend on the current Vault and Account types.
+type migration struct {
+	from        int
+	description string
+	apply       func(doc map[string]interface{}) error
+}
+
+// migrations is the ordered registry of format upgrades. Each entry must
+// upgrade from the version produced by the previous one; add new steps at
+// the end and bump FormatVersion.
+var migrations = []migration{
+	{
+		from:        1,
+		description: "drop the payload version string and record account types and encoders",
+		apply:       migrateV1ToV2,
+	},
+	{
+		from:        2,
+		description: "authenticate the header (salt and KDF parameters)",
+		apply:       migrateV2ToV3,
+	},
+	{
+		from:        3,
+		description: "wrap a master key in key slots",
+		apply:       migrateV3ToV4,
+	},
+	{
+		from:        4,
+		description: "seal each account secret separately",
+		apply:       migrateV4ToV5,
+	},
+	{
+		from:        5,
+		description: "record the payload cipher in the header",
+		apply:       migrateV5ToV6,
+	},
+	{
+		from:        6,
+		description: "seal account PINs",
+		apply:       migrateV6ToV7,
+	},
+}
+
+// formatVersion returns the format version recorded in the metadata.
+// Metadata without a version predates versioning and is format 1.
+func (m *VaultMetadata) formatVersion() int {
+	if m.Version == 0 {
+		return 1
+	}
+	return m.Version
+}
+
+// checkFormat rejects vaults written in a format newer than FormatVersion.
+func (m *VaultMetadata) checkFormat() error {
+	if v := m.formatVersion(); v > FormatVersion {
+		return fmt.Errorf("%w (format version %d, this build supports up to %d); please upgrade gotp", ErrNewerFormat, v, FormatVersion)
+	}
+	return nil
+}
+
+// migratePayload upgrades a decrypted payload from format version from to
+// FormatVersion by applying each registered migration in order.
+func migratePayload(plaintext []byte, from int) ([]byte, error) {
+	if from == FormatVersion {
+		return plaintext, nil
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(plaintext, &doc); err != nil {
+		return nil, err
+	}
+
+	for version := from; version < FormatVersion; version++ {
+		m, ok := findMigration(version)
+		if !ok {
+			return nil, fmt.Errorf("no migration from vault format version %d", version)
+		}
+		if err := m.apply(doc); err != nil {
+			return nil, fmt.Errorf("migrating vault format %d to %d (%s): %w", version, version+1, m.description, err)
+		}
+	}
+
+	return json.Marshal(doc)
+}
+
+func findMigration(from int) (migration, bool) {
+	for _, m := range migrations {
+		if m.from == from {
+			return m, true
+		}
+	}
+	return migration{}, false
+}
+
+// migrateV1ToV2 removes the unused "version" string from the payload and
+// fills in the account fields that version 1 vaults did not record.
+func migrateV1ToV2(doc map[string]interface{}) error {
+	delete(doc, "version")
+
+	raw, ok := doc["accounts"]
+	if !ok || raw == nil {
+		doc["accounts"] = []interface{}{}
+		return nil
+	}
+	accounts, ok := raw.([]interface{})
+	if !ok {
+		return fmt.Errorf("accounts is not a list")
+	}
+
+	for i, a := range accounts {
+		acc, ok := a.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("account %d is not an object", i)
+		}
+		if t, _ := acc["type"].(string); t == "" {
+			acc["type"] = "totp"
+		}
+		if e, _ := acc["encoder"].(string); e == "" {
+			acc["encoder"] = "rfc"
+		}
+		if acc["tags"] == nil {
+			acc["tags"] = []interface{}{}
+		}
+	}
+	return nil
+}
+
+// migrateV2ToV3 leaves the payload unchanged. Version 3 binds the header as
+// associated data and adds a header MAC; older files are opened without
+// them and gain both when the upgraded vault is saved.
+func migrateV2ToV3(doc map[string]interface{}) error {
+	return nil
+}
+
+// migrateV3ToV4 leaves the payload unchanged. Version 4 encrypts it with a
+// master key held in key slots; the key derived from the password of an
+// older vault becomes its master key and is wrapped in a password slot when
+// the upgraded vault is saved.
+func migrateV3ToV4(doc map[string]interface{}) error {
+	return nil
+}
+
+// migrateV4ToV5 leaves the payload unchanged. Version 5 seals each account
+// secret under a subkey of the master key; the plaintext secrets of an
+// older vault are sealed when the upgraded vault is saved.
+func migrateV4ToV5(doc map[string]interface{}) error {
+	return nil
+}
+
+// migrateV5ToV6 leaves the payload unchanged. Version 6 records the cipher
+// of the payload and account secrets in the header; older vaults are
+// AES-256-GCM, which is recorded when the upgraded vault is saved.
+func migrateV5ToV6(doc map[string]interface{}) error {
+	return nil
+}
+
+// migrateV6ToV7 leaves the payload unchanged. Version 7 seals the mOTP and
+// OCRA PINs of accounts like their secrets; the plaintext PINs of an older
+// vault are sealed when the upgraded vault is saved.
+func migrateV6ToV7(doc map[string]interface{}) error {
+	return nil
+}
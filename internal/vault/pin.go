@@ -0,0 +1,87 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zulfikawr/gotp/internal/agent"
+	"github.com/zulfikawr/gotp/internal/crypto"
+)
+
+// A quick-unlock PIN wraps a copy of the master key under a short PIN for a
+// bounded period, so that the master password is not needed every time the
+// session expires. The wrapped copy and the count of wrong PINs live only
+// in the memory of gotp agent, which checks PINs itself; nothing is
+// written to disk, so a PIN cannot be guessed offline. Once the count
+// reaches the limit, the copy is destroyed and only the master password
+// unlocks the vault again.
+
+const (
+	// DefaultPINDuration is how long a PIN unlocks the vault.
+	DefaultPINDuration = 8 * time.Hour
+	// DefaultPINAttempts is how many wrong PINs destroy the PIN.
+	DefaultPINAttempts = 5
+	// MinPINLength is the minimum length of a PIN.
+	MinPINLength = 6
+)
+
+// ErrWrongPIN is returned for a PIN that does not unlock the vault.
+var ErrWrongPIN = agent.ErrWrongPIN
+
+// ErrPINDestroyed is returned when the last allowed attempt was wrong and
+// the PIN has been destroyed.
+var ErrPINDestroyed = agent.ErrPINDestroyed
+
+// ErrPINNeedsAgent is returned by SetPIN when gotp agent, which keeps the
+// PIN, is not running.
+var ErrPINNeedsAgent = errors.New("a PIN is kept by gotp agent, which is not running")
+
+// PINState describes the quick-unlock PIN of a vault.
+type PINState = agent.PINState
+
+// SetPIN has the agent wrap masterKey under pin for duration, replacing any
+// PIN of the vault. After attempts wrong PINs, the PIN is destroyed.
+func SetPIN(vaultPath string, masterKey, pin []byte, params crypto.KDFParams, duration time.Duration, attempts int) error {
+	if len(pin) < MinPINLength {
+		return fmt.Errorf("the PIN must be at least %d characters", MinPINLength)
+	}
+	if duration <= 0 || attempts < 1 {
+		return fmt.Errorf("the PIN needs a positive duration and number of attempts")
+	}
+	err := agent.SetPIN(CanonicalPath(vaultPath), masterKey, pin, params, duration, attempts)
+	if errors.Is(err, agent.ErrNotRunning) {
+		return ErrPINNeedsAgent
+	}
+	return err
+}
+
+// GetPIN returns the state of the vault's PIN, or nil if it has none, it
+// has expired or no agent is running.
+func GetPIN(vaultPath string) (*PINState, error) {
+	state, err := agent.GetPIN(CanonicalPath(vaultPath))
+	if errors.Is(err, agent.ErrNotRunning) {
+		return nil, nil
+	}
+	return state, err
+}
+
+// RemovePIN destroys the vault's PIN. It is not an error if there is none.
+func RemovePIN(vaultPath string) error {
+	if err := agent.RemovePIN(CanonicalPath(vaultPath)); err != nil && !errors.Is(err, agent.ErrNotRunning) {
+		return err
+	}
+	return nil
+}
+
+// UnlockPIN returns the master key wrapped under the vault's PIN. The agent
+// counts a wrong PIN before it is checked; the last allowed wrong PIN
+// destroys the PIN and returns ErrPINDestroyed.
+func UnlockPIN(vaultPath string, pin []byte) ([]byte, error) {
+	key, err := agent.UnlockPIN(CanonicalPath(vaultPath), pin)
+	if err != nil {
+		return nil, err
+	}
+	defer key.Destroy()
+	return append([]byte(nil), key.Bytes()...), nil
+}
@@ -0,0 +1,308 @@
+package vault
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zulfikawr/gotp/internal/crypto"
+	"github.com/zulfikawr/gotp/internal/totp"
+	"github.com/zulfikawr/gotp/pkg/base32"
+)
+
+// secretKeyPurpose names the subkey that seals account secrets, keeping it
+// independent of the key that encrypts the payload.
+const secretKeyPurpose = "gotp account secrets"
+
+// ErrSecretsLocked is returned when a sealed secret is opened in a vault
+// that was not unlocked with its master key, such as a copy of its
+// accounts in another vault.
+var ErrSecretsLocked = errors.New("account secrets are sealed under another vault key")
+
+// OpenSecret decrypts the Base32 secret of an account of the vault into
+// locked memory. The caller must Destroy the buffer when done. A secret
+// that has not been sealed yet, e.g. of an account added since the vault
+// was saved, is copied into the buffer.
+func (v *Vault) OpenSecret(a *Account) (*crypto.SecureBuffer, error) {
+	if len(a.Secret) == 0 && len(a.SealedSecret) == 0 {
+		return nil, fmt.Errorf("account %q has no secret", a.Name)
+	}
+	buf, err := v.open(a.Secret, a.SealedSecret, a.secretAD())
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt the secret of %q: %w", a.Name, err)
+	}
+	return buf, nil
+}
+
+// OpenPIN decrypts the mOTP or OCRA PIN of an account of the vault into
+// locked memory, like OpenSecret. It returns a nil buffer if the account
+// has no PIN. The caller must Destroy the buffer when done.
+func (v *Vault) OpenPIN(a *Account) (*crypto.SecureBuffer, error) {
+	if len(a.PIN) == 0 && len(a.SealedPIN) == 0 {
+		return nil, nil
+	}
+	buf, err := v.open(a.PIN, a.SealedPIN, a.pinAD())
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt the PIN of %q: %w", a.Name, err)
+	}
+	return buf, nil
+}
+
+// open returns plaintext, or sealed decrypted with the secret subkey, in
+// locked memory.
+func (v *Vault) open(plaintext Secret, sealed, ad []byte) (*crypto.SecureBuffer, error) {
+	if len(plaintext) > 0 {
+		buf, err := crypto.NewSecureBuffer(len(plaintext))
+		if err != nil {
+			return nil, err
+		}
+		copy(buf.Bytes(), plaintext)
+		return buf, nil
+	}
+	if v.secretKey == nil {
+		return nil, ErrSecretsLocked
+	}
+	return v.secretCipher.DecryptToBuffer(sealed, v.secretKey.Bytes(), ad)
+}
+
+// DecodeSecret returns the raw key of an account, decoded from its Base32
+// secret, in locked memory. The secret never takes a string form. The
+// caller must Destroy the buffer when done.
+func (v *Vault) DecodeSecret(a *Account) (*crypto.SecureBuffer, error) {
+	secret, err := v.OpenSecret(a)
+	if err != nil {
+		return nil, err
+	}
+	defer secret.Destroy()
+
+	encoded := bytes.TrimRight(secret.Bytes(), "=")
+	key, err := crypto.NewSecureBuffer(base32.DecodedLen(len(encoded)))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := base32.DecodeTo(key.Bytes(), encoded); err != nil {
+		key.Destroy()
+		return nil, fmt.Errorf("failed to decode secret: %w", err)
+	}
+	return key, nil
+}
+
+// Generator is a code generator for one account. It holds the account's
+// decoded key and PIN in locked memory until Destroy is called, and must
+// not be used afterwards.
+type Generator struct {
+	*totp.Generator
+	key *crypto.SecureBuffer
+	pin *crypto.SecureBuffer
+}
+
+// Destroy wipes the generator's key and PIN and the HMAC state derived
+// from the key.
+func (g *Generator) Destroy() {
+	g.Generator.Destroy()
+	g.key.Destroy()
+	g.pin.Destroy()
+}
+
+// Generator decrypts the account's secret and returns a reusable code
+// generator for it.
+func (v *Vault) Generator(a *Account) (*Generator, error) {
+	if err := a.Validate(); err != nil {
+		return nil, err
+	}
+	encoder, pin, err := v.CodeEncoder(a)
+	if err != nil {
+		return nil, err
+	}
+	key, err := v.DecodeSecret(a)
+	if err != nil {
+		pin.Destroy()
+		return nil, err
+	}
+	gen, err := totp.NewGenerator(a.TOTPParams(key.Bytes(), time.Time{}, encoder))
+	if err != nil {
+		key.Destroy()
+		pin.Destroy()
+		return nil, err
+	}
+	return &Generator{Generator: gen, key: key, pin: pin}, nil
+}
+
+// GenerateAll generates the code at t for every account in parallel,
+// opening each secret only for the batch and destroying the generators
+// before it returns. Results are in the order of accounts. HOTP and OCRA
+// accounts, whose codes do not depend on the time alone, get an error.
+func (v *Vault) GenerateAll(accounts []Account, t time.Time) []totp.Code {
+	results := make([]totp.Code, len(accounts))
+	var gens []*Generator
+	var generators []*totp.Generator
+	var indexes []int
+	defer func() {
+		for _, gen := range gens {
+			gen.Destroy()
+		}
+	}()
+
+	for i := range accounts {
+		a := &accounts[i]
+		if a.IsHOTP() || a.IsOCRA() {
+			results[i].Err = fmt.Errorf("account %q is not time-based", a.Name)
+			continue
+		}
+		gen, err := v.Generator(a)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		gens = append(gens, gen)
+		generators = append(generators, gen.Generator)
+		indexes = append(indexes, i)
+	}
+
+	for n, res := range totp.GenerateAll(generators, t) {
+		results[indexes[n]] = res
+	}
+	return results
+}
+
+// CodeEncoder returns the encoder used to render the account's codes,
+// keyed with its PIN opened into locked memory. The encoder must not be
+// used after the caller Destroys the PIN, which may be nil.
+func (v *Vault) CodeEncoder(a *Account) (totp.Encoder, *crypto.SecureBuffer, error) {
+	pin, err := v.OpenPIN(a)
+	if err != nil {
+		return nil, nil, err
+	}
+	encoder, err := totp.NewEncoder(a.Encoder, pin.Bytes())
+	if err != nil {
+		pin.Destroy()
+		return nil, nil, err
+	}
+	return encoder, pin, nil
+}
+
+// Reveal returns a copy of the account with its secret and PIN decrypted, for
+// exports and QR codes that hand the secret to another authenticator.
+func (v *Vault) Reveal(a *Account) (Account, error) {
+	secret, err := v.OpenSecret(a)
+	if err != nil {
+		return Account{}, err
+	}
+	defer secret.Destroy()
+
+	pin, err := v.OpenPIN(a)
+	if err != nil {
+		return Account{}, err
+	}
+	defer pin.Destroy()
+
+	revealed := *a
+	revealed.Secret = append(Secret(nil), secret.Bytes()...)
+	revealed.SealedSecret = nil
+	if pin != nil {
+		revealed.PIN = append(Secret(nil), pin.Bytes()...)
+	}
+	revealed.SealedPIN = nil
+	return revealed, nil
+}
+
+// RevealAccounts returns copies of all accounts with their secrets
+// decrypted.
+func (v *Vault) RevealAccounts() ([]Account, error) {
+	accounts := make([]Account, len(v.Accounts))
+	for i := range v.Accounts {
+		acc, err := v.Reveal(&v.Accounts[i])
+		if err != nil {
+			return nil, err
+		}
+		accounts[i] = acc
+	}
+	return accounts, nil
+}
+
+// setKey derives the subkey that opens the account secrets from the master
+// key the vault was unlocked with, and keeps it in locked memory. The
+// secrets are taken to be sealed with the vault's Cipher.
+func (v *Vault) setKey(key []byte) error {
+	secretKey, err := crypto.DeriveSubkey(key, secretKeyPurpose)
+	if err != nil {
+		return err
+	}
+	buf, err := crypto.NewSecureBufferFrom(secretKey)
+	if err != nil {
+		return err
+	}
+	v.secretKey.Destroy()
+	v.secretKey = buf
+	v.secretCipher = v.cipher()
+	return nil
+}
+
+// Destroy wipes the keys the vault holds: the key that opens its account
+// secrets and the master key it was unlocked with by LoadVaultInteractive.
+// Sealed secrets can no longer be opened afterwards.
+func (v *Vault) Destroy() {
+	v.secretKey.Destroy()
+	v.masterKey.Destroy()
+	v.secretKey, v.masterKey = nil, nil
+}
+
+// sealSecrets encrypts every plaintext account secret and PIN under the
+// subkey of key and zeroes the plaintext. When key is not the key the vault
+// was unlocked with, as after a key rotation, or the vault's Cipher has
+// changed, sealed secrets and PINs are resealed.
+func (v *Vault) sealSecrets(key []byte) error {
+	secretKey, err := crypto.DeriveSubkey(key, secretKeyPurpose)
+	if err != nil {
+		return err
+	}
+	defer crypto.ZeroBytes(secretKey)
+	rekey := v.secretKey == nil || !crypto.SecureCompare(v.secretKey.Bytes(), secretKey) || v.secretCipher != v.cipher()
+
+	// Seal everything before changing any account, so that a failure
+	// leaves the vault as it was.
+	seal := func(plaintext Secret, sealed, ad []byte) ([]byte, error) {
+		if len(plaintext) == 0 && (len(sealed) == 0 || !rekey) {
+			return sealed, nil
+		}
+		buf, err := v.open(plaintext, sealed, ad)
+		if err != nil {
+			return nil, err
+		}
+		defer buf.Destroy()
+		return v.cipher().Encrypt(buf.Bytes(), secretKey, ad)
+	}
+	sealedSecrets := make([][]byte, len(v.Accounts))
+	sealedPINs := make([][]byte, len(v.Accounts))
+	for i := range v.Accounts {
+		a := &v.Accounts[i]
+		if sealedSecrets[i], err = seal(a.Secret, a.SealedSecret, a.secretAD()); err != nil {
+			return err
+		}
+		if sealedPINs[i], err = seal(a.PIN, a.SealedPIN, a.pinAD()); err != nil {
+			return err
+		}
+	}
+
+	for i := range v.Accounts {
+		a := &v.Accounts[i]
+		a.SealedSecret, a.SealedPIN = sealedSecrets[i], sealedPINs[i]
+		crypto.ZeroBytes(a.Secret)
+		crypto.ZeroBytes(a.PIN)
+		a.Secret, a.PIN = nil, nil
+	}
+	return v.setKey(key)
+}
+
+// secretAD binds a sealed secret to its account, so that secrets cannot be
+// swapped between accounts.
+func (a *Account) secretAD() []byte {
+	return []byte("gotp account secret " + a.ID)
+}
+
+// pinAD binds a sealed PIN to its account, and keeps it apart from the
+// account's secret.
+func (a *Account) pinAD() []byte {
+	return []byte("gotp account pin " + a.ID)
+}
@@ -1,155 +1,64 @@
 package vault
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
-	"crypto/sha256"
-	"encoding/json"
-	"fmt"
-	"io"
-	"os"
 	"path/filepath"
 	"time"
-)
-
-// Session represents a temporary authenticated session.
-type Session struct {
-	Key       []byte    `json:"key"`
-	ExpiresAt time.Time `json:"expires_at"`
-}
-
-// getMachineKey generates a machine-specific key for session encryption.
-func getMachineKey() ([]byte, error) {
-	hostname, err := os.Hostname()
-	if err != nil {
-		hostname = "unknown-host"
-	}
-	uid := os.Getuid()
-	
-	// Create a unique seed for this machine/user
-	seed := fmt.Sprintf("%s-%d-gotp-session-secret", hostname, uid)
-	hash := sha256.Sum256([]byte(seed))
-	return hash[:], nil
-}
-
-// GetSessionPath returns the path to the temporary session file in the user's config directory.
-func GetSessionPath() (string, error) {
-	configDir, err := os.UserConfigDir()
-	if err != nil {
-		return "", err
-	}
-	sessionDir := filepath.Join(configDir, "gotp")
-	if err := os.MkdirAll(sessionDir, 0700); err != nil {
-		return "", err
-	}
-	return filepath.Join(sessionDir, "session.bin"), nil
-}
-
-// SaveSession encrypts and saves the derived key to a private config file.
-func SaveSession(key []byte, duration time.Duration) error {
-	session := Session{
-		Key:       key,
-		ExpiresAt: time.Now().Add(duration),
-	}
-
-	plaintext, err := json.Marshal(session)
-	if err != nil {
-		return err
-	}
-
-	machineKey, err := getMachineKey()
-	if err != nil {
-		return err
-	}
 
-	block, err := aes.NewCipher(machineKey)
-	if err != nil {
-		return err
-	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return err
-	}
+	"github.com/zulfikawr/gotp/internal/crypto"
+)
 
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return err
-	}
+// Sessions keep the master key of an unlocked vault in gotp agent, so that
+// commands run shortly after each other do not prompt for the password.
+// Each vault has its own session, keyed by its canonical path. Without a
+// running agent there is no session and every command prompts.
 
-	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
+// DefaultSessionTimeout is how long LoadVaultInteractive keeps a vault
+// unlocked unless SetSessionTimeout says otherwise.
+const DefaultSessionTimeout = 5 * time.Minute
 
-	path, err := GetSessionPath()
-	if err != nil {
-		return err
-	}
+var sessionTimeout = DefaultSessionTimeout
 
-	return os.WriteFile(path, ciphertext, 0600)
+// SetSessionTimeout sets how long LoadVaultInteractive keeps a vault
+// unlocked (general.session_timeout in the config). Zero disables
+// sessions.
+func SetSessionTimeout(timeout time.Duration) {
+	sessionTimeout = timeout
 }
 
-// GetSession retrieves and decrypts the cached key if it hasn't expired.
-func GetSession() ([]byte, error) {
-	path, err := GetSessionPath()
-	if err != nil {
-		return nil, err
-	}
-
-	ciphertext, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil
-		}
-		return nil, err
-	}
-
-	machineKey, err := getMachineKey()
-	if err != nil {
-		return nil, err
-	}
-
-	block, err := aes.NewCipher(machineKey)
-	if err != nil {
-		return nil, err
-	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, err
-	}
-
-	nonceSize := gcm.NonceSize()
-	if len(ciphertext) < nonceSize {
-		return nil, fmt.Errorf("ciphertext too short")
-	}
+// SessionTimeout returns how long LoadVaultInteractive keeps a vault
+// unlocked.
+func SessionTimeout() time.Duration {
+	return sessionTimeout
+}
 
-	nonce, encryptedData := ciphertext[:nonceSize], ciphertext[nonceSize:]
-	plaintext, err := gcm.Open(nil, nonce, encryptedData, nil)
+// CanonicalPath returns the absolute path of a vault with symbolic links
+// resolved, which identifies its session.
+func CanonicalPath(path string) string {
+	abs, err := filepath.Abs(path)
 	if err != nil {
-		// If decryption fails, the machine key might have changed (e.g. hostname change)
-		// Better to clear the session than to crash.
-		_ = os.Remove(path)
-		return nil, nil
+		return path
 	}
-
-	var session Session
-	if err := json.Unmarshal(plaintext, &session); err != nil {
-		return nil, err
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved
 	}
+	return abs
+}
 
-	if time.Now().After(session.ExpiresAt) {
-		_ = os.Remove(path)
-		return nil, nil
-	}
+// SaveSession hands the master key of the vault at path to the agent for
+// duration.
+func SaveSession(path string, key []byte, duration time.Duration) error {
+	return AgentStore.Put(CanonicalPath(path), key, duration)
+}
 
-	return session.Key, nil
+// GetSession returns the key the agent holds for the vault at path, or nil
+// if there is none. The key is returned in locked memory; the caller must
+// Destroy it.
+func GetSession(path string) (*crypto.SecureBuffer, error) {
+	return AgentStore.Get(CanonicalPath(path))
 }
 
-// ClearSession removes the temporary session file.
-func ClearSession() error {
-	path, err := GetSessionPath()
-	if err != nil {
-		return err
-	}
-	return os.Remove(path)
+// ClearSession makes the agent forget the key of the vault at path. It is
+// not an error if no agent is running.
+func ClearSession(path string) error {
+	return AgentStore.Delete(CanonicalPath(path))
 }
@@ -0,0 +1,719 @@
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zulfikawr/gotp/internal/crypto"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// SlotType identifies the kind of secret that unlocks a key slot.
+type SlotType string
+
+const (
+	// SlotPassword is unlocked with a password.
+	SlotPassword SlotType = "password"
+	// SlotRecovery is unlocked with a printable recovery key generated by gotp.
+	SlotRecovery SlotType = "recovery"
+	// SlotKeyfile is unlocked with the contents of a file.
+	SlotKeyfile SlotType = "keyfile"
+	// SlotRecipient is unlocked with the X25519 identity of a team member.
+	SlotRecipient SlotType = "recipient"
+	// SlotSSHAgent is unlocked with an Ed25519 signature from ssh-agent.
+	SlotSSHAgent SlotType = "ssh-agent"
+)
+
+// MasterKeyLength is the length in bytes of the random key that encrypts
+// the vault contents.
+const MasterKeyLength = 32
+
+// slotKeyPurpose names the subkey that wraps the master key in a slot.
+const slotKeyPurpose = "gotp key slot"
+
+// recipientSlotPurpose names the key derived from the X25519 shared secret
+// of a recipient slot.
+const recipientSlotPurpose = "gotp recipient slot"
+
+// sshChallengeContext prefixes the challenge signed for an ssh-agent slot.
+const sshChallengeContext = "gotp ssh-agent slot"
+
+// ErrNoMatchingSlot is returned when a secret does not unlock any key slot.
+var ErrNoMatchingSlot = errors.New("no key slot matches the given secret")
+
+// ErrKeyfileRequired is returned when a vault can only be unlocked with a
+// password combined with a keyfile and no keyfile was given.
+var ErrKeyfileRequired = errors.New("this vault requires a keyfile to unlock")
+
+// KeySlot stores the vault's master key wrapped under a key derived from one
+// unlock secret. A vault can have several slots, so that, for example, a
+// recovery key still opens it when the password is lost. Similar to the
+// slots in an Aegis backup header.
+type KeySlot struct {
+	ID        string           `json:"id"`
+	Type      SlotType         `json:"type"`
+	Label     string           `json:"label,omitempty"`
+	Salt      []byte           `json:"salt"`
+	KDFParams crypto.KDFParams `json:"kdf_params"`
+	Key       []byte           `json:"key"` // Master key encrypted under the slot key
+	CreatedAt time.Time        `json:"created_at"`
+
+	// RequiresKeyfile marks a password slot whose key is derived from the
+	// password combined with the hash of a keyfile (two-factor unlock).
+	RequiresKeyfile bool `json:"requires_keyfile,omitempty"`
+
+	// Recipient is the "age1..." X25519 public key of a recipient slot, and
+	// EphemeralKey the ephemeral public key the master key was wrapped with.
+	Recipient    string `json:"recipient,omitempty"`
+	EphemeralKey []byte `json:"ephemeral_key,omitempty"`
+
+	// SSHKey is the Ed25519 public key of an ssh-agent slot, in
+	// authorized_keys format.
+	SSHKey string `json:"ssh_key,omitempty"`
+}
+
+// NewMasterKey generates a random master key for a new vault.
+func NewMasterKey() ([]byte, error) {
+	key := make([]byte, MasterKeyLength)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// NewPasswordSlot wraps masterKey under a password.
+func NewPasswordSlot(masterKey, password []byte, params crypto.KDFParams) (*KeySlot, error) {
+	return newSlot(SlotPassword, masterKey, password, nil, params)
+}
+
+// NewTwoFactorSlot wraps masterKey under a password combined with a keyfile.
+// Both are needed to unlock the slot.
+func NewTwoFactorSlot(masterKey, password, keyfile []byte, params crypto.KDFParams) (*KeySlot, error) {
+	if len(keyfile) == 0 {
+		return nil, ErrKeyfileRequired
+	}
+	return newSlot(SlotPassword, masterKey, password, keyfile, params)
+}
+
+// NewKeyfileSlot wraps masterKey under the contents of a keyfile.
+func NewKeyfileSlot(masterKey, keyfile []byte, params crypto.KDFParams) (*KeySlot, error) {
+	return newSlot(SlotKeyfile, masterKey, keyfileSecret(keyfile), nil, params)
+}
+
+// NewRecoverySlot wraps masterKey under a freshly generated recovery key,
+// which is returned in printable form. It is shown to the user once and
+// cannot be recovered from the slot.
+func NewRecoverySlot(masterKey []byte, params crypto.KDFParams) (*KeySlot, string, error) {
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", err
+	}
+	slot, err := newSlot(SlotRecovery, masterKey, raw, nil, params)
+	if err != nil {
+		return nil, "", err
+	}
+	return slot, formatRecoveryKey(raw), nil
+}
+
+// NewRecipientSlot wraps masterKey for the holder of the X25519 identity
+// matching recipient, in the spirit of an age recipient stanza.
+func NewRecipientSlot(masterKey []byte, recipient *ecdh.PublicKey) (*KeySlot, error) {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	slot := &KeySlot{
+		ID:        hex.EncodeToString(id),
+		Type:      SlotRecipient,
+		Recipient: crypto.FormatRecipient(recipient),
+		CreatedAt: time.Now(),
+	}
+	if err := slot.SetRecipientKey(masterKey); err != nil {
+		return nil, err
+	}
+	return slot, nil
+}
+
+// SetRecipientKey rewraps a recipient slot under a new master key with a
+// fresh ephemeral key. Unlike other slots, this needs no secret, so
+// recipient slots survive a rotation of the master key.
+func (s *KeySlot) SetRecipientKey(masterKey []byte) error {
+	if s.Type != SlotRecipient {
+		return fmt.Errorf("key slot %s is a %s slot, not a recipient slot", s.ID, s.Type)
+	}
+	recipient, err := crypto.ParseRecipient(s.Recipient)
+	if err != nil {
+		return err
+	}
+	ephemeral, err := crypto.GenerateX25519Identity()
+	if err != nil {
+		return err
+	}
+	s.EphemeralKey = ephemeral.PublicKey().Bytes()
+
+	derived, err := crypto.X25519SharedKey(ephemeral, recipient, s.recipientSalt(), recipientSlotPurpose)
+	if err != nil {
+		return err
+	}
+	defer crypto.ZeroBytes(derived)
+	return s.wrap(masterKey, derived)
+}
+
+// UnwrapWithIdentity returns the master key if the slot is a recipient slot
+// for identity.
+func (s *KeySlot) UnwrapWithIdentity(identity *ecdh.PrivateKey) ([]byte, error) {
+	if s.Type != SlotRecipient || s.Recipient != crypto.FormatRecipient(identity.PublicKey()) {
+		return nil, ErrNoMatchingSlot
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(s.EphemeralKey)
+	if err != nil {
+		return nil, fmt.Errorf("key slot %s: %w", s.ID, err)
+	}
+
+	derived, err := crypto.X25519SharedKey(identity, ephemeral, s.recipientSalt(), recipientSlotPurpose)
+	if err != nil {
+		return nil, ErrNoMatchingSlot
+	}
+	defer crypto.ZeroBytes(derived)
+	return s.unwrapDerived(derived)
+}
+
+// recipientSalt binds the derived key to both public keys, as age does.
+func (s *KeySlot) recipientSalt() []byte {
+	return append(append([]byte{}, s.EphemeralKey...), []byte(s.Recipient)...)
+}
+
+// NewSSHAgentSlot wraps masterKey under a key derived from the signature
+// the agent makes with an Ed25519 key over a challenge unique to the slot.
+// The slot then unlocks whenever an agent holding that key is running.
+func NewSSHAgentSlot(masterKey []byte, a agent.Agent, key ssh.PublicKey) (*KeySlot, error) {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	slot := &KeySlot{
+		ID:        hex.EncodeToString(id),
+		Type:      SlotSSHAgent,
+		Salt:      salt,
+		SSHKey:    strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))),
+		CreatedAt: time.Now(),
+	}
+	derived, err := crypto.DeriveKeyFromSSHAgent(a, key, slot.sshChallenge())
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.ZeroBytes(derived)
+	if err := slot.wrap(masterKey, derived); err != nil {
+		return nil, err
+	}
+	return slot, nil
+}
+
+// UnwrapWithSSHAgent returns the master key if the slot is an ssh-agent
+// slot and the agent signs its challenge with the slot's key.
+func (s *KeySlot) UnwrapWithSSHAgent(a agent.Agent) ([]byte, error) {
+	if s.Type != SlotSSHAgent {
+		return nil, ErrNoMatchingSlot
+	}
+	key, err := s.SSHPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	derived, err := crypto.DeriveKeyFromSSHAgent(a, key, s.sshChallenge())
+	if err != nil {
+		return nil, ErrNoMatchingSlot
+	}
+	defer crypto.ZeroBytes(derived)
+	return s.unwrapDerived(derived)
+}
+
+// SSHPublicKey parses the public key of an ssh-agent slot.
+func (s *KeySlot) SSHPublicKey() (ssh.PublicKey, error) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(s.SSHKey))
+	if err != nil {
+		return nil, fmt.Errorf("key slot %s: invalid SSH key: %w", s.ID, err)
+	}
+	return key, nil
+}
+
+// sshChallenge is the data signed for an ssh-agent slot. The random salt
+// makes it unique to the slot, so a signature cannot be reused for another
+// vault or slot.
+func (s *KeySlot) sshChallenge() []byte {
+	b := appendField(nil, []byte(sshChallengeContext))
+	b = appendField(b, []byte(s.ID))
+	return appendField(b, s.Salt)
+}
+
+// ReadIdentityFile reads an X25519 identity from a file in the format
+// written by 'gotp team keygen' and age-keygen: "#" comment lines and one
+// "AGE-SECRET-KEY-1..." line.
+func ReadIdentityFile(path string) (*ecdh.PrivateKey, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read identity file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return crypto.ParseIdentity(line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read identity file: %w", err)
+	}
+	return nil, fmt.Errorf("no identity found in %s", path)
+}
+
+// GenerateKeyfile returns random contents for a new keyfile.
+func GenerateKeyfile() ([]byte, error) {
+	data := make([]byte, 64)
+	if _, err := rand.Read(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// ReadKeyfile reads a keyfile from disk.
+func ReadKeyfile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read keyfile: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("keyfile %s is empty", path)
+	}
+	return data, nil
+}
+
+func newSlot(typ SlotType, masterKey, secret, keyfile []byte, params crypto.KDFParams) (*KeySlot, error) {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	slot := &KeySlot{
+		ID:        hex.EncodeToString(id),
+		Type:      typ,
+		CreatedAt: time.Now(),
+
+		RequiresKeyfile: keyfile != nil,
+	}
+	if err := slot.seal(masterKey, secret, keyfile, params); err != nil {
+		return nil, err
+	}
+	return slot, nil
+}
+
+// SetPassword rewraps a password slot under a new password with a fresh
+// salt, keeping its ID and label. A slot that requires a keyfile stays bound
+// to keyfile, which must be given.
+func (s *KeySlot) SetPassword(masterKey, password, keyfile []byte, params crypto.KDFParams) error {
+	if s.Type != SlotPassword {
+		return fmt.Errorf("key slot %s is a %s slot, not a password slot", s.ID, s.Type)
+	}
+	if !s.RequiresKeyfile {
+		keyfile = nil
+	}
+	return s.seal(masterKey, password, keyfile, params)
+}
+
+// Rekey rewraps every password slot that password opens, with keyfile where
+// a slot requires one, under a fresh salt and params, and makes params the
+// vault's KDFParams for new slots. It returns the number of slots rewrapped,
+// or ErrNoMatchingSlot if password opens none. Other slots keep their salt
+// and parameters.
+func (v *Vault) Rekey(masterKey, password, keyfile []byte, params crypto.KDFParams) (int, error) {
+	if err := params.Validate(); err != nil {
+		return 0, err
+	}
+
+	var opened []int
+	needKeyfile := false
+	for i := range v.Slots {
+		if v.Slots[i].Type != SlotPassword {
+			continue
+		}
+		key, err := v.Slots[i].UnwrapWithKeyfile(password, keyfile)
+		if err != nil {
+			if errors.Is(err, ErrKeyfileRequired) {
+				needKeyfile = true
+			}
+			continue
+		}
+		same := crypto.SecureCompare(key, masterKey)
+		crypto.ZeroBytes(key)
+		if same {
+			opened = append(opened, i)
+		}
+	}
+	if len(opened) == 0 {
+		if needKeyfile {
+			return 0, ErrKeyfileRequired
+		}
+		return 0, ErrNoMatchingSlot
+	}
+
+	for _, i := range opened {
+		if err := v.Slots[i].SetPassword(masterKey, password, keyfile, params); err != nil {
+			return 0, err
+		}
+	}
+	v.KDFParams = params
+	return len(opened), nil
+}
+
+// seal wraps masterKey under secret, combined with keyfile if the slot
+// requires one, with a new salt and the given KDF parameters.
+func (s *KeySlot) seal(masterKey, secret, keyfile []byte, params crypto.KDFParams) error {
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	salt, err := crypto.GenerateSalt(params.SaltLength)
+	if err != nil {
+		return err
+	}
+	s.Salt = salt
+	s.KDFParams = params
+
+	derived, err := s.derive(secret, keyfile)
+	if err != nil {
+		return err
+	}
+	defer crypto.ZeroBytes(derived)
+	return s.wrap(masterKey, derived)
+}
+
+// legacySlot converts the single password-derived key of a vault from before
+// format version 4 into a password slot. The derived key becomes the master
+// key, so the slot unlocks with the same password, salt and KDF parameters,
+// and existing sessions remain valid.
+func legacySlot(m *VaultMetadata, key []byte) (*KeySlot, error) {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	slot := &KeySlot{
+		ID:        hex.EncodeToString(id),
+		Type:      SlotPassword,
+		Salt:      m.Salt,
+		KDFParams: m.KDFParams,
+		CreatedAt: time.Now(),
+	}
+	if err := slot.wrap(key, key); err != nil {
+		return nil, err
+	}
+	return slot, nil
+}
+
+// wrap encrypts masterKey under a subkey of the key derived from the slot's
+// secret. The slot's parameters are bound as associated data, so weakening
+// them on disk makes the slot fail to open.
+func (s *KeySlot) wrap(masterKey, derived []byte) error {
+	kek, err := crypto.DeriveSubkey(derived, slotKeyPurpose)
+	if err != nil {
+		return err
+	}
+	defer crypto.ZeroBytes(kek)
+
+	s.Key, err = crypto.Encrypt(masterKey, kek, s.header())
+	return err
+}
+
+// Unwrap returns the master key if secret unlocks the slot. For keyfile
+// slots, secret is the contents of the keyfile; for recovery slots, it is
+// the printable recovery key. Recipient slots are opened with
+// UnwrapWithIdentity and ssh-agent slots with UnwrapWithSSHAgent instead. Slots that require a keyfile in addition to
+// the password return ErrKeyfileRequired; use UnwrapWithKeyfile.
+func (s *KeySlot) Unwrap(secret []byte) ([]byte, error) {
+	return s.UnwrapWithKeyfile(secret, nil)
+}
+
+// UnwrapWithKeyfile is like Unwrap, but combines the password with the
+// contents of a keyfile for slots that require one. The keyfile is ignored
+// by other slots.
+func (s *KeySlot) UnwrapWithKeyfile(secret, keyfile []byte) ([]byte, error) {
+	if s.Type == SlotRecipient || s.Type == SlotSSHAgent {
+		return nil, ErrNoMatchingSlot
+	}
+	if err := s.KDFParams.Validate(); err != nil {
+		return nil, fmt.Errorf("key slot %s: %w", s.ID, err)
+	}
+
+	switch s.Type {
+	case SlotKeyfile:
+		secret = keyfileSecret(secret)
+	case SlotRecovery:
+		raw, err := parseRecoveryKey(string(secret))
+		if err != nil {
+			return nil, ErrNoMatchingSlot
+		}
+		secret = raw
+	}
+
+	derived, err := s.derive(secret, keyfile)
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.ZeroBytes(derived)
+	return s.unwrapDerived(derived)
+}
+
+// derive derives the slot key from secret, combined with the keyfile for
+// slots that require one.
+func (s *KeySlot) derive(secret, keyfile []byte) ([]byte, error) {
+	if !s.RequiresKeyfile {
+		return crypto.DeriveKey(secret, s.Salt, s.KDFParams)
+	}
+	if len(keyfile) == 0 {
+		return nil, ErrKeyfileRequired
+	}
+	return crypto.DeriveKeyWithKeyfile(secret, keyfile, s.Salt, s.KDFParams)
+}
+
+func (s *KeySlot) unwrapDerived(derived []byte) ([]byte, error) {
+	kek, err := crypto.DeriveSubkey(derived, slotKeyPurpose)
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.ZeroBytes(kek)
+
+	masterKey, err := crypto.Decrypt(s.Key, kek, s.header())
+	if err != nil {
+		return nil, ErrNoMatchingSlot
+	}
+	return masterKey, nil
+}
+
+// header returns the canonical encoding of the slot's unencrypted fields.
+func (s *KeySlot) header() []byte {
+	b := appendField(nil, []byte(s.ID))
+	b = appendField(b, []byte(s.Type))
+	b = appendField(b, s.Salt)
+	b = appendKDFParams(b, s.KDFParams)
+	if s.RequiresKeyfile {
+		b = appendField(b, []byte("keyfile"))
+	}
+	if s.Type == SlotRecipient {
+		b = appendField(b, []byte(s.Recipient))
+		b = appendField(b, s.EphemeralKey)
+	}
+	if s.Type == SlotSSHAgent {
+		b = appendField(b, []byte(s.SSHKey))
+	}
+	return b
+}
+
+// unlockSlots tries secret, with keyfile where a slot requires one, against
+// every slot of the given types, in order, and returns the master key from
+// the first one it opens. If none opens and a slot was skipped for lack of a
+// keyfile, it returns ErrKeyfileRequired.
+func unlockSlots(slots []KeySlot, secret, keyfile []byte, types ...SlotType) ([]byte, error) {
+	needKeyfile := false
+	for i := range slots {
+		for _, t := range types {
+			if slots[i].Type != t {
+				continue
+			}
+			key, err := slots[i].UnwrapWithKeyfile(secret, keyfile)
+			if err == nil {
+				return key, nil
+			}
+			if errors.Is(err, ErrKeyfileRequired) {
+				needKeyfile = true
+			}
+		}
+	}
+	if needKeyfile {
+		return nil, ErrKeyfileRequired
+	}
+	return nil, ErrNoMatchingSlot
+}
+
+// unlockIdentity returns the master key from the recipient slot for
+// identity.
+func unlockIdentity(slots []KeySlot, identity *ecdh.PrivateKey) ([]byte, error) {
+	for i := range slots {
+		if key, err := slots[i].UnwrapWithIdentity(identity); err == nil {
+			return key, nil
+		}
+	}
+	return nil, ErrNoMatchingSlot
+}
+
+// unlockSSHAgent returns the master key from the first ssh-agent slot whose
+// key the agent holds.
+func unlockSSHAgent(slots []KeySlot, a agent.Agent) ([]byte, error) {
+	held, err := a.List()
+	if err != nil {
+		return nil, err
+	}
+	for i := range slots {
+		if slots[i].Type != SlotSSHAgent {
+			continue
+		}
+		key, err := slots[i].SSHPublicKey()
+		if err != nil {
+			continue
+		}
+		for _, h := range held {
+			if !bytes.Equal(h.Marshal(), key.Marshal()) {
+				continue
+			}
+			if masterKey, err := slots[i].UnwrapWithSSHAgent(a); err == nil {
+				return masterKey, nil
+			}
+		}
+	}
+	return nil, ErrNoMatchingSlot
+}
+
+// unlockWithSSHAgent opens an ssh-agent slot through the user's ssh-agent.
+// It returns nil if the vault has no such slot, no agent is running or the
+// agent holds none of the slots' keys.
+func unlockWithSSHAgent(slots []KeySlot) []byte {
+	found := false
+	for i := range slots {
+		found = found || slots[i].Type == SlotSSHAgent
+	}
+	if !found {
+		return nil
+	}
+	a, conn, err := crypto.DialSSHAgent()
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	key, _ := unlockSSHAgent(slots, a)
+	return key
+}
+
+// FindRecipient returns the index of the slot for the given "age1..."
+// recipient, or -1.
+func (v *Vault) FindRecipient(recipient string) int {
+	for i := range v.Slots {
+		if v.Slots[i].Type == SlotRecipient && v.Slots[i].Recipient == recipient {
+			return i
+		}
+	}
+	return -1
+}
+
+// onlyRecipients reports whether every slot is a recipient slot.
+func onlyRecipients(slots []KeySlot) bool {
+	for i := range slots {
+		if slots[i].Type != SlotRecipient {
+			return false
+		}
+	}
+	return len(slots) > 0
+}
+
+// hasTwoFactorSlot reports whether any slot combines a password with a
+// keyfile.
+func hasTwoFactorSlot(slots []KeySlot) bool {
+	for i := range slots {
+		if slots[i].RequiresKeyfile {
+			return true
+		}
+	}
+	return false
+}
+
+// requiresKeyfile reports whether every slot that can be unlocked at the
+// password prompt also requires a keyfile.
+func requiresKeyfile(slots []KeySlot) bool {
+	found := false
+	for i := range slots {
+		switch slots[i].Type {
+		case SlotPassword, SlotRecovery:
+			if !slots[i].RequiresKeyfile {
+				return false
+			}
+			found = true
+		}
+	}
+	return found
+}
+
+// FindSlot returns the index of the slot with the given ID, or -1.
+func (v *Vault) FindSlot(id string) int {
+	for i := range v.Slots {
+		if v.Slots[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// keyfileSecret hashes a keyfile so that files of any size yield a fixed
+// length secret.
+func keyfileSecret(keyfile []byte) []byte {
+	sum := sha256.Sum256(keyfile)
+	return sum[:]
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// formatRecoveryKey renders a recovery key as dash-separated groups of four
+// Base32 characters.
+func formatRecoveryKey(raw []byte) string {
+	s := recoveryEncoding.EncodeToString(raw)
+	var groups []string
+	for len(s) > 4 {
+		groups = append(groups, s[:4])
+		s = s[4:]
+	}
+	return strings.Join(append(groups, s), "-")
+}
+
+// parseRecoveryKey accepts a recovery key with or without dashes, spaces and
+// lowercase letters.
+func parseRecoveryKey(s string) ([]byte, error) {
+	s = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(s)))
+	return recoveryEncoding.DecodeString(s)
+}
+
+func appendField(b, field []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(field)))
+	return append(b, field...)
+}
+
+// appendKDFParams encodes KDF parameters. The algorithm and scrypt
+// parameters are only encoded when an algorithm is recorded, so that the
+// headers of slots from before scrypt support are unchanged.
+func appendKDFParams(b []byte, p crypto.KDFParams) []byte {
+	if p.Algorithm != "" {
+		b = appendField(b, []byte(p.Algorithm))
+		b = binary.BigEndian.AppendUint32(b, p.N)
+		b = binary.BigEndian.AppendUint32(b, p.R)
+	}
+	b = binary.BigEndian.AppendUint32(b, p.Memory)
+	b = binary.BigEndian.AppendUint32(b, p.Iterations)
+	b = append(b, p.Parallelism)
+	b = binary.BigEndian.AppendUint32(b, p.SaltLength)
+	return binary.BigEndian.AppendUint32(b, p.KeyLength)
+}
@@ -1,42 +1,78 @@
 package vault
 
 import (
+	"crypto/ecdh"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"time"
 
 	"github.com/zulfikawr/gotp/internal/crypto"
 )
 
 // VaultMetadata stores the unencrypted part of the vault required to decrypt it.
 type VaultMetadata struct {
-	Salt       []byte              `json:"salt"`
-	KDFParams  crypto.Argon2Params `json:"kdf_params"`
-	Ciphertext []byte              `json:"ciphertext"`
+	Version    int              `json:"version,omitempty"`   // On-disk format version; see FormatVersion
+	Cipher     crypto.Cipher    `json:"cipher,omitempty"`    // From format version 6; AES-256-GCM before
+	Salt       []byte           `json:"salt,omitempty"`      // Before format version 4 only
+	KDFParams  crypto.KDFParams `json:"kdf_params,omitzero"` // Before format version 4 only
+	Slots      []KeySlot        `json:"slots,omitempty"`
+	Ciphertext []byte           `json:"ciphertext"`
+	HeaderMAC  []byte           `json:"header_mac,omitempty"` // HMAC of the header; see verifyHeader
+	Generation uint64           `json:"generation,omitempty"` // Incremented by every save; see commit
 }
 
 // SaveVault writes the vault to its encrypted file atomically using a password.
+// A vault without key slots gets a new master key and a password slot.
 func SaveVault(path string, vault *Vault, password []byte) error {
-	key := crypto.DeriveKey(password, vault.Salt, vault.KDFParams)
+	key, err := vault.passwordKey(password)
+	if err != nil {
+		return err
+	}
 	defer crypto.ZeroBytes(key)
 	return SaveVaultWithKey(path, vault, key)
 }
 
-// SaveVaultWithKey writes the vault to its encrypted file atomically using a pre-derived key.
+// SaveVaultWithKey writes the vault to its encrypted file atomically using its master key.
+// It returns ErrConflict if another process has saved the file since the
+// vault was loaded.
 func SaveVaultWithKey(path string, vault *Vault, key []byte) error {
-	ciphertext, err := vault.MarshalWithKey(key)
+	metadata, err := vault.Seal(key)
+	if err != nil {
+		return err
+	}
+	return vault.commit(path, metadata)
+}
+
+// SaveSlots writes the vault's key slots to its file without re-encrypting
+// the payload, e.g. after a password change or a new recovery key. The key
+// must be the master key of the vault on disk.
+func SaveSlots(path string, vault *Vault, key []byte) error {
+	if len(vault.Slots) == 0 {
+		return fmt.Errorf("vault has no key slots")
+	}
+
+	metadata, err := readMetadata(path)
 	if err != nil {
 		return err
 	}
+	if metadata.formatVersion() != FormatVersion {
+		return SaveVaultWithKey(path, vault, key)
+	}
+	if err := metadata.verifyHeader(key); err != nil {
+		return err
+	}
 
-	metadata := VaultMetadata{
-		Salt:       vault.Salt,
-		KDFParams:  vault.KDFParams,
-		Ciphertext: ciphertext,
+	metadata.Slots = vault.Slots
+	if err := metadata.sign(key); err != nil {
+		return err
 	}
+	return vault.commit(path, metadata)
+}
 
+// writeMetadata writes the vault file atomically.
+func writeMetadata(path string, metadata *VaultMetadata) error {
 	data, err := json.Marshal(metadata)
 	if err != nil {
 		return err
@@ -81,33 +117,138 @@ func SaveVaultWithKey(path string, vault *Vault, key []byte) error {
 }
 
 // LoadVault reads and decrypts the vault from a file using a password.
+// Vaults in an older format are upgraded on disk; see LoadVaultWithKey.
 func LoadVault(path string, password []byte) (*Vault, error) {
-	data, err := os.ReadFile(path)
+	return LoadVaultWithKeyfile(path, password, nil)
+}
+
+// LoadVaultWithKeyfile loads a vault whose password slot also requires a
+// keyfile. The keyfile is ignored by slots that do not require one.
+func LoadVaultWithKeyfile(path string, password, keyfile []byte) (*Vault, error) {
+	metadata, err := readMetadata(path)
 	if err != nil {
 		return nil, err
 	}
+	if err := metadata.checkFormat(); err != nil {
+		return nil, err
+	}
 
-	var metadata VaultMetadata
-	if err := json.Unmarshal(data, &metadata); err != nil {
+	key, err := metadata.unlock(password, keyfile)
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.ZeroBytes(key)
+	return loadWithKey(path, metadata, key, false)
+}
+
+// LoadVaultWithIdentity loads a vault through the recipient slot of an
+// X25519 identity.
+func LoadVaultWithIdentity(path string, identity *ecdh.PrivateKey) (*Vault, error) {
+	metadata, err := readMetadata(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := metadata.checkFormat(); err != nil {
 		return nil, err
 	}
 
-	return UnmarshalVault(metadata.Ciphertext, password, metadata.Salt, metadata.KDFParams)
+	key, err := unlockIdentity(metadata.Slots, identity)
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.ZeroBytes(key)
+	return loadWithKey(path, metadata, key, false)
 }
 
 // LoadVaultWithKey reads and decrypts the vault using a pre-derived key.
+// A vault in an older format is migrated to FormatVersion and saved back,
+// after the original file has been copied to <path>.v<version>.bak.
 func LoadVaultWithKey(path string, key []byte) (*Vault, error) {
-	data, err := os.ReadFile(path)
+	metadata, err := readMetadata(path)
 	if err != nil {
 		return nil, err
 	}
+	return loadWithKey(path, metadata, key, false)
+}
 
-	var metadata VaultMetadata
-	if err := json.Unmarshal(data, &metadata); err != nil {
+// loadWithKey opens the vault read from path and upgrades an older format
+// on disk. locked tells that the caller holds the vault lock.
+func loadWithKey(path string, metadata *VaultMetadata, key []byte, locked bool) (*Vault, error) {
+	v, err := metadata.open(key)
+	if err != nil {
 		return nil, err
 	}
+	v.generation = metadata.Generation
+	v.loaded = true
+	v.locked = locked
+
+	if from := metadata.formatVersion(); from < FormatVersion {
+		if from < keySlotVersion {
+			slot, err := legacySlot(metadata, key)
+			if err != nil {
+				return nil, err
+			}
+			v.Slots = []KeySlot{*slot}
+		}
+
+		backupPath := fmt.Sprintf("%s.v%d.bak", path, from)
+		if err := copyFile(path, backupPath); err != nil {
+			return nil, fmt.Errorf("failed to back up vault before upgrading from format version %d: %w", from, err)
+		}
+		if err := SaveVaultWithKey(path, v, key); err != nil {
+			return nil, fmt.Errorf("failed to save upgraded vault: %w", err)
+		}
+	}
 
-	plaintext, err := crypto.Decrypt(metadata.Ciphertext, key)
+	return v, nil
+}
+
+// Decrypt decrypts the vault described by the metadata with a password,
+// migrating it in memory if it is in an older format. It is used for
+// encrypted exports, which are not written back.
+func (m *VaultMetadata) Decrypt(password []byte) (*Vault, error) {
+	if err := m.checkFormat(); err != nil {
+		return nil, err
+	}
+	key, err := m.unlock(password, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.ZeroBytes(key)
+	return m.open(key)
+}
+
+// unlock returns the key that decrypts the payload: the master key from a
+// password or recovery slot, or for formats before key slots, the key
+// derived from the password. The keyfile is combined with the password for
+// slots that require one and may be nil.
+func (m *VaultMetadata) unlock(password, keyfile []byte) ([]byte, error) {
+	if m.formatVersion() < keySlotVersion {
+		if err := m.KDFParams.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid vault KDF parameters: %w", err)
+		}
+		return crypto.DeriveKey(password, m.Salt, m.KDFParams)
+	}
+	return unlockSlots(m.Slots, password, keyfile, SlotPassword, SlotRecovery)
+}
+
+// open decrypts the ciphertext and upgrades the payload to FormatVersion.
+func (m *VaultMetadata) open(key []byte) (*Vault, error) {
+	if err := m.checkFormat(); err != nil {
+		return nil, err
+	}
+
+	if err := m.verifyHeader(key); err != nil {
+		return nil, err
+	}
+
+	plaintext, err := m.Cipher.Decrypt(m.Ciphertext, key, m.additionalData())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errDecrypt, err)
+	}
+	defer crypto.ZeroBytes(plaintext)
+
+	plaintext, err = migratePayload(plaintext, m.formatVersion())
 	if err != nil {
 		return nil, err
 	}
@@ -116,19 +257,85 @@ func LoadVaultWithKey(path string, key []byte) (*Vault, error) {
 	if err := json.Unmarshal(plaintext, &v); err != nil {
 		return nil, err
 	}
+	v.Slots = m.Slots
+	v.Cipher = m.Cipher
+	if err := v.setKey(key); err != nil {
+		return nil, err
+	}
 
 	return &v, nil
 }
 
-// LoadVaultInteractive attempts to load the vault using a session key, or prompts for a password if needed.
+// errDecrypt marks a failure to decrypt the payload, as opposed to a failure
+// to migrate or parse it once decrypted.
+var errDecrypt = errors.New("decryption failed")
+
+func readMetadata(path string) (*VaultMetadata, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata VaultMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, err
+	}
+	return &metadata, nil
+}
+
+// keyfilePath is the keyfile LoadVaultInteractive unlocks with, either alone
+// or combined with the password.
+var keyfilePath string
+
+// SetKeyfile sets the keyfile used by LoadVaultInteractive (the --keyfile
+// flag or security.keyfile in the config).
+func SetKeyfile(path string) {
+	keyfilePath = path
+}
+
+// KeyfilePath returns the keyfile set with SetKeyfile, if any.
+func KeyfilePath() string {
+	return keyfilePath
+}
+
+// identityPath is the X25519 identity file LoadVaultInteractive unlocks a
+// recipient slot with.
+var identityPath string
+
+// SetIdentity sets the identity file used by LoadVaultInteractive (the
+// --identity flag or security.identity in the config).
+func SetIdentity(path string) {
+	identityPath = path
+}
+
+// ErrIdentityRequired is returned when a vault can only be unlocked with a
+// team member's identity and none was given.
+var ErrIdentityRequired = errors.New("this vault is unlocked with a team identity")
+
+// LoadVaultInteractive loads the vault with the first of these that
+// unlocks it: a key from its session or another key store (see
+// SetKeyStores); the recipient slot of the identity, if one is set, or
+// else an ssh-agent slot whose key the user's ssh-agent holds; a keyfile
+// slot, if a keyfile is set; the quick-unlock PIN, which is only kept
+// while gotp agent runs and is skipped by entering an empty PIN; and
+// last the master password or a recovery key, asked for with promptFunc.
+// A keyfile that opens no slot of its own is combined with the password
+// for slots that require one. Without a keyfile, a vault that requires
+// one fails with ErrKeyfileRequired before anything is asked.
+//
+// The returned master key is held by the vault in locked memory; it must
+// not be used after the vault's Destroy.
 func LoadVaultInteractive(path string, promptFunc func(string) ([]byte, error)) (*Vault, []byte, error) {
-	key, _ := GetSession()
-	if key != nil {
-		v, err := LoadVaultWithKey(path, key)
-		if err == nil {
-			return v, key, nil
+	if v, stored, store := storedKey(path); v != nil {
+		v.masterKey = stored
+		// A key from a persistent store starts a session, so that the
+		// store is not asked again by the next command.
+		if store != AgentStore && sessionTimeout > 0 {
+			_ = SaveSession(path, stored.Bytes(), sessionTimeout)
 		}
+		return v, stored.Bytes(), nil
 	}
+	var key []byte
 
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -142,22 +349,122 @@ func LoadVaultInteractive(path string, promptFunc func(string) ([]byte, error))
 
 	// If unmarshaling failed or file is older format, Salt might be empty.
 	// We'll provide a clearer error message.
-	if len(metadata.Salt) == 0 {
+	if len(metadata.Salt) == 0 && len(metadata.Slots) == 0 {
 		return nil, nil, fmt.Errorf("vault file is corrupted or in an incompatible format (missing salt)")
 	}
+	if err := metadata.checkFormat(); err != nil {
+		return nil, nil, err
+	}
+
+	if identityPath != "" && metadata.formatVersion() >= keySlotVersion {
+		identity, err := ReadIdentityFile(identityPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, err = unlockIdentity(metadata.Slots, identity)
+		if err != nil {
+			return nil, nil, fmt.Errorf("identity %s does not unlock this vault", identityPath)
+		}
+	} else if metadata.formatVersion() >= keySlotVersion {
+		key = unlockWithSSHAgent(metadata.Slots)
+		if key == nil && onlyRecipients(metadata.Slots) {
+			return nil, nil, fmt.Errorf("%w (use --identity or set security.identity in the config)", ErrIdentityRequired)
+		}
+	}
+
+	var keyfile []byte
+	switch {
+	case key != nil:
+		// Unlocked with an identity or through ssh-agent.
+	case keyfilePath != "" && metadata.formatVersion() >= keySlotVersion:
+		keyfile, err = ReadKeyfile(keyfilePath)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil, fmt.Errorf("%w: keyfile %s not found", ErrKeyfileRequired, keyfilePath)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		defer crypto.ZeroBytes(keyfile)
+
+		key, err = unlockSlots(metadata.Slots, keyfile, nil, SlotKeyfile)
+		if err != nil && !hasTwoFactorSlot(metadata.Slots) {
+			return nil, nil, fmt.Errorf("keyfile %s does not unlock this vault", keyfilePath)
+		}
+	case requiresKeyfile(metadata.Slots):
+		return nil, nil, fmt.Errorf("%w (use --keyfile or set security.keyfile in the config)", ErrKeyfileRequired)
+	}
+
+	viaPIN := false
+	if key == nil {
+		if key, err = unlockWithPIN(path, promptFunc); err != nil {
+			return nil, nil, err
+		}
+		viaPIN = key != nil
+	}
 
-	password, err := promptFunc("Enter master password: ")
+	if key == nil {
+		password, err := promptFunc("Enter master password: ")
+		if err != nil {
+			return nil, nil, err
+		}
+
+		key, err = metadata.unlock(password, keyfile)
+		crypto.ZeroBytes(password)
+		switch {
+		case errors.Is(err, ErrKeyfileRequired):
+			return nil, nil, fmt.Errorf("%w (use --keyfile or set security.keyfile in the config)", ErrKeyfileRequired)
+		case errors.Is(err, ErrNoMatchingSlot) && keyfile != nil:
+			return nil, nil, fmt.Errorf("invalid master password or keyfile")
+		case errors.Is(err, ErrNoMatchingSlot):
+			return nil, nil, fmt.Errorf("invalid master password")
+		case err != nil:
+			return nil, nil, err
+		}
+	}
+
+	locked, err := crypto.NewSecureBufferFrom(key)
 	if err != nil {
+		crypto.ZeroBytes(key)
 		return nil, nil, err
 	}
 
-	key = crypto.DeriveKey(password, metadata.Salt, metadata.KDFParams)
-	v, err := LoadVaultWithKey(path, key)
+	v, err := loadWithKey(path, &metadata, locked.Bytes(), false)
 	if err != nil {
-		return nil, nil, fmt.Errorf("invalid master password")
+		locked.Destroy()
+		if errors.Is(err, errDecrypt) && viaPIN {
+			// The vault key has changed since the PIN was set.
+			_ = RemovePIN(path)
+			return nil, nil, fmt.Errorf("the PIN no longer unlocks this vault and was removed; use the master password")
+		}
+		if errors.Is(err, errDecrypt) {
+			return nil, nil, fmt.Errorf("invalid master password")
+		}
+		return nil, nil, fmt.Errorf("failed to open vault: %w", err)
 	}
+	v.masterKey = locked
 
-	_ = SaveSession(key, 5*time.Minute)
+	if sessionTimeout > 0 {
+		_ = SaveSession(path, locked.Bytes(), sessionTimeout)
+	}
 
-	return v, key, nil
+	return v, locked.Bytes(), nil
+}
+
+// unlockWithPIN prompts for the vault's quick-unlock PIN, if it has one,
+// and returns the master key it unwraps. It returns a nil key if there is
+// no PIN or the PIN is left empty.
+func unlockWithPIN(path string, promptFunc func(string) ([]byte, error)) ([]byte, error) {
+	// An agent that cannot be reached falls back to the password.
+	if state, _ := GetPIN(path); state == nil {
+		return nil, nil
+	}
+	pin, err := promptFunc("Enter PIN (empty for the master password): ")
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.ZeroBytes(pin)
+	if len(pin) == 0 {
+		return nil, nil
+	}
+	return UnlockPIN(path, pin)
 }
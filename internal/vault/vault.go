@@ -2,57 +2,190 @@ package vault
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/zulfikawr/gotp/internal/crypto"
 )
 
 // Vault represents the top-level structure of the encrypted vault.
+//
+// KDFParams are the KDF parameters used for new password slots. Cipher
+// encrypts the payload and account secrets, and is stored in the metadata
+// rather than the payload. Salt is the key derivation salt of vaults from
+// before key slots; each slot now has its own. Slots are stored in the
+// unencrypted metadata, not in the encrypted payload.
+//
+// Account secrets are sealed separately under a subkey of the master key
+// and stay sealed in memory; see OpenSecret. The subkey, and the master
+// key of a vault from LoadVaultInteractive, are held in locked memory
+// until Destroy.
 type Vault struct {
-	Version    string              `json:"version"`
-	CreatedAt  time.Time           `json:"created_at"`
-	ModifiedAt time.Time           `json:"modified_at"`
-	KDFParams  crypto.Argon2Params `json:"kdf_params"`
-	Salt       []byte              `json:"salt"`
-	Accounts   []Account           `json:"accounts"`
+	CreatedAt  time.Time        `json:"created_at"`
+	ModifiedAt time.Time        `json:"modified_at"`
+	KDFParams  crypto.KDFParams `json:"kdf_params"`
+	Salt       []byte           `json:"salt"`
+	Accounts   []Account        `json:"accounts"`
+	Slots      []KeySlot        `json:"-"`
+	Cipher     crypto.Cipher    `json:"-"`
+
+	secretKey    *crypto.SecureBuffer
+	secretCipher crypto.Cipher
+	masterKey    *crypto.SecureBuffer
+
+	// generation is the Generation of the file the vault was loaded from,
+	// or last saved to; loaded is false for a vault that is not on disk.
+	// locked is true while Update holds the vault lock for the vault.
+	generation uint64
+	loaded     bool
+	locked     bool
 }
 
-// NewVault creates a new, empty vault with default parameters.
+var kdfParams = crypto.DefaultArgon2Params()
+
+// SetKDFParams sets the KDF parameters NewVault gives new vaults (the
+// security.argon2_* settings in the config).
+func SetKDFParams(params crypto.KDFParams) error {
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	kdfParams = params
+	return nil
+}
+
+// KDFParams returns the KDF parameters NewVault gives new vaults.
+func KDFParams() crypto.KDFParams {
+	return kdfParams
+}
+
+// NewVault creates a new, empty vault with the parameters from
+// SetKDFParams.
 func NewVault(salt []byte) *Vault {
 	now := time.Now()
 	return &Vault{
-		Version:    "1.0",
 		CreatedAt:  now,
 		ModifiedAt: now,
-		KDFParams:  crypto.DefaultArgon2Params(),
+		KDFParams:  kdfParams,
+		Cipher:     crypto.CipherAES256GCM,
 		Salt:       salt,
 		Accounts:   []Account{},
 	}
 }
 
-// Marshal serializes the vault into an encrypted JSON blob using a password.
+// FindAccount returns the index of the account with the given ID, or -1.
+func (v *Vault) FindAccount(id string) int {
+	for i := range v.Accounts {
+		if v.Accounts[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Marshal serializes the vault payload into an encrypted JSON blob using a
+// key derived from password and the vault's Salt and KDFParams. Vault files
+// are written with Seal instead, which uses the master key.
 func (v *Vault) Marshal(password []byte) ([]byte, error) {
-	key := crypto.DeriveKey(password, v.Salt, v.KDFParams)
+	key, err := crypto.DeriveKey(password, v.Salt, v.KDFParams)
+	if err != nil {
+		return nil, err
+	}
 	defer crypto.ZeroBytes(key)
 	return v.MarshalWithKey(key)
 }
 
-// MarshalWithKey serializes the vault using a pre-derived key.
+// MarshalWithKey serializes the vault payload and encrypts it with key and
+// the vault's Cipher.
+// The format version is bound to the ciphertext as associated data.
+// Plaintext account secrets are sealed under a subkey of key first.
 func (v *Vault) MarshalWithKey(key []byte) ([]byte, error) {
+	if err := v.sealSecrets(key); err != nil {
+		return nil, err
+	}
 	v.ModifiedAt = time.Now()
 	plaintext, err := json.Marshal(v)
 	if err != nil {
 		return nil, err
 	}
-	return crypto.Encrypt(plaintext, key)
+	defer crypto.ZeroBytes(plaintext)
+	return v.cipher().Encrypt(plaintext, key, currentMetadata(v.cipher()).additionalData())
+}
+
+// Seal encrypts the vault with its master key and returns the complete
+// metadata to store on disk, including the key slots and header MAC.
+func (v *Vault) Seal(key []byte) (*VaultMetadata, error) {
+	if len(v.Slots) == 0 {
+		return nil, fmt.Errorf("vault has no key slots")
+	}
+
+	ciphertext, err := v.MarshalWithKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := currentMetadata(v.cipher())
+	metadata.Slots = v.Slots
+	metadata.Ciphertext = ciphertext
+	if err := metadata.sign(key); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// SealWithPassword is like Seal, but takes the master key from the password
+// slot that password unlocks. A vault without slots gets a new random master
+// key and a password slot for password.
+func (v *Vault) SealWithPassword(password []byte) (*VaultMetadata, error) {
+	key, err := v.passwordKey(password)
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.ZeroBytes(key)
+	return v.Seal(key)
+}
+
+// passwordKey returns the master key unlocked by password, creating the
+// master key and its first password slot if the vault has no slots yet.
+func (v *Vault) passwordKey(password []byte) ([]byte, error) {
+	if len(v.Slots) > 0 {
+		return unlockSlots(v.Slots, password, nil, SlotPassword)
+	}
+
+	key, err := NewMasterKey()
+	if err != nil {
+		return nil, err
+	}
+	slot, err := NewPasswordSlot(key, password, v.KDFParams)
+	if err != nil {
+		return nil, err
+	}
+	v.Slots = []KeySlot{*slot}
+	return key, nil
 }
 
-// UnmarshalVault decrypts and deserializes a vault from an encrypted blob.
-func UnmarshalVault(data []byte, password []byte, salt []byte, params crypto.Argon2Params) (*Vault, error) {
-	key := crypto.DeriveKey(password, salt, params)
+// cipher returns the vault's Cipher, AES-256-GCM if none is set.
+func (v *Vault) cipher() crypto.Cipher {
+	if v.Cipher == "" {
+		return crypto.CipherAES256GCM
+	}
+	return v.Cipher
+}
+
+// currentMetadata returns an empty header in the current format.
+func currentMetadata(c crypto.Cipher) *VaultMetadata {
+	return &VaultMetadata{Version: FormatVersion, Cipher: c}
+}
+
+// UnmarshalVault decrypts and deserializes a vault payload produced by
+// Marshal in the current format with the default cipher, AES-256-GCM.
+func UnmarshalVault(data []byte, password []byte, salt []byte, params crypto.KDFParams) (*Vault, error) {
+	key, err := crypto.DeriveKey(password, salt, params)
+	if err != nil {
+		return nil, err
+	}
 	defer crypto.ZeroBytes(key)
 
-	plaintext, err := crypto.Decrypt(data, key)
+	plaintext, err := crypto.Decrypt(data, key, currentMetadata(crypto.CipherAES256GCM).additionalData())
 	if err != nil {
 		return nil, err
 	}
@@ -61,6 +194,9 @@ func UnmarshalVault(data []byte, password []byte, salt []byte, params crypto.Arg
 	if err := json.Unmarshal(plaintext, &v); err != nil {
 		return nil, err
 	}
+	if err := v.setKey(key); err != nil {
+		return nil, err
+	}
 
 	return &v, nil
 }
@@ -2,14 +2,54 @@ package vault
 
 import (
 	"bytes"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/zulfikawr/gotp/internal/agent"
+	"github.com/zulfikawr/gotp/internal/config"
 	"github.com/zulfikawr/gotp/internal/crypto"
+	"github.com/zulfikawr/gotp/internal/totp"
+	"golang.org/x/crypto/ssh"
+	sshagent "golang.org/x/crypto/ssh/agent"
 )
 
+// TestMain runs the tests against an agent of their own, so that sessions
+// neither use nor disturb the user's agent, and without the user's
+// ssh-agent.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "gotp-agent")
+	if err != nil {
+		panic(err)
+	}
+	path := filepath.Join(dir, "agent.sock")
+	os.Setenv(agent.SocketEnv, path)
+	os.Unsetenv("SSH_AUTH_SOCK")
+
+	server := agent.NewServer(0)
+	if err := server.Listen(path); err != nil {
+		panic(err)
+	}
+	go server.Serve()
+
+	code := m.Run()
+	server.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 func TestVaultOperations(t *testing.T) {
 	password := []byte("password123")
 	salt, _ := crypto.GenerateSalt(16)
@@ -89,27 +129,155 @@ func TestAccountURI(t *testing.T) {
 	}
 }
 
+func TestAccountURI_T0(t *testing.T) {
+	acc, err := FromURI("otpauth://totp/X:y?secret=JBSWY3DPEHPK3PXP&t0=1000")
+	if err != nil {
+		t.Fatalf("FromURI failed: %v", err)
+	}
+	if acc.T0 != 1000 {
+		t.Fatalf("Expected T0 1000, got %d", acc.T0)
+	}
+	if acc2, _ := FromURI(acc.ToURI()); acc2 == nil || acc2.T0 != 1000 {
+		t.Errorf("T0 roundtrip mismatch. Got: %+v", acc2)
+	}
+}
+
+func TestAccountURI_Digits(t *testing.T) {
+	acc, err := FromURI("otpauth://totp/X:y?secret=JBSWY3DPEHPK3PXP&digits=10")
+	if err != nil || acc.Digits != 10 {
+		t.Fatalf("Expected 10-digit account, got %v, %v", acc, err)
+	}
+	if _, err := FromURI("otpauth://totp/X:y?secret=JBSWY3DPEHPK3PXP&digits=11"); err == nil {
+		t.Error("Expected error for 11 digits")
+	}
+}
+
+func TestAccountURI_HOTP(t *testing.T) {
+	acc, err := FromURI("otpauth://hotp/Bank:alice?secret=JBSWY3DPEHPK3PXP&issuer=Bank&counter=42")
+	if err != nil {
+		t.Fatalf("FromURI failed: %v", err)
+	}
+	if !acc.IsHOTP() || acc.Counter != 42 {
+		t.Fatalf("Expected HOTP account with counter 42, got type %q counter %d", acc.Type, acc.Counter)
+	}
+
+	acc2, err := FromURI(acc.ToURI())
+	if err != nil {
+		t.Fatalf("FromURI roundtrip failed: %v", err)
+	}
+	if !acc2.IsHOTP() || acc2.Counter != 42 || acc2.Issuer != "Bank" {
+		t.Errorf("HOTP roundtrip mismatch. Got: %+v", acc2)
+	}
+}
+
+func TestAccountURI_Malformed(t *testing.T) {
+	for _, uri := range []string{
+		"otpauth://totp/X:y?secret=JBSWY3DPEHPK3PXP&digits=6abc",
+		"otpauth://totp/X:y?secret=JBSWY3DPEHPK3PXP&period=30s",
+		"otpauth://hotp/X:y?secret=JBSWY3DPEHPK3PXP&counter=-1",
+		"otpauth://hotp/X:y?secret=JBSWY3DPEHPK3PXP&counter=1x",
+		"otpauth://totp/X:y?secret=JBSWY3DPEHPK3PXP&t0=1e3",
+		"otpauth://foo/X:y?secret=JBSWY3DPEHPK3PXP",
+	} {
+		if _, err := FromURI(uri); err == nil {
+			t.Errorf("Expected FromURI(%q) to fail", uri)
+		}
+	}
+}
+
+func TestAccountURI_Steam(t *testing.T) {
+	acc, err := FromURI("otpauth://steam/Steam:gamer?secret=JBSWY3DPEHPK3PXP&issuer=Steam")
+	if err != nil {
+		t.Fatalf("FromURI failed: %v", err)
+	}
+	if acc.Encoder != totp.EncoderSteam || acc.Digits != 5 {
+		t.Fatalf("Expected Steam encoder with 5 digits, got %q with %d", acc.Encoder, acc.Digits)
+	}
+
+	acc2, err := FromURI(acc.ToURI())
+	if err != nil {
+		t.Fatalf("FromURI roundtrip failed: %v", err)
+	}
+	if acc2.Encoder != totp.EncoderSteam || acc2.Digits != 5 {
+		t.Errorf("Steam roundtrip mismatch. Got: %+v", acc2)
+	}
+
+	if _, err := FromURI("otpauth://totp/X:y?secret=JBSWY3DPEHPK3PXP&encoder=unknown"); err == nil {
+		t.Error("Expected error for unsupported encoder")
+	}
+}
+
+func TestAccountURI_OCRA(t *testing.T) {
+	acc, err := FromURI("otpauth://ocra/Bank:alice?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=Bank&suite=OCRA-1%3AHOTP-SHA256-8%3AC-QN08-PSHA1&counter=3")
+	if err != nil {
+		t.Fatalf("FromURI failed: %v", err)
+	}
+	if !acc.IsOCRA() || acc.Algorithm != totp.SHA256 || acc.Digits != 8 || acc.Counter != 3 {
+		t.Fatalf("Unexpected OCRA account: %+v", acc)
+	}
+
+	acc2, err := FromURI(acc.ToURI())
+	if err != nil {
+		t.Fatalf("FromURI roundtrip failed: %v", err)
+	}
+	if acc2.OCRASuite != acc.OCRASuite || acc2.Counter != 3 {
+		t.Errorf("OCRA roundtrip mismatch. Got: %+v", acc2)
+	}
+
+	if _, err := FromURI("otpauth://ocra/X:y?secret=JBSWY3DPEHPK3PXP&suite=OCRA-1"); err == nil {
+		t.Error("Expected error for invalid OCRA suite")
+	}
+}
+
 func TestSessionManagement(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.enc")
+	second := filepath.Join(dir, "second.enc")
 	key := []byte("secret-key-32-bytes-long-exactly!!")
-	err := SaveSession(key, 1*time.Second)
+	err := SaveSession(first, key, time.Minute)
 	if err != nil {
 		t.Fatalf("SaveSession failed: %v", err)
 	}
 
-	cached, err := GetSession()
+	cached, err := GetSession(first)
 	if err != nil {
 		t.Fatalf("GetSession failed: %v", err)
 	}
 
-	if !bytes.Equal(cached, key) {
+	if !bytes.Equal(cached.Bytes(), key) {
 		t.Error("Cached key mismatch")
 	}
+	cached.Destroy()
+
+	// Sessions are per vault, by canonical path.
+	if cached, _ := GetSession(second); cached != nil {
+		t.Error("Another vault should not share the session")
+	}
+	if err := os.WriteFile(first, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link.enc")
+	if err := os.Symlink(first, link); err == nil {
+		cached, _ := GetSession(link)
+		if cached == nil {
+			t.Error("A symlink to the vault should share its session")
+		}
+		cached.Destroy()
+	}
 
-	_ = ClearSession()
-	cached, _ = GetSession()
+	_ = ClearSession(first)
+	cached, _ = GetSession(first)
 	if cached != nil {
 		t.Error("Session should be cleared")
 	}
+
+	if err := SaveSession(second, key, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if cached, _ := GetSession(second); cached != nil {
+		t.Error("Session should expire")
+	}
 }
 
 func TestLoadVaultInteractive(t *testing.T) {
@@ -148,3 +316,1552 @@ func TestLoadVaultInteractive(t *testing.T) {
 		t.Fatal("Failed to load from session")
 	}
 }
+
+// copyFixture copies a vault fixture from testdata into a temporary directory
+// so that migrations can rewrite it.
+func copyFixture(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "vault.enc")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+	return path
+}
+
+func TestMigrationRegistry(t *testing.T) {
+	if len(migrations) != FormatVersion-1 {
+		t.Fatalf("expected %d migrations, got %d", FormatVersion-1, len(migrations))
+	}
+	for i, m := range migrations {
+		if m.from != i+1 {
+			t.Errorf("migration %d upgrades from version %d, expected %d", i, m.from, i+1)
+		}
+	}
+}
+
+// loadFixture opens a fixture from an older format version and checks that
+// the vault was upgraded in place after the original was backed up.
+func loadFixture(t *testing.T, name string, from int) *Vault {
+	t.Helper()
+	vaultPath := copyFixture(t, name)
+	original, _ := os.ReadFile(vaultPath)
+	password := []byte("password")
+	backupPath := fmt.Sprintf("%s.v%d.bak", vaultPath, from)
+
+	if _, err := LoadVault(vaultPath, []byte("wrong")); err == nil {
+		t.Fatal("expected an error for a wrong password")
+	}
+	if _, err := os.Stat(backupPath); !os.IsNotExist(err) {
+		t.Fatal("a failed unlock should not create a migration backup")
+	}
+
+	v, err := LoadVault(vaultPath, password)
+	if err != nil {
+		t.Fatalf("LoadVault failed: %v", err)
+	}
+
+	backup, err := os.ReadFile(backupPath)
+	if err != nil {
+		t.Fatalf("expected a backup of the v%d vault: %v", from, err)
+	}
+	if !bytes.Equal(backup, original) {
+		t.Error("backup does not match the original vault")
+	}
+
+	metadata, err := readMetadata(vaultPath)
+	if err != nil {
+		t.Fatalf("readMetadata failed: %v", err)
+	}
+	if metadata.Version != FormatVersion || len(metadata.HeaderMAC) == 0 {
+		t.Errorf("expected vault to be upgraded to version %d with a header MAC, got version %d", FormatVersion, metadata.Version)
+	}
+
+	// The upgraded file loads without another migration.
+	if err := os.Remove(backupPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadVault(vaultPath, password); err != nil {
+		t.Fatalf("LoadVault of upgraded vault failed: %v", err)
+	}
+	if _, err := os.Stat(backupPath); !os.IsNotExist(err) {
+		t.Error("an up-to-date vault should not be backed up again")
+	}
+
+	return v
+}
+
+func TestLoadVault_V1Fixture(t *testing.T) {
+	v := loadFixture(t, "vault_v1.json", 1)
+
+	if len(v.Accounts) != 2 {
+		t.Fatalf("expected 2 accounts, got %d", len(v.Accounts))
+	}
+	gh := v.Accounts[0]
+	if secret, err := v.OpenSecret(&gh); err != nil || string(secret.Bytes()) != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("secret was not preserved: %v", err)
+	}
+	if gh.Name != "GitHub" || gh.Username != "alice@example.com" {
+		t.Errorf("account fields were not preserved: %+v", gh)
+	}
+	if gh.Type != totp.TypeTOTP || gh.Encoder != totp.EncoderRFC {
+		t.Errorf("expected type totp and encoder rfc, got %q and %q", gh.Type, gh.Encoder)
+	}
+	if v.Accounts[1].Digits != 8 || v.Accounts[1].Tags == nil {
+		t.Errorf("unexpected second account: %+v", v.Accounts[1])
+	}
+}
+
+func TestLoadVault_V3Fixture(t *testing.T) {
+	v := loadFixture(t, "vault_v3.json", 3)
+
+	if len(v.Accounts) != 2 {
+		t.Fatalf("expected 2 accounts, got %d", len(v.Accounts))
+	}
+	if gh := v.Accounts[0]; gh.T0 != 60 || gh.TimeOffset != -30 {
+		t.Errorf("expected T0 60 and offset -30, got %d and %d", gh.T0, gh.TimeOffset)
+	}
+	if h := v.Accounts[1]; h.Type != totp.TypeHOTP || h.Counter != 7 || h.Digits != 10 {
+		t.Errorf("unexpected HOTP account: %+v", h)
+	}
+	if len(v.Slots) != 1 || v.Slots[0].Type != SlotPassword {
+		t.Errorf("expected a single password slot, got %+v", v.Slots)
+	}
+}
+
+func TestLoadVault_V2Fixture(t *testing.T) {
+	v := loadFixture(t, "vault_v2.json", 2)
+
+	if len(v.Accounts) != 2 {
+		t.Fatalf("expected 2 accounts, got %d", len(v.Accounts))
+	}
+	if secret, err := v.OpenSecret(&v.Accounts[0]); err != nil || string(secret.Bytes()) != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("secret was not preserved: %v", err)
+	}
+	if v.Accounts[0].Name != "GitHub" {
+		t.Errorf("account fields were not preserved: %+v", v.Accounts[0])
+	}
+	if h := v.Accounts[1]; h.Type != totp.TypeHOTP || h.Counter != 7 {
+		t.Errorf("expected HOTP account with counter 7, got %q and %d", h.Type, h.Counter)
+	}
+}
+
+// checkSlotFixture checks a fixture written by gotp since key slots: a
+// GitHub TOTP account, an HOTP account at counter 7, and a password slot
+// and a recovery slot labelled "paper" that opens a fresh copy with
+// recoveryKey.
+func checkSlotFixture(t *testing.T, v *Vault, name, recoveryKey string) {
+	t.Helper()
+	if len(v.Accounts) != 2 {
+		t.Fatalf("expected 2 accounts, got %d", len(v.Accounts))
+	}
+	gh := v.Accounts[0]
+	if secret, err := v.OpenSecret(&gh); err != nil || string(secret.Bytes()) != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("secret was not preserved: %v", err)
+	}
+	if gh.Name != "GitHub" || gh.Issuer != "GitHub" || gh.Username != "alice@example.com" || gh.Type != totp.TypeTOTP {
+		t.Errorf("account fields were not preserved: %+v", gh)
+	}
+	if h := v.Accounts[1]; h.Name != "Bank" || h.Type != totp.TypeHOTP || h.Counter != 7 || h.Digits != 8 {
+		t.Errorf("unexpected HOTP account: %+v", h)
+	}
+	if secret, err := v.OpenSecret(&v.Accounts[1]); err != nil || string(secret.Bytes()) != "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" {
+		t.Errorf("HOTP secret was not preserved: %v", err)
+	}
+
+	if len(v.Slots) != 2 || v.Slots[0].Type != SlotPassword || v.Slots[1].Type != SlotRecovery || v.Slots[1].Label != "paper" {
+		t.Fatalf("expected a password and a recovery slot, got %+v", v.Slots)
+	}
+	recovered, err := LoadVault(copyFixture(t, name), []byte(recoveryKey))
+	if err != nil {
+		t.Fatalf("LoadVault with the recovery key failed: %v", err)
+	}
+	if len(recovered.Accounts) != 2 {
+		t.Errorf("expected 2 accounts, got %d", len(recovered.Accounts))
+	}
+}
+
+func TestLoadVault_V4Fixture(t *testing.T) {
+	v := loadFixture(t, "vault_v4.json", 4)
+	checkSlotFixture(t, v, "vault_v4.json", "P6K2-OODM-NLA7-Z7P6-5XA6-MEII-VJI5-4JJS")
+}
+
+func TestLoadVault_V5Fixture(t *testing.T) {
+	original, err := readMetadata(filepath.Join("testdata", "vault_v5.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if original.Version != 5 {
+		t.Fatalf("expected a version 5 fixture, got %d", original.Version)
+	}
+
+	v := loadFixture(t, "vault_v5.json", 5)
+	checkSlotFixture(t, v, "vault_v5.json", "BIQ3-GCAA-JE6P-VAMI-BVWY-AL6G-6LSN-4AHJ")
+	for _, a := range v.Accounts {
+		if len(a.Secret) != 0 || len(a.SealedSecret) == 0 {
+			t.Errorf("expected only a sealed secret for %q", a.Name)
+		}
+	}
+}
+
+func TestLoadVault_V6Fixture(t *testing.T) {
+	v := loadFixture(t, "vault_v6.json", 6)
+	checkSlotFixture(t, v, "vault_v6.json", "IUHL-5LQN-I47J-4STY-EQU2-HFHP-66LB-2XJY")
+	if v.Cipher != crypto.CipherXChaCha20Poly1305 {
+		t.Errorf("expected the XChaCha20-Poly1305 cipher, got %q", v.Cipher)
+	}
+	for _, slot := range v.Slots {
+		if slot.KDFParams.Algorithm != crypto.KDFScrypt {
+			t.Errorf("expected a scrypt slot, got %+v", slot.KDFParams)
+		}
+	}
+}
+
+func TestLoadVault_TamperedHeader(t *testing.T) {
+	password := []byte("password")
+	salt, _ := crypto.GenerateSalt(16)
+
+	tests := []struct {
+		name   string
+		tamper func(m *VaultMetadata)
+	}{
+		{"weaker slot KDF", func(m *VaultMetadata) { m.Slots[0].KDFParams.Iterations = 1; m.Slots[0].KDFParams.Memory = 8 }},
+		{"slot salt", func(m *VaultMetadata) { m.Slots[0].Salt[0] ^= 1 }},
+		{"slot label", func(m *VaultMetadata) { m.Slots[0].Label = "changed" }},
+		{"removed slot", func(m *VaultMetadata) { m.Slots = m.Slots[:1] }},
+		{"downgraded version", func(m *VaultMetadata) { m.Version = 3 }},
+		{"changed cipher", func(m *VaultMetadata) { m.Cipher = crypto.CipherXChaCha20Poly1305 }},
+		{"missing MAC", func(m *VaultMetadata) { m.HeaderMAC = nil }},
+		{"modified MAC", func(m *VaultMetadata) { m.HeaderMAC[0] ^= 1 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewVault(salt)
+			v.KDFParams = crypto.KDFParams{Memory: 1024, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+			vaultPath := filepath.Join(t.TempDir(), "vault.enc")
+			if err := SaveVault(vaultPath, v, password); err != nil {
+				t.Fatalf("SaveVault failed: %v", err)
+			}
+			key, err := unlockSlots(v.Slots, password, nil, SlotPassword)
+			if err != nil {
+				t.Fatalf("unlockSlots failed: %v", err)
+			}
+			recovery, _, err := NewRecoverySlot(key, v.KDFParams)
+			if err != nil {
+				t.Fatalf("NewRecoverySlot failed: %v", err)
+			}
+			v.Slots = append(v.Slots, *recovery)
+			if err := SaveSlots(vaultPath, v, key); err != nil {
+				t.Fatalf("SaveSlots failed: %v", err)
+			}
+			if _, err := LoadVaultWithKey(vaultPath, key); err != nil {
+				t.Fatalf("LoadVaultWithKey failed before tampering: %v", err)
+			}
+
+			metadata, _ := readMetadata(vaultPath)
+			tt.tamper(metadata)
+			data, _ := json.Marshal(metadata)
+			if err := os.WriteFile(vaultPath, data, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := LoadVaultWithKey(vaultPath, key); err == nil {
+				t.Error("expected tampered header to be rejected with the master key")
+			}
+			if _, err := LoadVault(vaultPath, password); err == nil {
+				t.Error("expected tampered header to be rejected with the password")
+			}
+		})
+	}
+}
+
+// TestLoadVault_OutOfRangeKDF checks that KDF parameters beyond the caps of
+// crypto.KDFParams.Validate, in the header of a legacy vault or in a key
+// slot, are rejected before the KDF allocates anything for them.
+func TestLoadVault_OutOfRangeKDF(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		tamper  func(p *crypto.KDFParams)
+	}{
+		{"legacy argon2 memory", "vault_v1.json", func(p *crypto.KDFParams) { p.Memory = 1 << 30 }},
+		{"legacy key length", "vault_v1.json", func(p *crypto.KDFParams) { p.KeyLength = 1 << 30 }},
+		{"argon2 memory", "vault_v5.json", func(p *crypto.KDFParams) { p.Memory = 1 << 30 }},
+		{"argon2 iterations", "vault_v5.json", func(p *crypto.KDFParams) { p.Iterations = math.MaxUint32 }},
+		{"key length", "vault_v5.json", func(p *crypto.KDFParams) { p.KeyLength = 1 << 30 }},
+		{"salt length", "vault_v5.json", func(p *crypto.KDFParams) { p.SaltLength = 1 << 30 }},
+		{"scrypt N", "vault_v6.json", func(p *crypto.KDFParams) { p.N = 1 << 30 }},
+		{"scrypt r", "vault_v6.json", func(p *crypto.KDFParams) { p.R = 1 << 24 }},
+		{"scrypt key length", "vault_v6.json", func(p *crypto.KDFParams) { p.KeyLength = 1 << 30 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vaultPath := copyFixture(t, tt.fixture)
+			metadata, err := readMetadata(vaultPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.tamper(&metadata.KDFParams)
+			for i := range metadata.Slots {
+				tt.tamper(&metadata.Slots[i].KDFParams)
+			}
+			data, _ := json.Marshal(metadata)
+			if err := os.WriteFile(vaultPath, data, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			_, err = LoadVault(vaultPath, []byte("password"))
+			runtime.ReadMemStats(&after)
+			if err == nil {
+				t.Fatal("expected out-of-range KDF parameters to be rejected")
+			}
+			if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+				t.Errorf("expected no allocation for the KDF, got %d bytes", allocated)
+			}
+		})
+	}
+}
+
+func TestLoadVault_NewerFormat(t *testing.T) {
+	vaultPath := filepath.Join(t.TempDir(), "vault.enc")
+	password := []byte("password")
+	salt, _ := crypto.GenerateSalt(16)
+	v := NewVault(salt)
+	v.KDFParams = crypto.KDFParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	if err := SaveVault(vaultPath, v, password); err != nil {
+		t.Fatalf("SaveVault failed: %v", err)
+	}
+
+	metadata, _ := readMetadata(vaultPath)
+	metadata.Version = FormatVersion + 1
+	data, _ := json.Marshal(metadata)
+	if err := os.WriteFile(vaultPath, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadVault(vaultPath, password); !errors.Is(err, ErrNewerFormat) {
+		t.Errorf("expected ErrNewerFormat, got %v", err)
+	}
+
+	_ = ClearSession(vaultPath)
+	_, _, err := LoadVaultInteractive(vaultPath, func(string) ([]byte, error) {
+		t.Fatal("prompt should not be called for a vault in a newer format")
+		return nil, nil
+	})
+	if !errors.Is(err, ErrNewerFormat) {
+		t.Errorf("expected ErrNewerFormat, got %v", err)
+	}
+}
+
+// testKDFParams keeps key derivation fast in tests.
+var testKDFParams = crypto.KDFParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestKeySlots(t *testing.T) {
+	vaultPath := filepath.Join(t.TempDir(), "vault.enc")
+	password := []byte("password")
+	v := NewVault(nil)
+	v.KDFParams = testKDFParams
+	v.Accounts = append(v.Accounts, *NewAccount("Test", []byte("JBSWY3DPEHPK3PXP")))
+	if err := SaveVault(vaultPath, v, password); err != nil {
+		t.Fatalf("SaveVault failed: %v", err)
+	}
+	if len(v.Slots) != 1 || v.Slots[0].Type != SlotPassword {
+		t.Fatalf("expected a password slot, got %+v", v.Slots)
+	}
+
+	key, err := unlockSlots(v.Slots, password, nil, SlotPassword)
+	if err != nil {
+		t.Fatalf("unlockSlots failed: %v", err)
+	}
+
+	recovery, recoveryKey, err := NewRecoverySlot(key, testKDFParams)
+	if err != nil {
+		t.Fatalf("NewRecoverySlot failed: %v", err)
+	}
+	keyfile, _ := GenerateKeyfile()
+	keyfileSlot, err := NewKeyfileSlot(key, keyfile, testKDFParams)
+	if err != nil {
+		t.Fatalf("NewKeyfileSlot failed: %v", err)
+	}
+	v.Slots = append(v.Slots, *recovery, *keyfileSlot)
+
+	before, _ := readMetadata(vaultPath)
+	if err := SaveSlots(vaultPath, v, key); err != nil {
+		t.Fatalf("SaveSlots failed: %v", err)
+	}
+	after, _ := readMetadata(vaultPath)
+	if !bytes.Equal(before.Ciphertext, after.Ciphertext) {
+		t.Error("SaveSlots should not re-encrypt the payload")
+	}
+
+	// The recovery key opens the vault, with or without formatting.
+	for _, secret := range []string{recoveryKey, strings.ToLower(strings.ReplaceAll(recoveryKey, "-", ""))} {
+		loaded, err := LoadVault(vaultPath, []byte(secret))
+		if err != nil {
+			t.Fatalf("LoadVault with recovery key %q failed: %v", secret, err)
+		}
+		if len(loaded.Accounts) != 1 || len(loaded.Slots) != 3 {
+			t.Errorf("unexpected vault: %d accounts, %d slots", len(loaded.Accounts), len(loaded.Slots))
+		}
+	}
+
+	// The keyfile opens the vault without a password prompt.
+	keyfilePath := filepath.Join(t.TempDir(), "gotp.key")
+	if err := os.WriteFile(keyfilePath, keyfile, 0600); err != nil {
+		t.Fatal(err)
+	}
+	_ = ClearSession(vaultPath)
+	SetKeyfile(keyfilePath)
+	defer SetKeyfile("")
+	_, key2, err := LoadVaultInteractive(vaultPath, func(string) ([]byte, error) {
+		t.Fatal("prompt should not be called when a keyfile is set")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("LoadVaultInteractive with keyfile failed: %v", err)
+	}
+	if !bytes.Equal(key, key2) {
+		t.Error("keyfile slot should unwrap the same master key")
+	}
+	_ = ClearSession(vaultPath)
+
+	// Rewrapping the password slot changes the password but not the master key.
+	id := v.Slots[0].ID
+	if err := v.Slots[0].SetPassword(key, []byte("new password"), nil, testKDFParams); err != nil {
+		t.Fatalf("SetPassword failed: %v", err)
+	}
+	if v.Slots[0].ID != id {
+		t.Error("SetPassword should keep the slot ID")
+	}
+	if err := v.Slots[1].SetPassword(key, []byte("new password"), nil, testKDFParams); err == nil {
+		t.Error("SetPassword should reject a recovery slot")
+	}
+	if err := SaveSlots(vaultPath, v, key); err != nil {
+		t.Fatalf("SaveSlots failed: %v", err)
+	}
+	if _, err := LoadVault(vaultPath, password); !errors.Is(err, ErrNoMatchingSlot) {
+		t.Errorf("expected the old password to be rejected, got %v", err)
+	}
+	if _, err := LoadVault(vaultPath, []byte("new password")); err != nil {
+		t.Errorf("LoadVault with new password failed: %v", err)
+	}
+
+	// A slot's wrapped key cannot be opened with another slot's secret.
+	if _, err := v.Slots[1].Unwrap(keyfile); err == nil {
+		t.Error("recovery slot should not open with the keyfile")
+	}
+}
+
+func TestTwoFactorKeyfile(t *testing.T) {
+	dir := t.TempDir()
+	vaultPath := filepath.Join(dir, "vault.enc")
+	password := []byte("password")
+	keyfile, _ := GenerateKeyfile()
+	keyfilePath := filepath.Join(dir, "gotp.key")
+	if err := os.WriteFile(keyfilePath, keyfile, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	key, _ := NewMasterKey()
+	slot, err := NewTwoFactorSlot(key, password, keyfile, testKDFParams)
+	if err != nil {
+		t.Fatalf("NewTwoFactorSlot failed: %v", err)
+	}
+	v := NewVault(nil)
+	v.KDFParams = testKDFParams
+	v.Slots = []KeySlot{*slot}
+	v.Accounts = append(v.Accounts, *NewAccount("Test", []byte("JBSWY3DPEHPK3PXP")))
+	if err := SaveVaultWithKey(vaultPath, v, key); err != nil {
+		t.Fatalf("SaveVaultWithKey failed: %v", err)
+	}
+
+	if _, err := LoadVaultWithKeyfile(vaultPath, password, keyfile); err != nil {
+		t.Fatalf("LoadVaultWithKeyfile failed: %v", err)
+	}
+
+	// Neither factor alone opens the vault.
+	if _, err := LoadVault(vaultPath, password); !errors.Is(err, ErrKeyfileRequired) {
+		t.Errorf("expected ErrKeyfileRequired without the keyfile, got %v", err)
+	}
+	if _, err := LoadVaultWithKeyfile(vaultPath, []byte("wrong"), keyfile); !errors.Is(err, ErrNoMatchingSlot) {
+		t.Errorf("expected ErrNoMatchingSlot with a wrong password, got %v", err)
+	}
+	other, _ := GenerateKeyfile()
+	if _, err := LoadVaultWithKeyfile(vaultPath, password, other); !errors.Is(err, ErrNoMatchingSlot) {
+		t.Errorf("expected ErrNoMatchingSlot with a wrong keyfile, got %v", err)
+	}
+
+	// The flag cannot be cleared on disk to drop the keyfile requirement.
+	metadata, _ := readMetadata(vaultPath)
+	metadata.Slots[0].RequiresKeyfile = false
+	if _, err := metadata.Slots[0].Unwrap(password); !errors.Is(err, ErrNoMatchingSlot) {
+		t.Errorf("expected a slot with a cleared flag to fail, got %v", err)
+	}
+
+	// Interactively, a missing keyfile fails before the password prompt.
+	_ = ClearSession(vaultPath)
+	_, _, err = LoadVaultInteractive(vaultPath, func(string) ([]byte, error) {
+		t.Fatal("prompt should not be called without the keyfile")
+		return nil, nil
+	})
+	if !errors.Is(err, ErrKeyfileRequired) {
+		t.Errorf("expected ErrKeyfileRequired, got %v", err)
+	}
+
+	SetKeyfile(filepath.Join(dir, "missing.key"))
+	defer SetKeyfile("")
+	_, _, err = LoadVaultInteractive(vaultPath, func(string) ([]byte, error) {
+		t.Fatal("prompt should not be called when the keyfile is missing")
+		return nil, nil
+	})
+	if !errors.Is(err, ErrKeyfileRequired) {
+		t.Errorf("expected ErrKeyfileRequired for a missing keyfile, got %v", err)
+	}
+
+	SetKeyfile(keyfilePath)
+	loaded, key2, err := LoadVaultInteractive(vaultPath, func(string) ([]byte, error) {
+		return []byte("password"), nil
+	})
+	if err != nil {
+		t.Fatalf("LoadVaultInteractive with keyfile failed: %v", err)
+	}
+	if !bytes.Equal(key, key2) || len(loaded.Accounts) != 1 {
+		t.Error("two-factor slot should unwrap the master key")
+	}
+	_ = ClearSession(vaultPath)
+
+	// Changing the password keeps the slot bound to the keyfile.
+	if err := v.Slots[0].SetPassword(key, []byte("new password"), nil, testKDFParams); !errors.Is(err, ErrKeyfileRequired) {
+		t.Errorf("expected ErrKeyfileRequired, got %v", err)
+	}
+	if err := v.Slots[0].SetPassword(key, []byte("new password"), keyfile, testKDFParams); err != nil {
+		t.Fatalf("SetPassword failed: %v", err)
+	}
+	if !v.Slots[0].RequiresKeyfile {
+		t.Error("SetPassword should keep the keyfile requirement")
+	}
+	if err := SaveSlots(vaultPath, v, key); err != nil {
+		t.Fatalf("SaveSlots failed: %v", err)
+	}
+	if _, err := LoadVaultWithKeyfile(vaultPath, []byte("new password"), keyfile); err != nil {
+		t.Errorf("LoadVaultWithKeyfile with new password failed: %v", err)
+	}
+}
+
+func TestRekey(t *testing.T) {
+	defer SetKDFParams(KDFParams())
+	if err := SetKDFParams(crypto.KDFParams{}); err == nil {
+		t.Error("expected SetKDFParams to reject invalid parameters")
+	}
+	if err := SetKDFParams(testKDFParams); err != nil {
+		t.Fatalf("SetKDFParams failed: %v", err)
+	}
+	if NewVault(nil).KDFParams != testKDFParams {
+		t.Error("expected NewVault to use the parameters from SetKDFParams")
+	}
+
+	vaultPath := filepath.Join(t.TempDir(), "vault.enc")
+	password := []byte("password")
+	v := NewVault(nil)
+	v.Accounts = append(v.Accounts, *NewAccount("Test", []byte("JBSWY3DPEHPK3PXP")))
+	if err := SaveVault(vaultPath, v, password); err != nil {
+		t.Fatalf("SaveVault failed: %v", err)
+	}
+	key, _ := unlockSlots(v.Slots, password, nil, SlotPassword)
+	other, err := NewPasswordSlot(key, []byte("other"), testKDFParams)
+	if err != nil {
+		t.Fatalf("NewPasswordSlot failed: %v", err)
+	}
+	v.Slots = append(v.Slots, *other)
+	oldSalt := v.Slots[0].Salt
+
+	stronger := testKDFParams
+	stronger.Iterations = 2
+	if _, err := v.Rekey(key, []byte("wrong"), nil, stronger); !errors.Is(err, ErrNoMatchingSlot) {
+		t.Errorf("expected ErrNoMatchingSlot for a wrong password, got %v", err)
+	}
+	n, err := v.Rekey(key, password, nil, stronger)
+	if err != nil || n != 1 {
+		t.Fatalf("Rekey failed: %d, %v", n, err)
+	}
+	if bytes.Equal(v.Slots[0].Salt, oldSalt) || v.Slots[0].KDFParams != stronger {
+		t.Error("expected the password slot to get a fresh salt and the new parameters")
+	}
+	if v.Slots[1].KDFParams != testKDFParams {
+		t.Error("expected other slots to keep their parameters")
+	}
+	if v.KDFParams != stronger {
+		t.Error("expected the vault to use the new parameters for new slots")
+	}
+
+	if err := SaveVaultWithKey(vaultPath, v, key); err != nil {
+		t.Fatalf("SaveVaultWithKey failed: %v", err)
+	}
+	loaded, err := LoadVault(vaultPath, password)
+	if err != nil || len(loaded.Accounts) != 1 || loaded.KDFParams != stronger {
+		t.Fatalf("expected the rekeyed vault to open with the password: %v", err)
+	}
+	if _, err := LoadVault(vaultPath, []byte("other")); err != nil {
+		t.Errorf("expected the other password slot to keep working: %v", err)
+	}
+}
+
+func TestCipherAndKDFAgility(t *testing.T) {
+	vaultPath := filepath.Join(t.TempDir(), "vault.enc")
+	password := []byte("password")
+	scryptParams := crypto.KDFParams{Algorithm: crypto.KDFScrypt, N: 1024, R: 8, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+	v := NewVault(nil)
+	v.Cipher = crypto.CipherXChaCha20Poly1305
+	v.KDFParams = scryptParams
+	v.Accounts = append(v.Accounts, *NewAccount("Test", []byte("JBSWY3DPEHPK3PXP")))
+	if err := SaveVault(vaultPath, v, password); err != nil {
+		t.Fatalf("SaveVault failed: %v", err)
+	}
+
+	metadata, _ := readMetadata(vaultPath)
+	if metadata.Cipher != crypto.CipherXChaCha20Poly1305 || metadata.Slots[0].KDFParams.Algorithm != crypto.KDFScrypt {
+		t.Fatalf("expected the cipher and KDF to be recorded, got %q and %q", metadata.Cipher, metadata.Slots[0].KDFParams.Algorithm)
+	}
+	if _, err := crypto.Decrypt(metadata.Ciphertext, make([]byte, 32), nil); err == nil {
+		t.Fatal("expected the payload not to be AES-256-GCM")
+	}
+
+	loaded, err := LoadVault(vaultPath, password)
+	if err != nil {
+		t.Fatalf("LoadVault failed: %v", err)
+	}
+	if loaded.Cipher != crypto.CipherXChaCha20Poly1305 {
+		t.Errorf("expected the loaded vault to keep its cipher, got %q", loaded.Cipher)
+	}
+	secret, err := loaded.OpenSecret(&loaded.Accounts[0])
+	if err != nil || string(secret.Bytes()) != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("OpenSecret failed: %v", err)
+	}
+	secret.Destroy()
+
+	// Switching the cipher reseals the account secrets.
+	key, _ := unlockSlots(loaded.Slots, password, nil, SlotPassword)
+	sealed := loaded.Accounts[0].SealedSecret
+	loaded.Cipher = crypto.CipherAES256GCM
+	if err := SaveVaultWithKey(vaultPath, loaded, key); err != nil {
+		t.Fatalf("SaveVaultWithKey failed: %v", err)
+	}
+	if bytes.Equal(loaded.Accounts[0].SealedSecret, sealed) {
+		t.Error("expected the account secret to be resealed")
+	}
+	loaded, err = LoadVault(vaultPath, password)
+	if err != nil || loaded.Cipher != crypto.CipherAES256GCM {
+		t.Fatalf("expected the vault to open as AES-256-GCM: %v", err)
+	}
+	secret, err = loaded.OpenSecret(&loaded.Accounts[0])
+	if err != nil || string(secret.Bytes()) != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("OpenSecret failed after changing the cipher: %v", err)
+	}
+	secret.Destroy()
+}
+
+func TestSaveConflict(t *testing.T) {
+	vaultPath := filepath.Join(t.TempDir(), "vault.enc")
+	password := []byte("password")
+	v := NewVault(nil)
+	v.KDFParams = testKDFParams
+	if err := SaveVault(vaultPath, v, password); err != nil {
+		t.Fatalf("SaveVault failed: %v", err)
+	}
+	key, _ := unlockSlots(v.Slots, password, nil, SlotPassword)
+
+	a, err := LoadVaultWithKey(vaultPath, key)
+	if err != nil {
+		t.Fatalf("LoadVaultWithKey failed: %v", err)
+	}
+	b, _ := LoadVaultWithKey(vaultPath, key)
+
+	a.Accounts = append(a.Accounts, *NewAccount("A", []byte("JBSWY3DPEHPK3PXP")))
+	if err := SaveVaultWithKey(vaultPath, a, key); err != nil {
+		t.Fatalf("SaveVaultWithKey failed: %v", err)
+	}
+	// A vault saves again on top of its own changes.
+	if err := SaveVaultWithKey(vaultPath, a, key); err != nil {
+		t.Fatalf("second SaveVaultWithKey failed: %v", err)
+	}
+
+	b.Accounts = append(b.Accounts, *NewAccount("B", []byte("JBSWY3DPEHPK3PXP")))
+	if err := SaveVaultWithKey(vaultPath, b, key); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict for a stale vault, got %v", err)
+	}
+	if err := SaveSlots(vaultPath, b, key); !errors.Is(err, ErrConflict) {
+		t.Errorf("expected ErrConflict from SaveSlots for a stale vault, got %v", err)
+	}
+	loaded, _ := LoadVaultWithKey(vaultPath, key)
+	if len(loaded.Accounts) != 1 || loaded.Accounts[0].Name != "A" {
+		t.Fatalf("expected the stale save to leave the file alone, got %d accounts", len(loaded.Accounts))
+	}
+	metadata, _ := readMetadata(vaultPath)
+	if metadata.Generation != 3 {
+		t.Errorf("expected generation 3 after three saves, got %d", metadata.Generation)
+	}
+
+	// A new vault replaces the file, as 'gotp init --force' does.
+	fresh := NewVault(nil)
+	fresh.KDFParams = testKDFParams
+	if err := SaveVault(vaultPath, fresh, password); err != nil {
+		t.Fatalf("SaveVault over an existing vault failed: %v", err)
+	}
+	if metadata, _ := readMetadata(vaultPath); metadata.Generation != 4 {
+		t.Errorf("expected a replaced vault to continue the generation, got %d", metadata.Generation)
+	}
+}
+
+func TestConcurrentSaves(t *testing.T) {
+	vaultPath := filepath.Join(t.TempDir(), "vault.enc")
+	password := []byte("password")
+	v := NewVault(nil)
+	v.KDFParams = testKDFParams
+	if err := SaveVault(vaultPath, v, password); err != nil {
+		t.Fatalf("SaveVault failed: %v", err)
+	}
+	key, _ := unlockSlots(v.Slots, password, nil, SlotPassword)
+
+	// Each writer retries on conflict, as a user would rerun the command,
+	// so no account may be lost.
+	const writers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				v, err := LoadVaultWithKey(vaultPath, key)
+				if err != nil {
+					errs <- err
+					return
+				}
+				v.Accounts = append(v.Accounts, *NewAccount(fmt.Sprintf("Account %d", i), []byte("JBSWY3DPEHPK3PXP")))
+				err = SaveVaultWithKey(vaultPath, v, key)
+				v.Destroy()
+				if !errors.Is(err, ErrConflict) {
+					errs <- err
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("writer failed: %v", err)
+		}
+	}
+
+	loaded, err := LoadVaultWithKey(vaultPath, key)
+	if err != nil {
+		t.Fatalf("LoadVaultWithKey failed: %v", err)
+	}
+	if len(loaded.Accounts) != writers {
+		t.Errorf("expected %d accounts, got %d", writers, len(loaded.Accounts))
+	}
+
+	// A save waits while another process holds the lock.
+	unlock, err := lockVault(vaultPath)
+	if err != nil {
+		t.Fatalf("lockVault failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- SaveVaultWithKey(vaultPath, loaded, key) }()
+	select {
+	case err := <-done:
+		t.Fatalf("expected the save to wait for the lock, got %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock()
+	if err := <-done; err != nil {
+		t.Errorf("save after unlocking failed: %v", err)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	vaultPath := filepath.Join(t.TempDir(), "vault.enc")
+	password := []byte("password")
+	v := NewVault(nil)
+	v.KDFParams = testKDFParams
+	if err := SaveVault(vaultPath, v, password); err != nil {
+		t.Fatalf("SaveVault failed: %v", err)
+	}
+	key, _ := unlockSlots(v.Slots, password, nil, SlotPassword)
+
+	// Updates hold the lock from the read to the write, so concurrent
+	// writers neither conflict nor lose each other's accounts.
+	const writers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- Update(vaultPath, key, func(v *Vault) error {
+				v.Accounts = append(v.Accounts, *NewAccount(fmt.Sprintf("Account %d", i), []byte("JBSWY3DPEHPK3PXP")))
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+	}
+	loaded, err := LoadVaultWithKey(vaultPath, key)
+	if err != nil {
+		t.Fatalf("LoadVaultWithKey failed: %v", err)
+	}
+	if len(loaded.Accounts) != writers {
+		t.Errorf("expected %d accounts, got %d", writers, len(loaded.Accounts))
+	}
+
+	// An update that fails saves nothing.
+	failed := errors.New("failed")
+	err = Update(vaultPath, key, func(v *Vault) error {
+		v.Accounts = nil
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Errorf("expected the error of the update, got %v", err)
+	}
+	if loaded, _ := LoadVaultWithKey(vaultPath, key); loaded == nil || len(loaded.Accounts) != writers {
+		t.Error("a failed update changed the vault")
+	}
+
+	// UpdateKey saves with the key it returns.
+	newKey, _ := NewMasterKey()
+	err = UpdateKey(vaultPath, key, func(v *Vault) ([]byte, error) {
+		slot, err := NewPasswordSlot(newKey, []byte("rotated"), testKDFParams)
+		if err != nil {
+			return nil, err
+		}
+		v.Slots = []KeySlot{*slot}
+		return newKey, nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateKey failed: %v", err)
+	}
+	if rotated, err := LoadVault(vaultPath, []byte("rotated")); err != nil || len(rotated.Accounts) != writers {
+		t.Errorf("LoadVault after UpdateKey failed: %v", err)
+	}
+
+	// A vault loaded before an update is stale afterwards.
+	if err := SaveVaultWithKey(vaultPath, loaded, key); !errors.Is(err, ErrConflict) {
+		t.Errorf("expected ErrConflict after an update, got %v", err)
+	}
+}
+
+func TestEscrowShares(t *testing.T) {
+	key, _ := NewMasterKey()
+	encoded, err := SplitKey(key, 5, 3)
+	if err != nil {
+		t.Fatalf("SplitKey failed: %v", err)
+	}
+
+	var shares []*EscrowShare
+	for _, s := range []string{encoded[4], strings.ToLower(encoded[1]), SharePrefix + strings.ReplaceAll(encoded[2][len(SharePrefix):], "-", " ")} {
+		share, err := ParseShare(s)
+		if err != nil {
+			t.Fatalf("ParseShare(%q) failed: %v", s, err)
+		}
+		shares = append(shares, share)
+	}
+	if shares[0].Index != 5 || shares[0].Threshold != 3 {
+		t.Errorf("unexpected share %d of threshold %d", shares[0].Index, shares[0].Threshold)
+	}
+
+	got, err := CombineShares(shares)
+	if err != nil {
+		t.Fatalf("CombineShares failed: %v", err)
+	}
+	if !bytes.Equal(got, key) {
+		t.Error("shares did not recover the master key")
+	}
+	if _, err := CombineShares(shares[:2]); err == nil {
+		t.Error("expected an error with fewer shares than the threshold")
+	}
+
+	// A typing mistake is caught by the checksum.
+	typo := []byte(encoded[0])
+	i := len(SharePrefix) + 5
+	if typo[i] == 'A' {
+		typo[i] = 'B'
+	} else {
+		typo[i] = 'A'
+	}
+	if _, err := ParseShare(string(typo)); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("expected a checksum error, got %v", err)
+	}
+
+	// Shares of another split of the same key are not mixed.
+	other, _ := SplitKey(key, 5, 3)
+	mixed, _ := ParseShare(other[0])
+	if _, err := CombineShares([]*EscrowShare{shares[0], shares[1], mixed}); !errors.Is(err, ErrShareMismatch) {
+		t.Errorf("expected ErrShareMismatch, got %v", err)
+	}
+}
+
+func TestLoadVaultInteractive_StaleSession(t *testing.T) {
+	vaultPath := filepath.Join(t.TempDir(), "vault.enc")
+	v := NewVault(nil)
+	v.KDFParams = testKDFParams
+	if err := SaveVault(vaultPath, v, []byte("password")); err != nil {
+		t.Fatalf("SaveVault failed: %v", err)
+	}
+
+	// A session key that does not open this vault falls back to the prompt.
+	stale, _ := NewMasterKey()
+	if err := SaveSession(vaultPath, stale, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	defer ClearSession(vaultPath)
+	prompted := false
+	_, _, err := LoadVaultInteractive(vaultPath, func(string) ([]byte, error) {
+		prompted = true
+		return []byte("password"), nil
+	})
+	if err != nil || !prompted {
+		t.Errorf("expected the password prompt after a stale session, got prompted=%v, err=%v", prompted, err)
+	}
+}
+
+func TestRecipientSlots(t *testing.T) {
+	dir := t.TempDir()
+	vaultPath := filepath.Join(dir, "vault.enc")
+	alice, _ := crypto.GenerateX25519Identity()
+	bob, _ := crypto.GenerateX25519Identity()
+
+	key, _ := NewMasterKey()
+	v := NewVault(nil)
+	v.KDFParams = testKDFParams
+	for _, id := range []*ecdh.PrivateKey{alice, bob} {
+		slot, err := NewRecipientSlot(key, id.PublicKey())
+		if err != nil {
+			t.Fatalf("NewRecipientSlot failed: %v", err)
+		}
+		v.Slots = append(v.Slots, *slot)
+	}
+	if err := SaveVaultWithKey(vaultPath, v, key); err != nil {
+		t.Fatalf("SaveVaultWithKey failed: %v", err)
+	}
+
+	for _, id := range []*ecdh.PrivateKey{alice, bob} {
+		if _, err := LoadVaultWithIdentity(vaultPath, id); err != nil {
+			t.Errorf("LoadVaultWithIdentity failed: %v", err)
+		}
+	}
+	eve, _ := crypto.GenerateX25519Identity()
+	if _, err := LoadVaultWithIdentity(vaultPath, eve); !errors.Is(err, ErrNoMatchingSlot) {
+		t.Errorf("expected ErrNoMatchingSlot for an unknown identity, got %v", err)
+	}
+	if _, err := v.Slots[0].Unwrap([]byte("password")); !errors.Is(err, ErrNoMatchingSlot) {
+		t.Errorf("expected a recipient slot to refuse a password, got %v", err)
+	}
+
+	// Pointing a slot at another recipient breaks it.
+	tampered := v.Slots[0]
+	tampered.Recipient = v.Slots[1].Recipient
+	if _, err := tampered.UnwrapWithIdentity(bob); err == nil {
+		t.Error("a slot with a replaced recipient should not open")
+	}
+
+	// Without an identity, the prompt is not offered for a recipient-only vault.
+	_ = ClearSession(vaultPath)
+	_, _, err := LoadVaultInteractive(vaultPath, func(string) ([]byte, error) {
+		t.Fatal("prompt should not be called for a recipient-only vault")
+		return nil, nil
+	})
+	if !errors.Is(err, ErrIdentityRequired) {
+		t.Errorf("expected ErrIdentityRequired, got %v", err)
+	}
+
+	identityPath := filepath.Join(dir, "alice.txt")
+	content := "# created: 2026-01-01T00:00:00Z\n# public key: " + crypto.FormatRecipient(alice.PublicKey()) + "\n" + crypto.FormatIdentity(alice) + "\n"
+	if err := os.WriteFile(identityPath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	SetIdentity(identityPath)
+	defer SetIdentity("")
+	_, key2, err := LoadVaultInteractive(vaultPath, nil)
+	if err != nil {
+		t.Fatalf("LoadVaultInteractive with identity failed: %v", err)
+	}
+	if !bytes.Equal(key, key2) {
+		t.Error("recipient slot should unwrap the master key")
+	}
+	_ = ClearSession(vaultPath)
+
+	// Rotating the key rewraps the slot without any secret.
+	newKey, _ := NewMasterKey()
+	if err := v.Slots[1].SetRecipientKey(newKey); err != nil {
+		t.Fatalf("SetRecipientKey failed: %v", err)
+	}
+	got, err := v.Slots[1].UnwrapWithIdentity(bob)
+	if err != nil || !bytes.Equal(got, newKey) {
+		t.Errorf("rewrapped slot should unwrap the new key: %v", err)
+	}
+}
+
+func TestSealedSecrets(t *testing.T) {
+	vaultPath := filepath.Join(t.TempDir(), "vault.enc")
+	password := []byte("password")
+	v := NewVault(nil)
+	v.KDFParams = testKDFParams
+	for _, name := range []string{"GitHub", "GitLab"} {
+		acc := NewAccount(name, []byte("JBSWY3DPEHPK3PXP"))
+		acc.ID = name
+		v.Accounts = append(v.Accounts, *acc)
+	}
+	if err := SaveVault(vaultPath, v, password); err != nil {
+		t.Fatalf("SaveVault failed: %v", err)
+	}
+
+	loaded, err := LoadVault(vaultPath, password)
+	if err != nil {
+		t.Fatalf("LoadVault failed: %v", err)
+	}
+	// Listing the accounts never exposes a plaintext secret.
+	listed, _ := json.Marshal(loaded.Accounts)
+	if bytes.Contains(listed, []byte("JBSWY3DPEHPK3PXP")) {
+		t.Error("loaded accounts hold a plaintext secret")
+	}
+	gh := &loaded.Accounts[0]
+	if len(gh.Secret) != 0 || len(gh.SealedSecret) == 0 {
+		t.Fatalf("expected only a sealed secret, got %+v", gh)
+	}
+
+	secret, err := loaded.OpenSecret(gh)
+	if err != nil || string(secret.Bytes()) != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("OpenSecret = %q, %v", secret.Bytes(), err)
+	}
+	gen, err := loaded.Generator(gh)
+	if err != nil {
+		t.Fatalf("Generator failed: %v", err)
+	}
+	if code, err := gen.Generate(time.Unix(59, 0)); err != nil || code != "996554" {
+		t.Errorf("Generate = %q, %v", code, err)
+	}
+
+	// A sealed secret is bound to its account.
+	swapped := *gh
+	swapped.ID = "GitLab"
+	if _, err := loaded.OpenSecret(&swapped); err == nil {
+		t.Error("a secret moved to another account should not open")
+	}
+
+	// A copy of the accounts in another vault cannot open them, but the
+	// revealed accounts can be sealed there.
+	other := NewVault(nil)
+	other.Accounts = append(other.Accounts, loaded.Accounts...)
+	if _, err := other.OpenSecret(&other.Accounts[0]); !errors.Is(err, ErrSecretsLocked) {
+		t.Errorf("expected ErrSecretsLocked, got %v", err)
+	}
+	revealed, err := loaded.RevealAccounts()
+	if err != nil || string(revealed[1].Secret) != "JBSWY3DPEHPK3PXP" || revealed[1].SealedSecret != nil {
+		t.Fatalf("RevealAccounts = %+v, %v", revealed, err)
+	}
+
+	// Saving with a new master key reseals the secrets.
+	newKey, _ := NewMasterKey()
+	slot, _ := NewPasswordSlot(newKey, []byte("rotated"), testKDFParams)
+	loaded.Slots = []KeySlot{*slot}
+	if err := SaveVaultWithKey(vaultPath, loaded, newKey); err != nil {
+		t.Fatalf("SaveVaultWithKey failed: %v", err)
+	}
+	rotated, err := LoadVault(vaultPath, []byte("rotated"))
+	if err != nil {
+		t.Fatalf("LoadVault after rotation failed: %v", err)
+	}
+	if secret, err := rotated.OpenSecret(&rotated.Accounts[1]); err != nil || string(secret.Bytes()) != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("OpenSecret after rotation = %q, %v", secret.Bytes(), err)
+	}
+}
+
+func TestGenerateAll(t *testing.T) {
+	v := NewVault(nil)
+	for _, name := range []string{"GitHub", "GitLab"} {
+		acc := NewAccount(name, []byte("JBSWY3DPEHPK3PXP"))
+		acc.ID = name
+		v.Accounts = append(v.Accounts, *acc)
+	}
+	hotp := NewAccount("Bank", []byte("JBSWY3DPEHPK3PXP"))
+	hotp.Type = totp.TypeHOTP
+	v.Accounts = append(v.Accounts, *hotp)
+	broken := NewAccount("Broken", []byte("not base32!"))
+	v.Accounts = append(v.Accounts, *broken)
+
+	res := v.GenerateAll(v.Accounts, time.Unix(59, 0))
+	if len(res) != 4 {
+		t.Fatalf("GenerateAll returned %d results", len(res))
+	}
+	for i := 0; i < 2; i++ {
+		if res[i].Err != nil || res[i].Code != "996554" {
+			t.Errorf("GenerateAll()[%d] = %q, %v", i, res[i].Code, res[i].Err)
+		}
+	}
+	if res[2].Err == nil || res[3].Err == nil {
+		t.Errorf("Expected errors for HOTP and invalid accounts, got %+v", res[2:])
+	}
+	if res := v.GenerateAll(nil, time.Now()); len(res) != 0 {
+		t.Errorf("GenerateAll(nil) returned %d results", len(res))
+	}
+}
+
+func TestSealedPIN(t *testing.T) {
+	vaultPath := filepath.Join(t.TempDir(), "vault.enc")
+	password := []byte("password")
+	v := NewVault(nil)
+	v.KDFParams = testKDFParams
+	acc := NewAccount("Mobile", []byte("GEZDGNBVGY3TQOJQ")) // "1234567890"
+	acc.ID = "mobile"
+	acc.Encoder = totp.EncoderMOTP
+	acc.Period = 10
+	acc.PIN = Secret("4711")
+	v.Accounts = append(v.Accounts, *acc)
+
+	// The code of the unsealed account, before the PIN is sealed.
+	encoder, err := totp.NewEncoder(totp.EncoderMOTP, []byte("4711"))
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	want, err := totp.GenerateTOTP(acc.TOTPParams([]byte("1234567890"), time.Unix(1000, 0), encoder))
+	if err != nil {
+		t.Fatalf("GenerateTOTP failed: %v", err)
+	}
+
+	if err := SaveVault(vaultPath, v, password); err != nil {
+		t.Fatalf("SaveVault failed: %v", err)
+	}
+	loaded, err := LoadVault(vaultPath, password)
+	if err != nil {
+		t.Fatalf("LoadVault failed: %v", err)
+	}
+	mobile := &loaded.Accounts[0]
+	if len(mobile.PIN) != 0 || len(mobile.SealedPIN) == 0 {
+		t.Fatalf("expected only a sealed PIN, got %+v", mobile)
+	}
+	listed, _ := json.Marshal(loaded.Accounts)
+	if bytes.Contains(listed, []byte("4711")) {
+		t.Error("loaded accounts hold a plaintext PIN")
+	}
+
+	pin, err := loaded.OpenPIN(mobile)
+	if err != nil || string(pin.Bytes()) != "4711" {
+		t.Fatalf("OpenPIN = %q, %v", pin.Bytes(), err)
+	}
+	pin.Destroy()
+	gen, err := loaded.Generator(mobile)
+	if err != nil {
+		t.Fatalf("Generator failed: %v", err)
+	}
+	if code, err := gen.Generate(time.Unix(1000, 0)); err != nil || code != want {
+		t.Errorf("Generate = %q, %v, want %q", code, err, want)
+	}
+	gen.Destroy()
+
+	// The PIN is bound to its account and kept apart from its secret.
+	swapped := *mobile
+	swapped.SealedSecret = mobile.SealedPIN
+	if _, err := loaded.OpenSecret(&swapped); err == nil {
+		t.Error("a sealed PIN should not open as the secret")
+	}
+	if pin, err := loaded.OpenPIN(&Account{Name: "other", SealedPIN: mobile.SealedPIN}); err == nil {
+		pin.Destroy()
+		t.Error("a PIN moved to another account should not open")
+	}
+
+	revealed, err := loaded.Reveal(mobile)
+	if err != nil || string(revealed.PIN) != "4711" || revealed.SealedPIN != nil {
+		t.Fatalf("Reveal = %+v, %v", revealed, err)
+	}
+	if !strings.Contains(revealed.ToURI(), "pin=4711") {
+		t.Errorf("ToURI of the revealed account lacks the PIN: %s", revealed.ToURI())
+	}
+
+	// The metadata view carries neither the secret nor the PIN.
+	info, _ := json.Marshal(mobile.Info())
+	for _, leak := range []string{"GEZDGNBVGY3TQOJQ", "4711", "secret", "pin"} {
+		if bytes.Contains(info, []byte(leak)) {
+			t.Errorf("account info contains %q: %s", leak, info)
+		}
+	}
+}
+
+func TestQuickUnlockPIN(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	vaultPath := filepath.Join(t.TempDir(), "vault.enc")
+	v := NewVault(nil)
+	v.KDFParams = testKDFParams
+	if err := SaveVault(vaultPath, v, []byte("password")); err != nil {
+		t.Fatalf("SaveVault failed: %v", err)
+	}
+	_ = ClearSession(vaultPath)
+	_, key, err := LoadVaultInteractive(vaultPath, func(string) ([]byte, error) {
+		return []byte("password"), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetPIN(vaultPath, key, []byte("12345"), testKDFParams, time.Hour, 3); err == nil {
+		t.Error("Expected error for a short PIN")
+	}
+	if err := SetPIN(vaultPath, key, []byte("123456"), testKDFParams, time.Hour, 3); err != nil {
+		t.Fatalf("SetPIN failed: %v", err)
+	}
+	state, err := GetPIN(vaultPath)
+	if err != nil || state == nil || state.AttemptsLeft != 3 {
+		t.Fatalf("GetPIN returned %+v, %v", state, err)
+	}
+
+	load := func(answers ...string) (*Vault, []string, error) {
+		_ = ClearSession(vaultPath)
+		var prompts []string
+		v, _, err := LoadVaultInteractive(vaultPath, func(prompt string) ([]byte, error) {
+			prompts = append(prompts, prompt)
+			answer := answers[0]
+			answers = answers[1:]
+			return []byte(answer), nil
+		})
+		return v, prompts, err
+	}
+
+	if _, prompts, err := load("123456"); err != nil || len(prompts) != 1 || !strings.Contains(prompts[0], "PIN") {
+		t.Fatalf("Expected to unlock with the PIN alone, got prompts %q, err %v", prompts, err)
+	}
+	if _, prompts, err := load("", "password"); err != nil || len(prompts) != 2 {
+		t.Errorf("An empty PIN should fall back to the password, got prompts %q, err %v", prompts, err)
+	}
+
+	// Wrong PINs are counted by the agent, and a correct PIN resets the
+	// count.
+	if _, _, err := load("000000"); !errors.Is(err, ErrWrongPIN) {
+		t.Errorf("Expected ErrWrongPIN, got %v", err)
+	}
+	if state, _ := GetPIN(vaultPath); state == nil || state.AttemptsLeft != 2 {
+		t.Errorf("Expected 2 attempts left, got %+v", state)
+	}
+
+	// Nothing is written to disk, so there is no wrapped key to copy and no
+	// counter to delete or edit: clearing the configuration directory
+	// leaves the count as it was.
+	configDir := config.GetDefaultConfigDir()
+	if _, err := os.Stat(filepath.Join(configDir, "pins")); !os.IsNotExist(err) {
+		t.Errorf("Expected no PIN files, got %v", err)
+	}
+	if err := os.RemoveAll(configDir); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := GetPIN(vaultPath); state == nil || state.AttemptsLeft != 2 {
+		t.Errorf("Expected the count to survive, got %+v", state)
+	}
+	if _, _, err := load("123456"); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := GetPIN(vaultPath); state == nil || state.AttemptsLeft != 3 {
+		t.Errorf("Expected the count to reset, got %+v", state)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := load("000000"); !errors.Is(err, ErrWrongPIN) {
+			t.Fatalf("Expected ErrWrongPIN, got %v", err)
+		}
+	}
+	if _, _, err := load("000000"); !errors.Is(err, ErrPINDestroyed) {
+		t.Fatalf("Expected ErrPINDestroyed, got %v", err)
+	}
+	if state, _ := GetPIN(vaultPath); state != nil {
+		t.Error("The PIN should be destroyed")
+	}
+	if _, prompts, err := load("password"); err != nil || strings.Contains(prompts[0], "PIN") {
+		t.Errorf("Expected the password prompt, got prompts %q, err %v", prompts, err)
+	}
+
+	// An expired PIN is removed.
+	if err := SetPIN(vaultPath, key, []byte("123456"), testKDFParams, time.Second, 3); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if state, _ := GetPIN(vaultPath); state != nil {
+		t.Error("The PIN should expire")
+	}
+
+	// Without an agent there is nowhere to keep a PIN.
+	t.Setenv(agent.SocketEnv, filepath.Join(t.TempDir(), "agent.sock"))
+	if err := SetPIN(vaultPath, key, []byte("123456"), testKDFParams, time.Hour, 3); !errors.Is(err, ErrPINNeedsAgent) {
+		t.Errorf("Expected ErrPINNeedsAgent, got %v", err)
+	}
+	if state, err := GetPIN(vaultPath); state != nil || err != nil {
+		t.Errorf("Expected no PIN, got %+v, %v", state, err)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(SessionKeyEnv, "")
+	vault := CanonicalPath(filepath.Join(t.TempDir(), "vault.enc"))
+	masterKey := bytes.Repeat([]byte{7}, 32)
+
+	if err := FileStore.Put(vault, masterKey, time.Hour); !errors.Is(err, ErrNoSessionKey) {
+		t.Fatalf("Expected ErrNoSessionKey, got %v", err)
+	}
+	session, err := NewSessionKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(SessionKeyEnv, session)
+	if err := FileStore.Put(vault, masterKey, time.Hour); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	info, err := os.Stat(sessionFilePath(vault))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+	}
+	data, _ := os.ReadFile(sessionFilePath(vault))
+	if bytes.Contains(data, masterKey) {
+		t.Error("The session file holds the key in the clear")
+	}
+
+	key, err := FileStore.Get(vault)
+	if err != nil || key == nil || !bytes.Equal(key.Bytes(), masterKey) {
+		t.Fatalf("Get returned %v, %v", key, err)
+	}
+	key.Destroy()
+
+	// Another session, or none, cannot open the key.
+	other, _ := NewSessionKey()
+	t.Setenv(SessionKeyEnv, other)
+	if key, err := FileStore.Get(vault); key != nil || err != nil {
+		t.Errorf("Expected no key under another session, got %v, %v", key, err)
+	}
+	t.Setenv(SessionKeyEnv, "")
+	if key, err := FileStore.Get(vault); key != nil || err != nil {
+		t.Errorf("Expected no key without a session, got %v, %v", key, err)
+	}
+
+	t.Setenv(SessionKeyEnv, session)
+	if err := FileStore.Delete(vault); err != nil {
+		t.Fatal(err)
+	}
+	if key, _ := FileStore.Get(vault); key != nil {
+		t.Error("Expected the key to be deleted")
+	}
+
+	// An expired key is removed.
+	if err := FileStore.Put(vault, masterKey, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if key, _ := FileStore.Get(vault); key != nil {
+		t.Error("The key should expire")
+	}
+	if _, err := os.Stat(sessionFilePath(vault)); !os.IsNotExist(err) {
+		t.Error("The expired session file should be removed")
+	}
+}
+
+// memStore is a key store in memory.
+type memStore map[string][]byte
+
+func (memStore) Name() string { return "memory" }
+
+func (s memStore) Get(vault string) (*crypto.SecureBuffer, error) {
+	if key, ok := s[vault]; ok {
+		return crypto.NewSecureBufferFrom(key)
+	}
+	return nil, nil
+}
+
+func (s memStore) Put(vault string, key []byte, _ time.Duration) error {
+	s[vault] = append([]byte(nil), key...)
+	return nil
+}
+
+func (s memStore) Delete(vault string) error {
+	delete(s, vault)
+	return nil
+}
+
+func TestKeyStores(t *testing.T) {
+	vaultPath := filepath.Join(t.TempDir(), "vault.enc")
+	v := NewVault(nil)
+	v.KDFParams = testKDFParams
+	if err := SaveVault(vaultPath, v, []byte("password")); err != nil {
+		t.Fatalf("SaveVault failed: %v", err)
+	}
+	_ = ClearSession(vaultPath)
+	_, key, err := LoadVaultInteractive(vaultPath, func(string) ([]byte, error) {
+		return []byte("password"), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := memStore{}
+	SetKeyStores(AgentStore, store)
+	t.Cleanup(func() { SetKeyStores(AgentStore) })
+	canonical := CanonicalPath(vaultPath)
+	if err := store.Put(canonical, key, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// A stored key opens the vault without a prompt and starts a session.
+	_ = ClearSession(vaultPath)
+	noPrompt := func(string) ([]byte, error) {
+		return nil, errors.New("unexpected prompt")
+	}
+	loaded, _, err := LoadVaultInteractive(vaultPath, noPrompt)
+	if err != nil {
+		t.Fatalf("Expected the stored key to open the vault: %v", err)
+	}
+	loaded.Destroy()
+	if session, _ := GetSession(vaultPath); session == nil {
+		t.Error("A key from another store should start a session")
+	} else {
+		session.Destroy()
+	}
+
+	// A key that no longer opens the vault is removed from its store.
+	_ = ClearSession(vaultPath)
+	store[canonical] = make([]byte, len(key))
+	if _, _, err := LoadVaultInteractive(vaultPath, func(string) ([]byte, error) {
+		return []byte("password"), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store[canonical]; ok {
+		t.Error("A stale key should be deleted from its store")
+	}
+
+	store[canonical] = append([]byte(nil), key...)
+	if err := ForgetKey(vaultPath); err != nil {
+		t.Fatalf("ForgetKey failed: %v", err)
+	}
+	if _, ok := store[canonical]; ok {
+		t.Error("ForgetKey should delete the key from every store")
+	}
+	if session, _ := GetSession(vaultPath); session != nil {
+		session.Destroy()
+		t.Error("ForgetKey should end the session")
+	}
+}
+
+// startSSHAgent serves an in-memory ssh-agent on a socket in a temporary
+// directory and points SSH_AUTH_SOCK at it.
+func startSSHAgent(t *testing.T) sshagent.Agent {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "gotp-ssh-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "agent.sock")
+	t.Setenv("SSH_AUTH_SOCK", path)
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	keyring := sshagent.NewKeyring()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = sshagent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	return keyring
+}
+
+func TestSSHAgentSlot(t *testing.T) {
+	keyring := startSSHAgent(t)
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	if err := keyring.Add(sshagent.AddedKey{PrivateKey: priv, Comment: "alice@laptop"}); err != nil {
+		t.Fatal(err)
+	}
+	signer, _ := ssh.NewSignerFromKey(priv)
+
+	masterKey, _ := NewMasterKey()
+	slot, err := NewSSHAgentSlot(masterKey, keyring, signer.PublicKey())
+	if err != nil {
+		t.Fatalf("NewSSHAgentSlot failed: %v", err)
+	}
+	if slot.Type != SlotSSHAgent || !strings.HasPrefix(slot.SSHKey, "ssh-ed25519 ") {
+		t.Errorf("Unexpected slot %+v", slot)
+	}
+	got, err := slot.UnwrapWithSSHAgent(keyring)
+	if err != nil || !bytes.Equal(got, masterKey) {
+		t.Fatalf("UnwrapWithSSHAgent returned %v", err)
+	}
+	if _, err := slot.Unwrap([]byte("password")); !errors.Is(err, ErrNoMatchingSlot) {
+		t.Errorf("A password should not open an ssh-agent slot, got %v", err)
+	}
+
+	// The key is bound to the slot.
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	_ = keyring.Add(sshagent.AddedKey{PrivateKey: other})
+	otherSigner, _ := ssh.NewSignerFromKey(other)
+	tampered := *slot
+	tampered.SSHKey = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(otherSigner.PublicKey())))
+	if _, err := tampered.UnwrapWithSSHAgent(keyring); !errors.Is(err, ErrNoMatchingSlot) {
+		t.Errorf("A slot with a replaced key should not open, got %v", err)
+	}
+
+	// LoadVaultInteractive opens the vault through the agent without a
+	// prompt.
+	vaultPath := filepath.Join(t.TempDir(), "vault.enc")
+	v := NewVault(nil)
+	v.KDFParams = testKDFParams
+	password, _ := NewPasswordSlot(masterKey, []byte("password"), testKDFParams)
+	v.Slots = []KeySlot{*password, *slot}
+	if err := SaveVaultWithKey(vaultPath, v, masterKey); err != nil {
+		t.Fatal(err)
+	}
+	_ = ClearSession(vaultPath)
+	loaded, _, err := LoadVaultInteractive(vaultPath, func(string) ([]byte, error) {
+		return nil, errors.New("unexpected prompt")
+	})
+	if err != nil {
+		t.Fatalf("Expected ssh-agent to unlock the vault: %v", err)
+	}
+	loaded.Destroy()
+
+	// Without the key in the agent, the password is asked for.
+	if err := keyring.RemoveAll(); err != nil {
+		t.Fatal(err)
+	}
+	_ = ClearSession(vaultPath)
+	prompted := false
+	loaded, _, err = LoadVaultInteractive(vaultPath, func(string) ([]byte, error) {
+		prompted = true
+		return []byte("password"), nil
+	})
+	if err != nil || !prompted {
+		t.Fatalf("Expected a password prompt, got prompted=%v, err %v", prompted, err)
+	}
+	loaded.Destroy()
+}
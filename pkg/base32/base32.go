@@ -52,27 +52,47 @@ func Encode(data []byte) string {
 // It supports strings with or without padding and is case-insensitive.
 // Returns an error if the input contains characters outside the Base32 alphabet.
 func Decode(s string) ([]byte, error) {
-	// Normalize the input: remove padding and convert to uppercase.
-	s = strings.ToUpper(strings.TrimRight(s, "="))
-	if s == "" {
-		return []byte{}, nil
+	src := []byte(strings.TrimRight(s, "="))
+	dst := make([]byte, DecodedLen(len(src)))
+	n, err := DecodeTo(dst, src)
+	if err != nil {
+		return nil, err
 	}
+	return dst[:n], nil
+}
+
+// DecodedLen returns the number of bytes n Base32 characters, without
+// padding, decode to.
+func DecodedLen(n int) int {
+	return n * 5 / 8
+}
 
-	var result []byte
+// DecodeTo decodes Base32 src into dst and returns the number of bytes
+// written. Like Decode, it ignores trailing padding and case. dst must hold
+// at least DecodedLen(len(src)) bytes. It does not allocate, so that a
+// secret held in a byte slice never has to take a string form.
+func DecodeTo(dst, src []byte) (int, error) {
+	for len(src) > 0 && src[len(src)-1] == '=' {
+		src = src[:len(src)-1]
+	}
+
+	var n int
 	var buffer uint64
 	var bitsLeft uint
 
-	for i := 0; i < len(s); i++ {
-		char := s[i]
+	for _, char := range src {
 		var val int
 
 		// Map the character to its 5-bit value.
+		if char >= 'a' && char <= 'z' {
+			char -= 'a' - 'A'
+		}
 		if char >= 'A' && char <= 'Z' {
 			val = int(char - 'A')
 		} else if char >= '2' && char <= '7' {
 			val = int(char - '2' + 26)
 		} else {
-			return nil, errors.New("invalid base32 character")
+			return 0, errors.New("invalid base32 character")
 		}
 
 		// Shift the buffer and add 5 new bits.
@@ -82,9 +102,13 @@ func Decode(s string) ([]byte, error) {
 		// Extract 8-bit bytes from the buffer.
 		if bitsLeft >= 8 {
 			bitsLeft -= 8
-			result = append(result, byte(buffer>>bitsLeft))
+			if n == len(dst) {
+				return 0, errors.New("base32 destination too short")
+			}
+			dst[n] = byte(buffer >> bitsLeft)
+			n++
 		}
 	}
 
-	return result, nil
+	return n, nil
 }
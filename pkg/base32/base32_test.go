@@ -42,3 +42,19 @@ func TestBase32DecodeInvalid(t *testing.T) {
 		t.Error("Expected error for invalid base32 string, got nil")
 	}
 }
+
+func TestBase32DecodeTo(t *testing.T) {
+	src := []byte("mzxw6ytboi======")
+	dst := make([]byte, DecodedLen(len(bytes.TrimRight(src, "="))))
+	n, err := DecodeTo(dst, src)
+	if err != nil {
+		t.Fatalf("DecodeTo error: %v", err)
+	}
+	if string(dst[:n]) != "foobar" || n != len(dst) {
+		t.Errorf("DecodeTo = %q, expected %q", dst[:n], "foobar")
+	}
+
+	if _, err := DecodeTo(make([]byte, 2), []byte("MZXW6YTB")); err == nil {
+		t.Error("Expected error for a short destination, got nil")
+	}
+}
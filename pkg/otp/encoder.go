@@ -0,0 +1,154 @@
+package otp
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// EncoderName identifies how an account turns its secret and moving factor
+// (time step or counter) into a printable code.
+type EncoderName string
+
+const (
+	// EncoderRFC is the decimal truncation of RFC 4226. It is the default.
+	EncoderRFC EncoderName = "rfc"
+	// EncoderSteam produces 5-character Steam Guard codes.
+	EncoderSteam EncoderName = "steam"
+	// EncoderMOTP produces Mobile-OTP codes (MD5 over time step, secret and PIN).
+	EncoderMOTP EncoderName = "motp"
+)
+
+// steamAlphabet is the character set used by Steam Guard codes.
+const steamAlphabet = "23456789BCDFGHJKMNPQRTVWXY"
+
+// Encoder generates a one-time code from a secret and a moving factor.
+// The moving factor is the HOTP counter or the TOTP time step.
+type Encoder interface {
+	Encode(secret []byte, counter uint64, digits int, algo HashAlgorithm) (string, error)
+}
+
+// MACEncoder is implemented by encoders whose code is derived only from the
+// HMAC of the moving factor. It lets a Generator supply the HMAC from a
+// precomputed key instead of the raw secret.
+type MACEncoder interface {
+	EncodeMAC(hs []byte, digits int) (string, error)
+}
+
+// RFCEncoder produces decimal codes using the dynamic truncation of RFC 4226.
+type RFCEncoder struct{}
+
+// Encode implements Encoder.
+func (RFCEncoder) Encode(secret []byte, counter uint64, digits int, algo HashAlgorithm) (string, error) {
+	return GenerateHOTP(secret, counter, digits, algo)
+}
+
+// EncodeMAC implements MACEncoder.
+func (RFCEncoder) EncodeMAC(hs []byte, digits int) (string, error) {
+	if err := ValidateDigits(EncoderRFC, digits); err != nil {
+		return "", err
+	}
+
+	// Dynamic Truncation (DT) to a 31-bit integer.
+	binaryValue := DynamicTruncate(hs)
+
+	// Apply modulo 10^digits to the 31-bit integer. 10^10 does not fit in
+	// 32 bits, so the arithmetic is done in 64 bits.
+	otp := uint64(binaryValue) % uint64(math.Pow10(digits))
+
+	// Format the resulting OTP as a string with leading zeros if necessary.
+	return fmt.Sprintf("%0*d", digits, otp), nil
+}
+
+// SteamEncoder produces Steam Guard codes: the 31-bit truncated HMAC value
+// rendered in base 26 over Steam's alphabet, least significant character first.
+type SteamEncoder struct{}
+
+// Encode implements Encoder. A digits value of 0 selects Steam's 5 characters.
+func (SteamEncoder) Encode(secret []byte, counter uint64, digits int, algo HashAlgorithm) (string, error) {
+	return SteamEncoder{}.EncodeMAC(HMAC(secret, counterBytes(counter), algo), digits)
+}
+
+// EncodeMAC implements MACEncoder.
+func (SteamEncoder) EncodeMAC(hs []byte, digits int) (string, error) {
+	if digits == 0 {
+		digits = 5
+	}
+	if err := ValidateDigits(EncoderSteam, digits); err != nil {
+		return "", err
+	}
+
+	value := DynamicTruncate(hs)
+
+	var code strings.Builder
+	for i := 0; i < digits; i++ {
+		code.WriteByte(steamAlphabet[value%uint32(len(steamAlphabet))])
+		value /= uint32(len(steamAlphabet))
+	}
+	return code.String(), nil
+}
+
+// MOTPEncoder produces Mobile-OTP codes. The code is the first digits hex
+// characters of MD5(counter || hex(secret) || PIN), where the counter is the
+// Unix time divided by a 10 second period. The hash algorithm is ignored.
+type MOTPEncoder struct {
+	PIN []byte
+}
+
+// Encode implements Encoder.
+func (e MOTPEncoder) Encode(secret []byte, counter uint64, digits int, _ HashAlgorithm) (string, error) {
+	if digits == 0 {
+		digits = 6
+	}
+	if err := ValidateDigits(EncoderMOTP, digits); err != nil {
+		return "", err
+	}
+	if len(e.PIN) == 0 {
+		return "", fmt.Errorf("motp requires a PIN")
+	}
+
+	h := md5.New()
+	h.Write([]byte(strconv.FormatUint(counter, 10)))
+	h.Write([]byte(hex.EncodeToString(secret)))
+	h.Write(e.PIN)
+	return hex.EncodeToString(h.Sum(nil))[:digits], nil
+}
+
+// ValidateDigits checks that digits is a code length the named encoder can
+// produce: 1 to 10 for RFC and Steam codes, which are derived from a 31-bit
+// value, and 1 to 32 hex characters for mOTP.
+func ValidateDigits(name EncoderName, digits int) error {
+	switch name {
+	case EncoderSteam:
+		if digits < MinDigits || digits > MaxDigits {
+			return fmt.Errorf("steam code length must be between %d and %d", MinDigits, MaxDigits)
+		}
+	case EncoderMOTP:
+		if digits < 1 || digits > md5.Size*2 {
+			return fmt.Errorf("motp code length must be between 1 and %d", md5.Size*2)
+		}
+	default:
+		if digits < MinDigits || digits > MaxDigits {
+			return fmt.Errorf("digits must be between %d and %d", MinDigits, MaxDigits)
+		}
+	}
+	return nil
+}
+
+// NewEncoder returns the Encoder registered under name. An empty name selects
+// the RFC encoder. The PIN is only used by encoders that require one.
+func NewEncoder(name EncoderName, pin []byte) (Encoder, error) {
+	switch name {
+	case "", EncoderRFC:
+		return RFCEncoder{}, nil
+	case EncoderSteam:
+		return SteamEncoder{}, nil
+	case EncoderMOTP:
+		return MOTPEncoder{PIN: pin}, nil
+	default:
+		return nil, fmt.Errorf("unsupported encoder: %s", name)
+	}
+}
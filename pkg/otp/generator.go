@@ -0,0 +1,125 @@
+package otp
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Generator produces codes for a single credential. The decoded secret and
+// the HMAC key state are prepared once by NewGenerator, so repeated
+// generation (a watch loop, or a list of many accounts) only hashes the
+// moving factor. A Generator is safe for concurrent use.
+type Generator struct {
+	params  TOTPParams
+	key     *HMACKey
+	encoder Encoder
+	mac     MACEncoder
+}
+
+// NewGenerator prepares a Generator for params. params.Secret must hold the
+// decoded secret; params.Timestamp is ignored. A nil Encoder selects RFC
+// decimal codes.
+func NewGenerator(params TOTPParams) (*Generator, error) {
+	if params.Period <= 0 {
+		params.Period = 30
+	}
+	if params.Algorithm == "" {
+		params.Algorithm = SHA1
+	}
+	if params.Encoder == nil {
+		params.Encoder = RFCEncoder{}
+		if params.Digits == 0 {
+			params.Digits = 6
+		}
+	}
+
+	if _, ok := params.Encoder.(RFCEncoder); ok {
+		if err := ValidateDigits(EncoderRFC, params.Digits); err != nil {
+			return nil, err
+		}
+	}
+
+	g := &Generator{params: params, encoder: params.Encoder}
+	if mac, ok := params.Encoder.(MACEncoder); ok {
+		g.mac = mac
+		g.key = NewHMACKey(params.Secret, params.Algorithm)
+	}
+	return g, nil
+}
+
+// Destroy zeroes the generator's precomputed HMAC key. The secret in its
+// parameters belongs to the caller and is left as it is. The generator
+// must not be used afterwards.
+func (g *Generator) Destroy() {
+	if g.key != nil {
+		g.key.Destroy()
+	}
+}
+
+// Params returns the generator's parameters with Timestamp set to t, for
+// example to compute the remaining validity of a code.
+func (g *Generator) Params(t time.Time) TOTPParams {
+	p := g.params
+	p.Timestamp = t
+	return p
+}
+
+// Generate returns the TOTP code at time t.
+func (g *Generator) Generate(t time.Time) (string, error) {
+	step, err := g.Params(t).TimeStep()
+	if err != nil {
+		return "", err
+	}
+	return g.GenerateCounter(step)
+}
+
+// GenerateCounter returns the code for an HOTP counter or TOTP time step.
+func (g *Generator) GenerateCounter(counter uint64) (string, error) {
+	if g.mac != nil {
+		return g.mac.EncodeMAC(g.key.Sum(counterBytes(counter)), g.params.Digits)
+	}
+	return g.encoder.Encode(g.params.Secret, counter, g.params.Digits, g.params.Algorithm)
+}
+
+// Code is the result of generating one code in a batch.
+type Code struct {
+	Code string
+	Err  error
+}
+
+// GenerateAll generates the TOTP code at time t for every generator, spreading
+// the work across GOMAXPROCS goroutines. Results are in the order of
+// generators.
+func GenerateAll(generators []*Generator, t time.Time) []Code {
+	results := make([]Code, len(generators))
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(generators) {
+		workers = len(generators)
+	}
+	if workers <= 1 {
+		for i, g := range generators {
+			results[i].Code, results[i].Err = g.Generate(t)
+		}
+		return results
+	}
+
+	var wg sync.WaitGroup
+	chunk := (len(generators) + workers - 1) / workers
+	for start := 0; start < len(generators); start += chunk {
+		end := start + chunk
+		if end > len(generators) {
+			end = len(generators)
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				results[i].Code, results[i].Err = generators[i].Generate(t)
+			}
+		}(start, end)
+	}
+	wg.Wait()
+	return results
+}
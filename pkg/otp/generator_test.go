@@ -0,0 +1,173 @@
+package otp
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestHMACKey(t *testing.T) {
+	longKey := make([]byte, 200)
+	for i := range longKey {
+		longKey[i] = byte(i)
+	}
+
+	for _, algo := range []HashAlgorithm{SHA1, SHA256, SHA512} {
+		for _, key := range [][]byte{[]byte("short"), longKey} {
+			k := NewHMACKey(key, algo)
+			for _, msg := range []string{"", "msg", "a longer message spanning more than one block of input data......................"} {
+				if !bytes.Equal(k.Sum([]byte(msg)), HMAC(key, []byte(msg), algo)) {
+					t.Errorf("HMACKey(%s, %d-byte key).Sum(%q) differs from HMAC", algo, len(key), msg)
+				}
+			}
+		}
+	}
+}
+
+func TestHMACKey_Destroy(t *testing.T) {
+	for _, algo := range []HashAlgorithm{SHA1, SHA256, SHA512} {
+		k := NewHMACKey([]byte("12345678901234567890"), algo)
+		ipad, opad, inner, outer := k.ipad, k.opad, k.inner, k.outer
+		k.Destroy()
+		for _, b := range [][]byte{ipad, opad, inner, outer} {
+			if len(b) == 0 || !bytes.Equal(b, make([]byte, len(b))) {
+				t.Errorf("%s: Destroy left %d bytes of key material", algo, len(b))
+			}
+		}
+		if k.ipad != nil || k.opad != nil || k.inner != nil || k.outer != nil {
+			t.Errorf("%s: Destroy kept references to the key material", algo)
+		}
+	}
+
+	gen, err := NewGenerator(TOTPParams{Secret: []byte("12345678901234567890")})
+	if err != nil {
+		t.Fatalf("NewGenerator failed: %v", err)
+	}
+	ipad := gen.key.ipad
+	gen.Destroy()
+	if !bytes.Equal(ipad, make([]byte, len(ipad))) {
+		t.Error("Generator.Destroy did not zero its HMAC key")
+	}
+	// A generator without an HMAC key, such as for mOTP, can be destroyed.
+	gen, _ = NewGenerator(TOTPParams{Secret: []byte("1234"), Encoder: MOTPEncoder{PIN: []byte("1234")}})
+	gen.Destroy()
+}
+
+func TestGenerator(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	times := []int64{59, 1111111109, 1234567890, 2000000000}
+
+	for _, enc := range []Encoder{nil, SteamEncoder{}, MOTPEncoder{PIN: []byte("1234")}} {
+		params := TOTPParams{Secret: secret, Digits: 8, Algorithm: SHA1, Encoder: enc}
+		if enc != nil {
+			params.Digits = 0
+		}
+		gen, err := NewGenerator(params)
+		if err != nil {
+			t.Fatalf("NewGenerator(%T) failed: %v", enc, err)
+		}
+		for _, ts := range times {
+			p := params
+			p.Timestamp = time.Unix(ts, 0)
+			want, _ := GenerateTOTP(p)
+			got, err := gen.Generate(p.Timestamp)
+			if err != nil || got != want {
+				t.Errorf("Generator(%T).Generate(%d) = %q, %v; want %q", enc, ts, got, err, want)
+			}
+		}
+	}
+
+	if _, err := NewGenerator(TOTPParams{Secret: secret, Digits: 11}); err == nil {
+		t.Error("Expected error for 11 digits")
+	}
+}
+
+func TestGenerateAll(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	generators := make([]*Generator, 100)
+	want := make([]string, len(generators))
+	for i := range generators {
+		params := TOTPParams{Secret: []byte(fmt.Sprintf("secret-%d", i)), Timestamp: now}
+		generators[i], _ = NewGenerator(params)
+		want[i], _ = GenerateTOTP(params)
+	}
+
+	for i, res := range GenerateAll(generators, now) {
+		if res.Err != nil || res.Code != want[i] {
+			t.Errorf("GenerateAll()[%d] = %q, %v; want %q", i, res.Code, res.Err, want[i])
+		}
+	}
+
+	if res := GenerateAll(nil, now); len(res) != 0 {
+		t.Errorf("GenerateAll(nil) returned %d results", len(res))
+	}
+}
+
+func BenchmarkHMAC(b *testing.B) {
+	key := []byte("12345678901234567890")
+	msg := counterBytes(1)
+	for i := 0; i < b.N; i++ {
+		HMAC(key, msg, SHA1)
+	}
+}
+
+func BenchmarkHMACKey(b *testing.B) {
+	k := NewHMACKey([]byte("12345678901234567890"), SHA1)
+	msg := counterBytes(1)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		k.Sum(msg)
+	}
+}
+
+// benchAccounts is the size of the batch benchmarks, matching a large shared vault.
+const benchAccounts = 2000
+
+func benchParams() []TOTPParams {
+	params := make([]TOTPParams, benchAccounts)
+	for i := range params {
+		params[i] = TOTPParams{Secret: []byte(fmt.Sprintf("account-secret-%04d", i)), Digits: 6, Algorithm: SHA1}
+	}
+	return params
+}
+
+func BenchmarkGenerateTOTP_Batch(b *testing.B) {
+	params := benchParams()
+	now := time.Now()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, p := range params {
+			p.Timestamp = now
+			GenerateTOTP(p)
+		}
+	}
+}
+
+func BenchmarkGenerator_Batch(b *testing.B) {
+	params := benchParams()
+	generators := make([]*Generator, len(params))
+	for i, p := range params {
+		generators[i], _ = NewGenerator(p)
+	}
+	now := time.Now()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, g := range generators {
+			g.Generate(now)
+		}
+	}
+}
+
+func BenchmarkGenerateAll(b *testing.B) {
+	params := benchParams()
+	generators := make([]*Generator, len(params))
+	for i, p := range params {
+		generators[i], _ = NewGenerator(p)
+	}
+	now := time.Now()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		GenerateAll(generators, now)
+	}
+}
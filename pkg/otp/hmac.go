@@ -0,0 +1,169 @@
+// Package otp provides a core engine for generating and verifying
+// Time-based One-Time Passwords (TOTP) as specified in RFC 6238 and
+// HMAC-based One-Time Passwords (HOTP) as specified in RFC 4226.
+//
+// Servers can use a Verifier to check submitted codes with asymmetric
+// clock-drift windows and replay protection backed by a CounterStore.
+package otp
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding"
+	"hash"
+)
+
+// HashAlgorithm represents the supported cryptographic hash algorithms
+// for HMAC-based OTP generation.
+type HashAlgorithm string
+
+const (
+	// SHA1 is the default hash algorithm used by most TOTP implementations (RFC 4226).
+	SHA1 HashAlgorithm = "SHA1"
+	// SHA256 provides enhanced security over SHA1 (RFC 6238).
+	SHA256 HashAlgorithm = "SHA256"
+	// SHA512 provides maximum security for TOTP generation (RFC 6238).
+	SHA512 HashAlgorithm = "SHA512"
+)
+
+// HMAC implements the HMAC keyed-hash message authentication code algorithm
+// as defined in RFC 2104. This implementation is dependency-free and
+// specifically designed for OTP generation.
+//
+// HMAC(K, m) = H((K ^ opad) || H((K ^ ipad) || m))
+//
+// HMAC derives the padded key on every call. Use an HMACKey to compute many
+// MACs with the same key.
+func HMAC(key []byte, message []byte, algo HashAlgorithm) []byte {
+	h, blockSize := hashFunc(algo)
+	ipad, opad := pads(h, blockSize, key)
+	defer clear(ipad)
+	defer clear(opad)
+
+	// Inner hash: H((K ^ ipad) || m)
+	innerHasher := h()
+	innerHasher.Write(ipad)
+	innerHasher.Write(message)
+	innerHash := innerHasher.Sum(nil)
+
+	// Outer hash: H((K ^ opad) || innerHash)
+	outerHasher := h()
+	outerHasher.Write(opad)
+	outerHasher.Write(innerHash)
+	return outerHasher.Sum(nil)
+}
+
+// HMACKey is an HMAC key with its padding precomputed. The hash states after
+// absorbing K ^ ipad and K ^ opad are cached, so each Sum only hashes the
+// message and the inner digest. An HMACKey is safe for concurrent use until
+// it is destroyed.
+type HMACKey struct {
+	newHash    func() hash.Hash
+	ipad, opad []byte
+	// inner and outer are the marshaled hash states after writing ipad and
+	// opad, or nil if the hash does not support state marshaling.
+	inner, outer []byte
+}
+
+// NewHMACKey precomputes the HMAC state for key and algo.
+func NewHMACKey(key []byte, algo HashAlgorithm) *HMACKey {
+	h, blockSize := hashFunc(algo)
+	ipad, opad := pads(h, blockSize, key)
+	return &HMACKey{
+		newHash: h,
+		ipad:    ipad,
+		opad:    opad,
+		inner:   absorbed(h, ipad),
+		outer:   absorbed(h, opad),
+	}
+}
+
+// Sum returns the HMAC of message.
+func (k *HMACKey) Sum(message []byte) []byte {
+	inner := k.restore(k.inner, k.ipad)
+	inner.Write(message)
+	outer := k.restore(k.outer, k.opad)
+	outer.Write(inner.Sum(nil))
+	return outer.Sum(nil)
+}
+
+// Destroy zeroes the padded key and the cached hash states. The key must
+// not be used afterwards.
+func (k *HMACKey) Destroy() {
+	for _, b := range [][]byte{k.ipad, k.opad, k.inner, k.outer} {
+		clear(b)
+	}
+	k.ipad, k.opad, k.inner, k.outer = nil, nil, nil, nil
+}
+
+// restore returns a hash that has absorbed pad, loading the cached state
+// when one is available.
+func (k *HMACKey) restore(state, pad []byte) hash.Hash {
+	h := k.newHash()
+	if state != nil {
+		if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err == nil {
+			return h
+		}
+		h.Reset()
+	}
+	h.Write(pad)
+	return h
+}
+
+// absorbed returns the marshaled state of a hash after writing pad, or nil if
+// the hash cannot be marshaled.
+func absorbed(h func() hash.Hash, pad []byte) []byte {
+	hasher := h()
+	hasher.Write(pad)
+	m, ok := hasher.(encoding.BinaryMarshaler)
+	if !ok {
+		return nil
+	}
+	state, err := m.MarshalBinary()
+	if err != nil {
+		return nil
+	}
+	return state
+}
+
+// hashFunc returns the hash constructor and block size for algo.
+func hashFunc(algo HashAlgorithm) (func() hash.Hash, int) {
+	switch algo {
+	case SHA256:
+		return sha256.New, 64
+	case SHA512:
+		return sha512.New, 128
+	default: // Default to SHA1
+		return sha1.New, 64
+	}
+}
+
+// pads returns K ^ ipad and K ^ opad for key, hashing or zero-padding the key
+// to the block size first.
+func pads(h func() hash.Hash, blockSize int, key []byte) ([]byte, []byte) {
+	// If key is longer than blockSize, hash it first according to RFC 2104.
+	if len(key) > blockSize {
+		hasher := h()
+		hasher.Write(key)
+		key = hasher.Sum(nil)
+		defer clear(key)
+	}
+
+	// If key is shorter than blockSize, pad it with zeros.
+	if len(key) < blockSize {
+		paddedKey := make([]byte, blockSize)
+		copy(paddedKey, key)
+		defer clear(paddedKey)
+		key = paddedKey
+	}
+
+	// ipad and opad are the inner and outer padding constants.
+	ipad := make([]byte, blockSize)
+	opad := make([]byte, blockSize)
+	for i := range key {
+		ipad[i] = key[i] ^ 0x36
+		opad[i] = key[i] ^ 0x5c
+	}
+	return ipad, opad
+}
@@ -0,0 +1,89 @@
+package otp
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+)
+
+// MinDigits and MaxDigits bound the length of decimal codes. The dynamic
+// truncation yields a 31-bit value (at most 2147483647), so codes longer than
+// 10 digits would only add leading zeros.
+const (
+	MinDigits = 1
+	MaxDigits = 10
+)
+
+// DefaultResyncWindow is the number of counter values searched ahead of the
+// stored counter when resynchronizing an HOTP counter.
+const DefaultResyncWindow = 100
+
+// GenerateHOTP generates a HMAC-based One-Time Password (HOTP) as defined in RFC 4226.
+// It takes a secret key, a counter value, the number of digits for the OTP, and
+// the hash algorithm to use for HMAC.
+//
+// The function follows the dynamic truncation algorithm to extract a 31-bit
+// integer from the HMAC result and then applies modulo 10^digits to get the OTP.
+func GenerateHOTP(secret []byte, counter uint64, digits int, algo HashAlgorithm) (string, error) {
+	if digits < MinDigits || digits > MaxDigits {
+		return "", fmt.Errorf("digits must be between %d and %d", MinDigits, MaxDigits)
+	}
+
+	// 1. Generate HMAC-SHA-1 (or SHA-256/512) result HS.
+	hs := HMAC(secret, counterBytes(counter), algo)
+
+	// 2. Dynamic truncation and 3. reduction modulo 10^digits.
+	return RFCEncoder{}.EncodeMAC(hs, digits)
+}
+
+// DynamicTruncate implements the dynamic truncation (DT) step of RFC 4226
+// section 5.3, extracting a 31-bit integer from an HMAC result. Encoders
+// other than the decimal one build on this value.
+func DynamicTruncate(hs []byte) uint32 {
+	// Extract the low-order 4 bits of the last byte of HS to use as an offset.
+	offset := hs[len(hs)-1] & 0x0f
+
+	// Extract a 4-byte sequence starting at HS[offset].
+	p := hs[offset : offset+4]
+
+	// Convert p to a 31-bit integer by ignoring the most significant bit (0x7fffffff).
+	return binary.BigEndian.Uint32(p) & 0x7fffffff
+}
+
+// counterBytes converts the counter to an 8-byte big-endian integer.
+func counterBytes(counter uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, counter)
+	return b
+}
+
+// ResyncHOTP searches the counter values [counter, counter+window) for two
+// consecutive codes matching code1 and code2, as recommended by RFC 4226
+// section 7.4. On success it returns the counter value to use for the next
+// code, i.e. the matched counter plus two.
+func ResyncHOTP(secret []byte, counter uint64, window int, digits int, algo HashAlgorithm, code1, code2 string) (uint64, bool, error) {
+	if window <= 0 {
+		window = DefaultResyncWindow
+	}
+
+	for i := 0; i < window; i++ {
+		c := counter + uint64(i)
+		first, err := GenerateHOTP(secret, c, digits, algo)
+		if err != nil {
+			return 0, false, err
+		}
+		if subtle.ConstantTimeCompare([]byte(first), []byte(code1)) != 1 {
+			continue
+		}
+
+		second, err := GenerateHOTP(secret, c+1, digits, algo)
+		if err != nil {
+			return 0, false, err
+		}
+		if subtle.ConstantTimeCompare([]byte(second), []byte(code2)) == 1 {
+			return c + 2, true, nil
+		}
+	}
+
+	return 0, false, nil
+}
@@ -0,0 +1,384 @@
+package otp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTOTP_RFC6238(t *testing.T) {
+	seed1 := []byte("12345678901234567890")
+	seed256 := []byte("12345678901234567890123456789012")
+	seed512 := []byte("1234567890123456789012345678901234567890123456789012345678901234")
+
+	testCases := []struct {
+		time   int64
+		sha1   string
+		sha256 string
+		sha512 string
+	}{
+		{59, "94287082", "46119246", "90693936"},
+		{1111111109, "07081804", "68084774", "25091201"},
+		{1111111111, "14050471", "67062674", "99943326"},
+		{1234567890, "89005924", "91819424", "93441116"},
+		{2000000000, "69279037", "90698825", "38618901"},
+	}
+
+	for _, tc := range testCases {
+		ts := time.Unix(tc.time, 0)
+
+		// Test SHA1
+		sha1, _ := GenerateTOTP(TOTPParams{
+			Secret:    seed1,
+			Timestamp: ts,
+			Period:    30,
+			Digits:    8,
+			Algorithm: SHA1,
+		})
+		if sha1 != tc.sha1 {
+			t.Errorf("At time %d, SHA1 expected %s, got %s", tc.time, tc.sha1, sha1)
+		}
+
+		// Test SHA256
+		sha256, _ := GenerateTOTP(TOTPParams{
+			Secret:    seed256,
+			Timestamp: ts,
+			Period:    30,
+			Digits:    8,
+			Algorithm: SHA256,
+		})
+		if sha256 != tc.sha256 {
+			t.Errorf("At time %d, SHA256 expected %s, got %s", tc.time, tc.sha256, sha256)
+		}
+
+		// Test SHA512
+		sha512, _ := GenerateTOTP(TOTPParams{
+			Secret:    seed512,
+			Timestamp: ts,
+			Period:    30,
+			Digits:    8,
+			Algorithm: SHA512,
+		})
+		if sha512 != tc.sha512 {
+			t.Errorf("At time %d, SHA512 expected %s, got %s", tc.time, tc.sha512, sha512)
+		}
+	}
+}
+
+func TestTOTP_Validation(t *testing.T) {
+	seed := []byte("JBSWY3DPEHPK3PXP")
+	ts := time.Unix(1234567890, 0)
+	params := TOTPParams{
+		Secret:    seed,
+		Timestamp: ts,
+		Period:    30,
+		Digits:    6,
+		Algorithm: SHA1,
+	}
+
+	code, _ := GenerateTOTP(params)
+
+	// Exact match
+	valid, _ := ValidateTOTP(code, params, 1)
+	if !valid {
+		t.Error("Expected code to be valid (exact match)")
+	}
+
+	// Within window (one period back)
+	paramsPast := params
+	paramsPast.Timestamp = ts.Add(30 * time.Second)
+	valid, _ = ValidateTOTP(code, paramsPast, 1)
+	if !valid {
+		t.Error("Expected code to be valid (within window -1)")
+	}
+
+	// Outside window
+	valid, _ = ValidateTOTP(code, paramsPast, 0)
+	if valid {
+		t.Error("Expected code to be invalid (outside window)")
+	}
+}
+
+func TestNextExpiration(t *testing.T) {
+	ts := time.Unix(30, 0)
+	next := NextExpiration(ts, 30)
+	if next.Unix() != 60 {
+		t.Errorf("Expected next expiration at 60, got %d", next.Unix())
+	}
+}
+
+func TestHOTP_RFC4226(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	expected := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+
+	for counter, want := range expected {
+		got, err := GenerateHOTP(secret, uint64(counter), 6, SHA1)
+		if err != nil {
+			t.Fatalf("GenerateHOTP(%d) failed: %v", counter, err)
+		}
+		if got != want {
+			t.Errorf("Counter %d: expected %s, got %s", counter, want, got)
+		}
+	}
+}
+
+func TestResyncHOTP(t *testing.T) {
+	secret := []byte("12345678901234567890")
+
+	// Token is at counter 5 and 6 while the vault still believes 1.
+	next, ok, err := ResyncHOTP(secret, 1, 10, 6, SHA1, "254676", "287922")
+	if err != nil {
+		t.Fatalf("ResyncHOTP failed: %v", err)
+	}
+	if !ok || next != 7 {
+		t.Errorf("Expected resync to counter 7, got %d (ok=%v)", next, ok)
+	}
+
+	// Codes out of order must not match.
+	if _, ok, _ := ResyncHOTP(secret, 1, 10, 6, SHA1, "287922", "254676"); ok {
+		t.Error("Expected non-consecutive codes to fail resync")
+	}
+
+	// Codes beyond the window must not match.
+	if _, ok, _ := ResyncHOTP(secret, 0, 3, 6, SHA1, "254676", "287922"); ok {
+		t.Error("Expected codes outside the window to fail resync")
+	}
+}
+
+func TestSteamEncoder(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	testCases := []struct {
+		time int64
+		code string
+	}{
+		{59, "PV9M4"},
+		{1111111109, "PY4YB"},
+		{2000000000, "9N776"},
+	}
+
+	for _, tc := range testCases {
+		code, err := GenerateTOTP(TOTPParams{
+			Secret:    secret,
+			Timestamp: time.Unix(tc.time, 0),
+			Encoder:   SteamEncoder{},
+		})
+		if err != nil {
+			t.Fatalf("GenerateTOTP with Steam encoder failed: %v", err)
+		}
+		if code != tc.code {
+			t.Errorf("At time %d, Steam expected %s, got %s", tc.time, tc.code, code)
+		}
+	}
+}
+
+func TestMOTPEncoder(t *testing.T) {
+	secret := []byte{0xe3, 0x15, 0x2a, 0xfe, 0xe6, 0x25, 0x99, 0xc8}
+	code, err := GenerateTOTP(TOTPParams{
+		Secret:    secret,
+		Timestamp: time.Unix(1234567890, 0),
+		Period:    10,
+		Encoder:   MOTPEncoder{PIN: []byte("1234")},
+	})
+	if err != nil {
+		t.Fatalf("GenerateTOTP with mOTP encoder failed: %v", err)
+	}
+	if code != "49c5b4" {
+		t.Errorf("mOTP expected 49c5b4, got %s", code)
+	}
+
+	if _, err := (MOTPEncoder{}).Encode(secret, 1, 6, ""); err == nil {
+		t.Error("Expected error for mOTP without PIN")
+	}
+}
+
+func TestNewEncoder(t *testing.T) {
+	for _, name := range []EncoderName{"", EncoderRFC, EncoderSteam, EncoderMOTP} {
+		if _, err := NewEncoder(name, nil); err != nil {
+			t.Errorf("NewEncoder(%q) failed: %v", name, err)
+		}
+	}
+	if _, err := NewEncoder("yandex", nil); err == nil {
+		t.Error("Expected error for unsupported encoder")
+	}
+}
+
+func TestTOTP_T0AndTimeOffset(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	base := TOTPParams{Secret: secret, Period: 30, Digits: 8, Algorithm: SHA1}
+
+	// RFC 6238 vector for T = 59 reached through T0 and through TimeOffset.
+	p := base
+	p.Timestamp = time.Unix(1059, 0)
+	p.T0 = 1000
+	if code, _ := GenerateTOTP(p); code != "94287082" {
+		t.Errorf("GenerateTOTP with T0 = %s, want 94287082", code)
+	}
+
+	p = base
+	p.Timestamp = time.Unix(1059, 0)
+	p.TimeOffset = -1000
+	if code, _ := GenerateTOTP(p); code != "94287082" {
+		t.Errorf("GenerateTOTP with TimeOffset = %s, want 94287082", code)
+	}
+	if r := p.RemainingSeconds(); r != 1 {
+		t.Errorf("RemainingSeconds with TimeOffset = %d, want 1", r)
+	}
+
+	p = base
+	p.Timestamp = time.Unix(10, 0)
+	p.T0 = 100
+	if _, err := GenerateTOTP(p); err == nil {
+		t.Error("Expected error for timestamp before T0")
+	}
+}
+
+func TestTOTP_ValidityWindow(t *testing.T) {
+	p := TOTPParams{Timestamp: time.Unix(1000, 0), Period: 30}
+	from, until := p.ValidityWindow()
+	if from.Unix() != 990 || until.Unix() != 1020 {
+		t.Errorf("ValidityWindow = [%d, %d), want [990, 1020)", from.Unix(), until.Unix())
+	}
+
+	// A clock 15 seconds behind the service shifts the window earlier.
+	p.TimeOffset = 15
+	from, until = p.ValidityWindow()
+	if from.Unix() != 975 || until.Unix() != 1005 {
+		t.Errorf("ValidityWindow with offset = [%d, %d), want [975, 1005)", from.Unix(), until.Unix())
+	}
+}
+
+func TestCalibrateTOTP(t *testing.T) {
+	params := TOTPParams{
+		Secret:    []byte("12345678901234567890"),
+		Timestamp: time.Unix(179, 0),
+		Period:    30,
+		Digits:    8,
+		Algorithm: SHA1,
+	}
+
+	// The observed code belongs to T = 59, four steps behind the local clock.
+	offset, ok, err := CalibrateTOTP("94287082", params, DefaultCalibrationWindow)
+	if err != nil || !ok {
+		t.Fatalf("CalibrateTOTP failed: ok=%v err=%v", ok, err)
+	}
+	if offset != -120 {
+		t.Errorf("CalibrateTOTP offset = %d, want -120", offset)
+	}
+
+	// Recalibrating from the stored offset finds no further drift.
+	params.TimeOffset = offset
+	if offset, ok, _ = CalibrateTOTP("94287082", params, 0); !ok || offset != -120 {
+		t.Errorf("Recalibration = %d (ok=%v), want -120", offset, ok)
+	}
+
+	params.TimeOffset = 0
+	if _, ok, _ := CalibrateTOTP("94287082", params, 3); ok {
+		t.Error("Expected no match outside the window")
+	}
+}
+
+func TestHOTP_ErrorCases(t *testing.T) {
+	_, err := GenerateHOTP([]byte("secret"), 1, 0, SHA1)
+	if err == nil {
+		t.Error("Expected error for digits < 1")
+	}
+	_, err = GenerateHOTP([]byte("secret"), 1, 11, SHA1)
+	if err == nil {
+		t.Error("Expected error for digits > 10")
+	}
+}
+
+func TestHOTP_DigitRange(t *testing.T) {
+	// The RFC 4226 truncated value for counter 0 is 1284755224.
+	secret := []byte("12345678901234567890")
+	for digits, want := range map[int]string{
+		1:  "4",
+		4:  "5224",
+		5:  "55224",
+		9:  "284755224",
+		10: "1284755224",
+	} {
+		got, err := GenerateHOTP(secret, 0, digits, SHA1)
+		if err != nil || got != want {
+			t.Errorf("GenerateHOTP(digits=%d) = %q, %v; want %q", digits, got, err, want)
+		}
+	}
+}
+
+func TestValidateDigits(t *testing.T) {
+	tests := []struct {
+		encoder EncoderName
+		digits  int
+		valid   bool
+	}{
+		{EncoderRFC, 4, true},
+		{EncoderRFC, 10, true},
+		{EncoderRFC, 0, false},
+		{EncoderRFC, 11, false},
+		{"", 6, true},
+		{EncoderSteam, 5, true},
+		{EncoderSteam, 11, false},
+		{EncoderMOTP, 32, true},
+		{EncoderMOTP, 33, false},
+	}
+	for _, tt := range tests {
+		if err := ValidateDigits(tt.encoder, tt.digits); (err == nil) != tt.valid {
+			t.Errorf("ValidateDigits(%q, %d) = %v, want valid=%v", tt.encoder, tt.digits, err, tt.valid)
+		}
+	}
+}
+
+func TestHMAC_KeyPadding(t *testing.T) {
+	// Test key longer than block size (64 for SHA1)
+	longKey := make([]byte, 100)
+	for i := range longKey {
+		longKey[i] = byte(i)
+	}
+	res1 := HMAC(longKey, []byte("msg"), SHA1)
+	if len(res1) != 20 {
+		t.Error("HMAC-SHA1 should return 20 bytes")
+	}
+
+	// Test key shorter than block size
+	shortKey := []byte("short")
+	res2 := HMAC(shortKey, []byte("msg"), SHA1)
+	if len(res2) != 20 {
+		t.Error("HMAC-SHA1 should return 20 bytes")
+	}
+
+	// Test SHA512 (block size 128)
+	res3 := HMAC(longKey, []byte("msg"), SHA512)
+	if len(res3) != 64 {
+		t.Error("HMAC-SHA512 should return 64 bytes")
+	}
+}
+
+func TestTOTP_DefaultValues(t *testing.T) {
+	// Test that default values are applied
+	code, err := GenerateTOTP(TOTPParams{
+		Secret:    []byte("JBSWY3DPEHPK3PXP"),
+		Timestamp: time.Unix(1234567890, 0),
+	})
+	if err != nil {
+		t.Fatalf("GenerateTOTP failed: %v", err)
+	}
+	if len(code) != 6 {
+		t.Errorf("Expected 6 digits, got %d", len(code))
+	}
+}
+
+func TestTOTP_ValidationWindow(t *testing.T) {
+	params := TOTPParams{
+		Secret:    []byte("JBSWY3DPEHPK3PXP"),
+		Timestamp: time.Unix(1234567890, 0),
+	}
+	code, _ := GenerateTOTP(params)
+
+	// Test with window = 0
+	valid, _ := ValidateTOTP(code, params, 0)
+	if !valid {
+		t.Error("Expected code to be valid with window 0")
+	}
+}
@@ -0,0 +1,47 @@
+package otp
+
+import "sync"
+
+// CounterStore records the last consumed time step (or HOTP counter) for each
+// credential, so a Verifier can reject codes that have already been used.
+// Implementations backed by a database should make Consume atomic, for
+// example with a conditional update.
+type CounterStore interface {
+	// LastUsed returns the last consumed counter for id, and false if none
+	// has been recorded.
+	LastUsed(id string) (uint64, bool, error)
+	// Consume records counter as used for id. It returns false, and records
+	// nothing, if counter is not greater than the last consumed value.
+	Consume(id string, counter uint64) (bool, error)
+}
+
+// MemoryStore is an in-memory CounterStore, safe for concurrent use. Its
+// state is lost when the process exits.
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]uint64
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: make(map[string]uint64)}
+}
+
+// LastUsed implements CounterStore.
+func (s *MemoryStore) LastUsed(id string) (uint64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counter, ok := s.counters[id]
+	return counter, ok, nil
+}
+
+// Consume implements CounterStore.
+func (s *MemoryStore) Consume(id string, counter uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if last, ok := s.counters[id]; ok && counter <= last {
+		return false, nil
+	}
+	s.counters[id] = counter
+	return true, nil
+}
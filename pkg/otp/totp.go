@@ -0,0 +1,180 @@
+package otp
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"time"
+)
+
+// DefaultCalibrationWindow is the number of time steps searched on either
+// side of the local clock when calibrating an account's time offset.
+const DefaultCalibrationWindow = 20
+
+// TOTPParams holds the configuration parameters for generating or
+// validating a Time-based One-Time Password (TOTP).
+type TOTPParams struct {
+	// Secret is the Base32-decoded secret key.
+	Secret []byte
+	// Timestamp is the time for which the OTP is generated (usually time.Now()).
+	Timestamp time.Time
+	// Period is the time step in seconds (usually 30 or 60).
+	Period int
+	// Digits is the number of digits in the generated code (1 to 10, usually 6 or 8).
+	Digits int
+	// Algorithm is the hash function to use (SHA1, SHA256, or SHA512).
+	Algorithm HashAlgorithm
+	// Encoder renders the code for a time step. Nil selects RFC decimal codes.
+	Encoder Encoder
+	// T0 is the Unix time from which time steps are counted (usually 0).
+	T0 int64
+	// TimeOffset is added to Timestamp, in seconds, to correct for a local
+	// clock that is ahead of or behind the service.
+	TimeOffset int64
+}
+
+// elapsed returns the number of seconds between T0 and the corrected timestamp.
+func (p TOTPParams) elapsed() int64 {
+	return p.Timestamp.Unix() + p.TimeOffset - p.T0
+}
+
+// TimeStep returns the time step counter T = (Timestamp + TimeOffset - T0) / Period.
+func (p TOTPParams) TimeStep() (uint64, error) {
+	if p.Period <= 0 {
+		p.Period = 30
+	}
+	elapsed := p.elapsed()
+	if elapsed < 0 {
+		return 0, fmt.Errorf("timestamp is before T0")
+	}
+	return uint64(elapsed / int64(p.Period)), nil
+}
+
+// RemainingSeconds returns the number of seconds remaining until the code
+// for these parameters expires, taking T0 and TimeOffset into account.
+func (p TOTPParams) RemainingSeconds() int {
+	if p.Period <= 0 {
+		p.Period = 30
+	}
+	elapsed := p.elapsed() % int64(p.Period)
+	if elapsed < 0 {
+		elapsed += int64(p.Period)
+	}
+	return p.Period - int(elapsed)
+}
+
+// ValidityWindow returns the interval [from, until) of local clock time during
+// which the code for Timestamp is generated, taking T0 and TimeOffset into
+// account.
+func (p TOTPParams) ValidityWindow() (time.Time, time.Time) {
+	if p.Period <= 0 {
+		p.Period = 30
+	}
+	until := p.Timestamp.Truncate(time.Second).Add(time.Duration(p.RemainingSeconds()) * time.Second)
+	return until.Add(-time.Duration(p.Period) * time.Second), until
+}
+
+// GenerateTOTP generates a Time-based One-Time Password (TOTP) as defined in RFC 6238.
+// It calculates the time step counter based on the provided timestamp and period,
+// then calls the configured Encoder (GenerateHOTP by default) to produce the code.
+func GenerateTOTP(params TOTPParams) (string, error) {
+	// Apply default values if not specified.
+	if params.Period <= 0 {
+		params.Period = 30
+	}
+	if params.Algorithm == "" {
+		params.Algorithm = SHA1
+	}
+
+	// T = (Current Unix Time - T0) / X
+	// T0 is usually 0 (Unix epoch). X is the time step (Period).
+	counter, err := params.TimeStep()
+	if err != nil {
+		return "", err
+	}
+
+	return params.codeAt(counter)
+}
+
+// codeAt renders the code for time step counter with the configured encoder.
+func (p TOTPParams) codeAt(counter uint64) (string, error) {
+	if p.Algorithm == "" {
+		p.Algorithm = SHA1
+	}
+	if p.Encoder != nil {
+		return p.Encoder.Encode(p.Secret, counter, p.Digits, p.Algorithm)
+	}
+
+	if p.Digits == 0 {
+		p.Digits = 6
+	}
+	return GenerateHOTP(p.Secret, counter, p.Digits, p.Algorithm)
+}
+
+// ValidateTOTP validates a TOTP code with a given time window tolerance.
+// A window of 1 allows for the current, previous, and next time steps to be valid,
+// helping to account for clock drift between the client and server.
+// Use a Verifier to learn which step matched or to reject replayed codes.
+func ValidateTOTP(code string, params TOTPParams, window int) (bool, error) {
+	v := Verifier{
+		Period:    params.Period,
+		Digits:    params.Digits,
+		Algorithm: params.Algorithm,
+		Encoder:   params.Encoder,
+		T0:        params.T0 - params.TimeOffset,
+		Past:      window,
+		Future:    window,
+	}
+
+	_, err := v.Verify("", params.Secret, code, params.Timestamp)
+	switch err {
+	case nil:
+		return true, nil
+	case ErrInvalidCode:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// CalibrateTOTP searches up to window time steps on either side of the
+// parameters' corrected time for a step that produces code. Steps closest to
+// the current offset are tried first. On a match it returns the new total
+// TimeOffset in seconds, a whole number of periods from params.TimeOffset.
+func CalibrateTOTP(code string, params TOTPParams, window int) (int64, bool, error) {
+	if params.Period <= 0 {
+		params.Period = 30
+	}
+
+	for _, i := range searchOrder(window, window) {
+		p := params
+		p.TimeOffset = params.TimeOffset + int64(i*params.Period)
+
+		generated, err := GenerateTOTP(p)
+		if err != nil {
+			return 0, false, err
+		}
+		if subtle.ConstantTimeCompare([]byte(generated), []byte(code)) == 1 {
+			return p.TimeOffset, true, nil
+		}
+	}
+
+	return 0, false, nil
+}
+
+// RemainingSeconds returns the number of seconds remaining until the
+// TOTP code generated for the given timestamp expires.
+func RemainingSeconds(timestamp time.Time, period int) int {
+	if period <= 0 {
+		period = 30
+	}
+	return period - int(timestamp.Unix()%int64(period))
+}
+
+// NextExpiration returns the absolute time when the current TOTP period will end.
+func NextExpiration(timestamp time.Time, period int) time.Time {
+	if period <= 0 {
+		period = 30
+	}
+	remaining := RemainingSeconds(timestamp, period)
+	return timestamp.Truncate(time.Second).Add(time.Duration(remaining) * time.Second)
+}
@@ -0,0 +1,112 @@
+package otp
+
+import (
+	"crypto/subtle"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrInvalidCode is returned when a code does not match any time step in
+	// the verifier's window.
+	ErrInvalidCode = errors.New("invalid code")
+	// ErrReplayedCode is returned when a code matches a time step that is not
+	// newer than the last step consumed for the same credential.
+	ErrReplayedCode = errors.New("code already used")
+)
+
+// Verifier checks submitted TOTP codes on the server side. A single Verifier
+// is typically shared by all credentials with the same parameters; the
+// secret and a credential ID are passed to each Verify call.
+type Verifier struct {
+	// Period is the time step in seconds (default 30).
+	Period int
+	// Digits is the code length (default 6 for RFC codes).
+	Digits int
+	// Algorithm is the HMAC hash function (default SHA1).
+	Algorithm HashAlgorithm
+	// Encoder renders the code for a time step. Nil selects RFC decimal codes.
+	Encoder Encoder
+	// T0 is the Unix time from which time steps are counted (usually 0).
+	T0 int64
+	// Past is the number of time steps behind the server clock to accept.
+	Past int
+	// Future is the number of time steps ahead of the server clock to accept.
+	Future int
+	// Store records consumed time steps. Nil disables replay protection.
+	Store CounterStore
+}
+
+// Match describes a successfully verified code.
+type Match struct {
+	// Step is the time step counter that produced the code.
+	Step uint64
+	// Offset is Step relative to the server's current step. A negative offset
+	// means the client's clock is behind the server's.
+	Offset int
+}
+
+// Verify checks code against the time steps around t for the credential id.
+// Steps closest to t are tried first. When a Store is configured, the matched
+// step is consumed and any code for the same or an earlier step is rejected
+// afterwards with ErrReplayedCode.
+func (v *Verifier) Verify(id string, secret []byte, code string, t time.Time) (Match, error) {
+	params := TOTPParams{
+		Secret:    secret,
+		Timestamp: t,
+		Period:    v.Period,
+		Digits:    v.Digits,
+		Algorithm: v.Algorithm,
+		Encoder:   v.Encoder,
+		T0:        v.T0,
+	}
+	current, err := params.TimeStep()
+	if err != nil {
+		return Match{}, err
+	}
+
+	for _, offset := range searchOrder(v.Past, v.Future) {
+		if offset < 0 && uint64(-offset) > current {
+			continue
+		}
+		step := uint64(int64(current) + int64(offset))
+
+		generated, err := params.codeAt(step)
+		if err != nil {
+			return Match{}, err
+		}
+
+		// Use constant-time comparison to prevent timing attacks.
+		if subtle.ConstantTimeCompare([]byte(generated), []byte(code)) != 1 {
+			continue
+		}
+
+		if v.Store != nil {
+			ok, err := v.Store.Consume(id, step)
+			if err != nil {
+				return Match{}, err
+			}
+			if !ok {
+				return Match{}, ErrReplayedCode
+			}
+		}
+		return Match{Step: step, Offset: offset}, nil
+	}
+
+	return Match{}, ErrInvalidCode
+}
+
+// searchOrder returns the step offsets from -past to +future ordered by
+// distance from zero, preferring the past on ties.
+func searchOrder(past, future int) []int {
+	offsets := []int{0}
+	for d := 1; d <= past || d <= future; d++ {
+		if d <= past {
+			offsets = append(offsets, -d)
+		}
+		if d <= future {
+			offsets = append(offsets, d)
+		}
+	}
+	return offsets
+}
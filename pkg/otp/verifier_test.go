@@ -0,0 +1,99 @@
+package otp
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func rfcVerifier() Verifier {
+	return Verifier{Period: 30, Digits: 8, Algorithm: SHA1}
+}
+
+func TestVerifier_Offset(t *testing.T) {
+	secret := []byte("12345678901234567890")
+
+	// 94287082 is the RFC 6238 code for T = 1 (Unix time 59).
+	tests := []struct {
+		name   string
+		now    int64
+		past   int
+		future int
+		offset int
+		err    error
+	}{
+		{"current step", 59, 0, 0, 0, nil},
+		{"two steps behind", 119, 2, 0, -2, nil},
+		{"outside past window", 119, 1, 5, 0, ErrInvalidCode},
+		{"one step ahead", 10, 0, 1, 1, nil},
+		{"outside future window", 10, 5, 0, 0, ErrInvalidCode},
+	}
+
+	for _, tt := range tests {
+		v := rfcVerifier()
+		v.Past, v.Future = tt.past, tt.future
+		m, err := v.Verify("alice", secret, "94287082", time.Unix(tt.now, 0))
+		if err != tt.err {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if err == nil && (m.Offset != tt.offset || m.Step != 1) {
+			t.Errorf("%s: got %+v, want offset %d at step 1", tt.name, m, tt.offset)
+		}
+	}
+}
+
+func TestVerifier_Replay(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	store := NewMemoryStore()
+	v := rfcVerifier()
+	v.Past, v.Future = 1, 1
+	v.Store = store
+
+	if _, err := v.Verify("alice", secret, "94287082", time.Unix(59, 0)); err != nil {
+		t.Fatalf("First verification failed: %v", err)
+	}
+	if _, err := v.Verify("alice", secret, "94287082", time.Unix(70, 0)); err != ErrReplayedCode {
+		t.Errorf("Reused code: err = %v, want ErrReplayedCode", err)
+	}
+	if _, err := v.Verify("bob", secret, "94287082", time.Unix(59, 0)); err != nil {
+		t.Errorf("Another credential should not share the counter: %v", err)
+	}
+
+	// A code for a later step is accepted, after which earlier steps are rejected.
+	later, _ := GenerateTOTP(TOTPParams{Secret: secret, Timestamp: time.Unix(89, 0), Digits: 8})
+	if m, err := v.Verify("alice", secret, later, time.Unix(89, 0)); err != nil || m.Step != 2 {
+		t.Fatalf("Later step: %+v, %v", m, err)
+	}
+	if last, ok, _ := store.LastUsed("alice"); !ok || last != 2 {
+		t.Errorf("LastUsed = %d (ok=%v), want 2", last, ok)
+	}
+	if _, err := v.Verify("alice", secret, "94287082", time.Unix(89, 0)); err != ErrReplayedCode {
+		t.Errorf("Earlier step after later one: err = %v, want ErrReplayedCode", err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore()
+	if _, ok, _ := s.LastUsed("x"); ok {
+		t.Error("Expected no counter for a new id")
+	}
+	if ok, _ := s.Consume("x", 0); !ok {
+		t.Error("Expected first counter to be consumed")
+	}
+	if ok, _ := s.Consume("x", 0); ok {
+		t.Error("Expected repeated counter to be rejected")
+	}
+	if ok, _ := s.Consume("x", 5); !ok {
+		t.Error("Expected greater counter to be consumed")
+	}
+}
+
+func TestSearchOrder(t *testing.T) {
+	if got := searchOrder(2, 1); !reflect.DeepEqual(got, []int{0, -1, 1, -2}) {
+		t.Errorf("searchOrder(2, 1) = %v", got)
+	}
+	if got := searchOrder(0, 0); !reflect.DeepEqual(got, []int{0}) {
+		t.Errorf("searchOrder(0, 0) = %v", got)
+	}
+}